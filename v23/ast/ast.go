@@ -2,11 +2,14 @@
 // maintaining the exact relationship between the text stored in the file and
 // the application-visible value.
 //
-// It is work in progress.
+// The nodes of the tree cover every single byte of the file, including
+// whitespace, comments and line continuations. Therefore the original text
+// can be reconstructed exactly from the tree, which allows to modify the
+// tree and write it back to the file without disturbing unrelated parts.
 package ast
 
 import (
-	"github.com/rillig/pkglint/v23/textproc"
+	"sort"
 	"strings"
 )
 
@@ -19,21 +22,124 @@ const NoPos Pos = 0
 func (p Pos) Plus(offset int) Pos  { return Pos(int(p) + offset) }
 func (p Pos) PlusLen(s string) Pos { return p.Plus(len(s)) }
 
+// offset returns the 0-based index into the text of the file.
+func (p Pos) offset() int { return int(p) - 1 }
+
 // File stores the original text from the file, allowing the nodes to only
 // store the offset of their start and end, instead of referring to the string
 // directly.
 type File struct {
 	text string
+
+	// The lines of a makefile, as parsed by ParseMkFile.
+	// Together, they cover the whole text of the file.
+	Lines []MkLine
 }
 
 func NewFile(text string) *File {
-	return &File{text}
+	return &File{text, nil}
+}
+
+// ParseMkFile parses the text as a makefile, splitting it into its logical
+// lines.
+func ParseMkFile(text string) *File {
+	f := NewFile(text)
+	p := NewMkParser(f)
+	for !p.EOF() {
+		f.Lines = append(f.Lines, p.ParseLine())
+	}
+	return f
 }
 
+// Text returns the text of the node, exactly as it appears in the file.
+//
+// For nodes that have been created in-memory, it returns their text instead.
 func (f *File) Text(n Node) string {
-	return f.text[n.Start()-1 : n.End()-1]
+	if n.Start() == NoPos {
+		return n.(*Literal).Text
+	}
+	return f.text[n.Start().offset():n.End().offset()]
+}
+
+// LogicalText returns the text of the node as make sees it, as computed
+// by LogicalLine. The trailing newline of a line is not part of its
+// logical text.
+func (f *File) LogicalText(n Node) string {
+	text := strings.TrimSuffix(f.Text(n), "\n")
+	return LogicalLine(strings.Split(text, "\n"))
 }
 
+// Span returns a node for the given part of the text,
+// to be modified using an Editor.
+// The offset is 0-based.
+func (f *File) Span(offset, length int) Node {
+	return &Literal{Pos(offset + 1), f.text[offset : offset+length]}
+}
+
+// LogicalLine joins the physical lines of a single logical line, without
+// their trailing newlines. Each backslash-newline and its surrounding
+// whitespace is replaced with a single space.
+//
+// In a commented continuation line, the '#' at the beginning of the next
+// line is discarded, to allow commented multi-line variable assignments.
+func LogicalLine(lines []string) string {
+	var sb strings.Builder
+	trim := ""
+
+	for i, line := range lines {
+		indent, text, outdent, cont := SplitContinuation(line)
+
+		if i == 0 {
+			sb.WriteString(indent)
+		}
+		sb.WriteString(strings.TrimPrefix(text, trim))
+
+		if cont == "" || i == len(lines)-1 {
+			sb.WriteString(outdent)
+			sb.WriteString(cont)
+			break
+		}
+
+		sb.WriteString(" ")
+		trim = ""
+		if strings.HasPrefix(text, "#") {
+			trim = "#"
+		}
+	}
+	return sb.String()
+}
+
+// SplitContinuation splits a physical line into its leading whitespace,
+// the text, the trailing whitespace and the backslash that continues the
+// line, if any.
+func SplitContinuation(line string) (indent, text, outdent, cont string) {
+	end := len(line)
+
+	j := end
+	for j > 0 && line[j-1] == '\\' {
+		j--
+	}
+	j = end - (end-j)%2
+	cont = line[j:end]
+
+	outdentEnd := j
+	for j > 0 && isHspace(line[j-1]) {
+		j--
+	}
+	outdent = line[j:outdentEnd]
+
+	i := 0
+	for i < j && isHspace(line[i]) {
+		i++
+	}
+	indent = line[:i]
+
+	text = line[i:j]
+	return
+}
+
+func isHspace(ch byte) bool { return ch == ' ' || ch == '\t' }
+
 // A Node in an abstract syntax tree represents a structural element of the
 // file. Every single byte from the file must be represented in some node,
 // even whitespace, linebreaks and comments.
@@ -48,6 +154,10 @@ type Literal struct {
 	Text  string
 }
 
+// NewLiteral creates a literal that is not backed by the text of a file,
+// to be inserted into the tree using an Editor.
+func NewLiteral(text string) *Literal { return &Literal{NoPos, text} }
+
 func (l *Literal) Start() Pos { return l.start }
 func (l *Literal) End() Pos   { return l.start.PlusLen(l.Text) }
 
@@ -68,7 +178,7 @@ type EscapableText struct {
 }
 
 func (t *EscapableText) Start() Pos { return t.start }
-func (t *EscapableText) End() Pos   { return t.start.PlusLen(t.LogicalText) }
+func (t *EscapableText) End() Pos   { return t.end }
 
 // Space represents whitespace. In case of backslash-newline sequences, the
 // represented text does not equal the text that is stored in the file.
@@ -83,69 +193,6 @@ type Space struct {
 func (s *Space) Start() Pos { return s.start }
 func (s *Space) End() Pos   { return s.end }
 
-type MkCond interface {
-	Node
-}
-
-type MkCondBinary struct {
-	Left   MkCond
-	OpText *Literal
-	Op     MkCondBoolOp
-	Right  MkCond
-}
-
-func (b *MkCondBinary) Start() Pos { return b.Left.Start() }
-func (b *MkCondBinary) End() Pos   { return b.Right.End() }
-
-type MkCondParen struct {
-	Open   *Literal
-	Space1 Space
-	X      MkCond
-	Space2 Space
-	Close  *Literal
-}
-
-func (p *MkCondParen) Start() Pos { return p.Open.Start() }
-func (p *MkCondParen) End() Pos   { return p.Close.End() }
-
-type MkCondNot struct {
-	Exclam *Literal
-	Space  Space
-	X      MkCond
-}
-
-func (n *MkCondNot) Start() Pos { return n.Exclam.Start() }
-func (n *MkCondNot) End() Pos   { return n.X.End() }
-
-type MkCondComparison struct {
-	// TODO: Actually model a comparison in detail.
-	Text *EscapableText
-}
-
-func (c *MkCondComparison) Start() Pos { return c.Text.Start() }
-func (c *MkCondComparison) End() Pos   { return c.Text.End() }
-
-// MkExpr represents an expression such as '$V', '${VAR:Mpattern}' or
-// '$(PARENTHESIZED)'.
-type MkExpr struct {
-	Open      *Literal
-	Varname   *MkVarname
-	Modifiers []MkExprModifier
-	Close     *Literal
-}
-
-func (e *MkExpr) Start() Pos { return e.Open.Start() }
-func (e *MkExpr) End() Pos   { return e.Close.End() }
-
-// MkExprModifier represents a single modifier in an expression, such as the
-// ':Mpattern' in the expression '${VAR:Ufallback:Mpattern:S,from,to,}'.
-type MkExprModifier interface {
-	Node
-	ModifierText()
-}
-
-type MkVarname EscapableText // TODO
-
 // Editor allows manipulating the AST in-memory.
 type Editor interface {
 	Remove(Node)
@@ -154,187 +201,74 @@ type Editor interface {
 	InsertAfter(Node, Node)
 }
 
-type MkCondCompareOp uint8
-
-const (
-	LT MkCondCompareOp = iota + 1
-	LE
-	EQ
-	NE
-	GE
-	GT
-)
-
-func (op MkCondCompareOp) String() string { return [...]string{"<", "<=", "==", "!=", ">=", ">"}[op] }
-
-type MkCondBoolOp uint8
-
-const (
-	NOT MkCondBoolOp = iota + 1
-	AND
-	OR
-)
-
-func (op MkCondBoolOp) String() string { return [...]string{"&&", "||", "!"}[op] }
-
-type MkParser struct {
-	lex     *textproc.Lexer
-	textLen int
-}
-
-func NewMkParser(f *File) *MkParser {
-	lex := textproc.NewLexer(f.text)
-	return &MkParser{lex, len(f.text)}
+// FileEditor is an Editor that records the changes to the nodes of a file
+// and renders them back to text, leaving all other parts of the file as
+// they are.
+//
+// The changes must not overlap.
+// Nodes can be moved around by inserting them at another place
+// and removing them from the original place.
+type FileEditor struct {
+	file  *File
+	edits []fileEdit
 }
 
-func (p *MkParser) ParseLine() MkLine {
-	dot := p.ParseLiteral(".")
-	s1 := p.ParseSpace()
-	directive := p.ParseDirective()
-	s2 := p.ParseSpace()
-	cond := p.ParseMkCond()
-	s3 := p.ParseSpace()
-	comment := p.ParseComment()
-	endOfLine := p.ParseEndOfLine()
-
-	return &MkCondLine{
-		dot,
-		s1,
-		directive,
-		s2,
-		cond,
-		s3,
-		comment,
-		endOfLine,
-	}
+type fileEdit struct {
+	start Pos
+	end   Pos
+	text  string
 }
 
-var directiveBytes = textproc.NewByteSet("a-z-")
+var _ Editor = (*FileEditor)(nil)
 
-func (p *MkParser) ParseDirective() *Literal {
-	pos := p.Pos()
-	dir := p.lex.NextBytesSet(directiveBytes)
-	if dir == "" {
-		return nil
-	}
-	return &Literal{pos, dir}
+func NewFileEditor(f *File) *FileEditor {
+	return &FileEditor{f, nil}
 }
 
-func (p *MkParser) ParseMkCond() MkCond {
-	pos := p.Pos()
-	text := p.lex.NextBytesSet(textproc.Space.Inverse())
-	// TODO: Properly parse conditions.
-	return &MkCondComparison{
-		Text: &EscapableText{
-			start:       pos,
-			end:         p.Pos(),
-			LogicalText: text,
-		},
-	}
+func (e *FileEditor) Remove(n Node) {
+	e.add(n.Start(), n.End(), "")
 }
 
-func (p *MkParser) ParseComment() *EscapableText {
-	return nil
+func (e *FileEditor) Replace(old Node, repl Node) {
+	e.add(old.Start(), old.End(), e.file.Text(repl))
 }
 
-func (p *MkParser) ParseSpace() Space {
-	lex := p.lex
-	start := p.Pos()
-	var sb strings.Builder
-again:
-	hspace := lex.NextHspace()
-	if hspace != "" {
-		sb.WriteString(hspace)
-		goto again
-	}
-	if lex.SkipString("\\\n") {
-		sb.WriteString(" ")
-		goto again
-	}
-	return Space{start, p.Pos(), sb.String()}
+func (e *FileEditor) InsertBefore(ref Node, n Node) {
+	e.add(ref.Start(), ref.Start(), e.file.Text(n))
 }
 
-func (p *MkParser) ParseEndOfLine() Space {
-	lex := p.lex
-	start := p.Pos()
-	text := lex.NextString("\n")
-	return Space{start, p.Pos(), text}
+func (e *FileEditor) InsertAfter(ref Node, n Node) {
+	e.add(ref.End(), ref.End(), e.file.Text(n))
 }
 
-func (p *MkParser) ParseLiteral(s string) *Literal {
-	lex := p.lex
-	start := p.Pos()
-	if !lex.SkipString(s) {
-		return nil
+func (e *FileEditor) add(start, end Pos, text string) {
+	if start == NoPos {
+		panic("ast: cannot edit a node that is not part of the file")
 	}
-	return &Literal{start, s}
-}
-
-func (p *MkParser) Pos() Pos {
-	return Pos(1) + Pos(p.textLen) - Pos(len(p.lex.Rest()))
-}
-
-type MkLine interface {
-	Node
-}
-
-type MkCondLine struct {
-	Dot       *Literal
-	S0        Space
-	Directive *Literal
-	S1        Space
-	Cond      MkCond
-	S2        Space
-	Comment   *EscapableText
-	EndOfLine Space
-}
-
-func (l *MkCondLine) Start() Pos { return l.Dot.Start() }
-func (l *MkCondLine) End() Pos   { return l.EndOfLine.End() }
-
-type MkAssignLine struct {
-	S0        Space
-	Name      *MkVarname
-	S1        Space
-	Op        *Literal
-	S2        Space
-	Value     *MkString
-	S3        Space
-	Comment   *EscapableText
-	EndOfLine Space
-}
-
-func (l *MkAssignLine) Start() Pos { return l.S0.Start() }
-func (l *MkAssignLine) End() Pos   { return l.Comment.Start() }
-
-type MkMessageLine struct {
-	Dot     *Literal
-	S0      Space
-	Message *EscapableText
-	S1      Space
-	Comment *EscapableText
+	e.edits = append(e.edits, fileEdit{start, end, text})
 }
 
-func (l *MkMessageLine) Start() Pos { return l.S0.Start() }
-func (l *MkMessageLine) End() Pos   { return l.Comment.Start() }
-
-type MkDependencyLine struct {
-	S0      Space
-	Targets []*MkWord
-	S1      Space
-	Op      *Literal
-	S2      Space
-	Sources []*MkWord
-	S3      Space
-	Comment *EscapableText
-}
+// Text renders the file with all changes applied.
+func (e *FileEditor) Text() string {
+	edits := append([]fileEdit(nil), e.edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		// Insertions go before the replacement at the same position.
+		return edits[i].end == edits[i].start && edits[j].end != edits[j].start
+	})
 
-type MkString struct {
-	Parts []MkStringPart
-}
-
-type MkStringPart interface {
-}
-
-type MkWord struct {
+	var sb strings.Builder
+	pos := Pos(1)
+	for _, edit := range edits {
+		if edit.start < pos {
+			panic("ast: overlapping edits")
+		}
+		sb.WriteString(e.file.text[pos.offset():edit.start.offset()])
+		sb.WriteString(edit.text)
+		pos = edit.end
+	}
+	sb.WriteString(e.file.text[pos.offset():])
+	return sb.String()
 }
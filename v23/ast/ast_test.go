@@ -31,3 +31,122 @@ func Test(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 }
+
+func Test_File_LogicalText(t *testing.T) {
+	f := ParseMkFile("VAR=\ta  \\\n\t\tb\\\\\n\tc\\\n")
+
+	if got, want := f.LogicalText(f.Lines[0]), "VAR=\ta b\\\\"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := f.LogicalText(f.Lines[1]), "\tc\\"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func Test_File_LogicalText__continuation(t *testing.T) {
+	test := func(text string, want ...string) {
+		f := ParseMkFile(text)
+		var got []string
+		for _, line := range f.Lines {
+			got = append(got, f.LogicalText(line))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %q, want %q", text, got, want)
+		}
+	}
+
+	// In a commented continuation line, the '#' from the next line
+	// is discarded, as in pkglint.nextLogicalLine.
+	test("# comment \\\n# continued\n",
+		"# comment  continued")
+	test("#VAR=\tvalue \\\n#\tcontinued\n",
+		"#VAR=\tvalue \tcontinued")
+
+	// Each empty continuation line adds a space.
+	test("VAR=\ta \\\n\\\n\tb\n",
+		"VAR=\ta  b")
+	test("VAR=\ta \\\n\n",
+		"VAR=\ta ")
+}
+
+func Test_File_Span(t *testing.T) {
+	f := NewFile("VAR=\tvalue\n")
+
+	span := f.Span(5, 5)
+
+	if got, want := f.Text(span), "value"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func Test_LogicalLine(t *testing.T) {
+	test := func(lines []string, want string) {
+		if got := LogicalLine(lines); got != want {
+			t.Errorf("%q: got %q, want %q", lines, got, want)
+		}
+	}
+
+	test([]string{""}, "")
+	test([]string{"\tword  "}, "\tword  ")
+	test([]string{"\tword \\", "\tword"}, "\tword word")
+	test([]string{"word\\\\"}, "word\\\\")
+	test([]string{"# a \\", "# b \\", "c"}, "# a  b c")
+	test([]string{"a \\", "\\", "b"}, "a  b")
+
+	// The last line keeps its backslash, since there is no next line.
+	test([]string{"a \\", "b \\"}, "a b \\")
+}
+
+func Test_SplitContinuation(t *testing.T) {
+	test := func(line, indent, text, outdent, cont string) {
+		i, te, o, c := SplitContinuation(line)
+		if i != indent || te != text || o != outdent || c != cont {
+			t.Errorf("%q: got %q %q %q %q, want %q %q %q %q",
+				line, i, te, o, c, indent, text, outdent, cont)
+		}
+	}
+
+	test("", "", "", "", "")
+	test("\tword   \\", "\t", "word", "   ", "\\")
+	test("word\\\\", "", "word\\\\", "", "")
+	test("word\\\\\\", "", "word\\\\", "", "\\")
+	test("  \\", "", "", "  ", "\\")
+}
+
+func Test_FileEditor_Text(t *testing.T) {
+	f := ParseMkFile("VAR=\t${A:M*} b # comment\n.if 1\n.endif\n")
+	assign := f.Lines[0].(*MkAssignLine)
+	expr := assign.Value.Parts[0].(*MkExpr)
+
+	e := NewFileEditor(f)
+	e.Replace(expr.Modifiers[0].Text, NewLiteral("N*"))
+	e.InsertAfter(expr.Modifiers[0], NewLiteral(":Q"))
+	e.InsertBefore(expr, NewLiteral("prefix-"))
+	e.Remove(assign.Comment)
+	e.Replace(&assign.S3, NewLiteral(""))
+	e.InsertBefore(f.Lines[2], f.Lines[1])
+
+	want := "VAR=\tprefix-${A:N*:Q} b\n.if 1\n.if 1\n.endif\n"
+	if got := e.Text(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := f.Text(f.Lines[0]); got != "VAR=\t${A:M*} b # comment\n" {
+		t.Errorf("the original text must not change, got %q", got)
+	}
+}
+
+func Test_FileEditor_Text__overlapping(t *testing.T) {
+	f := ParseMkFile("VAR=\tvalue\n")
+	assign := f.Lines[0].(*MkAssignLine)
+
+	e := NewFileEditor(f)
+	e.Remove(assign)
+	e.InsertAfter(assign.Op, NewLiteral("value"))
+
+	defer func() {
+		if r := recover(); r != "ast: overlapping edits" {
+			t.Errorf("got %v", r)
+		}
+	}()
+	_ = e.Text()
+}
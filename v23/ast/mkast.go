@@ -0,0 +1,306 @@
+package ast
+
+// MkLine is a single logical line of a makefile, including its comment,
+// the backslash-newline sequences of continuation lines and the final
+// newline, if any.
+type MkLine interface {
+	Node
+}
+
+// MkCommentLine is a line that consists only of whitespace, optionally
+// followed by a comment.
+type MkCommentLine struct {
+	S0        Space
+	Comment   *EscapableText // Including the '#'; nil for empty lines.
+	EndOfLine Space
+}
+
+func (l *MkCommentLine) Start() Pos { return l.S0.Start() }
+func (l *MkCommentLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkAssignLine is a variable assignment, such as 'VAR+=\tvalue # comment'.
+type MkAssignLine struct {
+	S0        Space
+	Name      *MkVarname
+	S1        Space
+	Op        *Literal // One of '=', ':=', '!=', '+=', '?='.
+	S2        Space
+	Value     *MkString
+	S3        Space
+	Comment   *EscapableText
+	EndOfLine Space
+}
+
+func (l *MkAssignLine) Start() Pos { return l.S0.Start() }
+func (l *MkAssignLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkCondLine is a directive that has a condition,
+// such as '.if', '.elif', '.ifdef' or '.elifndef'.
+type MkCondLine struct {
+	Dot       *Literal
+	S0        Space
+	Directive *Literal
+	S1        Space
+	Cond      MkCond
+	S2        Space
+	Comment   *EscapableText
+	EndOfLine Space
+}
+
+func (l *MkCondLine) Start() Pos { return l.Dot.Start() }
+func (l *MkCondLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkIncludeLine is an '.include' directive or one of its variants,
+// such as '.include "../../mk/bsd.prefs.mk"' or '.sinclude <file.mk>'.
+type MkIncludeLine struct {
+	Dot       *Literal
+	S0        Space
+	Directive *Literal // 'include', 'sinclude', '-include' or 'dinclude'.
+	S1        Space
+	Open      *Literal // Either '"' or '<'.
+	Path      *MkString
+	Close     *Literal // Either '"' or '>'.
+	S2        Space
+	Comment   *EscapableText
+	EndOfLine Space
+}
+
+func (l *MkIncludeLine) Start() Pos { return l.Dot.Start() }
+func (l *MkIncludeLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkDirectiveLine is any other directive, such as '.else', '.endif',
+// '.for i in ${LIST}', '.undef VAR' or '.error message'.
+type MkDirectiveLine struct {
+	Dot       *Literal
+	S0        Space
+	Directive *Literal
+	S1        Space
+	Args      *MkString
+	S2        Space
+	Comment   *EscapableText
+	EndOfLine Space
+}
+
+func (l *MkDirectiveLine) Start() Pos { return l.Dot.Start() }
+func (l *MkDirectiveLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkShellLine is a shell command that belongs to a target.
+// It starts with a tab, and a '#' does not start a comment.
+type MkShellLine struct {
+	Tab       *Literal
+	Command   *MkString
+	EndOfLine Space
+}
+
+func (l *MkShellLine) Start() Pos { return l.Tab.Start() }
+func (l *MkShellLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkDependencyLine declares targets and their sources,
+// such as 'pre-configure: ${WRKDIR}/file'.
+type MkDependencyLine struct {
+	S0        Space
+	Targets   *MkString
+	S1        Space
+	Op        *Literal // One of ':', '::' or '!'.
+	S2        Space
+	Sources   *MkString
+	S3        Space
+	Comment   *EscapableText
+	EndOfLine Space
+}
+
+func (l *MkDependencyLine) Start() Pos { return l.S0.Start() }
+func (l *MkDependencyLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkOtherLine is a line that cannot be parsed as any of the other line
+// types. Its text is kept so that the file can be reconstructed.
+type MkOtherLine struct {
+	S0        Space
+	Text      *MkString
+	S1        Space
+	Comment   *EscapableText
+	EndOfLine Space
+}
+
+func (l *MkOtherLine) Start() Pos { return l.S0.Start() }
+func (l *MkOtherLine) End() Pos   { return l.EndOfLine.End() }
+
+// MkString is text that may contain expressions, such as the value of a
+// variable assignment or the arguments of a directive.
+type MkString struct {
+	start Pos
+	end   Pos
+	Parts []MkStringPart
+}
+
+func (s *MkString) Start() Pos { return s.start }
+func (s *MkString) End() Pos   { return s.end }
+
+// MkStringPart is either an *EscapableText, a *Space for whitespace that
+// contains a backslash-newline, or an *MkExpr.
+type MkStringPart interface {
+	Node
+}
+
+// MkVarname is the name of a variable, as in an assignment or an expression.
+// It may itself contain expressions, as in '${PKGBASE}_VERSION'.
+type MkVarname struct {
+	MkString
+}
+
+// MkExpr represents an expression such as '$V', '${VAR:Mpattern}' or
+// '$(PARENTHESIZED)'.
+type MkExpr struct {
+	Open      *Literal // One of '$', '${' or '$('.
+	Varname   *MkVarname
+	Modifiers []*MkExprModifier
+	Close     *Literal // Nil for '$V' and for unclosed expressions.
+}
+
+func (e *MkExpr) Start() Pos { return e.Open.Start() }
+
+func (e *MkExpr) End() Pos {
+	switch {
+	case e.Close != nil:
+		return e.Close.End()
+	case len(e.Modifiers) > 0:
+		return e.Modifiers[len(e.Modifiers)-1].End()
+	}
+	return e.Varname.End()
+}
+
+// MkExprModifier represents a single modifier in an expression, such as the
+// ':Mpattern' in the expression '${VAR:Ufallback:Mpattern:S,from,to,}'.
+type MkExprModifier struct {
+	Colon *Literal
+	// The text of the modifier, without the leading colon.
+	// It may contain nested expressions.
+	Text *MkString
+}
+
+func (m *MkExprModifier) Start() Pos { return m.Colon.Start() }
+func (m *MkExprModifier) End() Pos   { return m.Text.End() }
+
+// MkCond is a condition in an '.if' or '.elif' directive.
+//
+// It is one of *MkCondBinary, *MkCondParen, *MkCondNot, *MkCondCall,
+// *MkCondComparison or *MkCondUnparsed.
+type MkCond interface {
+	Node
+}
+
+type MkCondBinary struct {
+	Left   MkCond
+	S1     Space
+	OpText *Literal
+	Op     MkCondBoolOp
+	S2     Space
+	Right  MkCond
+}
+
+func (b *MkCondBinary) Start() Pos { return b.Left.Start() }
+func (b *MkCondBinary) End() Pos   { return b.Right.End() }
+
+type MkCondParen struct {
+	Open   *Literal
+	Space1 Space
+	X      MkCond
+	Space2 Space
+	Close  *Literal
+}
+
+func (p *MkCondParen) Start() Pos { return p.Open.Start() }
+func (p *MkCondParen) End() Pos   { return p.Close.End() }
+
+type MkCondNot struct {
+	Exclam *Literal
+	Space  Space
+	X      MkCond
+}
+
+func (n *MkCondNot) Start() Pos { return n.Exclam.Start() }
+func (n *MkCondNot) End() Pos   { return n.X.End() }
+
+// MkCondCall is a function call such as 'defined(VAR)' or
+// 'empty(VAR:Mpattern)'.
+type MkCondCall struct {
+	Name  *Literal
+	S0    Space
+	Open  *Literal
+	Arg   *MkString
+	Close *Literal
+}
+
+func (c *MkCondCall) Start() Pos { return c.Name.Start() }
+func (c *MkCondCall) End() Pos   { return c.Close.End() }
+
+// MkCondComparison compares two operands, such as in '${VAR} == value'.
+// In a condition like '.if ${VAR}', the operator and the right operand
+// are nil.
+type MkCondComparison struct {
+	Left   MkCondOperand
+	S1     Space
+	OpText *Literal
+	Op     MkCondCompareOp
+	S2     Space
+	Right  MkCondOperand
+}
+
+func (c *MkCondComparison) Start() Pos { return c.Left.Start() }
+
+func (c *MkCondComparison) End() Pos {
+	if c.Right != nil {
+		return c.Right.End()
+	}
+	return c.Left.End()
+}
+
+// MkCondOperand is either an *MkString for a bare word, which may also be
+// a single expression, or an *MkCondQuoted.
+type MkCondOperand interface {
+	Node
+}
+
+// MkCondQuoted is a string literal in double quotes, such as "${VAR}".
+type MkCondQuoted struct {
+	Open  *Literal
+	Text  *MkString
+	Close *Literal
+}
+
+func (q *MkCondQuoted) Start() Pos { return q.Open.Start() }
+func (q *MkCondQuoted) End() Pos   { return q.Close.End() }
+
+// MkCondUnparsed is a condition that is malformed.
+// Its text is kept so that the file can be reconstructed.
+type MkCondUnparsed struct {
+	Text *MkString
+}
+
+func (u *MkCondUnparsed) Start() Pos { return u.Text.Start() }
+func (u *MkCondUnparsed) End() Pos   { return u.Text.End() }
+
+type MkCondCompareOp uint8
+
+const (
+	LT MkCondCompareOp = iota + 1
+	LE
+	EQ
+	NE
+	GE
+	GT
+)
+
+func (op MkCondCompareOp) String() string {
+	return [...]string{"", "<", "<=", "==", "!=", ">=", ">"}[op]
+}
+
+type MkCondBoolOp uint8
+
+const (
+	NOT MkCondBoolOp = iota + 1
+	AND
+	OR
+)
+
+func (op MkCondBoolOp) String() string { return [...]string{"", "!", "&&", "||"}[op] }
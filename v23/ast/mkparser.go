@@ -0,0 +1,715 @@
+package ast
+
+import "strings"
+
+// MkParser parses the text of a makefile into a concrete syntax tree.
+//
+// Each logical line is parsed on its own. A logical line consists of one or
+// more physical lines, joined by a backslash at the end of the line. The
+// node for a line includes all backslash-newline sequences, the comment and
+// the final newline.
+type MkParser struct {
+	text string
+	pos  int // The 0-based offset of the next byte to be parsed.
+	end  int // The parser does not look beyond this offset.
+}
+
+func NewMkParser(f *File) *MkParser {
+	return &MkParser{f.text, 0, len(f.text)}
+}
+
+// EOF returns whether the whole text has been parsed.
+func (p *MkParser) EOF() bool { return p.pos >= len(p.text) }
+
+func (p *MkParser) Pos() Pos { return Pos(p.pos + 1) }
+
+func (p *MkParser) rest() string { return p.text[p.pos:p.end] }
+
+// ParseLine parses a single logical line, including its final newline.
+func (p *MkParser) ParseLine() MkLine {
+	p.end = len(p.text)
+	rest := p.rest()
+
+	// As in pkglint, shell commands cannot have comments at the end of
+	// the line, except for lines that consist only of a comment.
+	shell := strings.HasPrefix(rest, "\t") &&
+		!strings.HasPrefix(strings.TrimLeft(rest, " \t"), "#")
+
+	contentEnd, lineEnd := p.scanLine(!shell)
+	p.end = contentEnd
+
+	if shell {
+		return p.parseShellLine(lineEnd)
+	}
+	if strings.HasPrefix(rest, ".") {
+		if line := p.parseDirectiveLine(contentEnd, lineEnd); line != nil {
+			return line
+		}
+	}
+	if p.trimSpaceEnd(p.pos, contentEnd) == p.pos {
+		s0 := p.ParseSpace()
+		comment, endOfLine := p.parseLineEnd(lineEnd)
+		return &MkCommentLine{s0, comment, endOfLine}
+	}
+	if line := p.parseAssignLine(contentEnd, lineEnd); line != nil {
+		return line
+	}
+	if line := p.parseDependencyLine(contentEnd, lineEnd); line != nil {
+		return line
+	}
+	return p.parseOtherLine(contentEnd, lineEnd)
+}
+
+// scanLine finds the end of the current logical line, as well as the start
+// of the comment, if any. Without a comment, contentEnd equals lineEnd.
+func (p *MkParser) scanLine(comments bool) (contentEnd, lineEnd int) {
+	s := p.text
+	contentEnd = -1
+	i := p.pos
+	for i < len(s) && s[i] != '\n' {
+		if s[i] == '\\' && i+1 < len(s) {
+			i += 2
+			continue
+		}
+		if s[i] == '#' && comments && contentEnd < 0 {
+			contentEnd = i
+		}
+		i++
+	}
+	if contentEnd < 0 {
+		contentEnd = i
+	}
+	return contentEnd, i
+}
+
+// trimSpaceEnd returns the end of the text between start and end,
+// after removing trailing whitespace and backslash-newline sequences.
+func (p *MkParser) trimSpaceEnd(start, end int) int {
+	s := p.text
+	i := end
+	for i > start {
+		if s[i-1] == ' ' || s[i-1] == '\t' {
+			i--
+			continue
+		}
+		if i-2 >= start && s[i-2] == '\\' && s[i-1] == '\n' {
+			j := i - 2
+			for j > start && s[j-1] == '\\' {
+				j--
+			}
+			if (i-1-j)%2 == 1 {
+				i -= 2
+				continue
+			}
+		}
+		break
+	}
+	return i
+}
+
+// parseLineEnd parses the comment and the newline of the current line.
+func (p *MkParser) parseLineEnd(lineEnd int) (*EscapableText, Space) {
+	p.end = lineEnd
+	comment := p.ParseComment()
+	p.end = len(p.text)
+	return comment, p.ParseEndOfLine()
+}
+
+func (p *MkParser) parseShellLine(lineEnd int) MkLine {
+	p.end = lineEnd
+	tab := p.ParseLiteral("\t")
+	command := p.parseMkString(nil)
+	p.end = len(p.text)
+	return &MkShellLine{tab, command, p.ParseEndOfLine()}
+}
+
+func (p *MkParser) parseDirectiveLine(contentEnd, lineEnd int) MkLine {
+	start := p.pos
+	dot := p.ParseLiteral(".")
+	s0 := p.ParseSpace()
+	directive := p.ParseDirective()
+	if directive == nil {
+		p.pos = start
+		return nil
+	}
+	s1 := p.ParseSpace()
+	p.end = p.trimSpaceEnd(p.pos, contentEnd)
+
+	var line MkLine
+	switch directive.Text {
+	case "include", "sinclude", "-include", "dinclude":
+		line = p.parseIncludeArgs(dot, s0, directive, s1)
+	case "if", "ifdef", "ifndef", "ifmake", "ifnmake",
+		"elif", "elifdef", "elifndef", "elifmake", "elifnmake":
+		line = &MkCondLine{Dot: dot, S0: s0, Directive: directive, S1: s1,
+			Cond: p.ParseMkCond()}
+	}
+	if line == nil {
+		line = &MkDirectiveLine{Dot: dot, S0: s0, Directive: directive, S1: s1,
+			Args: p.parseMkString(nil)}
+	}
+
+	p.end = contentEnd
+	s2 := p.ParseSpace()
+	comment, endOfLine := p.parseLineEnd(lineEnd)
+
+	switch line := line.(type) {
+	case *MkCondLine:
+		line.S2, line.Comment, line.EndOfLine = s2, comment, endOfLine
+	case *MkIncludeLine:
+		line.S2, line.Comment, line.EndOfLine = s2, comment, endOfLine
+	case *MkDirectiveLine:
+		line.S2, line.Comment, line.EndOfLine = s2, comment, endOfLine
+	}
+	return line
+}
+
+// parseIncludeArgs parses the '"path"' or '<path>' of an include directive.
+// If the arguments are malformed, it returns nil.
+func (p *MkParser) parseIncludeArgs(dot *Literal, s0 Space, directive *Literal, s1 Space) MkLine {
+	start := p.pos
+	open := p.ParseLiteral("\"")
+	if open == nil {
+		open = p.ParseLiteral("<")
+	}
+	if open == nil {
+		return nil
+	}
+
+	closing := map[string]string{"\"": "\"", "<": ">"}[open.Text]
+	path := p.parseMkString(func(rest string) bool { return rest[0] == closing[0] })
+	closeLit := p.ParseLiteral(closing)
+	if closeLit == nil || p.pos != p.end {
+		p.pos = start
+		return nil
+	}
+
+	return &MkIncludeLine{Dot: dot, S0: s0, Directive: directive, S1: s1,
+		Open: open, Path: path, Close: closeLit}
+}
+
+func (p *MkParser) parseAssignLine(contentEnd, lineEnd int) MkLine {
+	start := p.pos
+	s0 := p.ParseSpace()
+	name := p.parseMkString(func(rest string) bool {
+		switch rest[0] {
+		case ' ', '\t', '=':
+			return true
+		case ':', '!', '+', '?':
+			return len(rest) > 1 && rest[1] == '='
+		}
+		return rest[0] == '\\' && len(rest) > 1 && rest[1] == '\n'
+	})
+	s1 := p.ParseSpace()
+	op := p.parseAssignOp()
+	if len(name.Parts) == 0 || op == nil {
+		p.pos = start
+		return nil
+	}
+
+	s2 := p.ParseSpace()
+	p.end = p.trimSpaceEnd(p.pos, contentEnd)
+	value := p.parseMkString(nil)
+	p.end = contentEnd
+	s3 := p.ParseSpace()
+	comment, endOfLine := p.parseLineEnd(lineEnd)
+
+	return &MkAssignLine{s0, &MkVarname{*name}, s1, op, s2, value, s3, comment, endOfLine}
+}
+
+func (p *MkParser) parseAssignOp() *Literal {
+	for _, op := range [...]string{"!=", "+=", ":=", "?=", "="} {
+		if lit := p.ParseLiteral(op); lit != nil {
+			return lit
+		}
+	}
+	return nil
+}
+
+func (p *MkParser) parseDependencyLine(contentEnd, lineEnd int) MkLine {
+	opIndex := p.pos
+	for opIndex < contentEnd && p.text[opIndex] != ':' && p.text[opIndex] != '!' {
+		opIndex = p.scanUnit(opIndex)
+	}
+	if opIndex >= contentEnd {
+		return nil
+	}
+
+	s0 := p.ParseSpace()
+	p.end = p.trimSpaceEnd(p.pos, opIndex)
+	targets := p.parseMkString(nil)
+	p.end = contentEnd
+	s1 := p.ParseSpace()
+	op := p.ParseLiteral("::")
+	if op == nil {
+		op = p.ParseLiteral(p.text[opIndex : opIndex+1])
+	}
+	s2 := p.ParseSpace()
+	p.end = p.trimSpaceEnd(p.pos, contentEnd)
+	sources := p.parseMkString(nil)
+	p.end = contentEnd
+	s3 := p.ParseSpace()
+	comment, endOfLine := p.parseLineEnd(lineEnd)
+
+	return &MkDependencyLine{s0, targets, s1, op, s2, sources, s3, comment, endOfLine}
+}
+
+func (p *MkParser) parseOtherLine(contentEnd, lineEnd int) MkLine {
+	s0 := p.ParseSpace()
+	p.end = p.trimSpaceEnd(p.pos, contentEnd)
+	text := p.parseMkString(nil)
+	p.end = contentEnd
+	s1 := p.ParseSpace()
+	comment, endOfLine := p.parseLineEnd(lineEnd)
+	return &MkOtherLine{s0, text, s1, comment, endOfLine}
+}
+
+func (p *MkParser) ParseDirective() *Literal {
+	start := p.pos
+	for p.pos < p.end && (p.text[p.pos] >= 'a' && p.text[p.pos] <= 'z' || p.text[p.pos] == '-') {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil
+	}
+	return &Literal{Pos(start + 1), p.text[start:p.pos]}
+}
+
+// ParseMkCond parses the condition of an '.if' or '.elif' directive.
+// If the condition is malformed, it is returned as an *MkCondUnparsed.
+func (p *MkParser) ParseMkCond() MkCond {
+	start := p.pos
+	cond := p.parseCondBinary(OR)
+	if cond == nil || p.pos != p.end {
+		p.pos = start
+		return &MkCondUnparsed{p.parseMkString(nil)}
+	}
+	return cond
+}
+
+func (p *MkParser) parseCondBinary(op MkCondBoolOp) MkCond {
+	next := p.parseCondNot
+	if op == OR {
+		next = func() MkCond { return p.parseCondBinary(AND) }
+	}
+
+	left := next()
+	if left == nil {
+		return nil
+	}
+	for {
+		mark := p.pos
+		s1 := p.ParseSpace()
+		opText := p.ParseLiteral(op.String())
+		if opText == nil {
+			p.pos = mark
+			return left
+		}
+		s2 := p.ParseSpace()
+		right := next()
+		if right == nil {
+			p.pos = mark
+			return left
+		}
+		left = &MkCondBinary{left, s1, opText, op, s2, right}
+	}
+}
+
+func (p *MkParser) parseCondNot() MkCond {
+	start := p.pos
+	exclam := p.ParseLiteral("!")
+	if exclam == nil {
+		return p.parseCondPrimary()
+	}
+
+	space := p.ParseSpace()
+	x := p.parseCondNot()
+	if x == nil {
+		p.pos = start
+		return nil
+	}
+	return &MkCondNot{exclam, space, x}
+}
+
+func (p *MkParser) parseCondPrimary() MkCond {
+	start := p.pos
+	if open := p.ParseLiteral("("); open != nil {
+		space1 := p.ParseSpace()
+		x := p.parseCondBinary(OR)
+		space2 := p.ParseSpace()
+		closeLit := p.ParseLiteral(")")
+		if x == nil || closeLit == nil {
+			p.pos = start
+			return nil
+		}
+		return &MkCondParen{open, space1, x, space2, closeLit}
+	}
+
+	if call := p.parseCondCall(); call != nil {
+		return call
+	}
+	return p.parseCondComparison()
+}
+
+func (p *MkParser) parseCondCall() MkCond {
+	start := p.pos
+	for p.pos < p.end && p.text[p.pos] >= 'a' && p.text[p.pos] <= 'z' {
+		p.pos++
+	}
+	switch p.text[start:p.pos] {
+	case "defined", "empty", "make", "exists", "target", "commands":
+	default:
+		p.pos = start
+		return nil
+	}
+	name := &Literal{Pos(start + 1), p.text[start:p.pos]}
+
+	s0 := p.ParseSpace()
+	open := p.ParseLiteral("(")
+	if open == nil {
+		p.pos = start
+		return nil
+	}
+
+	argEnd := p.pos
+	depth := 0
+	for argEnd < p.end && (depth > 0 || p.text[argEnd] != ')') {
+		switch p.text[argEnd] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		argEnd = p.scanUnit(argEnd)
+	}
+	if argEnd >= p.end {
+		p.pos = start
+		return nil
+	}
+
+	arg := p.parseMkStringTo(argEnd)
+	return &MkCondCall{name, s0, open, arg, p.ParseLiteral(")")}
+}
+
+func (p *MkParser) parseCondComparison() MkCond {
+	left := p.parseCondOperand()
+	if left == nil {
+		return nil
+	}
+
+	mark := p.pos
+	noSpace := Space{p.Pos(), p.Pos(), ""}
+	s1 := p.ParseSpace()
+	var opText *Literal
+	var op MkCondCompareOp
+	for _, candidate := range [...]MkCondCompareOp{LE, GE, EQ, NE, LT, GT} {
+		if opText = p.ParseLiteral(candidate.String()); opText != nil {
+			op = candidate
+			break
+		}
+	}
+	if opText != nil {
+		s2 := p.ParseSpace()
+		if right := p.parseCondOperand(); right != nil {
+			return &MkCondComparison{left, s1, opText, op, s2, right}
+		}
+	}
+
+	p.pos = mark
+	return &MkCondComparison{Left: left, S1: noSpace, S2: noSpace}
+}
+
+func (p *MkParser) parseCondOperand() MkCondOperand {
+	start := p.pos
+	if open := p.ParseLiteral("\""); open != nil {
+		text := p.parseMkString(func(rest string) bool { return rest[0] == '"' })
+		closeLit := p.ParseLiteral("\"")
+		if closeLit == nil {
+			p.pos = start
+			return nil
+		}
+		return &MkCondQuoted{open, text, closeLit}
+	}
+
+	word := p.parseMkString(func(rest string) bool {
+		if strings.IndexByte(" \t=!<>()&|\"", rest[0]) >= 0 {
+			return true
+		}
+		return rest[0] == '\\' && len(rest) > 1 && rest[1] == '\n'
+	})
+	if len(word.Parts) == 0 {
+		return nil
+	}
+	return word
+}
+
+// ParseExpr parses an expression such as '$V', '${VAR}' or
+// '$(VAR:Mpattern:S,from,to,)'.
+func (p *MkParser) ParseExpr() *MkExpr {
+	rest := p.rest()
+	if len(rest) < 2 || rest[0] != '$' {
+		return nil
+	}
+
+	if rest[1] != '{' && rest[1] != '(' {
+		open := p.literal(1)
+		name := p.parseMkStringTo(p.pos + 1)
+		return &MkExpr{open, &MkVarname{*name}, nil, nil}
+	}
+
+	closing := byte('}')
+	if rest[1] == '(' {
+		closing = ')'
+	}
+	open := p.literal(2)
+	name := p.parseMkStringTo(p.scanVarname(p.pos, closing))
+
+	var mods []*MkExprModifier
+	for p.pos < p.end && p.text[p.pos] == ':' {
+		colon := p.literal(1)
+		text := p.parseMkStringTo(p.scanModifier(p.pos, closing))
+		mods = append(mods, &MkExprModifier{colon, text})
+	}
+
+	var closeLit *Literal
+	if p.pos < p.end && p.text[p.pos] == closing {
+		closeLit = p.literal(1)
+	}
+	return &MkExpr{open, &MkVarname{*name}, mods, closeLit}
+}
+
+// scanUnit returns the end of the expression, escape sequence or single
+// character that starts at index i.
+func (p *MkParser) scanUnit(i int) int {
+	switch {
+	case p.text[i] == '$':
+		return p.scanExpr(i)
+	case p.text[i] == '\\' && i+1 < p.end:
+		return i + 2
+	}
+	return i + 1
+}
+
+func (p *MkParser) scanExpr(i int) int {
+	s, end := p.text, p.end
+	if i+1 >= end {
+		return end
+	}
+
+	closing := byte('}')
+	switch s[i+1] {
+	case '{':
+	case '(':
+		closing = ')'
+	default:
+		return i + 2
+	}
+
+	i = p.scanVarname(i+2, closing)
+	for i < end && s[i] == ':' {
+		i = p.scanModifier(i+1, closing)
+	}
+	if i < end && s[i] == closing {
+		i++
+	}
+	return i
+}
+
+func (p *MkParser) scanVarname(i int, closing byte) int {
+	for i < p.end && p.text[i] != ':' && p.text[i] != closing {
+		if p.text[i] == '$' {
+			i = p.scanExpr(i)
+		} else {
+			i++
+		}
+	}
+	return i
+}
+
+// scanModifier returns the end of the modifier that starts at index i,
+// just after the colon.
+func (p *MkParser) scanModifier(i int, closing byte) int {
+	s, end := p.text, p.end
+
+	// skipSeparated skips the parts of a modifier like ':S,from,to,'
+	// or ':@var@body@'.
+	skipSeparated := func(i int, sep byte, n int) int {
+		for i < end && n > 0 {
+			if s[i] == sep {
+				n--
+				i++
+			} else {
+				i = p.scanUnit(i)
+			}
+		}
+		return i
+	}
+
+	// skipPlain skips a modifier like ':Mpattern' or ':from=to',
+	// which ends at the next colon or at the closing brace,
+	// except when these are nested in braces or parentheses.
+	skipPlain := func(i int) int {
+		depth := 0
+		for i < end {
+			c := s[i]
+			if depth == 0 && (c == ':' || c == closing) {
+				break
+			}
+			if c == '{' || c == '(' {
+				depth++
+			} else if (c == '}' || c == ')') && depth > 0 {
+				depth--
+			}
+			i = p.scanUnit(i)
+		}
+		return i
+	}
+
+	switch {
+	case i+1 < end && (s[i] == 'S' || s[i] == 'C'):
+		i = skipSeparated(i+2, s[i+1], 2)
+	case i < end && s[i] == '@':
+		i = skipSeparated(i+1, '@', 2)
+	case i+2 < end && s[i] == 't' && s[i+1] == 's':
+		i += 3
+	case i < end && s[i] == ':':
+		// The assignment modifiers '::=', '::+=' and so on.
+		i++
+	case i < end && s[i] == '?':
+		i = skipPlain(i + 1)
+		if i < end && s[i] == ':' {
+			i++
+		}
+	}
+	return skipPlain(i)
+}
+
+// parseMkString parses text and expressions until either the end of the
+// parsed region or until stop returns true.
+func (p *MkParser) parseMkString(stop func(rest string) bool) *MkString {
+	str := &MkString{start: p.Pos()}
+
+	textStart := p.pos
+	var logical strings.Builder
+	flush := func() {
+		if p.pos > textStart {
+			text := &EscapableText{Pos(textStart + 1), p.Pos(), logical.String()}
+			str.Parts = append(str.Parts, text)
+		}
+		logical.Reset()
+	}
+
+	for p.pos < p.end {
+		rest := p.rest()
+		if stop != nil && stop(rest) {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(rest, "$$"):
+			logical.WriteString("$$")
+			p.pos += 2
+		case rest[0] == '$' && len(rest) > 1:
+			flush()
+			str.Parts = append(str.Parts, p.ParseExpr())
+			textStart = p.pos
+		case p.hasContinuation():
+			flush()
+			space := p.ParseSpace()
+			str.Parts = append(str.Parts, &space)
+			textStart = p.pos
+		case rest[0] == '\\' && len(rest) > 1:
+			if rest[1] == '#' {
+				logical.WriteByte('#')
+			} else {
+				logical.WriteString(rest[:2])
+			}
+			p.pos += 2
+		default:
+			logical.WriteByte(rest[0])
+			p.pos++
+		}
+	}
+	flush()
+
+	str.end = p.Pos()
+	return str
+}
+
+// parseMkStringTo parses text and expressions up to the given index.
+func (p *MkParser) parseMkStringTo(end int) *MkString {
+	prevEnd := p.end
+	p.end = end
+	str := p.parseMkString(nil)
+	p.end = prevEnd
+	return str
+}
+
+// hasContinuation returns whether the whitespace at the current position
+// contains a backslash-newline.
+func (p *MkParser) hasContinuation() bool {
+	s := p.text
+	for i := p.pos; i < p.end; i++ {
+		switch {
+		case s[i] == ' ' || s[i] == '\t':
+			continue
+		case s[i] == '\\' && i+1 < p.end && s[i+1] == '\n':
+			return true
+		}
+		break
+	}
+	return false
+}
+
+// ParseComment parses the comment at the end of the line, including the
+// '#'. In its logical text, the '#' is removed, and each backslash-newline
+// is replaced with a space.
+func (p *MkParser) ParseComment() *EscapableText {
+	if !strings.HasPrefix(p.rest(), "#") {
+		return nil
+	}
+	start := p.pos
+	p.pos = p.end
+	text := p.text[start+1 : p.end]
+	return &EscapableText{Pos(start + 1), p.Pos(), strings.ReplaceAll(text, "\\\n", " ")}
+}
+
+func (p *MkParser) ParseSpace() Space {
+	start := p.Pos()
+	var sb strings.Builder
+	for p.pos < p.end {
+		rest := p.rest()
+		if rest[0] == ' ' || rest[0] == '\t' {
+			sb.WriteByte(rest[0])
+			p.pos++
+		} else if strings.HasPrefix(rest, "\\\n") {
+			sb.WriteString(" ")
+			p.pos += 2
+		} else {
+			break
+		}
+	}
+	return Space{start, p.Pos(), sb.String()}
+}
+
+func (p *MkParser) ParseEndOfLine() Space {
+	start := p.Pos()
+	if strings.HasPrefix(p.rest(), "\n") {
+		p.pos++
+		return Space{start, p.Pos(), "\n"}
+	}
+	return Space{start, start, ""}
+}
+
+func (p *MkParser) ParseLiteral(s string) *Literal {
+	if !strings.HasPrefix(p.rest(), s) {
+		return nil
+	}
+	return p.literal(len(s))
+}
+
+func (p *MkParser) literal(n int) *Literal {
+	start := p.pos
+	p.pos += n
+	return &Literal{Pos(start + 1), p.text[start:p.pos]}
+}
@@ -0,0 +1,308 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkTree ensures that the children of each node are contiguous and
+// cover their parent node completely.
+func checkTree(t *testing.T, f *File, n Node) {
+	t.Helper()
+
+	var children []Node
+	var collect func(v reflect.Value)
+	collect = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if !v.IsNil() {
+				children = append(children, v.Interface().(Node))
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				collect(v.Index(i))
+			}
+		case reflect.Struct:
+			children = append(children, v.Addr().Interface().(Node))
+		}
+	}
+
+	v := reflect.ValueOf(n).Elem()
+	if varname, ok := n.(*MkVarname); ok {
+		v = reflect.ValueOf(&varname.MkString).Elem()
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).IsExported() {
+			collect(v.Field(i))
+		}
+	}
+
+	pos := n.Start()
+	for _, child := range children {
+		if child.Start() != pos {
+			t.Errorf("%T %q: child %T %q starts at %d, want %d",
+				n, f.Text(n), child, f.Text(child), child.Start(), pos)
+		}
+		checkTree(t, f, child)
+		pos = child.End()
+	}
+	if len(children) > 0 && pos != n.End() {
+		t.Errorf("%T %q: children end at %d, want %d", n, f.Text(n), pos, n.End())
+	}
+}
+
+func parseMk(t *testing.T, text string) *File {
+	t.Helper()
+
+	f := ParseMkFile(text)
+
+	var sb strings.Builder
+	for _, line := range f.Lines {
+		checkTree(t, f, line)
+		sb.WriteString(f.Text(line))
+	}
+	if sb.String() != text {
+		t.Errorf("round trip: got %q, want %q", sb.String(), text)
+	}
+	return f
+}
+
+func Test_ParseMkFile__round_trip(t *testing.T) {
+	texts := []string{
+		"",
+		"\n",
+		"# comment\n",
+		"VAR=\tvalue # comment\n",
+		"VAR+=\t${OTHER:Mpattern:S,from,to,g} \\\n\tsecond \\\n\tthird\n",
+		"VAR!=\techo \\# not a comment\n",
+		"${PKGBASE}_VERSION?=\t1.0\n",
+		"VAR:=\t${:U$$}${V:@v@${v:Q}@}${V:ts:}${V:?yes:no}\n",
+		"VAR=\t${V::=value}${V:M{a,b}}$(PAREN:M*)$V $@\n",
+		".if ${OPSYS} == NetBSD && !defined(VAR) || (empty(X:M*) && ${Y})\n",
+		".elif \"${V}\" != \"\" # comment\n",
+		".if ${A} &&\\\n    ${B}\n",
+		".if garbage ==\n",
+		".  include \"../../mk/bsd.prefs.mk\"\n",
+		".sinclude <file.mk>   # comment\n",
+		".include \"unclosed\n",
+		".for i in ${LIST}\n",
+		".endfor\n",
+		".else\n",
+		".endif # comment\n",
+		"pre-configure: ${WRKSRC}/file\n",
+		"\tcd ${WRKSRC} && ${ECHO} '#' # not a comment\n",
+		"\t# comment\n",
+		"no newline at end",
+		"VAR=\tunclosed ${EXPR\n",
+		"VAR=\ttrailing backslash\\",
+		"VAR=\ttwo backslashes\\\\\n",
+		"   \n",
+		"#\\\n# continued comment\n",
+	}
+
+	for _, text := range texts {
+		parseMk(t, text)
+	}
+
+	// All texts together, as a single file.
+	parseMk(t, strings.Join(texts[:len(texts)-1], ""))
+}
+
+func Test_ParseMkFile__line_types(t *testing.T) {
+	tests := []struct {
+		text string
+		want interface{}
+	}{
+		{"\n", (*MkCommentLine)(nil)},
+		{"# comment\n", (*MkCommentLine)(nil)},
+		{"\t# comment\n", (*MkCommentLine)(nil)},
+		{"VAR=value\n", (*MkAssignLine)(nil)},
+		{"VAR :=value\n", (*MkAssignLine)(nil)},
+		{".if 1\n", (*MkCondLine)(nil)},
+		{".ifdef VAR\n", (*MkCondLine)(nil)},
+		{".include \"file.mk\"\n", (*MkIncludeLine)(nil)},
+		{".include file.mk\n", (*MkDirectiveLine)(nil)},
+		{".endif\n", (*MkDirectiveLine)(nil)},
+		{"\techo\n", (*MkShellLine)(nil)},
+		{"target: source\n", (*MkDependencyLine)(nil)},
+		{"target! source\n", (*MkDependencyLine)(nil)},
+		{"target:: source\n", (*MkDependencyLine)(nil)},
+		{"just words\n", (*MkOtherLine)(nil)},
+	}
+
+	for _, test := range tests {
+		f := parseMk(t, test.text)
+		if got, want := reflect.TypeOf(f.Lines[0]), reflect.TypeOf(test.want); got != want {
+			t.Errorf("%q: got %v, want %v", test.text, got, want)
+		}
+	}
+}
+
+func Test_MkParser_ParseLine__assign(t *testing.T) {
+	f := parseMk(t, "VAR+= \\\n\t${A:M*} b # comment\n")
+	line := f.Lines[0].(*MkAssignLine)
+
+	test := func(n Node, want string) {
+		t.Helper()
+		if got := f.Text(n); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	test(line.Name, "VAR")
+	test(line.Op, "+=")
+	test(&line.S2, " \\\n\t")
+	test(line.Value, "${A:M*} b")
+	test(&line.S3, " ")
+	test(line.Comment, "# comment")
+	test(&line.EndOfLine, "\n")
+
+	expr := line.Value.Parts[0].(*MkExpr)
+	test(expr.Varname, "A")
+	test(expr.Modifiers[0], ":M*")
+	test(expr.Modifiers[0].Text, "M*")
+
+	if got := line.Comment.LogicalText; got != " comment" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func Test_MkParser_ParseLine__escaped_comment(t *testing.T) {
+	f := parseMk(t, "VAR=\tvalue\\#1 # comment\n")
+	line := f.Lines[0].(*MkAssignLine)
+
+	text := line.Value.Parts[0].(*EscapableText)
+	if got, want := text.LogicalText, "value#1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := f.Text(line.Comment), "# comment"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func Test_MkParser_ParseLine__continuation(t *testing.T) {
+	f := parseMk(t, "VAR=\ta \\\n\tb\n")
+	line := f.Lines[0].(*MkAssignLine)
+
+	parts := line.Value.Parts
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if got := parts[1].(*Space).LogicalText; got != "  \t" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func Test_MkParser_ParseExpr(t *testing.T) {
+	tests := []struct {
+		text      string
+		varname   string
+		modifiers []string
+	}{
+		{"$V", "V", nil},
+		{"${VAR}", "VAR", nil},
+		{"$(VAR)", "VAR", nil},
+		{"${VAR:Mpattern:Nother}", "VAR", []string{"Mpattern", "Nother"}},
+		{"${VAR:S,a,b,g:C/x/y/1W}", "VAR", []string{"S,a,b,g", "C/x/y/1W"}},
+		{"${VAR:S}:}:}:Q}", "VAR", []string{"S}:}:}", "Q"}},
+		{"${VAR:@v@${v}:@:S,a,b,}", "VAR", []string{"@v@${v}:@", "S,a,b,"}},
+		{"${VAR:ts::Q}", "VAR", []string{"ts:", "Q"}},
+		{"${VAR:?yes:no}", "VAR", []string{"?yes:no"}},
+		{"${VAR::=value}", "VAR", []string{":=value"}},
+		{"${VAR:M{a,b}}", "VAR", []string{"M{a,b}"}},
+		{"${VAR:M\\:}", "VAR", []string{"M\\:"}},
+		{"${${NAME}:U${DEFAULT:Q}}", "${NAME}", []string{"U${DEFAULT:Q}"}},
+		{"${VAR:}", "VAR", []string{""}},
+	}
+
+	for _, test := range tests {
+		f := NewFile(test.text)
+		expr := NewMkParser(f).ParseExpr()
+		checkTree(t, f, expr)
+
+		if got := f.Text(expr); got != test.text {
+			t.Errorf("%q: got %q", test.text, got)
+		}
+		if got := f.Text(expr.Varname); got != test.varname {
+			t.Errorf("%q: varname %q, want %q", test.text, got, test.varname)
+		}
+		var mods []string
+		for _, mod := range expr.Modifiers {
+			mods = append(mods, f.Text(mod.Text))
+		}
+		if !reflect.DeepEqual(mods, test.modifiers) {
+			t.Errorf("%q: modifiers %q, want %q", test.text, mods, test.modifiers)
+		}
+	}
+}
+
+func Test_MkParser_ParseMkCond(t *testing.T) {
+	cond := func(text string) (*File, MkCond) {
+		t.Helper()
+		f := parseMk(t, ".if "+text+"\n")
+		return f, f.Lines[0].(*MkCondLine).Cond
+	}
+
+	f, c := cond("${A} == 1 && !defined(B) || (\"${C}\" != c)")
+	or := c.(*MkCondBinary)
+	if or.Op != OR {
+		t.Errorf("got %v", or.Op)
+	}
+	and := or.Left.(*MkCondBinary)
+	if and.Op != AND {
+		t.Errorf("got %v", and.Op)
+	}
+	cmp := and.Left.(*MkCondComparison)
+	if cmp.Op != EQ || f.Text(cmp.Left) != "${A}" || f.Text(cmp.Right) != "1" {
+		t.Errorf("got %v %q %q", cmp.Op, f.Text(cmp.Left), f.Text(cmp.Right))
+	}
+	not := and.Right.(*MkCondNot)
+	call := not.X.(*MkCondCall)
+	if f.Text(call.Name) != "defined" || f.Text(call.Arg) != "B" {
+		t.Errorf("got %q", f.Text(call))
+	}
+	paren := or.Right.(*MkCondParen)
+	quoted := paren.X.(*MkCondComparison).Left.(*MkCondQuoted)
+	if f.Text(quoted.Text) != "${C}" {
+		t.Errorf("got %q", f.Text(quoted))
+	}
+
+	f, c = cond("${A}")
+	cmp = c.(*MkCondComparison)
+	if cmp.OpText != nil || cmp.Right != nil || f.Text(cmp) != "${A}" {
+		t.Errorf("got %q", f.Text(cmp))
+	}
+
+	f, c = cond("empty(VAR:M(*))")
+	if f.Text(c.(*MkCondCall).Arg) != "VAR:M(*)" {
+		t.Errorf("got %q", f.Text(c))
+	}
+
+	f, c = cond("${A} == 1 &&")
+	if f.Text(c.(*MkCondUnparsed)) != "${A} == 1 &&" {
+		t.Errorf("got %q", f.Text(c))
+	}
+}
+
+func Test_MkCondCompareOp_String(t *testing.T) {
+	if got := EQ.String() + NE.String() + LT.String() + GT.String(); got != "==!=<>" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func Test_MkCondBoolOp_String(t *testing.T) {
+	if got := NOT.String() + AND.String() + OR.String(); got != "!&&||" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func FuzzParseMkFile(f *testing.F) {
+	f.Add("VAR=\t${A:S,a,b,} # comment\n")
+	f.Add(".if ${A} && !defined(B)\n.endif\n")
+	f.Add("\techo \\\n\t'#'\n")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		parseMk(t, text)
+	})
+}
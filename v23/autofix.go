@@ -1,6 +1,7 @@
 package pkglint
 
 import (
+	"github.com/rillig/pkglint/v23/ast"
 	"os"
 	"strconv"
 	"strings"
@@ -131,22 +132,13 @@ func (fix *Autofix) ReplaceAfter(prefix, from string, to string) {
 	}
 
 	for rawIndex, text := range fix.texts {
-		ok, replaced := replaceOnce(text, prefixFrom, prefixTo)
-		if !ok {
+		textIndex := strings.Index(text, prefixFrom)
+		if textIndex == -1 || textIndex != strings.LastIndex(text, prefixFrom) {
 			continue
 		}
 
 		if G.Logger.IsAutofix() {
-			fix.texts[rawIndex] = replaced
-
-			// Fix the parsed text as well.
-			// This is only approximate and won't work in some edge cases
-			// that involve escaped comments or replacements across line breaks.
-			//
-			// TODO: Do this properly by parsing the whole line again,
-			//  and ideally everything that depends on the parsed line.
-			//  This probably requires a generic notification mechanism.
-			_, fix.line.Text = replaceOnce(fix.line.Text, prefixFrom, prefixTo)
+			fix.replaceText(rawIndex, textIndex, prefixFrom, prefixTo)
 		}
 		fix.Describef(rawIndex, "Replacing %q with %q.", from, to)
 		return
@@ -167,20 +159,51 @@ func (fix *Autofix) ReplaceAt(rawIndex int, textIndex int, from string, to strin
 	assert(textIndex < len(text))
 	assert(hasPrefix(text[textIndex:], from))
 
-	replaced := text[:textIndex] + to + text[textIndex+len(from):]
+	fix.replaceText(rawIndex, textIndex, from, to)
 
-	fix.texts[rawIndex] = replaced
+	fix.Describef(rawIndex, "Replacing %q with %q.", from, to)
+}
 
-	// Fix the parsed text as well.
-	// This is only approximate and won't work in some edge cases
-	// that involve escaped comments or replacements across line breaks.
-	//
-	// TODO: Do this properly by parsing the whole line again,
-	//  and ideally everything that depends on the parsed line.
-	//  This probably requires a generic notification mechanism.
-	_, fix.line.Text = replaceOnce(fix.line.Text, from, to)
+// replaceText replaces the text at the given position of a physical line
+// by editing the syntax tree of the whole logical line,
+// and then updates the logical text of the line.
+func (fix *Autofix) replaceText(rawIndex, textIndex int, from, to string) {
+	before := 0
+	for _, text := range fix.texts[:rawIndex] {
+		before += len(text)
+	}
+	after := 0
+	for _, text := range fix.texts[rawIndex+1:] {
+		after += len(text)
+	}
 
-	fix.Describef(rawIndex, "Replacing %q with %q.", from, to)
+	f := ast.ParseMkFile(strings.Join(fix.texts, ""))
+	e := ast.NewFileEditor(f)
+	e.Replace(f.Span(before+textIndex, len(from)), ast.NewLiteral(to))
+	edited := e.Text()
+
+	fix.texts[rawIndex] = edited[before : len(edited)-after]
+	fix.updateText()
+}
+
+// updateText parses the modified physical lines again, to keep the
+// logical text of the line in sync with them.
+//
+// Everything else that depends on the parsed line, such as the MkLine,
+// is not updated. This would require a generic notification mechanism.
+func (fix *Autofix) updateText() {
+	if len(fix.texts) == 1 {
+		fix.line.Text = strings.TrimSuffix(fix.texts[0], "\n")
+		return
+	}
+
+	// If the replacement has split the logical line, the line no longer
+	// corresponds to a single parsed line. In that case, the text of the
+	// line stays as it is.
+	f := ast.ParseMkFile(strings.Join(fix.texts, ""))
+	if len(f.Lines) == 1 {
+		fix.line.Text = f.LogicalText(f.Lines[0])
+	}
 }
 
 // InsertAbove prepends a line above the current line.
@@ -802,6 +802,106 @@ func (s *Suite) Test_Autofix_ReplaceAt__only(c *check.C) {
 		"# remark")
 }
 
+func (s *Suite) Test_Autofix_replaceText(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+	mklines := t.SetUpFileMkLines("filename.mk",
+		"VAR=\ta \\",
+		"\ta \\",
+		"\ta")
+	mkline := mklines.mklines[0]
+
+	fix := mkline.Autofix()
+	fix.Warnf("Warning.")
+	fix.ReplaceAt(1, 1, "a", "b")
+	fix.Apply()
+	mklines.SaveAutofixChanges()
+
+	t.CheckEquals(mkline.Text, "VAR=\ta b a")
+	t.CheckOutputLines(
+		"AUTOFIX: ~/filename.mk:2: Replacing \"a\" with \"b\".")
+	t.CheckFileLines("filename.mk",
+		"VAR=\ta \\",
+		"\tb \\",
+		"\ta")
+}
+
+func (s *Suite) Test_Autofix_updateText(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+	test := func(texts []string, rawIndex int, column int, from, to string, text string) {
+		mklines := t.NewMkLines("filename.mk", texts...)
+		mkline := mklines.mklines[0]
+
+		fix := mkline.Autofix()
+		fix.Warnf("Warning.")
+		fix.ReplaceAt(rawIndex, column, from, to)
+		fix.Apply()
+
+		t.CheckEquals(mkline.Text, text)
+	}
+
+	lines := func(lines ...string) []string { return lines }
+
+	// The second occurrence of "a" is replaced,
+	// in the physical line as well as in the logical line.
+	test(
+		lines("VAR=\ta a"),
+		0, 7, "a", "b",
+		"VAR=\ta b")
+
+	test(
+		lines(
+			"VAR=\tvalue \\",
+			"\tvalue"),
+		1, 1, "value", "other",
+		"VAR=\tvalue other")
+
+	// The replacement splits the logical line into two.
+	// Since a single Line cannot represent that,
+	// its text stays the same.
+	test(
+		lines(
+			"VAR=\tvalue \\",
+			"\tvalue"),
+		0, 11, "\\", "#",
+		"VAR=\tvalue value")
+
+	// The logical text after the autofix is the same as if the file
+	// were loaded again, even for commented continuation lines.
+	test(
+		lines(
+			"# comment \\",
+			"# continued"),
+		1, 2, "continued", "other",
+		"# comment  other")
+
+	// An empty continuation line adds a space to the logical text.
+	test(
+		lines(
+			"VAR=\tvalue \\",
+			"\\",
+			"\tvalue"),
+		2, 1, "value", "other",
+		"VAR=\tvalue  other")
+
+	t.CheckOutputLines(
+		"AUTOFIX: filename.mk:1: Replacing \"a\" with \"b\".",
+		"AUTOFIX: filename.mk:2: Replacing \"value\" with \"other\".",
+		"AUTOFIX: filename.mk:1: Replacing \"\\\\\" with \"#\".",
+		"AUTOFIX: filename.mk:2: Replacing \"continued\" with \"other\".",
+		"AUTOFIX: filename.mk:3: Replacing \"value\" with \"other\".")
+
+	t.CheckEquals(
+		t.NewMkLines("loaded.mk", "# comment \\", "# other").mklines[0].Text,
+		"# comment  other")
+	t.CheckEquals(
+		t.NewMkLines("loaded.mk", "VAR=\tvalue \\", "\\", "\tother").mklines[0].Text,
+		"VAR=\tvalue  other")
+}
+
 func (s *Suite) Test_Autofix_InsertAbove(c *check.C) {
 	t := s.Init(c)
 
@@ -598,21 +598,29 @@ func (t *Tester) CreateFileLines(filename RelPath, lines ...string) CurrPath {
 // CreateFileDummyPatch creates a patch file with the given name in the
 // temporary directory.
 func (t *Tester) CreateFileDummyPatch(filename RelPath) {
+	t.createFilePatch(filename, "Documentation")
+}
+
+// CreateFileDocumentedPatch creates a patch file whose documentation
+// says why the patch is needed and whether it has been sent upstream.
+func (t *Tester) CreateFileDocumentedPatch(filename RelPath) {
+	t.createFilePatch(filename, "Fix the build.", "Upstream-Status: not reported")
+}
+
+func (t *Tester) createFilePatch(filename RelPath, documentation ...string) {
 	// Patch files only make sense in category/package/patches directories.
 	assert(G.Pkgsrc.Rel(t.File(filename)).Count() == 4)
 
 	patchedFile := replaceAll(filename.String(), `.*?\bpatches/patch-`, "")
 
 	t.CreateFileLines(filename,
-		CvsID,
-		"",
-		"Documentation",
-		"",
-		"--- oldfile",
-		"+++ "+patchedFile,
-		"@@ -1 +1 @@",
-		"-old",
-		"+new")
+		append(append([]string{CvsID, ""}, documentation...),
+			"",
+			"--- oldfile",
+			"+++ "+patchedFile,
+			"@@ -1 +1 @@",
+			"-old",
+			"+new")...)
 }
 
 func (t *Tester) CreateFileBuildlink3(filename RelPath, customLines ...string) {
@@ -6,8 +6,8 @@ import (
 	"crypto/sha512"
 	"encoding/hex"
 	"golang.org/x/crypto/blake2s"
-	hashpkg "hash"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -45,6 +45,7 @@ func CheckLinesDistinfo(pkg *Package, lines *Lines) {
 	}
 
 	SaveAutofixChanges(lines)
+	ck.regenerate()
 }
 
 type distinfoLinesChecker struct {
@@ -150,6 +151,9 @@ func (ck *distinfoLinesChecker) checkAlgorithms(info distinfoFileInfo) {
 	case algorithms == "SHA1" && isPatch != no:
 		return
 	case algorithms == "BLAKE2s, SHA512, Size" && isPatch != yes:
+		if distfile := ck.distfile(filename); !distfile.IsEmpty() {
+			ck.checkDistfileHashes(info, distfile, ck.distfileHashes(distfile))
+		}
 		return
 	}
 
@@ -215,10 +219,8 @@ func (ck *distinfoLinesChecker) checkAlgorithmsDistfile(info distinfoFileInfo) {
 		return
 	}
 
-	distdir := G.Pkgsrc.File("distfiles")
-
-	distfile := distdir.JoinNoClean(info.filename()).CleanPath()
-	if !distfile.IsFile() {
+	distfile := ck.distfile(info.filename())
+	if distfile.IsEmpty() {
 
 		// It's a rare situation that the explanation is generated
 		// this far from the corresponding diagnostic.
@@ -246,52 +248,11 @@ func (ck *distinfoLinesChecker) checkAlgorithmsDistfile(info distinfoFileInfo) {
 		return
 	}
 
-	computeHash := func(hasher hashpkg.Hash) string {
-		f, err := distfile.Open()
-		assertNil(err, "Opening distfile")
-
-		// Don't load the distfile into memory since some of them
-		// are hundreds of MB in size.
-		_, err = io.Copy(hasher, f)
-		assertNil(err, "Computing hash of distfile")
-
-		hexHash := hex.EncodeToString(hasher.Sum(nil))
-
-		err = f.Close()
-		assertNil(err, "Closing distfile")
-
-		return hexHash
-	}
-
-	compute := func(alg string) string {
-		switch alg {
-		case "BLAKE2s":
-			blake, err := blake2s.New256(nil)
-			assertNil(err, "blake2s")
-			return computeHash(blake)
-		case "SHA512":
-			return computeHash(sha512.New())
-		default:
-			fileInfo, err := distfile.Lstat()
-			assertNil(err, "Inaccessible distfile info")
-			return sprintf("%d bytes", fileInfo.Size())
-		}
-	}
-
-	for _, hash := range info.hashes {
-		alg := hash.algorithm
-		if !seen[alg] {
-			continue
-		}
-		computed := compute(alg)
-
-		if computed != hash.hash {
-			// Do not try to autofix anything in this situation,
-			// as inconsistent hashes are a serious issue.
-			line.Errorf("The %s checksum for %q is %s in distinfo, %s in %s.",
-				alg, hash.filename, hash.hash, computed, line.Rel(distfile))
-			return
-		}
+	computed := ck.distfileHashes(distfile)
+	if !ck.checkDistfileHashes(info, distfile, computed) {
+		// Do not try to autofix anything in this situation,
+		// as inconsistent hashes are a serious issue.
+		return
 	}
 
 	// At this point, all the existing hash algorithms are correct,
@@ -303,17 +264,15 @@ func (ck *distinfoLinesChecker) checkAlgorithmsDistfile(info distinfoFileInfo) {
 	var remainingHashes = info.hashes
 	for _, alg := range algorithms {
 		if missing[alg] {
-			computed := compute(alg)
-
 			if insertion == nil {
 				fix := line.Autofix()
 				fix.Errorf("Missing %s hash for %s.", alg, info.filename())
-				fix.InsertAbove(sprintf("%s (%s) = %s", alg, info.filename(), computed))
+				fix.InsertAbove(sprintf("%s (%s) = %s", alg, info.filename(), computed[alg]))
 				fix.Apply()
 			} else {
 				fix := insertion.Autofix()
 				fix.Errorf("Missing %s hash for %s.", alg, info.filename())
-				fix.InsertBelow(sprintf("%s (%s) = %s", alg, info.filename(), computed))
+				fix.InsertBelow(sprintf("%s (%s) = %s", alg, info.filename(), computed[alg]))
 				fix.Apply()
 			}
 
@@ -324,6 +283,61 @@ func (ck *distinfoLinesChecker) checkAlgorithmsDistfile(info distinfoFileInfo) {
 	}
 }
 
+// distfile returns the path to the distfile in the distfiles directory,
+// or an empty path if the distfile has not been downloaded.
+func (ck *distinfoLinesChecker) distfile(filename RelPath) CurrPath {
+	distdir := G.Pkgsrc.File("distfiles")
+
+	distfile := distdir.JoinNoClean(filename).CleanPath()
+	if !distfile.IsFile() {
+		return ""
+	}
+	return distfile
+}
+
+// distfileHashes computes the hashes of the downloaded distfile,
+// in the same format as in the distinfo file.
+func (*distinfoLinesChecker) distfileHashes(distfile CurrPath) map[string]string {
+	blake, err := blake2s.New256(nil)
+	assertNil(err, "blake2s")
+	sha := sha512.New()
+
+	f, err := distfile.Open()
+	assertNil(err, "Opening distfile")
+
+	// Don't load the distfile into memory since some of them
+	// are hundreds of MB in size.
+	size, err := io.Copy(io.MultiWriter(blake, sha), f)
+	assertNil(err, "Computing hash of distfile")
+
+	err = f.Close()
+	assertNil(err, "Closing distfile")
+
+	return map[string]string{
+		"BLAKE2s": hex.EncodeToString(blake.Sum(nil)),
+		"SHA512":  hex.EncodeToString(sha.Sum(nil)),
+		"Size":    sprintf("%d bytes", size)}
+}
+
+// checkDistfileHashes compares the hashes from the distinfo file with
+// the hashes of the downloaded distfile. This detects distfiles that
+// have been replaced upstream without changing their name, before a
+// bulk build runs into them, and without needing network access.
+//
+// It returns whether all hashes match.
+func (ck *distinfoLinesChecker) checkDistfileHashes(info distinfoFileInfo, distfile CurrPath, computed map[string]string) bool {
+	ok := true
+	for _, hash := range info.hashes {
+		alg := hash.algorithm
+		if computed[alg] != "" && computed[alg] != hash.hash {
+			hash.line.Errorf("The %s checksum for %q is %s in distinfo, %s in %s.",
+				alg, hash.filename, hash.hash, computed[alg], hash.line.Rel(distfile))
+			ok = false
+		}
+	}
+	return ok
+}
+
 func (ck *distinfoLinesChecker) checkUnrecordedPatches() {
 	if ck.pkg == nil {
 		return
@@ -347,6 +361,215 @@ func (ck *distinfoLinesChecker) checkUnrecordedPatches() {
 	}
 }
 
+// regenerate rebuilds the whole distinfo file from the downloaded
+// distfiles and the patches of the package, in the same format as
+// "bmake makesum makepatchsum", but without downloading anything.
+//
+// Entries for distfiles that have not been downloaded are kept,
+// since they may be needed on other platforms. Entries for distfiles
+// that are not mentioned in DISTFILES or PATCHFILES anymore are only
+// removed if these variables are unconditional and fully known, and if
+// the current distfiles are available.
+func (ck *distinfoLinesChecker) regenerate() {
+	if ck.pkg == nil || !G.Logger.IsAutofix() {
+		return
+	}
+
+	// The texts of the lines, including the autofixes from the other checks.
+	texts := func(line *Line) []string {
+		fix := line.fix
+		if fix == nil {
+			fix = NewAutofix(line)
+		}
+		return append(append(append([]string(nil), fix.above...), fix.texts...), fix.below...)
+	}
+
+	hashLines := map[*Line]bool{}
+	for _, info := range ck.infos {
+		for _, hash := range info.hashes {
+			hashLines[hash.line] = true
+		}
+	}
+
+	var autofixed, header []string
+	inHeader := true
+	for _, line := range ck.lines.Lines {
+		autofixed = append(autofixed, texts(line)...)
+		switch {
+		case hashLines[line]:
+			inHeader = false
+		case inHeader:
+			header = append(header, texts(line)...)
+		case line.Text != "":
+			// An invalid line, which would get lost.
+			return
+		}
+	}
+	for len(header) > 0 && header[len(header)-1] == "\n" {
+		header = header[:len(header)-1]
+	}
+
+	// Entries for distfiles that are no longer mentioned in DISTFILES
+	// are only removed after all current distfiles are available,
+	// since until then, the old entries may still be needed.
+	declared := ck.declaredDistfiles()
+	complete := declared != nil
+	for filename := range declared {
+		if ck.infos[filename].hashes == nil && ck.distfile(filename).IsEmpty() {
+			complete = false
+		}
+	}
+
+	var distfiles, patches []RelPath
+	entries := map[RelPath][]string{}
+
+	for _, filename := range ck.filenames {
+		info := ck.infos[filename]
+		switch {
+		case entries[filename] != nil:
+			continue
+		case info.isPatch == yes:
+			// Existing patches are taken from the patches directory below.
+			continue
+		case filename.HasPrefixText("patch-") && info.algorithms() == "SHA1":
+			if !ck.pkg.IgnoreMissingPatches {
+				continue
+			}
+			patches = append(patches, filename)
+		case complete && !declared[filename]:
+			continue
+		default:
+			distfiles = append(distfiles, filename)
+		}
+
+		for _, hash := range info.hashes {
+			entries[filename] = append(entries[filename], texts(hash.line)...)
+		}
+	}
+
+	for filename := range declared {
+		distfile := ck.distfile(filename)
+		if entries[filename] != nil || distfile.IsEmpty() {
+			continue
+		}
+
+		computed := ck.distfileHashes(distfile)
+		for _, alg := range [...]string{"BLAKE2s", "SHA512", "Size"} {
+			entries[filename] = append(entries[filename],
+				sprintf("%s (%s) = %s\n", alg, filename, computed[alg]))
+		}
+		distfiles = append(distfiles, filename)
+	}
+
+	patchEntries, _ := ck.pkg.File(ck.patchdir).ReadDir()
+	for _, entry := range patchEntries {
+		patchName := NewRelPathString(entry.Name())
+		if !entry.Type().IsRegular() || !ck.isPatch(patchName) {
+			continue
+		}
+
+		patchLines := Load(ck.pkg.File(ck.patchdir.JoinNoClean(patchName)), 0)
+		if patchLines == nil {
+			return
+		}
+		patches = append(patches, patchName)
+		entries[patchName] = []string{
+			sprintf("SHA1 (%s) = %s\n", patchName, computePatchSha1Hex(patchLines))}
+	}
+
+	var text strings.Builder
+	for _, textnl := range header {
+		text.WriteString(textnl)
+	}
+	if len(header) > 0 && len(entries) > 0 {
+		text.WriteString("\n")
+	}
+	for _, filenames := range [][]RelPath{distfiles, patches} {
+		sort.Slice(filenames, func(i, j int) bool { return filenames[i] < filenames[j] })
+		for _, filename := range filenames {
+			for _, textnl := range entries[filename] {
+				text.WriteString(textnl)
+			}
+		}
+	}
+
+	if text.String() == strings.Join(autofixed, "") {
+		return
+	}
+
+	filename := ck.lines.Filename
+	line := NewLineWhole(filename)
+	fix := line.Autofix()
+	fix.Notef("The distinfo file is not up to date.")
+	fix.Explain(
+		"The distinfo file records the checksums of all distfiles",
+		"and all patches of the package, sorted by filename.",
+		"",
+		"With --autofix, pkglint regenerates the distinfo file",
+		"from the downloaded distfiles and the patches,",
+		sprintf("like %q, but without downloading anything.", bmake("makesum makepatchsum")),
+		"The entries for distfiles that have not been downloaded are kept.")
+	fix.Custom(func(showAutofix, autofix bool) {
+		fix.Describef(0, "Regenerating the distinfo file")
+		if !autofix {
+			return
+		}
+
+		G.fileCache.Evict(filename)
+		tmpName := filename + ".pkglint.tmp"
+		if err := tmpName.WriteString(text.String()); err != nil {
+			G.Logger.TechErrorf(tmpName, "Cannot write: %s", err)
+		} else if err := tmpName.Rename(filename); err != nil {
+			G.Logger.TechErrorf(tmpName, "Cannot overwrite with autofixed content: %s", err)
+		}
+	})
+	fix.Apply()
+}
+
+// declaredDistfiles returns the distfiles from DISTFILES and PATCHFILES,
+// including the DIST_SUBDIR, in the form in which they appear in the
+// distinfo file.
+//
+// If the distfiles cannot be determined reliably, it returns nil.
+func (ck *distinfoLinesChecker) declaredDistfiles() map[RelPath]bool {
+	pkg := ck.pkg
+	if pkg.conditionalDistfiles {
+		return nil
+	}
+
+	value := func(varname, defaultValue string) (string, bool) {
+		value, found, indeterminate := pkg.vars.LastValueFound(varname)
+		if !found {
+			value = defaultValue
+		}
+		// See DEFAULT_DISTFILES in mk/fetch/bsd.fetch-vars.mk.
+		value = strings.ReplaceAll(value, "${DEFAULT_DISTFILES}", "${DISTNAME}${EXTRACT_SUFX}")
+		value = resolveExprs(value, nil, pkg)
+		return value, !indeterminate && !containsExpr(value)
+	}
+
+	distfiles, ok1 := value("DISTFILES", "${DEFAULT_DISTFILES}")
+	patchfiles, ok2 := value("PATCHFILES", "")
+	distSubdir, ok3 := value("DIST_SUBDIR", "")
+	if !ok1 || !ok2 || !ok3 {
+		return nil
+	}
+
+	declared := map[RelPath]bool{}
+	for _, field := range strings.Fields(distfiles + " " + patchfiles) {
+		if contains(field, ":") {
+			// A distfile from a specific group of MASTER_SITES.
+			return nil
+		}
+		filename := NewRelPathString(field)
+		if distSubdir != "" {
+			filename = NewRelPathString(distSubdir).JoinNoClean(filename)
+		}
+		declared[filename.CleanPath()] = true
+	}
+	return declared
+}
+
 func (*distinfoLinesChecker) isPatch(filename RelPath) bool {
 	// See function is_patch in mk/checksum/distinfo.awk.
 	switch {
@@ -57,8 +57,12 @@ func (s *Suite) Test_CheckLinesDistinfo__DISTINFO_FILE(c *check.C) {
 	G.Check(".")
 
 	t.CheckOutputLines(
-		"WARN: distinfo:3: ../../category/package/patches/patch-dummy_txt " +
-			"is registered in distinfo but not added to CVS.")
+		"WARN: distinfo:3: ../../category/package/patches/patch-dummy_txt "+
+			"is registered in distinfo but not added to CVS.",
+		"WARN: ../../category/package/patches/patch-dummy_txt: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ../../category/package/patches/patch-dummy_txt: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_distinfoLinesChecker_parse__trailing_empty_line(c *check.C) {
@@ -137,6 +141,14 @@ func (s *Suite) Test_distinfoLinesChecker_check__distinfo_and_patches_in_separat
 	G.checkdirPackage(".")
 
 	t.CheckOutputLines(
+		"WARN: ../../other/common/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ../../other/common/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
+		"WARN: ../../other/common/patches/patch-only-in-patches: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ../../other/common/patches/patch-only-in-patches: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
 		"ERROR: ../../other/common/distinfo:3: SHA1 hash of patches/patch-aa differs "+
 			"(distinfo has ..., patch file has 9a93207561abfef7e7550598c5a08f2c3226995b).",
 		"WARN: ../../other/common/distinfo:4: Patch file \"patch-only-in-distinfo\" "+
@@ -216,7 +228,11 @@ func (s *Suite) Test_distinfoLinesChecker_check__missing_php_patches(c *check.C)
 
 	G.Check(t.File("archivers/php-bz2"))
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/lang/php72/patches/patch-php72: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/lang/php72/patches/patch-php72: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 
 	t.CreateFileLines("archivers/php-zlib/Makefile",
 		MkCvsID,
@@ -347,7 +363,11 @@ func (s *Suite) Test_distinfoLinesChecker_checkAlgorithms__wrong_patch_algorithm
 		"ERROR: distinfo:3: Expected SHA1 hash for patch-aa, got MD5, SHA1.",
 		"ERROR: distinfo:4: SHA1 hash of patches/patch-aa differs "+
 			"(distinfo has 1234567890123456789012345678901234567890, "+
-			"patch file has 9a93207561abfef7e7550598c5a08f2c3226995b).")
+			"patch file has 9a93207561abfef7e7550598c5a08f2c3226995b).",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_distinfoLinesChecker_checkAlgorithms__missing_patch_with_distfile_checksums(c *check.C) {
@@ -392,8 +412,12 @@ func (s *Suite) Test_distinfoLinesChecker_checkAlgorithms__existing_patch_with_d
 	// that the distinfo lines clearly refer to that patch file and not
 	// to a distfile.
 	t.CheckOutputLines(
-		"ERROR: ~/category/package/distinfo:3: " +
-			"Expected SHA1 hash for patch-aa, got BLAKE2s, SHA512, Size.")
+		"ERROR: ~/category/package/distinfo:3: "+
+			"Expected SHA1 hash for patch-aa, got BLAKE2s, SHA512, Size.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_distinfoLinesChecker_checkAlgorithms__missing_patch_with_wrong_algorithms(c *check.C) {
@@ -673,6 +697,71 @@ func (s *Suite) Test_distinfoLinesChecker_checkAlgorithmsDistfile__wrong_order_a
 	)
 }
 
+func (s *Suite) Test_distinfoLinesChecker_distfile(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.CreateFileLines("distfiles/subdir/package-1.0.txt",
+		"hello, world")
+	t.FinishSetUp()
+	ck := distinfoLinesChecker{}
+
+	t.CheckEquals(ck.distfile("subdir/package-1.0.txt"),
+		t.File("distfiles/subdir/package-1.0.txt"))
+	t.CheckEquals(ck.distfile("package-1.0.txt"), CurrPath(""))
+	t.CheckEquals(ck.distfile("subdir"), CurrPath(""))
+}
+
+func (s *Suite) Test_distinfoLinesChecker_distfileHashes(c *check.C) {
+	t := s.Init(c)
+
+	distfile := t.CreateFileLines("distfiles/package-1.0.txt",
+		"hello, world")
+
+	hashes := (*distinfoLinesChecker).distfileHashes(nil, distfile)
+
+	t.CheckDeepEquals(hashes, map[string]string{
+		"BLAKE2s": "ee494623e60caeda840ed7de4fb70db4a36bc92b445b09f12b9ed46094e9bd59",
+		"SHA512": "f65f341b35981fda842b09b2c8af9bcdb7602a4c2e6fa1f7d41f0974d3e3122f" +
+			"268fc79d5a4af66358f5133885cd1c165c916f80ab25e5d8d95db46f803c782c",
+		"Size": "13 bytes"})
+}
+
+// When the distfile has already been downloaded, all its hashes from the
+// distinfo file are compared with the actual file. This catches distfiles
+// that have been silently re-rolled upstream.
+func (s *Suite) Test_distinfoLinesChecker_checkDistfileHashes(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (package-1.0.txt) = ee494623e60caeda840ed7de4fb70db4a36bc92b445b09f12b9ed46094e9bd59",
+		"SHA512 (package-1.0.txt) = 1234wrongHash1234",
+		"Size (package-1.0.txt) = 14 bytes",
+		"BLAKE2s (package-1.1.txt) = 1234wrongHash1234",
+		"SHA512 (package-1.1.txt) = 1234wrongHash1234",
+		"Size (package-1.1.txt) = 14 bytes")
+	t.CreateFileLines("distfiles/package-1.0.txt",
+		"hello, world")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	// Since package-1.1.txt has not been downloaded,
+	// its hashes cannot be checked.
+	t.CheckOutputLines(
+		"ERROR: ~/category/package/distinfo:4: "+
+			"The SHA512 checksum for \"package-1.0.txt\" is 1234wrongHash1234 in distinfo, "+
+			"f65f341b35981fda842b09b2c8af9bcdb7602a4c2e6fa1f7d41f0974d3e3122f"+
+			"268fc79d5a4af66358f5133885cd1c165c916f80ab25e5d8d95db46f803c782c "+
+			"in ../../distfiles/package-1.0.txt.",
+		"ERROR: ~/category/package/distinfo:5: "+
+			"The Size checksum for \"package-1.0.txt\" is 14 bytes in distinfo, "+
+			"13 bytes in ../../distfiles/package-1.0.txt.")
+}
+
 func (s *Suite) Test_distinfoLinesChecker_checkUnrecordedPatches(c *check.C) {
 	t := s.Init(c)
 
@@ -698,7 +787,201 @@ func (s *Suite) Test_distinfoLinesChecker_checkUnrecordedPatches(c *check.C) {
 	t.CheckOutputLines(
 		"WARN: distinfo:3: Distfiles without version number should be placed in a versioned DIST_SUBDIR.",
 		"ERROR: distinfo: Patch \"patches/patch-aa\" is not recorded. Run \""+confMake+" makepatchsum\".",
-		"ERROR: distinfo: Patch \"patches/patch-src-Makefile\" is not recorded. Run \""+confMake+" makepatchsum\".")
+		"ERROR: distinfo: Patch \"patches/patch-src-Makefile\" is not recorded. Run \""+confMake+" makepatchsum\".",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
+		"WARN: patches/patch-src-Makefile: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-src-Makefile: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
+}
+
+func (s *Suite) Test_distinfoLinesChecker_regenerate(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DISTNAME=\tpackage-1.1",
+		"EXTRACT_SUFX=\t.txt")
+	t.CreateFileDummyPatch("category/package/patches/patch-existing")
+	t.CreateFileDummyPatch("category/package/patches/patch-new")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"SHA1 (patch-removed) = 1234567890123456789012345678901234567890",
+		"SHA1 (patch-existing) = 1234567890123456789012345678901234567890",
+		"BLAKE2s (package-1.0.txt) = 1234",
+		"SHA512 (package-1.0.txt) = 1234",
+		"Size (package-1.0.txt) = 13 bytes")
+	t.CreateFileLines("distfiles/package-1.1.txt",
+		"hello, world")
+	t.SetUpCommandLine("-Wall", "--show-autofix")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"ERROR: ~/category/package/distinfo:4: SHA1 hash of patches/patch-existing differs "+
+			"(distinfo has 1234567890123456789012345678901234567890, "+
+			"patch file has f27b84b38fdf603d657173875a355705af347a0d).",
+		"AUTOFIX: ~/category/package/distinfo:4: "+
+			"Replacing \"1234567890123456789012345678901234567890\" with \"f27b84b38fdf603d657173875a355705af347a0d\".",
+		"NOTE: ~/category/package/distinfo: The distinfo file is not up to date.",
+		"AUTOFIX: ~/category/package/distinfo: Regenerating the distinfo file")
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/package/distinfo:4: "+
+			"Replacing \"1234567890123456789012345678901234567890\" with \"f27b84b38fdf603d657173875a355705af347a0d\".",
+		"AUTOFIX: ~/category/package/distinfo: Regenerating the distinfo file")
+	t.CheckFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (package-1.1.txt) = ee494623e60caeda840ed7de4fb70db4a36bc92b445b09f12b9ed46094e9bd59",
+		"SHA512 (package-1.1.txt) = f65f341b35981fda842b09b2c8af9bcdb7602a4c2e6fa1f7d41f0974d3e3122f"+
+			"268fc79d5a4af66358f5133885cd1c165c916f80ab25e5d8d95db46f803c782c",
+		"Size (package-1.1.txt) = 13 bytes",
+		"SHA1 (patch-existing) = f27b84b38fdf603d657173875a355705af347a0d",
+		"SHA1 (patch-new) = 393d2ca8806debe0009828262a0564d4e7abbcdc")
+
+	// The regenerated file is stable.
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputEmpty()
+}
+
+// As long as the current distfile has not been downloaded,
+// the entries for the previous distfiles are kept.
+func (s *Suite) Test_distinfoLinesChecker_regenerate__not_downloaded(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DISTNAME=\tpackage-1.1",
+		"EXTRACT_SUFX=\t.txt")
+	t.CreateFileDummyPatch("category/package/patches/patch-new")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (package-1.0.txt) = 1234",
+		"SHA512 (package-1.0.txt) = 1234",
+		"Size (package-1.0.txt) = 13 bytes")
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/package/distinfo: Regenerating the distinfo file")
+	t.CheckFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (package-1.0.txt) = 1234",
+		"SHA512 (package-1.0.txt) = 1234",
+		"Size (package-1.0.txt) = 13 bytes",
+		"SHA1 (patch-new) = 393d2ca8806debe0009828262a0564d4e7abbcdc")
+}
+
+// When the distfiles depend on the platform, the entries for the distfiles
+// of the other platforms are kept, even when they are not downloaded.
+func (s *Suite) Test_distinfoLinesChecker_regenerate__conditional_distfiles(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DISTNAME=\tpackage-1.0",
+		".if ${MACHINE_ARCH} == x86_64",
+		"DISTFILES=\tpackage-1.0-amd64.txt",
+		".else",
+		"DISTFILES=\tpackage-1.0-i386.txt",
+		".endif")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (package-1.0-amd64.txt) = 1234",
+		"SHA512 (package-1.0-amd64.txt) = 1234",
+		"Size (package-1.0-amd64.txt) = 13 bytes")
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputEmpty()
+}
+
+// Invalid lines would get lost when regenerating the file.
+func (s *Suite) Test_distinfoLinesChecker_regenerate__invalid_line(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileDummyPatch("category/package/patches/patch-new")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (distfile-1.0.tar.gz) = 12341234",
+		"SHA512 (distfile-1.0.tar.gz) = 12341234",
+		"Size (distfile-1.0.tar.gz) = 12341234",
+		"invalid")
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputEmpty()
+	t.CheckFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (distfile-1.0.tar.gz) = 12341234",
+		"SHA512 (distfile-1.0.tar.gz) = 12341234",
+		"Size (distfile-1.0.tar.gz) = 12341234",
+		"invalid")
+}
+
+func (s *Suite) Test_distinfoLinesChecker_declaredDistfiles(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.FinishSetUp()
+
+	test := func(lines []string, expected map[RelPath]bool) {
+		t.SetUpPackage("category/package", lines...)
+		pkg := NewPackage(t.File("category/package"))
+		_, _, _ = pkg.load()
+		ck := distinfoLinesChecker{pkg: pkg}
+
+		t.CheckDeepEquals(ck.declaredDistfiles(), expected)
+	}
+	lines := func(lines ...string) []string { return lines }
+
+	test(lines(),
+		map[RelPath]bool{"package-1.0.tar.gz": true})
+	test(lines(
+		"DISTFILES=\t${DEFAULT_DISTFILES} extra.zip",
+		"PATCHFILES=\tfix.patch",
+		"DIST_SUBDIR=\t${DISTNAME}"),
+		map[RelPath]bool{
+			"package-1.0/extra.zip":          true,
+			"package-1.0/fix.patch":          true,
+			"package-1.0/package-1.0.tar.gz": true})
+
+	// The distfiles depend on the platform.
+	test(lines(
+		".if ${OPSYS} == NetBSD",
+		"DISTFILES=\tnetbsd.tar.gz",
+		".endif"),
+		nil)
+
+	// The distfiles cannot be determined.
+	test(lines(
+		"DISTFILES=\t${UNKNOWN}"),
+		nil)
+
+	// The distfile is from a specific group of MASTER_SITES.
+	test(lines(
+		"DISTFILES=\tfile.tar.gz:-group"),
+		nil)
 }
 
 func (s *Suite) Test_distinfoLinesChecker_isPatch(c *check.C) {
@@ -813,7 +1096,11 @@ func (s *Suite) Test_distinfoLinesChecker_checkUncommittedPatch__bad(c *check.C)
 	G.checkdirPackage(".")
 
 	t.CheckOutputLines(
-		"WARN: distinfo:3: patches/patch-aa is registered in distinfo but not added to CVS.")
+		"WARN: distinfo:3: patches/patch-aa is registered in distinfo but not added to CVS.",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_distinfoLinesChecker_checkUncommittedPatch__good(c *check.C) {
@@ -834,7 +1121,11 @@ func (s *Suite) Test_distinfoLinesChecker_checkUncommittedPatch__good(c *check.C
 
 	G.checkdirPackage(".")
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // The distinfo file and the patches are usually placed in the package
@@ -861,6 +1152,14 @@ func (s *Suite) Test_distinfoLinesChecker_checkPatchSha1__relative_path_in_disti
 	G.checkdirPackage(".")
 
 	t.CheckOutputLines(
+		"WARN: ../../devel/patches/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ../../devel/patches/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
+		"WARN: ../../devel/patches/patches/patch-only-in-patches: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ../../devel/patches/patches/patch-only-in-patches: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
 		"ERROR: ../../other/common/distinfo:3: SHA1 hash of ../../devel/patches/patches/patch-aa differs "+
 			"(distinfo has ..., patch file has 9a93207561abfef7e7550598c5a08f2c3226995b).",
 		"WARN: ../../other/common/distinfo:4: Patch file \"patch-only-in-distinfo\" "+
@@ -0,0 +1,344 @@
+package pkglint
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// MakefileDump writes the package Makefile, including all included files,
+// in JSON format, so that other tools can build on the parser of pkglint
+// instead of reimplementing it.
+//
+// See the --dump command line option.
+type MakefileDump struct {
+	pkg      *Package
+	allLines *MkLines // The package Makefile, including the included files.
+}
+
+type dumpLine struct {
+	Location  string       `json:"location"`
+	Kind      string       `json:"kind"`
+	Text      string       `json:"text"`
+	Varname   string       `json:"varname,omitempty"`
+	Op        string       `json:"op,omitempty"`
+	Value     *string      `json:"value,omitempty"`
+	Tokens    []*dumpToken `json:"tokens,omitempty"`
+	Directive string       `json:"directive,omitempty"`
+	Args      string       `json:"args,omitempty"`
+	Cond      *dumpCond    `json:"cond,omitempty"`
+	Path      string       `json:"path,omitempty"`
+	Command   string       `json:"command,omitempty"`
+	Targets   string       `json:"targets,omitempty"`
+	Sources   string       `json:"sources,omitempty"`
+	Comment   string       `json:"comment,omitempty"`
+}
+
+type dumpToken struct {
+	Text string    `json:"text"`
+	Expr *dumpExpr `json:"expr,omitempty"`
+}
+
+type dumpExpr struct {
+	Varname   string   `json:"varname"`
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+type dumpCond struct {
+	Or      []*dumpCond  `json:"or,omitempty"`
+	And     []*dumpCond  `json:"and,omitempty"`
+	Not     *dumpCond    `json:"not,omitempty"`
+	Defined string       `json:"defined,omitempty"`
+	Empty   *dumpExpr    `json:"empty,omitempty"`
+	Term    *dumpTerm    `json:"term,omitempty"`
+	Compare *dumpCompare `json:"compare,omitempty"`
+	Call    *dumpCall    `json:"call,omitempty"`
+	Paren   *dumpCond    `json:"paren,omitempty"`
+}
+
+type dumpTerm struct {
+	Str  *string   `json:"str,omitempty"`
+	Num  string    `json:"num,omitempty"`
+	Expr *dumpExpr `json:"expr,omitempty"`
+}
+
+type dumpCompare struct {
+	Left  *dumpTerm `json:"left"`
+	Op    string    `json:"op,omitempty"`
+	Right *dumpTerm `json:"right,omitempty"`
+}
+
+type dumpCall struct {
+	Name string `json:"name"`
+	Arg  string `json:"arg"`
+}
+
+type dumpInclude struct {
+	Location   string         `json:"location,omitempty"`
+	File       string         `json:"file,omitempty"`
+	Path       string         `json:"path,omitempty"`
+	Resolved   string         `json:"resolved,omitempty"`
+	Conditions []string       `json:"conditions,omitempty"`
+	Loaded     bool           `json:"loaded"`
+	Includes   []*dumpInclude `json:"includes,omitempty"`
+}
+
+type dumpVariable struct {
+	Name        string     `json:"name"`
+	Value       *string    `json:"value,omitempty"`
+	Definitions []string   `json:"definitions,omitempty"`
+	Uses        []*dumpUse `json:"uses,omitempty"`
+}
+
+type dumpUse struct {
+	Location string `json:"location"`
+	Time     string `json:"time,omitempty"`
+}
+
+func NewMakefileDump(pkg *Package, allLines *MkLines) *MakefileDump {
+	return &MakefileDump{pkg, allLines}
+}
+
+// Write writes the given aspect of the package Makefile,
+// which is one of "ast", "includes" or "scope".
+func (d *MakefileDump) Write(out *SeparatorWriter, kind string) {
+	type jsonPackage struct {
+		Package   string          `json:"package"`
+		Lines     []*dumpLine     `json:"lines,omitempty"`
+		Files     []*dumpInclude  `json:"files,omitempty"`
+		Variables []*dumpVariable `json:"variables,omitempty"`
+	}
+
+	data := jsonPackage{Package: d.pkg.Pkgpath.String()}
+	switch kind {
+	case "ast":
+		data.Lines = d.lines()
+	case "includes":
+		data.Files = d.includes()
+	case "scope":
+		data.Variables = d.variables()
+	}
+	writeJSON(out, data)
+}
+
+// lines returns the parsed lines of the package Makefile.
+func (d *MakefileDump) lines() []*dumpLine {
+	lines := []*dumpLine{}
+	for _, mkline := range d.allLines.mklines {
+		lines = append(lines, d.line(mkline))
+	}
+	return lines
+}
+
+func (d *MakefileDump) line(mkline *MkLine) *dumpLine {
+	line := dumpLine{Location: d.location(mkline), Text: mkline.Text}
+
+	switch {
+	case mkline.IsVarassign():
+		value, tokens := mkline.Value(), []*dumpToken{}
+		valueTokens, _ := mkline.ValueTokens()
+		for _, token := range valueTokens {
+			tokens = append(tokens, &dumpToken{token.Text, d.expr(token.Expr)})
+		}
+		line.Kind, line.Varname, line.Op = "varassign", mkline.Varname(), mkline.Op().String()
+		line.Value, line.Tokens = &value, tokens
+	case mkline.IsShellCommand():
+		line.Kind, line.Command = "shellcmd", mkline.ShellCommand()
+	case mkline.IsComment():
+		line.Kind = "comment"
+	case mkline.IsEmpty():
+		line.Kind = "empty"
+	case mkline.IsDirective():
+		line.Kind, line.Directive, line.Args = "directive", mkline.Directive(), mkline.Args()
+		line.Cond = d.cond(mkline.Cond())
+	case mkline.IsInclude():
+		line.Kind, line.Path = "include", mkline.IncludedFile().String()
+	case mkline.IsSysinclude():
+		line.Kind, line.Path = "sysinclude", mkline.IncludedFile().String()
+	case mkline.IsDependency():
+		line.Kind, line.Targets, line.Sources = "dependency", mkline.Targets(), mkline.Sources()
+	default:
+		line.Kind = "unknown"
+	}
+
+	if !mkline.IsComment() && !mkline.IsShellCommand() && !mkline.IsEmpty() {
+		line.Comment = mkline.Comment()
+	}
+	if mkline.IsDirective() {
+		line.Comment = mkline.DirectiveComment()
+	}
+	return &line
+}
+
+func (d *MakefileDump) expr(expr *MkExpr) *dumpExpr {
+	if expr == nil {
+		return nil
+	}
+	var mods []string
+	for _, mod := range expr.modifiers {
+		mods = append(mods, mod.String())
+	}
+	return &dumpExpr{expr.varname, mods}
+}
+
+func (d *MakefileDump) cond(cond *MkCond) *dumpCond {
+	if cond == nil {
+		return nil
+	}
+
+	term := func(term *MkCondTerm) *dumpTerm {
+		switch {
+		case term.Expr != nil:
+			return &dumpTerm{Expr: d.expr(term.Expr)}
+		case term.Num != "":
+			return &dumpTerm{Num: term.Num}
+		}
+		str := term.Str
+		return &dumpTerm{Str: &str}
+	}
+
+	conds := func(cs []*MkCond) []*dumpCond {
+		var result []*dumpCond
+		for _, c := range cs {
+			result = append(result, d.cond(c))
+		}
+		return result
+	}
+
+	result := dumpCond{
+		Or:      conds(cond.Or),
+		And:     conds(cond.And),
+		Not:     d.cond(cond.Not),
+		Defined: cond.Defined,
+		Empty:   d.expr(cond.Empty),
+		Paren:   d.cond(cond.Paren)}
+	if cond.Term != nil {
+		result.Term = term(cond.Term)
+	}
+	if cmp := cond.Compare; cmp != nil {
+		result.Compare = &dumpCompare{Left: term(&cmp.Left), Op: cmp.Op}
+		if cmp.Op != "" {
+			result.Compare.Right = term(&cmp.Right)
+		}
+	}
+	if call := cond.Call; call != nil {
+		result.Call = &dumpCall{call.Name, call.Arg}
+	}
+	return &result
+}
+
+// includes returns the hierarchy of included files.
+//
+// The first file is the package Makefile. It may be followed by other
+// files that are loaded by the pkgsrc infrastructure, such as hacks.mk.
+func (d *MakefileDump) includes() []*dumpInclude {
+	type level struct {
+		filename CurrPath
+		node     *dumpInclude
+	}
+
+	var files []*dumpInclude
+	var stack []level
+	// The include directive from the previous line.
+	// It is loaded if the current line comes from the included file.
+	var pending *dumpInclude
+	var branches BranchConditions
+
+	for _, mkline := range d.allLines.mklines {
+		filename := mkline.Filename()
+		if pending != nil && pending.Resolved != "" &&
+			G.Pkgsrc.Rel(filename).String() == pending.Resolved {
+			pending.Loaded = true
+			stack = append(stack, level{filename, pending})
+		}
+		pending = nil
+
+		for len(stack) > 0 && stack[len(stack)-1].filename != filename {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			file := &dumpInclude{File: G.Pkgsrc.Rel(filename).String(), Loaded: true}
+			files = append(files, file)
+			stack = append(stack, level{filename, file})
+		}
+
+		branches.Track(mkline)
+		if !mkline.IsInclude() && !mkline.IsSysinclude() {
+			continue
+		}
+
+		node := &dumpInclude{
+			Location:   d.location(mkline),
+			Path:       mkline.IncludedFile().String(),
+			Conditions: []string{}}
+		for _, cond := range branches.Lines() {
+			node.Conditions = append(node.Conditions, cond.Args())
+		}
+		if mkline.IsInclude() {
+			resolved := d.pkg.resolveIncludedFile(mkline, filename)
+			if !resolved.IsEmpty() {
+				node.Resolved = G.Pkgsrc.Rel(mkline.File(resolved)).String()
+			}
+		}
+
+		top := stack[len(stack)-1].node
+		top.Includes = append(top.Includes, node)
+		pending = node
+	}
+	return files
+}
+
+// variables returns the variables that are defined or used in the
+// package Makefile, sorted by name.
+func (d *MakefileDump) variables() []*dumpVariable {
+	vars := make(map[string]*dumpVariable)
+	var varnames []string
+	get := func(varname string) *dumpVariable {
+		if v := vars[varname]; v != nil {
+			return v
+		}
+		v := &dumpVariable{Name: varname}
+		varnames = append(varnames, varname)
+		if value, found, _ := d.pkg.vars.LastValueFound(varname); found {
+			v.Value = &value
+		}
+		vars[varname] = v
+		return v
+	}
+
+	for _, mkline := range d.allLines.mklines {
+		if mkline.IsVarassign() {
+			v := get(mkline.Varname())
+			v.Definitions = append(v.Definitions, d.location(mkline))
+		}
+		mkline.ForEachUsed(func(expr *MkExpr, time EctxTime) {
+			v := get(expr.varname)
+			timeName := map[EctxTime]string{EctxLoadTime: "load", EctxRunTime: "run"}[time]
+			v.Uses = append(v.Uses, &dumpUse{d.location(mkline), timeName})
+		})
+	}
+
+	sort.Strings(varnames)
+	result := []*dumpVariable{}
+	for _, varname := range varnames {
+		result = append(result, vars[varname])
+	}
+	return result
+}
+
+// location returns the place of the line, relative to the pkgsrc root
+// directory, e.g. "category/package/Makefile:20".
+func (d *MakefileDump) location(mkline *MkLine) string {
+	return sprintf("%s:%s", G.Pkgsrc.Rel(mkline.Filename()), mkline.Linenos())
+}
+
+// writeJSON writes the data in indented JSON format,
+// to be processed by other tools.
+func writeJSON(out *SeparatorWriter, data interface{}) {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	assertNil(enc.Encode(data), "json.Encode")
+	out.Write(b.String())
+}
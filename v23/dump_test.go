@@ -0,0 +1,291 @@
+package pkglint
+
+import (
+	"gopkg.in/check.v1"
+	"strings"
+)
+
+func (s *Suite) Test_NewMakefileDump(c *check.C) {
+	t := s.Init(c)
+
+	pkg := NewPackage(t.File("category/package"))
+	d := NewMakefileDump(pkg, nil)
+
+	t.CheckEquals(d.pkg, pkg)
+}
+
+func (s *Suite) Test_MakefileDump_Write(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"PKGNAME=\tpackage-1.0")
+
+	exitcode := t.Main("--dump=includes", "-Wall", "category/package")
+
+	// Instead of the diagnostics, the JSON is written.
+	t.CheckEquals(exitcode, 0)
+	t.CheckOutputLines(
+		"{",
+		"\t\"package\": \"category/package\",",
+		"\t\"files\": [",
+		"\t\t{",
+		"\t\t\t\"file\": \"category/package/Makefile\",",
+		"\t\t\t\"loaded\": true,",
+		"\t\t\t\"includes\": [",
+		"\t\t\t\t{",
+		"\t\t\t\t\t\"location\": \"category/package/Makefile:13\",",
+		"\t\t\t\t\t\"path\": \"suppress-varorder.mk\",",
+		"\t\t\t\t\t\"resolved\": \"category/package/suppress-varorder.mk\",",
+		"\t\t\t\t\t\"loaded\": true",
+		"\t\t\t\t},",
+		"\t\t\t\t{",
+		"\t\t\t\t\t\"location\": \"category/package/Makefile:21\",",
+		"\t\t\t\t\t\"path\": \"../../mk/bsd.pkg.mk\",",
+		"\t\t\t\t\t\"resolved\": \"mk/bsd.pkg.mk\",",
+		"\t\t\t\t\t\"loaded\": false",
+		"\t\t\t\t}",
+		"\t\t\t]",
+		"\t\t}",
+		"\t]",
+		"}")
+}
+
+func (s *Suite) Test_MakefileDump_lines(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+
+	lines := NewMakefileDump(pkg, allLines).lines()
+
+	var kinds []string
+	for _, line := range lines {
+		kinds = append(kinds, line.Kind)
+	}
+	t.CheckDeepEquals(kinds, []string{
+		"comment", "empty",
+		"varassign", "comment", "varassign", "varassign",
+		"empty",
+		"varassign", "varassign", "varassign", "varassign",
+		"empty",
+		"include",
+		"comment", "empty",
+		"comment", "comment", "comment", "comment",
+		"empty", "empty",
+		"include"})
+}
+
+func (s *Suite) Test_MakefileDump_line(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.FinishSetUp()
+	mklines := t.NewMkLines(t.File("category/package/filename.mk"),
+		MkCvsID,
+		"VAR+=\t${OTHER:Q} value # comment",
+		".if defined(VAR)",
+		".endif",
+		".include \"other.mk\"",
+		"target: source",
+		"\techo")
+	d := NewMakefileDump(nil, mklines)
+
+	test := func(i int, expected *dumpLine) {
+		t.CheckDeepEquals(d.line(mklines.mklines[i]), expected)
+	}
+
+	value := "${OTHER:Q} value"
+	test(1, &dumpLine{
+		Location: "category/package/filename.mk:2",
+		Kind:     "varassign",
+		Text:     "VAR+=\t${OTHER:Q} value # comment",
+		Varname:  "VAR",
+		Op:       "+=",
+		Value:    &value,
+		Tokens: []*dumpToken{
+			{"${OTHER:Q}", &dumpExpr{"OTHER", []string{"Q"}}},
+			{" value", nil}},
+		Comment: " comment"})
+	test(2, &dumpLine{
+		Location:  "category/package/filename.mk:3",
+		Kind:      "directive",
+		Text:      ".if defined(VAR)",
+		Directive: "if",
+		Args:      "defined(VAR)",
+		Cond:      &dumpCond{Defined: "VAR"}})
+	test(4, &dumpLine{
+		Location: "category/package/filename.mk:5",
+		Kind:     "include",
+		Text:     ".include \"other.mk\"",
+		Path:     "other.mk"})
+	test(5, &dumpLine{
+		Location: "category/package/filename.mk:6",
+		Kind:     "dependency",
+		Text:     "target: source",
+		Targets:  "target",
+		Sources:  "source"})
+	test(6, &dumpLine{
+		Location: "category/package/filename.mk:7",
+		Kind:     "shellcmd",
+		Text:     "\techo",
+		Command:  "echo"})
+}
+
+func (s *Suite) Test_MakefileDump_expr(c *check.C) {
+	t := s.Init(c)
+
+	d := NewMakefileDump(nil, nil)
+
+	t.CheckNil(d.expr(nil))
+	t.CheckDeepEquals(
+		d.expr(NewMkExpr("VAR", "Mpattern", "S,from,to,")),
+		&dumpExpr{"VAR", []string{"Mpattern", "S,from,to,"}})
+}
+
+func (s *Suite) Test_MakefileDump_cond(c *check.C) {
+	t := s.Init(c)
+
+	d := NewMakefileDump(nil, nil)
+	test := func(cond string, expected string) {
+		mkline := t.NewMkLine("filename.mk", 123, ".if "+cond)
+		var sb strings.Builder
+		writeJSON(NewSeparatorWriter(&sb), d.cond(mkline.Cond()))
+		t.CheckEquals(strings.Join(strings.Fields(sb.String()), " "), expected)
+	}
+
+	test("${OPSYS} == NetBSD || !empty(VAR:M*)",
+		`{ "or": [ { "compare": { "left": { "expr": { "varname": "OPSYS" } }, `+
+			`"op": "==", "right": { "str": "NetBSD" } } }, `+
+			`{ "not": { "empty": { "varname": "VAR", "modifiers": [ "M*" ] } } } ] }`)
+	test("${VAR} && (exists(file) || ${N} > 0)",
+		`{ "and": [ { "term": { "expr": { "varname": "VAR" } } }, `+
+			`{ "paren": { "or": [ { "call": { "name": "exists", "arg": "file" } }, `+
+			`{ "compare": { "left": { "expr": { "varname": "N" } }, "op": ">", "right": { "num": "0" } } } ] } } ] }`)
+	test("\"\"",
+		`{ "term": { "str": "" } }`)
+}
+
+func (s *Suite) Test_MakefileDump_includes(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		".include \"options.mk\"",
+		".include \"${UNRESOLVED}/file.mk\"")
+	t.CreateFileLines("category/package/options.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".  include \"../../category/lib/buildlink3.mk\"",
+		".endif",
+		"",
+		"# The last line of the file is an include that is not loaded.",
+		".include \"../../mk/bsd.prefs.mk\"")
+	t.CreateFileBuildlink3("category/lib/buildlink3.mk")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+
+	files := NewMakefileDump(pkg, allLines).includes()
+
+	var sb strings.Builder
+	writeJSON(NewSeparatorWriter(&sb), files)
+	t.CheckEquals(sb.String(), ""+
+		"[\n"+
+		"\t{\n"+
+		"\t\t\"file\": \"category/package/Makefile\",\n"+
+		"\t\t\"loaded\": true,\n"+
+		"\t\t\"includes\": [\n"+
+		"\t\t\t{\n"+
+		"\t\t\t\t\"location\": \"category/package/Makefile:13\",\n"+
+		"\t\t\t\t\"path\": \"suppress-varorder.mk\",\n"+
+		"\t\t\t\t\"resolved\": \"category/package/suppress-varorder.mk\",\n"+
+		"\t\t\t\t\"loaded\": true\n"+
+		"\t\t\t},\n"+
+		"\t\t\t{\n"+
+		"\t\t\t\t\"location\": \"category/package/Makefile:20\",\n"+
+		"\t\t\t\t\"path\": \"options.mk\",\n"+
+		"\t\t\t\t\"resolved\": \"category/package/options.mk\",\n"+
+		"\t\t\t\t\"loaded\": true,\n"+
+		"\t\t\t\t\"includes\": [\n"+
+		"\t\t\t\t\t{\n"+
+		"\t\t\t\t\t\t\"location\": \"category/package/options.mk:3\",\n"+
+		"\t\t\t\t\t\t\"path\": \"../../category/lib/buildlink3.mk\",\n"+
+		"\t\t\t\t\t\t\"resolved\": \"category/lib/buildlink3.mk\",\n"+
+		"\t\t\t\t\t\t\"conditions\": [\n"+
+		"\t\t\t\t\t\t\t\"${OPSYS} == NetBSD\"\n"+
+		"\t\t\t\t\t\t],\n"+
+		"\t\t\t\t\t\t\"loaded\": true\n"+
+		"\t\t\t\t\t},\n"+
+		"\t\t\t\t\t{\n"+
+		"\t\t\t\t\t\t\"location\": \"category/package/options.mk:7\",\n"+
+		"\t\t\t\t\t\t\"path\": \"../../mk/bsd.prefs.mk\",\n"+
+		"\t\t\t\t\t\t\"resolved\": \"mk/bsd.prefs.mk\",\n"+
+		"\t\t\t\t\t\t\"loaded\": false\n"+
+		"\t\t\t\t\t}\n"+
+		"\t\t\t\t]\n"+
+		"\t\t\t},\n"+
+		"\t\t\t{\n"+
+		"\t\t\t\t\"location\": \"category/package/Makefile:21\",\n"+
+		"\t\t\t\t\"path\": \"${UNRESOLVED}/file.mk\",\n"+
+		"\t\t\t\t\"loaded\": false\n"+
+		"\t\t\t},\n"+
+		"\t\t\t{\n"+
+		"\t\t\t\t\"location\": \"category/package/Makefile:23\",\n"+
+		"\t\t\t\t\"path\": \"../../mk/bsd.pkg.mk\",\n"+
+		"\t\t\t\t\"resolved\": \"mk/bsd.pkg.mk\",\n"+
+		"\t\t\t\t\"loaded\": false\n"+
+		"\t\t\t}\n"+
+		"\t\t]\n"+
+		"\t}\n"+
+		"]\n")
+}
+
+func (s *Suite) Test_MakefileDump_variables(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.FinishSetUp()
+	mklines := t.NewMkLines(t.File("category/package/filename.mk"),
+		MkCvsID,
+		"VAR=\t${OTHER}",
+		"VAR+=\tsecond",
+		".if ${VAR:Mx}",
+		".endif")
+	pkg := NewPackage(t.File("category/package"))
+	pkg.vars.Define("VAR", mklines.mklines[1])
+	d := NewMakefileDump(pkg, mklines)
+
+	value := "${OTHER}"
+	t.CheckDeepEquals(d.variables(), []*dumpVariable{
+		{"OTHER", nil, nil, []*dumpUse{
+			{"category/package/filename.mk:2", "run"}}},
+		{"VAR", &value, []string{
+			"category/package/filename.mk:2",
+			"category/package/filename.mk:3"}, []*dumpUse{
+			{"category/package/filename.mk:4", "load"}}}})
+}
+
+func (s *Suite) Test_MakefileDump_location(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.FinishSetUp()
+	mklines := t.NewMkLines(t.File("category/package/filename.mk"),
+		"VAR=\tvalue \\",
+		"\tcontinued")
+	d := NewMakefileDump(nil, mklines)
+
+	t.CheckEquals(d.location(mklines.mklines[0]), "category/package/filename.mk:1--2")
+}
+
+func (s *Suite) Test_writeJSON(c *check.C) {
+	t := s.Init(c)
+
+	writeJSON(G.Logger.out, map[string]string{"key": "<value>"})
+
+	t.CheckOutputLines(
+		"{",
+		"\t\"key\": \"<value>\"",
+		"}")
+}
@@ -1,7 +1,7 @@
 package pkglint
 
 import (
-	"github.com/rillig/pkglint/v23/textproc"
+	"github.com/rillig/pkglint/v23/ast"
 	"strings"
 )
 
@@ -104,62 +104,20 @@ func nextLogicalLine(filename CurrPath, rawLines []*RawLine, index int) (*Line,
 		}
 	}
 
-	var text strings.Builder
 	firstLineno := index + 1
 	var lineRawLines []*RawLine
-	interestingRawLines := rawLines[index:]
-	trim := ""
-
-	for i, rawLine := range interestingRawLines {
-		indent, rawText, outdent, cont := matchContinuationLine(rawLine.Orig())
-
-		if text.Len() == 0 {
-			text.WriteString(indent)
-		}
-		text.WriteString(strings.TrimPrefix(rawText, trim))
+	var texts []string
 
+	for _, rawLine := range rawLines[index:] {
 		lineRawLines = append(lineRawLines, rawLine)
+		texts = append(texts, rawLine.Orig())
 
-		if cont != "" && i != len(interestingRawLines)-1 {
-			text.WriteString(" ")
-			index++
-			trim = textproc.NewLexer(rawText).NextString("#")
-		} else {
-			text.WriteString(outdent)
-			text.WriteString(cont)
+		_, _, _, cont := ast.SplitContinuation(rawLine.Orig())
+		if cont == "" || index == len(rawLines)-1 {
 			break
 		}
+		index++
 	}
 
-	return NewLineMulti(filename, firstLineno, text.String(), lineRawLines), index + 1
-}
-
-func matchContinuationLine(text string) (leadingWhitespace, result, trailingWhitespace, cont string) {
-	end := len(text)
-
-	j := end
-	for j > 0 && text[j-1] == '\\' {
-		j--
-	}
-	backslashes := (end - j) % 2
-	j = end - backslashes
-	cont = text[j:end]
-
-	trailingEnd := j
-	for j > 0 && isHspace(text[j-1]) {
-		j--
-	}
-	trailingStart := j
-	trailingWhitespace = text[trailingStart:trailingEnd]
-
-	i := 0
-	leadingStart := i
-	for i < j && isHspace(text[i]) {
-		i++
-	}
-	leadingEnd := i
-	leadingWhitespace = text[leadingStart:leadingEnd]
-
-	result = text[leadingEnd:trailingStart]
-	return
+	return NewLineMulti(filename, firstLineno, ast.LogicalLine(texts), lineRawLines), index + 1
 }
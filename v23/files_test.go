@@ -263,21 +263,3 @@ func (s *Suite) Test_nextLogicalLine__commented_multi(c *check.C) {
 	t.CheckEquals(mkline.Value(), "continuation 1 \tcontinuation 2")
 	t.CheckEquals(mkline.HasComment(), false)
 }
-
-func (s *Suite) Test_matchContinuationLine(c *check.C) {
-	t := s.Init(c)
-
-	leadingWhitespace, text, trailingWhitespace, continuation := matchContinuationLine("")
-
-	t.CheckEquals(leadingWhitespace, "")
-	t.CheckEquals(text, "")
-	t.CheckEquals(trailingWhitespace, "")
-	t.CheckEquals(continuation, "")
-
-	leadingWhitespace, text, trailingWhitespace, continuation = matchContinuationLine("\tword   \\")
-
-	t.CheckEquals(leadingWhitespace, "\t")
-	t.CheckEquals(text, "word")
-	t.CheckEquals(trailingWhitespace, "   ")
-	t.CheckEquals(continuation, "\\")
-}
@@ -0,0 +1,448 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/getopt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MkFormatter brings a makefile into its canonical layout,
+// similar to gofmt for Go code.
+//
+// It applies all autofixes that only affect the layout of the makefile,
+// independently of the -W command line options: trailing whitespace,
+// the indentation of directives and shell commands, the alignment of
+// variable assignments and, in simple package Makefiles, the order of
+// the common variables at the top.
+//
+// The formatter does not need the pkgsrc infrastructure,
+// which makes it usable for any BSD makefile.
+//
+// See "pkglint fmt".
+type MkFormatter struct {
+	filename CurrPath
+}
+
+func NewMkFormatter(filename CurrPath) *MkFormatter {
+	return &MkFormatter{filename}
+}
+
+// Format returns the text of the makefile in its canonical layout.
+//
+// Some transformations enable others. For example, reordering the
+// variables creates new paragraphs, which then need to be aligned.
+// Therefore, the transformations are repeated until the text is stable.
+func (f *MkFormatter) Format(text string) string {
+	// The autofixes are applied silently,
+	// independently of the command line options.
+	logger := &G.Logger
+	defer func(opts LoggerOpts, out *SeparatorWriter) {
+		logger.Opts, logger.out = opts, out
+	}(logger.Opts, logger.out)
+	logger.Opts = LoggerOpts{Autofix: true}
+	logger.out = NewSeparatorWriter(io.Discard)
+
+	for i := 0; i < 10; i++ {
+		formatted := f.pass(text)
+		if formatted == text {
+			break
+		}
+		text = formatted
+	}
+	return text
+}
+
+// pass applies each of the transformations once.
+func (f *MkFormatter) pass(text string) string {
+	mklines := NewMkLines(convertToLogicalLines(f.filename, text, true), nil, nil)
+
+	var varalign VaralignBlock
+	mklines.ForEach(func(mkline *MkLine) {
+		ck := MkLineChecker{mklines, mkline}
+		LineChecker{mkline.Line}.CheckTrailingWhitespace()
+
+		switch {
+		case mkline.IsDirective():
+			ck.checkDirectiveIndentation(mklines.indentation.Depth(mkline.Directive()))
+		case mkline.IsInclude() && mkline.Indent() != "":
+			ck.checkDirectiveIndentation(mklines.indentation.Depth("include"))
+		case mkline.IsShellCommand():
+			ck.checkShellCommandIndentation()
+		}
+
+		varalign.Process(mkline)
+	})
+	varalign.Finish()
+
+	texts := make([]string, len(mklines.mklines))
+	for i, mkline := range mklines.mklines {
+		texts[i] = f.text(mkline.Line)
+	}
+	texts = f.reorder(mklines, texts)
+
+	// See CheckLinesTrailingEmptyLines.
+	for len(texts) > 1 && texts[len(texts)-1] == "\n" {
+		texts = texts[:len(texts)-1]
+	}
+
+	formatted := strings.Join(texts, "")
+	if formatted != "" && !hasSuffix(formatted, "\n") {
+		formatted += "\n"
+	}
+	return formatted
+}
+
+// text returns the possibly autofixed text of the line,
+// including the lines that have been inserted above or below.
+func (f *MkFormatter) text(line *Line) string {
+	fix := line.fix
+	if fix == nil {
+		fix = NewAutofix(line)
+	}
+	return strings.Join(fix.above, "") +
+		strings.Join(fix.texts, "") +
+		strings.Join(fix.below, "")
+}
+
+// reorder arranges the variable assignments at the top of a simple
+// package Makefile in the order that VarorderChecker expects,
+// separating the sections by a single empty line.
+//
+// The variables are only reordered if the block at the top consists of
+// nothing but these variables and empty lines, since comments cannot be
+// attributed reliably to the surrounding lines.
+// Assignments that are evaluated immediately, such as := or !=,
+// prevent reordering as well, since their value may depend on the
+// preceding lines.
+func (f *MkFormatter) reorder(mklines *MkLines, texts []string) []string {
+	if mklines.lines.BaseName != "Makefile" {
+		return texts
+	}
+
+	ck := NewVarorderChecker(mklines)
+	relevant, _ := ck.relevantLines()
+	if len(relevant) == 0 {
+		return texts
+	}
+
+	order := map[string]int{}
+	section := map[string]int{}
+	sections := 1
+	for i, v := range varorderVariables {
+		if v.canon == "" {
+			sections++
+		} else {
+			order[v.canon], section[v.canon] = i, sections-1
+		}
+	}
+
+	all := mklines.mklines
+	var start, end int
+	for i, mkline := range all {
+		if mkline == relevant[0] {
+			start = i
+		}
+		if mkline == relevant[len(relevant)-1] {
+			end = i + 1
+		}
+	}
+
+	grouped := make([][]int, sections)
+	for i := start; i < end; i++ {
+		mkline := all[i]
+		if mkline.IsEmpty() {
+			continue
+		}
+		if !mkline.IsVarassignMaybeCommented() || !ck.relevant[mkline.Varcanon()] {
+			return texts
+		}
+		if !mkline.IsCommentedVarassign() &&
+			(mkline.Op() == opAssignEval || mkline.Op() == opAssignShell) {
+			return texts
+		}
+
+		s := section[mkline.Varcanon()]
+		grouped[s] = append(grouped[s], i)
+	}
+
+	reordered := append([]string(nil), texts[:start]...)
+	for _, indexes := range grouped {
+		if len(indexes) == 0 {
+			continue
+		}
+		if len(reordered) > start {
+			reordered = append(reordered, "\n")
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return order[all[indexes[i]].Varcanon()] < order[all[indexes[j]].Varcanon()]
+		})
+		for _, index := range indexes {
+			reordered = append(reordered, texts[index])
+		}
+	}
+	return append(reordered, texts[end:]...)
+}
+
+// unifiedDiff returns the differences between the old and the new text
+// of the file, in the format of "diff -u".
+func unifiedDiff(filename CurrPath, oldText, newText string) string {
+	split := func(text string) []string {
+		lines := strings.SplitAfter(text, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		return lines
+	}
+	a, b := split(oldText), split(newText)
+
+	type diffLine struct {
+		op   byte
+		text string
+	}
+	d := lineDiffer{a, b, make([]bool, len(a)), make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+
+	var lines []diffLine
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		case j < len(b) && d.inserted[j]:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		}
+	}
+
+	const context = 3
+	var sb strings.Builder
+	sb.WriteString(sprintf("--- %s.orig\n+++ %s\n", filename.String(), filename.String()))
+
+	aLineno, bLineno := 0, 0
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			aLineno++
+			bLineno++
+			start++
+			continue
+		}
+
+		// Extend the hunk as long as the next change is near enough.
+		end := start
+		for i := start; i < len(lines) && i <= end+2*context; i++ {
+			if lines[i].op != ' ' {
+				end = i
+			}
+		}
+		from := imax(0, start-context)
+		to := imin(len(lines), end+context+1)
+
+		aStart, bStart := aLineno-(start-from), bLineno-(start-from)
+		aCount, bCount := 0, 0
+		for _, line := range lines[from:to] {
+			if line.op != '+' {
+				aCount++
+			}
+			if line.op != '-' {
+				bCount++
+			}
+		}
+		// Same as in GNU diff, to keep the patches from "pkglint
+		// --refresh-patches" and from mkpatches identical.
+		hunkRange := func(lineno, count int) string {
+			switch count {
+			case 0:
+				return sprintf("%d,0", lineno)
+			case 1:
+				return sprintf("%d", lineno+1)
+			}
+			return sprintf("%d,%d", lineno+1, count)
+		}
+		sb.WriteString(sprintf("@@ -%s +%s @@\n",
+			hunkRange(aStart, aCount), hunkRange(bStart, bCount)))
+
+		for _, line := range lines[from:to] {
+			sb.WriteByte(line.op)
+			sb.WriteString(line.text)
+			if !hasSuffix(line.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		aLineno, bLineno = aStart+aCount, bStart+bCount
+		start = to
+	}
+	return sb.String()
+}
+
+// lineDiffer finds the lines that differ between two texts, using the
+// linear space variant of the algorithm from Eugene W. Myers,
+// "An O(ND) Difference Algorithm and Its Variations", 1986.
+//
+// Other than a table of the longest common subsequences,
+// it also works for large generated files such as configure scripts.
+type lineDiffer struct {
+	a, b     []string
+	deleted  []bool // Whether the line from a is not in b.
+	inserted []bool // Whether the line from b is not in a.
+}
+
+// compare marks the lines of a[aLo:aHi] and b[bLo:bHi] that differ.
+func (d *lineDiffer) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		// Since the common prefix and suffix have been removed,
+		// there are at least 2 differences, and each of the halves
+		// has fewer differences than the whole.
+		x0, y0, x1, y1 := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x0, bLo, y0)
+		d.compare(x1, aHi, y1, bHi)
+	}
+}
+
+// middleSnake returns the start and the end of the common lines that
+// are in the middle of a shortest edit script from a[aLo:aHi] to
+// b[bLo:bHi], by searching from the front and from the back at the
+// same time.
+func (d *lineDiffer) middleSnake(aLo, aHi, bLo, bHi int) (x0, y0, x1, y1 int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+
+	// The furthest x on each diagonal k = x - y, searching forward
+	// from the start, and backward from the end.
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+
+	for dist := 0; dist <= maxD; dist++ {
+		for k := -dist; k <= dist; k += 2 {
+			x := forward[off+k-1] + 1
+			if k == -dist || k != dist && forward[off+k-1] < forward[off+k+1] {
+				x = forward[off+k+1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[off+k] = x
+
+			c := delta - k
+			if delta%2 != 0 && c >= -(dist-1) && c <= dist-1 && x+backward[off+c] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for k := -dist; k <= dist; k += 2 {
+			x := backward[off+k-1] + 1
+			if k == -dist || k != dist && backward[off+k-1] < backward[off+k+1] {
+				x = backward[off+k+1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[off+k] = x
+
+			c := delta - k
+			if delta%2 == 0 && c >= -dist && c <= dist && forward[off+c]+x >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	assertf(false, "middleSnake: no overlap")
+	return
+}
+
+// mainFmt implements "pkglint fmt", which brings the given makefiles
+// into their canonical layout.
+func mainFmt(args []string) int {
+	p := &G
+	opts := getopt.NewOptions()
+	var diff, list, write bool
+	opts.AddFlagVar(0, "debug", &trace.Tracing, false, "log verbose call traces for debugging")
+	opts.AddFlagVar('d', "diff", &diff, false, "display diffs instead of the formatted files")
+	opts.AddFlagVar('l', "list", &list, false, "list files whose formatting differs")
+	opts.AddFlagVar('w', "write", &write, false, "write the result to the files instead of stdout")
+
+	usage := "pkglint fmt [options] file..."
+	filenames, exitCode := p.parseOptions(opts, args, usage)
+	if exitCode != -1 {
+		return exitCode
+	}
+	if len(filenames) == 0 {
+		p.Logger.TechErrorf("", "The file names are missing.")
+		return 1
+	}
+
+	// The layout of a makefile does not depend on the pkgsrc
+	// infrastructure, therefore the files may be anywhere.
+	p.Project = NewNetBSDProject()
+
+	out := p.Logger.out
+	exitCode = 0
+	for _, arg := range filenames {
+		filename := NewCurrPathSlash(arg)
+		text, err := filename.ReadString()
+		if err != nil {
+			p.Logger.TechErrorf(filename, "Cannot be read.")
+			exitCode = 1
+			continue
+		}
+
+		formatted := NewMkFormatter(filename).Format(text)
+		if !list && !diff && !write {
+			out.Write(formatted)
+			continue
+		}
+		if formatted == text {
+			continue
+		}
+
+		if list {
+			out.WriteLine(filename.String())
+			exitCode = 1
+		}
+		if diff {
+			out.Write(unifiedDiff(filename, text, formatted))
+		}
+		if write {
+			tmpName := filename + ".pkglint.tmp"
+			if err := tmpName.WriteString(formatted); err != nil {
+				p.Logger.TechErrorf(tmpName, "Cannot write: %s", err)
+				exitCode = 1
+			} else if err := tmpName.Rename(filename); err != nil {
+				p.Logger.TechErrorf(tmpName, "Cannot overwrite with formatted content: %s", err)
+				exitCode = 1
+			}
+		}
+	}
+	return exitCode
+}
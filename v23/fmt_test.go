@@ -0,0 +1,489 @@
+package pkglint
+
+import (
+	"gopkg.in/check.v1"
+	"strings"
+)
+
+func (s *Suite) Test_NewMkFormatter(c *check.C) {
+	t := s.Init(c)
+
+	f := NewMkFormatter("filename.mk")
+
+	t.CheckEquals(f.filename, CurrPath("filename.mk"))
+}
+
+func (s *Suite) Test_MkFormatter_Format(c *check.C) {
+	t := s.Init(c)
+
+	test := func(filename CurrPath, text string, expected ...string) {
+		formatted := NewMkFormatter(filename).Format(text)
+		t.CheckEquals(formatted, strings.Join(expected, "\n")+"\n")
+		t.CheckEquals(NewMkFormatter(filename).Format(formatted), formatted)
+	}
+
+	test("filename.mk",
+		""+
+			"VAR=   value   \n"+
+			"LONG_VARIABLE= value\n"+
+			".if 1\n"+
+			".for i in 1 2\n"+
+			"LOOP+=${i}\n"+
+			".endfor\n"+
+			".endif\n"+
+			"\n"+
+			"target:\n"+
+			"\t\techo 'indented'\n"+
+			"\n"+
+			"\n",
+		"VAR=\t\tvalue",
+		"LONG_VARIABLE=\tvalue",
+		".if 1",
+		".  for i in 1 2",
+		"LOOP+=\t\t${i}",
+		".  endfor",
+		".endif",
+		"",
+		"target:",
+		"\techo 'indented'")
+
+	// Reordering the variables creates new paragraphs,
+	// which are then aligned in a further pass.
+	test("Makefile",
+		""+
+			"COMMENT=\tComment\n"+
+			"DISTNAME=\tpackage-1.0\n"+
+			"CATEGORIES=\tcategory\n"+
+			"LICENSE=\t2-clause-bsd\n"+
+			"\n"+
+			".include \"../../mk/bsd.pkg.mk\"\n",
+		"DISTNAME=\tpackage-1.0",
+		"CATEGORIES=\tcategory",
+		"",
+		"COMMENT=\tComment",
+		"LICENSE=\t2-clause-bsd",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+
+	// A missing newline at the end of the file is added.
+	test("filename.mk",
+		"VAR=\tvalue",
+		"VAR=\tvalue")
+}
+
+func (s *Suite) Test_MkFormatter_Format__already_formatted(c *check.C) {
+	t := s.Init(c)
+
+	texts := []string{
+		"",
+		"\n",
+		"# comment\n",
+		MkCvsID + "\n\nVAR=\tvalue\n",
+		"VAR=\t\\\n\tcontinued\n",
+		".if !defined(GUARD_MK)\nGUARD_MK:=\n.if 1\n.endif\n.endif\n",
+		"pkgpath := ${PKGPATH}\n",
+		"target: source\n\t${ECHO} \"# not a comment\"\n",
+	}
+
+	for _, text := range texts {
+		t.CheckEquals(NewMkFormatter("filename.mk").Format(text), text)
+	}
+}
+
+func (s *Suite) Test_MkFormatter_pass(c *check.C) {
+	t := s.Init(c)
+
+	f := NewMkFormatter("filename.mk")
+
+	t.CheckEquals(f.pass("VAR=value  \n.if 1\n.if 2\n.endif\n.endif\n\n\n"),
+		"VAR=\tvalue\n.if 1\n.  if 2\n.  endif\n.endif\n")
+}
+
+func (s *Suite) Test_MkFormatter_text(c *check.C) {
+	t := s.Init(c)
+
+	lines := convertToLogicalLines("filename.mk", "VAR=\t\\\n\tvalue\nOTHER=\tvalue\n", true)
+	f := NewMkFormatter("filename.mk")
+
+	t.SetUpCommandLine("--autofix")
+	fix := lines.Lines[1].Autofix()
+	fix.Notef(SilentAutofixFormat)
+	fix.InsertAbove("# above")
+	fix.InsertBelow("# below")
+	fix.Apply()
+
+	t.CheckEquals(f.text(lines.Lines[0]), "VAR=\t\\\n\tvalue\n")
+	t.CheckEquals(f.text(lines.Lines[1]), "# above\nOTHER=\tvalue\n# below\n")
+}
+
+func (s *Suite) Test_MkFormatter_reorder(c *check.C) {
+	t := s.Init(c)
+
+	test := func(filename CurrPath, lines []string, expected ...string) {
+		mklines := t.NewMkLines(filename, lines...)
+		texts := make([]string, len(lines))
+		for i, line := range lines {
+			texts[i] = line + "\n"
+		}
+
+		reordered := NewMkFormatter(filename).reorder(mklines, texts)
+
+		t.CheckEquals(strings.Join(reordered, ""), strings.Join(expected, "\n")+"\n")
+	}
+
+	lines := func(lines ...string) []string { return lines }
+
+	test("Makefile",
+		lines(
+			MkCvsID,
+			"",
+			"HOMEPAGE=\thttps://example.org/",
+			"MASTER_SITES=\tsecond",
+			"DISTNAME=\tpackage-1.0",
+			"#LICENSE=\tmit",
+			"MASTER_SITES+=\tthird",
+			"",
+			"",
+			"DEPENDS+=\tlib-[0-9]*:../../category/lib",
+			"",
+			".include \"../../mk/bsd.pkg.mk\""),
+		MkCvsID,
+		"",
+		"DISTNAME=\tpackage-1.0",
+		"MASTER_SITES=\tsecond",
+		"MASTER_SITES+=\tthird",
+		"",
+		"HOMEPAGE=\thttps://example.org/",
+		"#LICENSE=\tmit",
+		"",
+		"DEPENDS+=\tlib-[0-9]*:../../category/lib",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+
+	// Comments between the variables would get lost.
+	test("Makefile",
+		lines(
+			"COMMENT=\tComment",
+			"# This comment belongs to DISTNAME.",
+			"DISTNAME=\tpackage-1.0",
+			".include \"../../mk/bsd.pkg.mk\""),
+		"COMMENT=\tComment",
+		"# This comment belongs to DISTNAME.",
+		"DISTNAME=\tpackage-1.0",
+		".include \"../../mk/bsd.pkg.mk\"")
+
+	// Other variables between the relevant ones make the order unclear.
+	test("Makefile",
+		lines(
+			"COMMENT=\tComment",
+			"VERSION=\t1.0",
+			"DISTNAME=\tpackage-${VERSION}",
+			".include \"../../mk/bsd.pkg.mk\""),
+		"COMMENT=\tComment",
+		"VERSION=\t1.0",
+		"DISTNAME=\tpackage-${VERSION}",
+		".include \"../../mk/bsd.pkg.mk\"")
+
+	// The value of an immediate assignment depends on the preceding lines.
+	test("Makefile",
+		lines(
+			"COMMENT=\tComment",
+			"DISTNAME:=\tpackage-1.0",
+			".include \"../../mk/bsd.pkg.mk\""),
+		"COMMENT=\tComment",
+		"DISTNAME:=\tpackage-1.0",
+		".include \"../../mk/bsd.pkg.mk\"")
+
+	// Only package Makefiles have a canonical variable order.
+	test("Makefile.common",
+		lines(
+			"COMMENT=\tComment",
+			"DISTNAME=\tpackage-1.0",
+			".include \"../../mk/bsd.pkg.mk\""),
+		"COMMENT=\tComment",
+		"DISTNAME=\tpackage-1.0",
+		".include \"../../mk/bsd.pkg.mk\"")
+}
+
+func (s *Suite) Test_unifiedDiff(c *check.C) {
+	t := s.Init(c)
+
+	test := func(oldText, newText string, expected ...string) {
+		t.CheckEquals(unifiedDiff("file.mk", oldText, newText), strings.Join(expected, "\n")+"\n")
+	}
+
+	test("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+		"1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n12\nthirteen\n",
+		"--- file.mk.orig",
+		"+++ file.mk",
+		"@@ -1,7 +1,7 @@",
+		" 1",
+		" 2",
+		" 3",
+		"-4",
+		"+four",
+		" 5",
+		" 6",
+		" 7",
+		"@@ -10,3 +10,4 @@",
+		" 10",
+		" 11",
+		" 12",
+		"+thirteen")
+
+	test("1\n2\n3\n4\n5\n6\n7\n",
+		"1\n3\n4\n5\n7\n",
+		"--- file.mk.orig",
+		"+++ file.mk",
+		"@@ -1,7 +1,5 @@",
+		" 1",
+		"-2",
+		" 3",
+		" 4",
+		" 5",
+		"-6",
+		" 7")
+
+	test("",
+		"line\n",
+		"--- file.mk.orig",
+		"+++ file.mk",
+		"@@ -0,0 +1 @@",
+		"+line")
+
+	test("no newline",
+		"no newline\n",
+		"--- file.mk.orig",
+		"+++ file.mk",
+		"@@ -1 +1 @@",
+		"-no newline",
+		"\\ No newline at end of file",
+		"+no newline")
+}
+
+// Large generated files, such as configure scripts, are compared
+// without allocating memory quadratic in the number of lines.
+func (s *Suite) Test_unifiedDiff__large(c *check.C) {
+	t := s.Init(c)
+
+	var oldText, newText strings.Builder
+	for i := 0; i < 100000; i++ {
+		oldText.WriteString(sprintf("line %d\n", i))
+		if i%20000 == 10000 {
+			newText.WriteString("inserted\n")
+		}
+		newText.WriteString(sprintf("line %d\n", i))
+	}
+
+	diff := unifiedDiff("configure", oldText.String(), newText.String())
+
+	t.CheckEquals(strings.Count(diff, "\n+inserted\n"), 5)
+	t.CheckEquals(strings.Count(diff, "\n@@ "), 5)
+}
+
+func (s *Suite) Test_lineDiffer_compare(c *check.C) {
+	t := s.Init(c)
+
+	test := func(a, b string, deleted, inserted string) {
+		d := lineDiffer{
+			strings.Split(a, ""), strings.Split(b, ""),
+			make([]bool, len(a)), make([]bool, len(b))}
+
+		d.compare(0, len(a), 0, len(b))
+
+		marks := func(flags []bool, text string) string {
+			var sb strings.Builder
+			for i, flag := range flags {
+				sb.WriteByte(condStr(flag, text[i:i+1], ".")[0])
+			}
+			return sb.String()
+		}
+		t.CheckEquals(marks(d.deleted, a), deleted)
+		t.CheckEquals(marks(d.inserted, b), inserted)
+	}
+
+	test("", "",
+		"", "")
+	test("abc", "abc",
+		"...", "...")
+	test("abc", "",
+		"abc", "")
+	test("", "abc",
+		"", "abc")
+	test("abcabba", "cbabac",
+		"a.c..b.", "c....c")
+	test("abcdef", "axcyef",
+		".b.d..", ".x.y..")
+
+	// The result is a shortest edit script,
+	// which keeps the longest common subsequence.
+	lcs := func(a, b string) int {
+		table := make([][]int, len(a)+1)
+		for i := range table {
+			table[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					table[i][j] = table[i+1][j+1] + 1
+				} else {
+					table[i][j] = imax(table[i+1][j], table[i][j+1])
+				}
+			}
+		}
+		return table[0][0]
+	}
+	texts := []string{"", "a", "ab", "ba", "abcabba", "cbabac", "aaabbb",
+		"bbbaaa", "abcdefgh", "hgfedcba", "acegbdfh", "abababab"}
+	for _, a := range texts {
+		for _, b := range texts {
+			d := lineDiffer{
+				strings.Split(a, ""), strings.Split(b, ""),
+				make([]bool, len(a)), make([]bool, len(b))}
+			d.compare(0, len(a), 0, len(b))
+
+			common := 0
+			for _, deleted := range d.deleted {
+				if !deleted {
+					common++
+				}
+			}
+			t.CheckEquals(common, lcs(a, b))
+		}
+	}
+}
+
+func (s *Suite) Test_lineDiffer_middleSnake(c *check.C) {
+	t := s.Init(c)
+
+	test := func(a, b string, x0, y0, x1, y1 int) {
+		d := lineDiffer{strings.Split(a, ""), strings.Split(b, ""), nil, nil}
+
+		ax0, ay0, ax1, ay1 := d.middleSnake(0, len(a), 0, len(b))
+
+		t.CheckDeepEquals([]int{ax0, ay0, ax1, ay1}, []int{x0, y0, x1, y1})
+	}
+
+	// The example from the paper by Myers.
+	test("abcabba", "cbabac",
+		3, 2, 5, 4)
+
+	test("ab", "ba",
+		1, 0, 2, 1)
+}
+
+func (s *Suite) Test_mainFmt(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("outside/Makefile",
+		"VAR= value",
+		"LONG_VARIABLE=\tvalue")
+
+	exitCode := t.Main("fmt", "outside/Makefile")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"VAR=\t\tvalue",
+		"LONG_VARIABLE=\tvalue")
+	t.CheckFileLines("outside/Makefile",
+		"VAR= value",
+		"LONG_VARIABLE=\tvalue")
+}
+
+func (s *Suite) Test_mainFmt__list(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("formatted.mk",
+		"VAR=\tvalue")
+	t.CreateFileLines("unformatted.mk",
+		"VAR= value")
+
+	exitCode := t.Main("fmt", "-l", "formatted.mk", "unformatted.mk")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"~/unformatted.mk")
+
+	exitCode = t.Main("fmt", "-l", "formatted.mk")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_mainFmt__diff(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("filename.mk",
+		".if 1",
+		".if 2",
+		".endif",
+		".endif")
+
+	exitCode := t.Main("fmt", "-d", "filename.mk")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"--- ~/filename.mk.orig",
+		"+++ ~/filename.mk",
+		"@@ -1,4 +1,4 @@",
+		" .if 1",
+		"-.if 2",
+		"-.endif",
+		"+.  if 2",
+		"+.  endif",
+		" .endif")
+}
+
+func (s *Suite) Test_mainFmt__write(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("filename.mk",
+		"VAR= value   ")
+
+	exitCode := t.Main("fmt", "-w", "filename.mk")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputEmpty()
+	t.CheckFileLines("filename.mk",
+		"VAR=\tvalue")
+}
+
+func (s *Suite) Test_mainFmt__missing_files(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("fmt")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"ERROR: The file names are missing.")
+}
+
+func (s *Suite) Test_mainFmt__unreadable(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("filename.mk",
+		"VAR=\tvalue")
+
+	exitCode := t.Main("fmt", "nonexistent.mk", "filename.mk")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"VAR=\tvalue",
+		"ERROR: nonexistent.mk: Cannot be read.")
+}
+
+func (s *Suite) Test_mainFmt__help(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("fmt", "--help")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"usage: pkglint fmt [options] file...",
+		"",
+		"  --debug       log verbose call traces for debugging",
+		"  -d, --diff    display diffs instead of the formatted files",
+		"  -l, --list    list files whose formatting differs",
+		"  -w, --write   write the result to the files instead of stdout",
+		"  -h, --help    show a detailed usage message")
+}
@@ -0,0 +1,417 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/getopt"
+	"github.com/rillig/pkglint/v23/makepat"
+	"strings"
+)
+
+// DependencyGraph contains the dependencies between pkgsrc packages,
+// as declared in the package Makefiles and the files they include.
+//
+// See "pkglint graph".
+type DependencyGraph struct {
+	Packages []PkgsrcPath
+	Edges    []*DependencyEdge
+}
+
+// DependencyKind describes how a package depends on another package.
+type DependencyKind uint8
+
+const (
+	DkDepends DependencyKind = iota
+	DkBuildDepends
+	DkToolDepends
+	DkTestDepends
+	DkBuildlink3 // The package includes the buildlink3.mk file of the other package.
+)
+
+func (k DependencyKind) String() string {
+	return [...]string{
+		"DEPENDS",
+		"BUILD_DEPENDS",
+		"TOOL_DEPENDS",
+		"TEST_DEPENDS",
+		"buildlink3"}[k]
+}
+
+// dependencyKinds maps the variable names to the corresponding kinds.
+var dependencyKinds = map[string]DependencyKind{
+	"DEPENDS":       DkDepends,
+	"BUILD_DEPENDS": DkBuildDepends,
+	"TOOL_DEPENDS":  DkToolDepends,
+	"TEST_DEPENDS":  DkTestDepends,
+}
+
+// DependencyEdge is a single dependency from one package to another.
+type DependencyEdge struct {
+	From PkgsrcPath
+	To   PkgsrcPath
+	Kind DependencyKind
+
+	// The package pattern, such as "package>=1.0".
+	// It is empty for buildlink3.mk inclusions.
+	Pattern string
+
+	// The line that declares the dependency.
+	MkLine *MkLine
+
+	// The variables from the surrounding .if and .for directives,
+	// such as PKG_OPTIONS or OPSYS.
+	// For unconditional dependencies, this is empty.
+	Conditions []string
+
+	// The facts from the surrounding .if and .elif directives
+	// that must hold for the dependency to be active.
+	Facts []VarFact
+}
+
+// Location returns the place where the dependency is declared,
+// relative to the pkgsrc root directory, e.g. "category/package/Makefile:20".
+func (e *DependencyEdge) Location() string {
+	return sprintf("%s:%s", G.Pkgsrc.Rel(e.MkLine.Filename()), e.MkLine.Linenos())
+}
+
+func (e *DependencyEdge) IsConditional() bool { return len(e.Conditions) > 0 }
+
+// IsExclusive returns whether the two dependencies cannot be active
+// at the same time since their conditions contradict each other,
+// such as in '.if ${OPSYS} == NetBSD' and '.if ${OPSYS} == Linux'.
+//
+// Within the same package, any variable may be used to decide this.
+// Across packages, only those variables are considered that have the
+// same value in all packages, such as OPSYS or the variables from mk.conf.
+func (e *DependencyEdge) IsExclusive(other *DependencyEdge) bool {
+	samePackage := e.From == other.From
+	for _, fact := range e.Facts {
+		for _, otherFact := range other.Facts {
+			if fact.Varname != otherFact.Varname {
+				continue
+			}
+			if !samePackage {
+				vartype := G.Pkgsrc.VariableType(nil, fact.Varname)
+				if vartype == nil || !vartype.IsSystemProvided() && !vartype.IsUserSettable() {
+					continue
+				}
+			}
+			if !makepat.Intersect(fact.Pattern, otherFact.Pattern).CanMatch() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddPackage loads the package from the given directory and adds all its
+// dependencies to the graph.
+func (g *DependencyGraph) AddPackage(dir CurrPath) {
+	if trace.Tracing {
+		defer trace.Call(dir)()
+	}
+
+	pkg := NewPackage(dir)
+	files, _, allLines := pkg.load()
+	if files == nil {
+		return
+	}
+	g.Packages = append(g.Packages, pkg.Pkgpath)
+	g.collect(pkg, allLines)
+}
+
+// collect adds the dependencies that are declared in the package Makefile
+// and the files it includes.
+// The given lines must be the complete makefile of the package,
+// including all included files, as from Package.load.
+func (g *DependencyGraph) collect(pkg *Package, allLines *MkLines) {
+
+	var branches BranchConditions
+
+	add := func(mkline *MkLine, kind DependencyKind, pattern string, to PkgsrcPath) {
+		var conditions []string
+		if allLines.indentation.IsConditional() {
+			conditions = allLines.indentation.Varnames()
+		}
+		var facts []VarFact
+		for _, cond := range branches.Lines() {
+			facts = append(facts, dependencyFacts(cond, allLines)...)
+		}
+		g.Edges = append(g.Edges,
+			&DependencyEdge{pkg.Pkgpath, to, kind, pattern, mkline, conditions, facts})
+	}
+
+	handleVarassign := func(mkline *MkLine) {
+		kind, found := dependencyKinds[mkline.Varname()]
+		if !found {
+			return
+		}
+
+		resolved := resolveExprs(mkline.Value(), nil, pkg)
+		for _, dep := range mkline.ValueFields(resolved) {
+			parts := mkline.ValueSplit(dep, ":")
+			if len(parts) != 2 || containsExpr(parts[1]) || NewPath(parts[1]).IsAbs() {
+				if trace.Tracing {
+					trace.Stepf("Skipping unresolvable dependency %q.", dep)
+				}
+				continue
+			}
+			to := G.Pkgsrc.Rel(pkg.File(NewPackagePathString(parts[1])))
+			add(mkline, kind, parts[0], to)
+		}
+	}
+
+	handleInclude := func(mkline *MkLine) {
+		// Only the direct dependencies are interesting,
+		// the indirect ones come from the other packages.
+		if mkline.Basename == "buildlink3.mk" {
+			return
+		}
+
+		resolved := mkline.ResolveExprsInRelPath(mkline.IncludedFile(), pkg)
+		includedFile := NewRelPathString(resolveExprs(resolved.String(), nil, pkg))
+		if containsExpr(includedFile.String()) || !includedFile.HasSuffixPath("buildlink3.mk") {
+			return
+		}
+
+		to := G.Pkgsrc.Rel(mkline.File(includedFile)).Dir()
+		if to.Count() == 2 && to != pkg.Pkgpath {
+			add(mkline, DkBuildlink3, "", to)
+		}
+	}
+
+	allLines.ForEach(func(mkline *MkLine) {
+		switch {
+		case mkline.IsVarassign():
+			handleVarassign(mkline)
+		case mkline.IsInclude():
+			handleInclude(mkline)
+		case mkline.IsDirective():
+			branches.Track(mkline)
+		}
+	})
+}
+
+// dependencyFacts returns the facts from the condition of the directive
+// that must be true for the dependencies in its branch.
+//
+// In addition to the facts from MkCondChecker.collectFacts,
+// comparisons like '${OPSYS} == NetBSD' count as facts,
+// since these are common for platform-specific dependencies.
+func dependencyFacts(mkline *MkLine, mklines *MkLines) []VarFact {
+	facts := NewMkCondChecker(mkline, mklines).collectFacts(mkline)
+
+	addCompare := func(cmp *MkCondCompare) {
+		expr := cmp.Left.Expr
+		if expr == nil || len(expr.modifiers) != 0 || cmp.Op != "==" ||
+			cmp.Right.Expr != nil || cmp.Right.Num != "" {
+			return
+		}
+		value := cmp.Right.Str
+		if value == "" || containsExpr(value) || strings.ContainsAny(value, "*?[\\$") {
+			return
+		}
+
+		vartype := G.Pkgsrc.VariableType(mklines, expr.varname)
+		if vartype.IsList() != no {
+			return
+		}
+
+		m, err := makepat.Compile(value)
+		if err != nil {
+			return
+		}
+
+		facts = append(facts, VarFact{expr.varname, value, m, mkline})
+	}
+
+	var collect func(cond *MkCond)
+	collect = func(cond *MkCond) {
+		switch {
+		case cond == nil:
+			break
+		case cond.Compare != nil:
+			addCompare(cond.Compare)
+		case cond.Paren != nil:
+			collect(cond.Paren)
+		default:
+			for _, and := range cond.And {
+				collect(and)
+			}
+		}
+	}
+	collect(mkline.Cond())
+
+	return facts
+}
+
+// Cycles returns the dependency cycles between the packages of the graph.
+// Each cycle starts and ends at the same package.
+//
+// Cycles whose dependencies are mutually exclusive by their conditions
+// are ignored.
+// For each group of packages that depend on each other,
+// only a single cycle is returned, to keep the number of diagnostics low.
+func (g *DependencyGraph) Cycles() [][]*DependencyEdge {
+	outgoing := make(map[PkgsrcPath][]*DependencyEdge)
+	for _, e := range g.Edges {
+		outgoing[e.From] = append(outgoing[e.From], e)
+	}
+
+	var cycles [][]*DependencyEdge
+	done := make(map[PkgsrcPath]bool)
+
+	for _, start := range g.Packages {
+		if done[start] {
+			continue
+		}
+		done[start] = true
+
+		cycle := g.findCycle(start, outgoing, done)
+		if cycle == nil {
+			continue
+		}
+		cycles = append(cycles, cycle)
+		for _, e := range cycle {
+			done[e.To] = true
+		}
+	}
+	return cycles
+}
+
+// findCycle returns a path of dependencies from the start package back
+// to itself, avoiding the packages that are done already.
+func (g *DependencyGraph) findCycle(
+	start PkgsrcPath,
+	outgoing map[PkgsrcPath][]*DependencyEdge,
+	done map[PkgsrcPath]bool,
+) []*DependencyEdge {
+
+	var path []*DependencyEdge
+	visited := make(map[PkgsrcPath]bool)
+
+	compatible := func(e *DependencyEdge) bool {
+		for _, prev := range path {
+			if e.IsExclusive(prev) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var search func(from PkgsrcPath) bool
+	search = func(from PkgsrcPath) bool {
+		for _, e := range outgoing[from] {
+			if e.To != start && (done[e.To] || visited[e.To]) || !compatible(e) {
+				continue
+			}
+
+			path = append(path, e)
+			if e.To == start {
+				return true
+			}
+			visited[e.To] = true
+			if search(e.To) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+
+	if search(start) {
+		return path
+	}
+	return nil
+}
+
+// WriteDot writes the graph in the format of Graphviz.
+//
+// Conditional edges are dashed,
+// and their label lists the variables they depend on.
+func (g *DependencyGraph) WriteDot(out *SeparatorWriter) {
+	out.WriteLine("digraph dependencies {")
+	for _, pkgpath := range g.Packages {
+		out.WriteLine(sprintf("\t%q;", pkgpath.String()))
+	}
+	for _, e := range g.Edges {
+		label := e.Kind.String()
+		style := ""
+		if e.IsConditional() {
+			label += " (" + strings.Join(e.Conditions, ", ") + ")"
+			style = ", style=dashed"
+		}
+		out.WriteLine(sprintf("\t%q -> %q [label=%q%s, tooltip=%q];",
+			e.From.String(), e.To.String(), label, style, e.Location()))
+	}
+	out.WriteLine("}")
+}
+
+// WriteJSON writes the graph in JSON format,
+// to be processed by other tools.
+func (g *DependencyGraph) WriteJSON(out *SeparatorWriter) {
+	type jsonEdge struct {
+		From       string   `json:"from"`
+		To         string   `json:"to"`
+		Kind       string   `json:"kind"`
+		Pattern    string   `json:"pattern,omitempty"`
+		Location   string   `json:"location"`
+		Conditions []string `json:"conditions,omitempty"`
+	}
+	type jsonGraph struct {
+		Packages []string   `json:"packages"`
+		Edges    []jsonEdge `json:"edges"`
+	}
+
+	data := jsonGraph{[]string{}, []jsonEdge{}}
+	for _, pkgpath := range g.Packages {
+		data.Packages = append(data.Packages, pkgpath.String())
+	}
+	for _, e := range g.Edges {
+		data.Edges = append(data.Edges, jsonEdge{
+			e.From.String(), e.To.String(), e.Kind.String(),
+			e.Pattern, e.Location(), e.Conditions})
+	}
+
+	writeJSON(out, data)
+}
+
+// mainGraph implements "pkglint graph", which loads the given packages
+// and writes their dependency graph to stdout.
+func mainGraph(args []string) int {
+	p := &G
+	opts := getopt.NewOptions()
+	var format string
+	opts.AddStrVar('f', "format", &format, "dot", "output format, either dot or json")
+
+	usage := "pkglint graph [options] dir..."
+	if exitCode := p.parseCommandArgs(opts, args, usage); exitCode != -1 {
+		return exitCode
+	}
+
+	if format != "dot" && format != "json" {
+		p.Logger.TechErrorf("", "Unknown output format %q.", format)
+		return 1
+	}
+
+	p.prepareMainLoop()
+	if p.Pkgsrc == nil {
+		G.Logger.TechFatalf(p.Todo.Front(), "Must be inside a pkgsrc tree.")
+	}
+
+	var graph DependencyGraph
+	for !p.Todo.IsEmpty() {
+		for _, dir := range p.packageDirs(p.Todo.Pop()) {
+			graph.AddPackage(dir)
+		}
+	}
+
+	if format == "json" {
+		graph.WriteJSON(p.Logger.out)
+	} else {
+		graph.WriteDot(p.Logger.out)
+	}
+
+	if p.Logger.errors != 0 {
+		return 1
+	}
+	return 0
+}
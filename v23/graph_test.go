@@ -0,0 +1,485 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_DependencyKind_String(c *check.C) {
+	t := s.Init(c)
+
+	t.CheckEquals(DkDepends.String(), "DEPENDS")
+	t.CheckEquals(DkBuildDepends.String(), "BUILD_DEPENDS")
+	t.CheckEquals(DkToolDepends.String(), "TOOL_DEPENDS")
+	t.CheckEquals(DkTestDepends.String(), "TEST_DEPENDS")
+	t.CheckEquals(DkBuildlink3.String(), "buildlink3")
+}
+
+func (s *Suite) Test_DependencyEdge_Location(c *check.C) {
+	t := s.Init(c)
+
+	mkline := t.NewMkLine(t.File("category/package/Makefile"), 20,
+		"DEPENDS+=\tlib>=1.0:../../devel/lib")
+	edge := DependencyEdge{"category/package", "devel/lib", DkDepends,
+		"lib>=1.0", mkline, nil, nil}
+
+	t.CheckEquals(edge.Location(), "category/package/Makefile:20")
+}
+
+func (s *Suite) Test_DependencyEdge_IsConditional(c *check.C) {
+	t := s.Init(c)
+
+	edge := DependencyEdge{From: "category/package", To: "devel/lib"}
+
+	t.CheckEquals(edge.IsConditional(), false)
+
+	edge.Conditions = []string{"PKG_OPTIONS"}
+
+	t.CheckEquals(edge.IsConditional(), true)
+}
+
+func (s *Suite) Test_DependencyEdge_IsExclusive(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines(t.File("category/package/Makefile"),
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".endif",
+		".if ${OPSYS:MLinux}",
+		".endif",
+		".if ${OPSYS:MNet*}",
+		".endif",
+		".if ${DISTNAME} == package-1.0",
+		".endif",
+		".if ${DISTNAME} == package-2.0",
+		".endif")
+	facts := func(i int) []VarFact {
+		mkline := mklines.mklines[i]
+		return dependencyFacts(mkline, mklines)
+	}
+	edge := func(from PkgsrcPath, facts []VarFact) *DependencyEdge {
+		return &DependencyEdge{From: from, To: "devel/lib", Facts: facts}
+	}
+	test := func(a, b *DependencyEdge, expected bool) {
+		t.CheckEquals(a.IsExclusive(b), expected)
+		t.CheckEquals(b.IsExclusive(a), expected)
+	}
+
+	netbsd := edge("category/package", facts(1))
+	linux := edge("devel/other", facts(3))
+	netGlob := edge("devel/other", facts(5))
+	unconditional := edge("devel/other", nil)
+
+	test(netbsd, linux, true)
+	test(netbsd, netGlob, false)
+	test(netbsd, unconditional, false)
+
+	distname1 := edge("category/package", facts(7))
+	distname2 := edge("category/package", facts(9))
+	otherDistname2 := edge("devel/other", facts(9))
+
+	// Within the same package, all variables have the same value.
+	test(distname1, distname2, true)
+
+	// In another package, a package-defined variable may have a
+	// different value.
+	test(distname1, otherDistname2, false)
+}
+
+func (s *Suite) Test_DependencyGraph_AddPackage(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib")
+	t.SetUpPackage("devel/lib")
+	t.FinishSetUp()
+
+	var graph DependencyGraph
+	graph.AddPackage(t.File("category/package"))
+	graph.AddPackage(t.File("devel/lib"))
+
+	t.CheckDeepEquals(graph.Packages, []PkgsrcPath{"category/package", "devel/lib"})
+	t.CheckLen(graph.Edges, 1)
+	t.CheckEquals(graph.Edges[0].To, PkgsrcPath("devel/lib"))
+}
+
+func (s *Suite) Test_DependencyGraph_AddPackage__missing_Makefile(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.Remove("category/package/Makefile")
+	t.FinishSetUp()
+
+	var graph DependencyGraph
+	graph.AddPackage(t.File("category/package"))
+
+	t.CheckLen(graph.Packages, 0)
+	t.CheckOutputLines(
+		"ERROR: ~/category/package/Makefile: Cannot be read.")
+}
+
+func (s *Suite) Test_DependencyGraph_collect(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpOption("opt", "")
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib",
+		"BUILD_DEPENDS+=\tbuild-[0-9]*:../../devel/build",
+		"TOOL_DEPENDS+=\ttool-[0-9]*:../../devel/tool",
+		"TEST_DEPENDS+=\ttest-[0-9]*:../../devel/test",
+		".include \"options.mk\"",
+		".include \"../../devel/bl3/buildlink3.mk\"")
+	t.CreateFileLines("category/package/options.mk",
+		MkCvsID,
+		"",
+		"PKG_OPTIONS_VAR=\tPKG_OPTIONS.package",
+		"PKG_SUPPORTED_OPTIONS=\topt",
+		"",
+		".include \"../../mk/bsd.options.mk\"",
+		"",
+		".if ${PKG_OPTIONS:Mopt}",
+		".  include \"../../devel/opt/buildlink3.mk\"",
+		".endif")
+	t.CreateFileLines("mk/bsd.options.mk",
+		MkCvsID)
+	t.CreateFileBuildlink3("devel/bl3/buildlink3.mk",
+		".include \"../../devel/indirect/buildlink3.mk\"")
+	t.CreateFileBuildlink3("devel/opt/buildlink3.mk")
+	t.CreateFileBuildlink3("devel/indirect/buildlink3.mk")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+	var graph DependencyGraph
+	graph.collect(pkg, allLines)
+
+	var edges []string
+	for _, e := range graph.Edges {
+		edges = append(edges, sprintf("%s %s %q %s %v",
+			e.To, e.Kind, e.Pattern, e.Location(), e.Conditions))
+	}
+	t.CheckDeepEquals(edges, []string{
+		"devel/lib DEPENDS \"lib>=1.0\" category/package/Makefile:20 []",
+		"devel/build BUILD_DEPENDS \"build-[0-9]*\" category/package/Makefile:21 []",
+		"devel/tool TOOL_DEPENDS \"tool-[0-9]*\" category/package/Makefile:22 []",
+		"devel/test TEST_DEPENDS \"test-[0-9]*\" category/package/Makefile:23 []",
+		"devel/opt buildlink3 \"\" category/package/options.mk:9 [PKG_OPTIONS]",
+		"devel/bl3 buildlink3 \"\" category/package/Makefile:25 []"})
+}
+
+func (s *Suite) Test_DependencyGraph_collect__unresolvable(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tlib>=1.0:${UNKNOWN_DIR}",
+		"DEPENDS+=\tmissing-path",
+		"DEPENDS+=\tdep>=1.0:${DEP_DIR}",
+		"DEP_DIR=\t../../devel/dep")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+	var graph DependencyGraph
+	graph.collect(pkg, allLines)
+
+	t.CheckLen(graph.Edges, 1)
+	t.CheckEquals(graph.Edges[0].To, PkgsrcPath("devel/dep"))
+}
+
+func (s *Suite) Test_DependencyGraph_collect__facts(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		".if ${OPSYS} == NetBSD",
+		".  for dep in lib",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib",
+		".  endfor",
+		".elif ${OPSYS:MLinux} && ${MACHINE_ARCH} == x86_64",
+		"DEPENDS+=\tlinux>=1.0:../../devel/linux",
+		".else",
+		"DEPENDS+=\tother>=1.0:../../devel/other",
+		".endif",
+		"DEPENDS+=\tall>=1.0:../../devel/all")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+	var graph DependencyGraph
+	graph.collect(pkg, allLines)
+
+	var edges []string
+	for _, e := range graph.Edges {
+		var facts []string
+		for _, fact := range e.Facts {
+			facts = append(facts, fact.Varname+"="+fact.PatternText)
+		}
+		edges = append(edges, sprintf("%s %v", e.To, facts))
+	}
+	t.CheckDeepEquals(edges, []string{
+		"devel/lib [OPSYS=NetBSD]",
+		"devel/linux [OPSYS=Linux MACHINE_ARCH=x86_64]",
+		"devel/other []",
+		"devel/all []"})
+}
+
+func (s *Suite) Test_dependencyFacts(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD && (${MACHINE_ARCH} == x86_64)",
+		".endif",
+		".if ${OPSYS:MLinux} && ${OS_VERSION} == ${PKGVERSION}",
+		".endif",
+		".if ${OPSYS} == NetBSD || ${OPSYS} == Linux",
+		".endif",
+		".if ${OPSYS} != NetBSD && ${OPSYS:tl} == linux && ${OPSYS} == \"Net*\"",
+		".endif")
+	test := func(i int, expected ...string) {
+		mkline := mklines.mklines[i]
+		var actual []string
+		for _, fact := range dependencyFacts(mkline, mklines) {
+			actual = append(actual, fact.Varname+"="+fact.PatternText)
+		}
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	test(1, "OPSYS=NetBSD", "MACHINE_ARCH=x86_64")
+	test(3, "OPSYS=Linux")
+
+	// In a disjunction, neither of the comparisons is a fact.
+	test(5, nil...)
+
+	// Only plain comparisons for equality are facts.
+	test(7, nil...)
+}
+
+func (s *Suite) Test_DependencyGraph_Cycles(c *check.C) {
+	t := s.Init(c)
+
+	edge := func(from, to PkgsrcPath) *DependencyEdge {
+		return &DependencyEdge{From: from, To: to}
+	}
+	graph := DependencyGraph{
+		[]PkgsrcPath{"a/a", "b/b", "c/c", "d/d", "e/e"},
+		[]*DependencyEdge{
+			edge("a/a", "b/b"),
+			edge("b/b", "c/c"),
+			edge("c/c", "a/a"),
+			edge("c/c", "b/b"),
+			edge("d/d", "d/d"),
+			edge("e/e", "a/a"),
+			edge("e/e", "unchecked/package")}}
+
+	var cycles []string
+	for _, cycle := range graph.Cycles() {
+		path := cycle[0].From.String()
+		for _, e := range cycle {
+			path += " -> " + e.To.String()
+		}
+		cycles = append(cycles, path)
+	}
+
+	// The cycle b -> c -> b is not reported separately since b and c
+	// are already part of the cycle starting at a.
+	t.CheckDeepEquals(cycles, []string{
+		"a/a -> b/b -> c/c -> a/a",
+		"d/d -> d/d"})
+}
+
+func (s *Suite) Test_DependencyGraph_findCycle(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines(t.File("category/package/Makefile"),
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".endif",
+		".if ${OPSYS} == Linux",
+		".endif")
+	facts := func(i int) []VarFact {
+		mkline := mklines.mklines[i]
+		return dependencyFacts(mkline, mklines)
+	}
+	edge := func(from, to PkgsrcPath, facts []VarFact) *DependencyEdge {
+		return &DependencyEdge{From: from, To: to, Facts: facts}
+	}
+	graph := DependencyGraph{
+		[]PkgsrcPath{"a/a", "b/b", "c/c"},
+		[]*DependencyEdge{
+			edge("a/a", "b/b", facts(1)),
+			edge("b/b", "a/a", facts(3)),
+			edge("b/b", "c/c", nil),
+			edge("c/c", "a/a", facts(1))}}
+	outgoing := make(map[PkgsrcPath][]*DependencyEdge)
+	for _, e := range graph.Edges {
+		outgoing[e.From] = append(outgoing[e.From], e)
+	}
+
+	cycle := graph.findCycle("a/a", outgoing, map[PkgsrcPath]bool{})
+
+	// The direct way back from b to a is only active on Linux,
+	// while the dependency from a to b is only active on NetBSD.
+	t.CheckDeepEquals(cycle, []*DependencyEdge{
+		graph.Edges[0], graph.Edges[2], graph.Edges[3]})
+
+	cycle = graph.findCycle("a/a", outgoing, map[PkgsrcPath]bool{"c/c": true})
+
+	t.CheckNil(cycle)
+}
+
+func (s *Suite) Test_DependencyGraph_WriteDot(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines(t.File("category/package/Makefile"),
+		"DEPENDS+=\tlib>=1.0:../../devel/lib",
+		".include \"../../devel/opt/buildlink3.mk\"")
+	graph := DependencyGraph{
+		[]PkgsrcPath{"category/package"},
+		[]*DependencyEdge{
+			{"category/package", "devel/lib", DkDepends,
+				"lib>=1.0", mklines.mklines[0], nil, nil},
+			{"category/package", "devel/opt", DkBuildlink3,
+				"", mklines.mklines[1], []string{"PKG_OPTIONS", "OPSYS"}, nil}}}
+
+	graph.WriteDot(G.Logger.out)
+
+	t.CheckOutputLines(
+		"digraph dependencies {",
+		"\t\"category/package\";",
+		"\t\"category/package\" -> \"devel/lib\" "+
+			"[label=\"DEPENDS\", tooltip=\"category/package/Makefile:1\"];",
+		"\t\"category/package\" -> \"devel/opt\" "+
+			"[label=\"buildlink3 (PKG_OPTIONS, OPSYS)\", style=dashed, "+
+			"tooltip=\"category/package/Makefile:2\"];",
+		"}")
+}
+
+func (s *Suite) Test_DependencyGraph_WriteJSON(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines(t.File("category/package/Makefile"),
+		"DEPENDS+=\tlib>=1.0:../../devel/lib",
+		".include \"../../devel/opt/buildlink3.mk\"")
+	graph := DependencyGraph{
+		[]PkgsrcPath{"category/package"},
+		[]*DependencyEdge{
+			{"category/package", "devel/lib", DkDepends,
+				"lib>=1.0", mklines.mklines[0], nil, nil},
+			{"category/package", "devel/opt", DkBuildlink3,
+				"", mklines.mklines[1], []string{"PKG_OPTIONS"}, nil}}}
+
+	graph.WriteJSON(G.Logger.out)
+
+	t.CheckOutputLines(
+		"{",
+		"\t\"packages\": [",
+		"\t\t\"category/package\"",
+		"\t],",
+		"\t\"edges\": [",
+		"\t\t{",
+		"\t\t\t\"from\": \"category/package\",",
+		"\t\t\t\"to\": \"devel/lib\",",
+		"\t\t\t\"kind\": \"DEPENDS\",",
+		"\t\t\t\"pattern\": \"lib>=1.0\",",
+		"\t\t\t\"location\": \"category/package/Makefile:1\"",
+		"\t\t},",
+		"\t\t{",
+		"\t\t\t\"from\": \"category/package\",",
+		"\t\t\t\"to\": \"devel/opt\",",
+		"\t\t\t\"kind\": \"buildlink3\",",
+		"\t\t\t\"location\": \"category/package/Makefile:2\",",
+		"\t\t\t\"conditions\": [",
+		"\t\t\t\t\"PKG_OPTIONS\"",
+		"\t\t\t]",
+		"\t\t}",
+		"\t]",
+		"}")
+}
+
+func (s *Suite) Test_DependencyGraph_WriteJSON__empty(c *check.C) {
+	t := s.Init(c)
+
+	var graph DependencyGraph
+
+	graph.WriteJSON(G.Logger.out)
+
+	t.CheckOutputLines(
+		"{",
+		"\t\"packages\": [],",
+		"\t\"edges\": []",
+		"}")
+}
+
+func (s *Suite) Test_mainGraph(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib")
+	t.SetUpPackage("devel/lib")
+
+	exitCode := t.Main("graph", "category")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"digraph dependencies {",
+		"\t\"category/package\";",
+		"\t\"category/package\" -> \"devel/lib\" "+
+			"[label=\"DEPENDS\", tooltip=\"category/package/Makefile:20\"];",
+		"}")
+}
+
+func (s *Suite) Test_mainGraph__json(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+
+	exitCode := t.Main("graph", "--format=json", "category/package")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"{",
+		"\t\"packages\": [",
+		"\t\t\"category/package\"",
+		"\t],",
+		"\t\"edges\": []",
+		"}")
+}
+
+func (s *Suite) Test_mainGraph__unknown_format(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("graph", "--format=svg", ".")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"ERROR: Unknown output format \"svg\".")
+}
+
+func (s *Suite) Test_mainGraph__help(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("graph", "--help")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"usage: pkglint graph [options] dir...",
+		"",
+		"  -f, --format   output format, either dot or json",
+		"  -d, --debug    log verbose call traces for debugging",
+		"  -h, --help     show a detailed usage message")
+}
+
+func (s *Suite) Test_mainGraph__outside_pkgsrc(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("filename.mk",
+		MkCvsID)
+
+	exitCode := t.Main("graph", "filename.mk")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"ERROR: ~/filename.mk: Cannot check directories outside a pkgsrc tree.",
+		"digraph dependencies {",
+		"}")
+}
@@ -0,0 +1,103 @@
+package pkglint
+
+// LoadTimeOrderChecker checks that no variable is modified after it has
+// been used at load time, for example in an .if or .for directive or in
+// a := assignment.
+//
+// At that point, the value of the variable has already been used, and
+// any later modification has no effect on the earlier decisions.
+// Such bugs depend on the order in which the files are included,
+// which makes them hard to spot in the individual files.
+//
+// The check covers the whole include sequence of a package, including
+// the files from the pkgsrc infrastructure, as far as pkglint loads them.
+// It doesn't look into mk/bsd.prefs.mk and mk/bsd.pkg.mk though.
+type LoadTimeOrderChecker struct {
+	mklines *MkLines
+
+	// The first line in which each variable is used at load time.
+	used map[string]*MkLine
+
+	// IsRelevant returns whether a warning for the given line should be
+	// reported. The other lines are only used for collecting the uses.
+	IsRelevant func(mkline *MkLine) bool
+}
+
+func NewLoadTimeOrderChecker(mklines *MkLines) *LoadTimeOrderChecker {
+	return &LoadTimeOrderChecker{
+		mklines,
+		make(map[string]*MkLine),
+		func(mkline *MkLine) bool { return true }}
+}
+
+func (ck *LoadTimeOrderChecker) Check() {
+	ck.mklines.ForEach(func(mkline *MkLine) {
+		if mkline.IsVarassign() {
+			ck.checkVarassign(mkline, ck.mklines.indentation)
+		}
+		ck.collectUses(mkline)
+	})
+}
+
+// checkVarassign warns if the variable has been used at load time before.
+func (ck *LoadTimeOrderChecker) checkVarassign(mkline *MkLine, ind *Indentation) {
+	varname := mkline.Varname()
+	use := ck.used[varname]
+	if use == nil || containsExpr(varname) || !ck.IsRelevant(mkline) {
+		return
+	}
+
+	// Multiple-inclusion guards are set after they are checked.
+	if hasSuffix(varname, "_MK") {
+		return
+	}
+
+	// Already covered by Package.checkUseLanguagesCompilerMk,
+	// which has a more specific explanation.
+	if varname == "USE_LANGUAGES" {
+		return
+	}
+
+	// In a typical guard like ".if !defined(VAR)" or ".if empty(VAR)",
+	// the variable is intentionally modified after it has been used.
+	if ind.DependsOn(varname) {
+		return
+	}
+
+	mkline.Warnf("%s is modified here, but it has already been used at load time in %s.",
+		varname, mkline.RelMkLine(use))
+	mkline.Explain(
+		"Expressions in .if and .for directives, in := assignments",
+		"and in != assignments are evaluated when the makefile is loaded.",
+		"Modifying a variable after such an expression has been evaluated",
+		"doesn't affect that expression anymore,",
+		"so the variable may have different values in different places.",
+		"",
+		"To fix this, move the assignment before the first use of the variable,",
+		"for example before including bsd.prefs.mk or another file",
+		"from the pkgsrc infrastructure.")
+}
+
+// collectUses remembers the variables that are used at load time
+// in the given line.
+func (ck *LoadTimeOrderChecker) collectUses(mkline *MkLine) {
+	use := func(expr *MkExpr, time EctxTime) {
+		if ck.used[expr.varname] == nil {
+			ck.used[expr.varname] = mkline
+		}
+	}
+
+	switch {
+	case mkline.IsVarassign():
+		switch mkline.Op() {
+		case opAssignEval, opAssignShell:
+			mkline.ForEachUsedText(mkline.Value(), EctxLoadTime, use)
+		}
+
+	case mkline.IsDirective():
+		switch mkline.Directive() {
+		case "if", "elif", "for":
+			mkline.ForEachUsed(use)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_NewLoadTimeOrderChecker(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID)
+
+	ck := NewLoadTimeOrderChecker(mklines)
+
+	t.CheckLen(ck.used, 0)
+	t.CheckEquals(ck.IsRelevant(mklines.mklines[0]), true)
+}
+
+func (s *Suite) Test_LoadTimeOrderChecker_Check(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${PKGSRC_RUN_TEST:Uno} == yes",
+		".endif",
+		"PKGSRC_RUN_TEST=\tyes")
+
+	NewLoadTimeOrderChecker(mklines).Check()
+
+	t.CheckOutputLines(
+		"WARN: filename.mk:4: PKGSRC_RUN_TEST is modified here, "+
+			"but it has already been used at load time in line 2.",
+		"",
+		"\tExpressions in .if and .for directives, in := assignments and in !=",
+		"\tassignments are evaluated when the makefile is loaded. Modifying a",
+		"\tvariable after such an expression has been evaluated doesn't affect",
+		"\tthat expression anymore, so the variable may have different values",
+		"\tin different places.",
+		"",
+		"\tTo fix this, move the assignment before the first use of the",
+		"\tvariable, for example before including bsd.prefs.mk or another file",
+		"\tfrom the pkgsrc infrastructure.",
+		"")
+}
+
+// The check covers the whole include sequence of a package.
+// The pkgsrc infrastructure uses BUILD_DEFS at load time,
+// therefore the package must not modify it afterwards.
+func (s *Suite) Test_LoadTimeOrderChecker_Check__package(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("mk/pkg-build-options.mk",
+		MkCvsID,
+		"",
+		".for var in ${BUILD_DEFS}",
+		".endfor")
+	t.SetUpPackage("category/package",
+		"BUILD_DEFS+=\tVARBASE",
+		".include \"../../mk/pkg-build-options.mk\"",
+		"BUILD_DEFS+=\tPKG_SYSCONFDIR",
+		"",
+		".include \"late.mk\"")
+	t.CreateFileLines("category/package/late.mk",
+		MkCvsID,
+		"",
+		"BUILD_DEFS+=\tVARBASE")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.checkdirPackage(".")
+
+	t.CheckOutputLines(
+		"WARN: Makefile:22: BUILD_DEFS is modified here, "+
+			"but it has already been used at load time "+
+			"in ../../mk/pkg-build-options.mk:3.",
+		"WARN: late.mk:3: BUILD_DEFS is modified here, "+
+			"but it has already been used at load time "+
+			"in ../../mk/pkg-build-options.mk:3.")
+}
+
+// Assignments in the pkgsrc infrastructure are only checked with -Cglobal,
+// just like in RedundantScope.
+func (s *Suite) Test_LoadTimeOrderChecker_Check__infrastructure(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("mk/late.mk",
+		MkCvsID,
+		"",
+		".if ${LATE_VAR:Uno} == yes",
+		".endif",
+		"LATE_VAR=\tyes")
+	t.SetUpPackage("category/package",
+		".include \"../../mk/late.mk\"")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.checkdirPackage(".")
+
+	t.CheckOutputEmpty()
+
+	t.SetUpCommandLine("-Wall", "-Cglobal")
+
+	G.checkdirPackage(".")
+
+	t.CheckOutputLines(
+		"WARN: ../../mk/late.mk:5: LATE_VAR is modified here, " +
+			"but it has already been used at load time in line 3.")
+}
+
+func (s *Suite) Test_LoadTimeOrderChecker_checkVarassign(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if !defined(GUARDED)",
+		"GUARDED=\tdefault",
+		".endif",
+		".if !defined(FILENAME_MK)",
+		"FILENAME_MK:=\t# defined",
+		".endif",
+		"",
+		".if ${OPSYS} == NetBSD",
+		"USE_LANGUAGES+=\tc++",
+		"VAR.${OPSYS}=\tvalue",
+		".endif",
+		"OPSYS=\tOverwritten",
+		"UNUSED=\tvalue")
+
+	NewLoadTimeOrderChecker(mklines).Check()
+
+	// The variables from the guards are not reported,
+	// and neither are the variables whose names are not known.
+	// USE_LANGUAGES is not used at load time in this file,
+	// therefore it is not reported either.
+	t.CheckOutputLines(
+		"WARN: filename.mk:13: OPSYS is modified here, " +
+			"but it has already been used at load time in line 9.")
+}
+
+func (s *Suite) Test_LoadTimeOrderChecker_checkVarassign__irrelevant(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".endif",
+		"OPSYS=\tOverwritten")
+
+	ck := NewLoadTimeOrderChecker(mklines)
+	ck.IsRelevant = func(mkline *MkLine) bool { return false }
+	ck.Check()
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_LoadTimeOrderChecker_collectUses(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		"EVAL:=\t${EVAL_VALUE}",
+		"SHELL_CMD!=\techo ${SHELL_VALUE}",
+		"ASSIGN=\t${ASSIGN_VALUE}",
+		".if ${COND:M${PATTERN}}",
+		".elif defined(DEFINED)",
+		".endif",
+		".for i in ${FOR_VALUE}",
+		".endfor",
+		".info ${INFO_VALUE}",
+		"target: ${TARGET_VALUE}")
+
+	ck := NewLoadTimeOrderChecker(mklines)
+	mklines.ForEach(ck.collectUses)
+
+	// Only the uses in .if, .elif and .for directives and in
+	// := and != assignments are collected.
+	uses := make(map[string]bool)
+	for varname, mkline := range ck.used {
+		uses[varname+":"+mkline.Linenos()] = true
+	}
+	t.CheckDeepEquals(keysSorted(uses), []string{
+		"COND:5",
+		"DEFINED:6",
+		"EVAL_VALUE:2",
+		"FOR_VALUE:8",
+		"PATTERN:5",
+		"SHELL_VALUE:3"})
+}
@@ -0,0 +1,430 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/makepat"
+	"strings"
+)
+
+// MkCondBranchChecker finds branches of .if/.elif/.else chains that are
+// never taken, as well as nested conditions that merely repeat or
+// contradict an enclosing condition.
+//
+// In contrast to MkCondChecker.checkContradictions, which only looks at
+// the facts that must hold in a single branch, this checker also uses
+// the knowledge that the earlier branches of the same chain have not
+// been taken.
+type MkCondBranchChecker struct {
+	MkLines *MkLines
+}
+
+func NewMkCondBranchChecker(mklines *MkLines) *MkCondBranchChecker {
+	return &MkCondBranchChecker{mklines}
+}
+
+func (ck *MkCondBranchChecker) Check() {
+	if ck.MkLines.stmts == nil {
+		return
+	}
+	ck.checkStmt(ck.MkLines.stmts, nil)
+}
+
+// checkStmt checks the chains of conditions in the given statement,
+// given the atoms that are known to hold at this point.
+func (ck *MkCondBranchChecker) checkStmt(stmt MkStmt, context []*condAtom) {
+	switch stmt := stmt.(type) {
+	case *MkStmtBlock:
+		for _, sub := range *stmt {
+			ck.checkStmt(sub, context)
+			context = ck.forget(context, sub)
+		}
+	case *MkStmtCond:
+		ck.checkCond(stmt, context)
+	case *MkStmtLoop:
+		// The loop body may modify the variables before the
+		// next iteration, therefore the whole body is inspected
+		// before looking at the first nested statement.
+		context = ck.forget(context, stmt.Body)
+		if m, vars, _ := match2(stmt.Head.Args(), `^([^\t ]+(?:[\t ]*[^\t ]+)*?)[\t ]+in[\t ]+(.*)$`); m {
+			for _, forvar := range strings.Fields(vars) {
+				context = ck.forgetVar(context, forvar)
+			}
+		}
+		ck.checkStmt(stmt.Body, context)
+	}
+}
+
+// forget removes the atoms about those variables that may be modified
+// by the given statement.
+func (ck *MkCondBranchChecker) forget(context []*condAtom, stmt MkStmt) []*condAtom {
+	WalkMkStmt(stmt, MkStmtCallback{
+		Line: func(mkline *MkLine) {
+			switch {
+			case mkline.IsVarassign():
+				context = ck.forgetVar(context, mkline.Varname())
+			case mkline.IsInclude(), mkline.IsSysinclude():
+				context = nil
+			}
+		}})
+	return context
+}
+
+// forgetVar removes the atoms about the given variable.
+func (ck *MkCondBranchChecker) forgetVar(context []*condAtom, varname string) []*condAtom {
+	if containsExpr(varname) {
+		return nil
+	}
+
+	var remaining []*condAtom
+	for _, atom := range context {
+		if atom.varname != varname {
+			remaining = append(remaining, atom)
+		}
+	}
+	return remaining
+}
+
+// checkCond checks the branches of a single .if/.elif/.else chain.
+//
+// Each branch is only taken if none of the earlier branches has been
+// taken, therefore the negation of each earlier condition is known to
+// hold in the later branches, as far as it can be expressed as an atom.
+func (ck *MkCondBranchChecker) checkCond(cond *MkStmtCond, context []*condAtom) {
+	branchContext := context
+
+	// The earlier branch that is always taken, if any.
+	var always *MkLine
+
+	for i, mkline := range cond.Conds {
+		branch := cond.Branches[i]
+
+		if always != nil {
+			ck.warnUnreachable(mkline, always,
+				"This branch is unreachable since the condition %q from %s is always true there.",
+				always.Args(), mkline.RelMkLine(always))
+			continue
+		}
+
+		if !mkline.NeedsCond() {
+			ck.checkStmt(branch, branchContext)
+			continue
+		}
+
+		atoms, complete := ck.atoms(mkline)
+		if ck.checkEarlier(mkline, cond.Conds[:i]) || ck.checkContext(mkline, atoms, branchContext) {
+			continue
+		}
+
+		if complete && ck.impliedBy(mkline, branchContext) != nil {
+			if i == 0 {
+				ck.noteRepeated(mkline, branchContext)
+			}
+			always = mkline
+		}
+
+		ck.checkStmt(branch, append(append([]*condAtom(nil), branchContext...), atoms...))
+
+		if complete && len(atoms) == 1 {
+			branchContext = append(append([]*condAtom(nil), branchContext...), atoms[0].negate())
+		}
+	}
+}
+
+// checkEarlier warns if the condition of an .elif branch implies the
+// condition of an earlier branch of the same chain, which makes it
+// unreachable.
+func (ck *MkCondBranchChecker) checkEarlier(mkline *MkLine, earlier []*MkLine) bool {
+	atoms, _ := ck.atoms(mkline)
+
+	for _, prev := range earlier {
+		prevAtoms, complete := ck.atoms(prev)
+		if !complete || len(prevAtoms) == 0 || !ck.impliesAll(atoms, prevAtoms) {
+			continue
+		}
+
+		ck.warnUnreachable(mkline, prev,
+			"This branch is unreachable since its condition implies %q from %s.",
+			prev.Args(), mkline.RelMkLine(prev))
+		return true
+	}
+	return false
+}
+
+// checkContext warns if the condition contradicts one of the atoms
+// that are known to hold, which makes the branch unreachable.
+func (ck *MkCondBranchChecker) checkContext(mkline *MkLine, atoms []*condAtom, context []*condAtom) bool {
+	for _, atom := range atoms {
+		for _, known := range context {
+			if !atom.contradicts(known) {
+				continue
+			}
+
+			// Contradictions between two positive patterns are already
+			// reported by MkCondChecker.checkContradictions.
+			if !atom.negated && !known.negated && !known.inverted && atom.pattern != nil {
+				return true
+			}
+
+			verb := condStr(known.inverted, "implies", "contradicts")
+			ck.warnUnreachable(mkline, known.mkline,
+				"This branch is unreachable since its condition "+verb+" %q from %s.",
+				known.mkline.Args(), mkline.RelMkLine(known.mkline))
+			return true
+		}
+	}
+	return false
+}
+
+// noteRepeated notes that the condition of a nested .if is already
+// decided by the enclosing conditions.
+func (ck *MkCondBranchChecker) noteRepeated(mkline *MkLine, context []*condAtom) {
+	known := ck.impliedBy(mkline, context)
+	mkline.Notef("The condition %q is always true here since it is implied by %q from %s.",
+		mkline.Args(), known.mkline.Args(), mkline.RelMkLine(known.mkline))
+	mkline.Explain(
+		"The enclosing conditions already make sure that this condition",
+		"is satisfied, therefore it can be removed.")
+}
+
+// warnUnreachable reports a branch that is never taken because of the
+// condition in the given earlier line.
+//
+// With -Cplatforms, conditions on the platform are left to the
+// PlatformChecker, which would otherwise report the same branch again.
+func (ck *MkCondBranchChecker) warnUnreachable(mkline *MkLine, earlier *MkLine, format string, args ...interface{}) {
+	if G.CheckPlatforms && ck.MkLines.pkg != nil {
+		var platforms PlatformChecker
+		if platforms.mentionsPlatform(mkline) || platforms.mentionsPlatform(earlier) {
+			return
+		}
+	}
+
+	mkline.Warnf(format, args...)
+	ck.explain(mkline)
+}
+
+func (ck *MkCondBranchChecker) explain(mkline *MkLine) {
+	mkline.Explain(
+		"In a chain of .if, .elif and .else, each branch is only tried",
+		"if none of the earlier branches has been taken.",
+		"Nested conditions are only evaluated if the enclosing",
+		"conditions are satisfied.",
+		"",
+		"Since the earlier conditions already decide the outcome,",
+		"the code in this branch is never used.",
+		"Either remove it or fix the conditions.")
+}
+
+// impliedBy returns an atom from the context that contributes to the
+// condition of the given line being always true, or nil if the
+// condition is not known to be always true.
+func (ck *MkCondBranchChecker) impliedBy(mkline *MkLine, context []*condAtom) *condAtom {
+	atoms, complete := ck.atoms(mkline)
+	if !complete || len(atoms) == 0 {
+		return nil
+	}
+
+	var first *condAtom
+	for _, atom := range atoms {
+		var found *condAtom
+		for _, known := range context {
+			if known.implies(atom) {
+				found = known
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		if first == nil {
+			first = found
+		}
+	}
+	return first
+}
+
+// impliesAll returns whether the atoms on the left side, taken
+// together, imply each of the atoms on the right side.
+func (ck *MkCondBranchChecker) impliesAll(left []*condAtom, right []*condAtom) bool {
+	for _, r := range right {
+		implied := false
+		for _, l := range left {
+			if l.implies(r) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return false
+		}
+	}
+	return true
+}
+
+// atoms returns the basic conditions that must all be true for the
+// condition of the given .if or .elif line to be true.
+//
+// If the condition consists of these atoms and nothing else,
+// complete is true.
+func (ck *MkCondBranchChecker) atoms(mkline *MkLine) (atoms []*condAtom, complete bool) {
+	switch mkline.Directive() {
+	case "if", "elif":
+		break
+	default:
+		return nil, false
+	}
+
+	complete = true
+	var collect func(cond *MkCond)
+	collect = func(cond *MkCond) {
+		switch {
+		case cond == nil:
+			complete = false
+		case cond.And != nil:
+			for _, sub := range cond.And {
+				collect(sub)
+			}
+		case cond.Paren != nil:
+			collect(cond.Paren)
+		default:
+			atom := ck.atom(cond, mkline)
+			if atom != nil {
+				atoms = append(atoms, atom)
+			} else {
+				complete = false
+			}
+		}
+	}
+	collect(mkline.Cond())
+	return
+}
+
+// atom converts a basic condition about a single variable to an atom,
+// or returns nil if the condition is too complicated.
+func (ck *MkCondBranchChecker) atom(cond *MkCond, mkline *MkLine) *condAtom {
+	newPattern := func(expr *MkExpr, pattern string, negated bool) *condAtom {
+		vartype := G.Pkgsrc.VariableType(ck.MkLines, expr.varname)
+		if vartype.IsList() != no || containsExpr(pattern) {
+			return nil
+		}
+		m, err := makepat.Compile(pattern)
+		if err != nil {
+			return nil
+		}
+		return &condAtom{expr.varname, pattern, m, negated, false, mkline}
+	}
+
+	newMatch := func(expr *MkExpr, negated bool) *condAtom {
+		if expr == nil || len(expr.modifiers) != 1 {
+			return nil
+		}
+		ok, positive, pattern, _ := expr.modifiers[0].MatchMatch()
+		if !ok {
+			return nil
+		}
+		return newPattern(expr, pattern, negated == positive)
+	}
+
+	switch {
+	case cond.Defined != "":
+		if containsExpr(cond.Defined) {
+			return nil
+		}
+		return &condAtom{cond.Defined, "", nil, false, false, mkline}
+
+	case cond.Not != nil:
+		if atom := ck.atom(cond.Not, mkline); atom != nil {
+			atom.negated = !atom.negated
+			return atom
+		}
+
+	case cond.Empty != nil:
+		return newMatch(cond.Empty, true)
+
+	case cond.Term != nil:
+		return newMatch(cond.Term.Expr, false)
+
+	case cond.Compare != nil:
+		cmp := cond.Compare
+		expr := cmp.Left.Expr
+		if expr == nil || len(expr.modifiers) != 0 ||
+			cmp.Op != "==" && cmp.Op != "!=" ||
+			cmp.Right.Expr != nil || cmp.Right.Num != "" {
+			return nil
+		}
+		value := cmp.Right.Str
+		if value == "" || strings.ContainsAny(value, "*?[\\") {
+			return nil
+		}
+		return newPattern(expr, value, cmp.Op == "!=")
+
+	case cond.Paren != nil:
+		return ck.atom(cond.Paren, mkline)
+	}
+	return nil
+}
+
+// condAtom is a basic condition about a single variable,
+// such as ${OPSYS} == NetBSD, ${MACHINE_ARCH:Mx86_64} or defined(VAR).
+type condAtom struct {
+	varname string
+
+	// The pattern that the value of the variable is matched against.
+	// For defined(VAR), the pattern is nil.
+	patternText string
+	pattern     *makepat.Pattern
+
+	negated bool
+
+	// Whether the atom has been derived from an earlier branch that was
+	// not taken. In that case, negated is the opposite of the condition
+	// that is written in the line.
+	inverted bool
+
+	mkline *MkLine
+}
+
+// negate returns the atom that holds if the given atom doesn't hold.
+func (a *condAtom) negate() *condAtom {
+	return &condAtom{a.varname, a.patternText, a.pattern, !a.negated, !a.inverted, a.mkline}
+}
+
+// implies returns whether the other atom is known to hold if this atom
+// holds.
+func (a *condAtom) implies(other *condAtom) bool {
+	if a.varname != other.varname || (a.pattern == nil) != (other.pattern == nil) {
+		return false
+	}
+	if a.pattern == nil {
+		return a.negated == other.negated
+	}
+
+	switch {
+	case !a.negated && !other.negated:
+		return a.subsetOf(other)
+	case a.negated && other.negated:
+		return other.subsetOf(a)
+	case !a.negated && other.negated:
+		return !makepat.Intersect(a.pattern, other.pattern).CanMatch()
+	}
+	return false
+}
+
+// contradicts returns whether the two atoms cannot hold at the same time.
+func (a *condAtom) contradicts(other *condAtom) bool {
+	return a.implies(other.negate())
+}
+
+// subsetOf returns whether each string that matches this pattern also
+// matches the other pattern.
+//
+// This is only decided for literal strings, which are by far the most
+// common case in the pkgsrc infrastructure.
+func (a *condAtom) subsetOf(other *condAtom) bool {
+	if a.patternText == other.patternText {
+		return true
+	}
+	if strings.ContainsAny(a.patternText, "*?[\\") {
+		return false
+	}
+	return other.pattern.Match(a.patternText)
+}
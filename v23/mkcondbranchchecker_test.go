@@ -0,0 +1,562 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/makepat"
+	"gopkg.in/check.v1"
+	"strings"
+)
+
+func (s *Suite) Test_NewMkCondBranchChecker(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID)
+
+	ck := NewMkCondBranchChecker(mklines)
+
+	t.CheckEquals(ck.MkLines, mklines)
+}
+
+func (s *Suite) Test_MkCondBranchChecker_Check(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".elif ${OPSYS} == Linux",
+		".elif ${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64",
+		".elif ${OPSYS:MNet*}",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	// The patterns in line 5 are not literal,
+	// therefore pkglint cannot decide whether the branch is reachable.
+	t.CheckOutputLines(
+		"WARN: filename.mk:4: This branch is unreachable " +
+			"since its condition implies \"${OPSYS} == NetBSD\" from line 2.")
+}
+
+// If the .if and .endif are not balanced, the check is skipped.
+func (s *Suite) Test_MkCondBranchChecker_Check__unbalanced(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".elif ${OPSYS} == NetBSD")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_MkCondBranchChecker_checkStmt(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} != NetBSD",
+		".  if ${OPSYS} == NetBSD",
+		".  endif",
+		".  for i in 1 2 3",
+		".    if ${OPSYS} == NetBSD",
+		".    endif",
+		".  endfor",
+		"OPSYS=\tNetBSD",
+		".  if ${OPSYS} == NetBSD",
+		".  endif",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	// In line 9, OPSYS has been modified,
+	// therefore the condition from line 2 doesn't apply anymore.
+	t.CheckOutputLines(
+		"WARN: filename.mk:3: This branch is unreachable "+
+			"since its condition contradicts \"${OPSYS} != NetBSD\" from line 2.",
+		"WARN: filename.mk:6: This branch is unreachable "+
+			"since its condition contradicts \"${OPSYS} != NetBSD\" from line 2.")
+}
+
+// A .for loop may modify the variables in one iteration,
+// which affects the conditions in the next iteration.
+func (s *Suite) Test_MkCondBranchChecker_checkStmt__loop(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if !defined(VAR) && ${OPSYS} == NetBSD && defined(i)",
+		".  for i in 1 2 3",
+		".    if defined(VAR) || ${OPSYS} != NetBSD || !defined(i)",
+		".    elif defined(VAR)",
+		".    elif !defined(i)",
+		".    elif ${OPSYS} != NetBSD",
+		".    endif",
+		"VAR=\tdefined",
+		".  endfor",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	// Only the knowledge about OPSYS survives the loop.
+	t.CheckOutputLines(
+		"WARN: filename.mk:7: This branch is unreachable " +
+			"since its condition contradicts " +
+			"\"!defined(VAR) && ${OPSYS} == NetBSD && defined(i)\" from line 2.")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_forget(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if defined(ONE) && defined(TWO) && defined(THREE)",
+		"ONE=\t1",
+		".  if !defined(ONE) || !defined(TWO) || !defined(THREE)",
+		".  endif",
+		".  if !defined(ONE)",
+		".  endif",
+		".  if !defined(TWO)",
+		".  endif",
+		".  include \"other.mk\"",
+		".  if !defined(THREE)",
+		".  endif",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	// The .if in line 4 is not analyzed since it is a disjunction.
+	// The assignment in line 3 removes the knowledge about ONE,
+	// the .include in line 10 removes the knowledge about all variables.
+	t.CheckOutputLines(
+		"WARN: filename.mk:8: This branch is unreachable " +
+			"since its condition contradicts " +
+			"\"defined(ONE) && defined(TWO) && defined(THREE)\" from line 2.")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_forgetVar(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if defined(ONE) && defined(TWO)",
+		".endif")
+	ck := NewMkCondBranchChecker(mklines)
+	atoms, _ := ck.atoms(mklines.mklines[1])
+
+	t.CheckLen(ck.forgetVar(atoms, "ONE"), 1)
+	t.CheckLen(ck.forgetVar(atoms, "THREE"), 2)
+	t.CheckLen(ck.forgetVar(atoms, "${VAR}"), 0)
+}
+
+func (s *Suite) Test_MkCondBranchChecker_checkCond(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if defined(VAR)",
+		".elif !defined(VAR)",
+		".elif ${OPSYS} == NetBSD",
+		".else",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	t.CheckOutputLines(
+		"WARN: filename.mk:4: This branch is unreachable "+
+			"since the condition \"!defined(VAR)\" from line 3 is always true there.",
+		"WARN: filename.mk:5: This branch is unreachable "+
+			"since the condition \"!defined(VAR)\" from line 3 is always true there.")
+}
+
+// The negation of an earlier condition is only known if that condition
+// consists of a single atom.
+func (s *Suite) Test_MkCondBranchChecker_checkCond__negation(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64",
+		".elif ${OPSYS} != NetBSD",
+		".else",
+		".endif",
+		"",
+		".if ${OPSYS} == NetBSD",
+		".elif ${OPSYS} != NetBSD",
+		".else",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	t.CheckOutputLines(
+		"WARN: filename.mk:9: This branch is unreachable " +
+			"since the condition \"${OPSYS} != NetBSD\" from line 8 is always true there.")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_checkEarlier(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64",
+		".elif ${MACHINE_ARCH} == x86_64 && ${OPSYS} == NetBSD",
+		".elif ${OPSYS} == NetBSD || ${OPSYS} == Linux",
+		".elif ${OPSYS} == Linux",
+		".elif ${MACHINE_ARCH} == x86_64 && ${OPSYS} == NetBSD && exists(/usr)",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	// The disjunction in line 4 cannot be analyzed,
+	// therefore line 5 is considered reachable.
+	t.CheckOutputLines(
+		"WARN: filename.mk:3: This branch is unreachable "+
+			"since its condition implies "+
+			"\"${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64\" from line 2.",
+		"WARN: filename.mk:6: This branch is unreachable "+
+			"since its condition implies "+
+			"\"${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64\" from line 2.")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_checkContext(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".else",
+		".  if ${OPSYS} == NetBSD",
+		".  endif",
+		".  if ${OPSYS:MNetBSD}",
+		".  endif",
+		".endif",
+		"",
+		".if ${OPSYS} == NetBSD",
+		".  if ${OPSYS} == Linux",
+		".  endif",
+		".  if ${OPSYS} != NetBSD",
+		".  endif",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	// The contradiction in line 11 is already reported by
+	// MkCondChecker.checkContradictions.
+	t.CheckOutputLines(
+		"WARN: filename.mk:4: This branch is unreachable "+
+			"since its condition implies \"${OPSYS} == NetBSD\" from line 2.",
+		"WARN: filename.mk:6: This branch is unreachable "+
+			"since its condition implies \"${OPSYS} == NetBSD\" from line 2.",
+		"WARN: filename.mk:13: This branch is unreachable "+
+			"since its condition contradicts \"${OPSYS} == NetBSD\" from line 10.")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_noteRepeated(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD && defined(VAR)",
+		".  if defined(VAR)",
+		".  else",
+		".  endif",
+		".  if ${OPSYS:MNet*}",
+		".  endif",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	t.CheckOutputLines(
+		"NOTE: filename.mk:3: The condition \"defined(VAR)\" is always true here "+
+			"since it is implied by \"${OPSYS} == NetBSD && defined(VAR)\" from line 2.",
+		"WARN: filename.mk:4: This branch is unreachable "+
+			"since the condition \"defined(VAR)\" from line 3 is always true there.",
+		"NOTE: filename.mk:6: The condition \"${OPSYS:MNet*}\" is always true here "+
+			"since it is implied by \"${OPSYS} == NetBSD && defined(VAR)\" from line 2.")
+}
+
+// With -Cplatforms, branches that depend on the platform are reported
+// by the PlatformChecker instead.
+func (s *Suite) Test_MkCondBranchChecker_warnUnreachable(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "-Cplatforms")
+	t.SetUpPackage("category/package",
+		".include \"../../mk/bsd.prefs.mk\"",
+		"",
+		".if ${OPSYS} == NetBSD",
+		".elif ${OPSYS} == NetBSD",
+		".endif",
+		".if ${PKGPATH} == category/package",
+		".elif ${PKGPATH} == category/package",
+		".endif")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"WARN: ~/category/package/Makefile:26: This branch is unreachable "+
+			"since its condition implies \"${PKGPATH} == category/package\" from line 25.",
+		"WARN: ~/category/package/Makefile:23: "+
+			"This branch is not taken on any of the "+
+			sprintf("%d", 6*2*2+2*(len(strings.Fields(archValues))-2))+" platforms.")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_explain(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".elif ${OPSYS} == NetBSD",
+		".endif")
+
+	NewMkCondBranchChecker(mklines).Check()
+
+	t.CheckOutputLines(
+		"WARN: filename.mk:3: This branch is unreachable "+
+			"since its condition implies \"${OPSYS} == NetBSD\" from line 2.",
+		"",
+		"\tIn a chain of .if, .elif and .else, each branch is only tried if",
+		"\tnone of the earlier branches has been taken. Nested conditions are",
+		"\tonly evaluated if the enclosing conditions are satisfied.",
+		"",
+		"\tSince the earlier conditions already decide the outcome, the code in",
+		"\tthis branch is never used. Either remove it or fix the conditions.",
+		"")
+}
+
+func (s *Suite) Test_MkCondBranchChecker_impliedBy(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if defined(ONE) && defined(TWO)",
+		".if defined(TWO)",
+		".if defined(TWO) && defined(THREE)",
+		".if defined(TWO) || defined(THREE)",
+		".if defined(ONE) && defined(ONE) && defined(TWO)")
+	ck := NewMkCondBranchChecker(mklines)
+	context, _ := ck.atoms(mklines.mklines[1])
+
+	test := func(i int, expected *condAtom) {
+		t.CheckEquals(ck.impliedBy(mklines.mklines[i], context), expected)
+	}
+
+	test(2, context[1])
+	test(3, nil)
+	test(4, nil)
+	test(5, context[0])
+}
+
+func (s *Suite) Test_MkCondBranchChecker_impliesAll(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if defined(ONE) && defined(TWO)",
+		".if defined(TWO)",
+		".if defined(TWO) && defined(THREE)")
+	ck := NewMkCondBranchChecker(mklines)
+	atoms := func(i int) []*condAtom {
+		atoms, _ := ck.atoms(mklines.mklines[i])
+		return atoms
+	}
+
+	t.CheckEquals(ck.impliesAll(atoms(1), atoms(2)), true)
+	t.CheckEquals(ck.impliesAll(atoms(2), atoms(1)), false)
+	t.CheckEquals(ck.impliesAll(atoms(1), atoms(3)), false)
+	t.CheckEquals(ck.impliesAll(atoms(1), nil), true)
+}
+
+func (s *Suite) Test_MkCondBranchChecker_atoms(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if defined(ONE) && (${OPSYS} == NetBSD && !${MACHINE_ARCH:Mx86_64})",
+		".elif defined(ONE) && exists(/usr)",
+		".elif defined(ONE) || defined(TWO)",
+		".else",
+		".endif",
+		".ifdef ONE",
+		".endif")
+	ck := NewMkCondBranchChecker(mklines)
+
+	test := func(i int, expectedComplete bool, expected ...string) {
+		atoms, complete := ck.atoms(mklines.mklines[i])
+		var actual []string
+		for _, atom := range atoms {
+			actual = append(actual, sprintf("%s %s %v", atom.varname, atom.patternText, atom.negated))
+		}
+		t.CheckDeepEquals(actual, expected)
+		t.CheckEquals(complete, expectedComplete)
+	}
+
+	test(1, true,
+		"ONE  false",
+		"OPSYS NetBSD false",
+		"MACHINE_ARCH x86_64 true")
+	test(2, false,
+		"ONE  false")
+	test(3, false)
+	test(4, false)
+	test(6, false)
+}
+
+func (s *Suite) Test_MkCondBranchChecker_atom(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mkline := t.NewMkLine("filename.mk", 123, ".if 1")
+	mklines := NewMkLines(NewLines("filename.mk", []*Line{mkline.Line}), nil, nil)
+	ck := NewMkCondBranchChecker(mklines)
+
+	test := func(cond string, expected string) {
+		p := NewMkParser(nil, cond)
+		atom := ck.atom(p.MkCond(), mkline)
+		actual := "nil"
+		if atom != nil {
+			actual = sprintf("%s %q %v", atom.varname, atom.patternText, atom.negated)
+		}
+		t.CheckEquals(actual, expected)
+	}
+
+	test("defined(VAR)", "VAR \"\" false")
+	test("!defined(VAR)", "VAR \"\" true")
+	test("defined(${VAR})", "nil")
+	test("!!defined(VAR)", "VAR \"\" false")
+	test("(defined(VAR))", "VAR \"\" false")
+
+	test("${OPSYS:MNet*}", "OPSYS \"Net*\" false")
+	test("${OPSYS:NNet*}", "OPSYS \"Net*\" true")
+	test("!${OPSYS:MNet*}", "OPSYS \"Net*\" true")
+	test("empty(OPSYS:MNet*)", "OPSYS \"Net*\" true")
+	test("!empty(OPSYS:MNet*)", "OPSYS \"Net*\" false")
+	test("empty(OPSYS:NNet*)", "OPSYS \"Net*\" false")
+	test("${OPSYS}", "nil")
+	test("empty(OPSYS)", "nil")
+	test("${OPSYS:tl:Mnet*}", "nil")
+	test("${OPSYS:S,a,b,}", "nil")
+	test("${OPSYS:M${PATTERN}}", "nil")
+	test("${OPSYS:M[}", "nil")
+
+	// Lists can contain several words, which would require
+	// a more detailed analysis.
+	test("${PKG_OPTIONS:Mopt}", "nil")
+	test("${UNKNOWN:Mopt}", "nil")
+
+	test("${OPSYS} == NetBSD", "OPSYS \"NetBSD\" false")
+	test("${OPSYS} != NetBSD", "OPSYS \"NetBSD\" true")
+	test("${OPSYS} == \"NetBSD\"", "OPSYS \"NetBSD\" false")
+	test("${OPSYS} == \"Net*\"", "nil")
+	test("${OPSYS} == \"\"", "nil")
+	test("${OPSYS} == ${OTHER}", "nil")
+	test("${OPSYS:tl} == netbsd", "nil")
+	test("${OS_VERSION} >= 9", "nil")
+	test("\"NetBSD\" == ${OPSYS}", "nil")
+
+	test("exists(/usr)", "nil")
+	test("!exists(/usr)", "nil")
+}
+
+func (s *Suite) Test_condAtom_negate(c *check.C) {
+	t := s.Init(c)
+
+	atom := &condAtom{"VAR", "", nil, false, false, nil}
+	negated := atom.negate()
+
+	t.CheckEquals(negated.negated, true)
+	t.CheckEquals(negated.inverted, true)
+	t.CheckEquals(negated.negate().negated, false)
+	t.CheckEquals(negated.negate().inverted, false)
+}
+
+func (s *Suite) Test_condAtom_implies(c *check.C) {
+	t := s.Init(c)
+
+	defined := func(varname string, negated bool) *condAtom {
+		return &condAtom{varname, "", nil, negated, false, nil}
+	}
+	pattern := func(varname, pattern string, negated bool) *condAtom {
+		m, err := makepat.Compile(pattern)
+		t.AssertNil(err)
+		return &condAtom{varname, pattern, m, negated, false, nil}
+	}
+	test := func(a, b *condAtom, expected bool) {
+		t.CheckEquals(a.implies(b), expected)
+	}
+
+	test(defined("VAR", false), defined("VAR", false), true)
+	test(defined("VAR", false), defined("VAR", true), false)
+	test(defined("VAR", false), defined("OTHER", false), false)
+	test(defined("VAR", false), pattern("VAR", "*", false), false)
+
+	// ${VAR} == value implies ${VAR:M*}.
+	test(pattern("VAR", "value", false), pattern("VAR", "*", false), true)
+	test(pattern("VAR", "*", false), pattern("VAR", "value", false), false)
+	test(pattern("VAR", "v*", false), pattern("VAR", "v*", false), true)
+
+	// ${VAR} != value is implied by ${VAR} != v*.
+	test(pattern("VAR", "v*", true), pattern("VAR", "value", true), true)
+	test(pattern("VAR", "value", true), pattern("VAR", "v*", true), false)
+
+	// ${VAR} == other implies ${VAR} != value.
+	test(pattern("VAR", "other", false), pattern("VAR", "value", true), true)
+	test(pattern("VAR", "value", false), pattern("VAR", "value", true), false)
+
+	test(pattern("VAR", "value", true), pattern("VAR", "other", false), false)
+}
+
+func (s *Suite) Test_condAtom_contradicts(c *check.C) {
+	t := s.Init(c)
+
+	pattern := func(pattern string, negated bool) *condAtom {
+		m, err := makepat.Compile(pattern)
+		t.AssertNil(err)
+		return &condAtom{"VAR", pattern, m, negated, false, nil}
+	}
+
+	t.CheckEquals(pattern("one", false).contradicts(pattern("two", false)), true)
+	t.CheckEquals(pattern("one", false).contradicts(pattern("o*", false)), false)
+	t.CheckEquals(pattern("one", false).contradicts(pattern("o*", true)), true)
+	t.CheckEquals(pattern("one", true).contradicts(pattern("two", true)), false)
+}
+
+func (s *Suite) Test_condAtom_subsetOf(c *check.C) {
+	t := s.Init(c)
+
+	pattern := func(pattern string) *condAtom {
+		m, err := makepat.Compile(pattern)
+		t.AssertNil(err)
+		return &condAtom{"VAR", pattern, m, false, false, nil}
+	}
+	test := func(a, b string, expected bool) {
+		t.CheckEquals(pattern(a).subsetOf(pattern(b)), expected)
+	}
+
+	test("NetBSD", "NetBSD", true)
+	test("NetBSD", "Net*", true)
+	test("NetBSD", "Linux", false)
+	test("Net*", "Net*", true)
+
+	// Non-literal patterns are not analyzed further.
+	test("NetBSD-[0-9]*", "NetBSD-*", false)
+}
@@ -79,6 +79,9 @@ func (ck *MkCondChecker) Check() {
 		Compare: ck.checkCompare,
 		Expr:    checkExpr})
 
+	s := MkCondSimplifier{ck.MkLines, mkline}
+	s.SimplifyCond(cond)
+
 	ck.checkContradictions()
 }
 
@@ -208,7 +208,9 @@ func (s *Suite) Test_MkCondChecker_Check__compare_pattern_with_empty(c *check.C)
 
 	t.CheckOutputLines(
 		"WARN: filename.mk:8: The pathname pattern \"<>\" contains the invalid characters \"<>\".",
-		"WARN: filename.mk:8: The pathname \"*\" contains the invalid character \"*\".")
+		"WARN: filename.mk:8: The pathname \"*\" contains the invalid character \"*\".",
+		"NOTE: filename.mk:11: \"!(${OPSYS:M*BSD} != \\\"\\\")\" "+
+			"can be simplified to \"${OPSYS:M*BSD} == \\\"\\\"\".")
 }
 
 func (s *Suite) Test_MkCondChecker_Check__comparing_PKGSRC_COMPILER_with_eqeq(c *check.C) {
@@ -924,6 +926,11 @@ func (s *Suite) Test_MkCondChecker_checkContradictions(c *check.C) {
 	test("!empty(MACHINE_PLATFORM:Mone) && !empty(MACHINE_PLATFORM:Mtwo)",
 		"ERROR: filename.mk:1: The patterns \"one\" and \"two\" "+
 			"cannot match at the same time.")
+
+	// Plain comparisons are not facts for this check.
+	// They are handled by the platform checks.
+	test("${OPSYS} == NetBSD && ${OPSYS} == Linux",
+		nil...)
 }
 
 // A condition from a skipped .if or .elif branch does not contradict a
@@ -56,13 +56,13 @@ func (s *MkCondSimplifier) simplifyWord(expr *MkExpr, fromEmpty bool, neg bool)
 	replace := func(positive bool, pattern string) (bool, string, string) {
 		defined := s.isDefined(varname, vartype)
 		if !defined && !positive {
-			// TODO: This is a double negation, maybe even triple.
-			//  There is an :N pattern, and the variable may be undefined.
-			//  If it is indeed undefined, should the whole condition
-			//  evaluate to true or false?
-			//  The cases to be distinguished are: undefined, empty, filled.
-
-			// For now, be conservative and don't suggest anything wrong.
+			// This is a double negation, maybe even triple.
+			// There is an :N pattern, and the variable may be undefined.
+			// An undefined variable behaves like an empty one here,
+			// so '!empty(VAR:Npattern)' is false in both cases.
+			// The comparison '${VAR:U} != pattern' would be true for
+			// them, and adding a check for the empty string would not
+			// make the condition any simpler than before.
 			return false, "", ""
 		}
 		uMod := condStr(!defined && !expr.HasModifier("U"), ":U", "")
@@ -125,13 +125,10 @@ func (s *MkCondSimplifier) simplifyWord(expr *MkExpr, fromEmpty bool, neg bool)
 func (s *MkCondSimplifier) simplifyYesNo(expr *MkExpr, fromEmpty bool, neg bool) (done bool) {
 
 	// TODO: Merge the common code from simplifyWord and simplifyYesNo.
-	//  Even better would be to manipulate the conditions in an AST
-	//  instead of working directly with strings, but as of November 2022,
-	//  that is not implemented yet.
-	//  .
-	//  Another useful feature would be to chain multiple autofixes
-	//  together, but to do that, pkglint needs to be able to convert an
-	//  AST back into the source code form.
+	//  Even better would be to manipulate the conditions in the AST,
+	//  like in SimplifyCond, instead of working directly with strings.
+	//  MkCond.String converts the AST back into the source code form,
+	//  which would allow chaining multiple autofixes together.
 
 	toLower := func(p string) string {
 		var sb strings.Builder
@@ -349,3 +346,286 @@ func (*MkCondSimplifier) mayMatchNumber(pattern string) (bool, error) {
 	both := makepat.Intersect(p, numeric)
 	return both.CanMatch(), nil
 }
+
+// SimplifyCond rewrites the whole condition of a directive in a simpler
+// form with the same meaning.
+//
+// Double negations are removed, negated groups of conditions are resolved
+// using De Morgan's laws, comparisons of a single variable with several
+// values are merged into a single :M modifier, and conditions that are
+// implied by other conditions are removed.
+//
+// Since the condition is rewritten as a whole, the autofix is only
+// offered if the condition is written in the canonical formatting,
+// to preserve any intentional quoting or spacing.
+func (s *MkCondSimplifier) SimplifyCond(cond *MkCond) {
+	from := s.MkLine.Args()
+	if cond.String() != from {
+		return
+	}
+
+	to := s.simplify(cond).String()
+	if to == from {
+		return
+	}
+
+	fix := s.MkLine.Autofix()
+	fix.Notef("%q can be simplified to %q.", from, to)
+	fix.Explain(
+		"The simplified condition has the same meaning as the original one.",
+		"",
+		"In a double negation, the two negations cancel each other out.",
+		"A negated group of conditions is replaced with a group of",
+		"negated conditions, for example !(A && B) becomes !A || !B.",
+		"Several comparisons of the same variable are merged",
+		"into a single pattern.",
+		"A condition that is implied by another condition",
+		"in the same group is removed.")
+	fix.Replace(from, to)
+	fix.Apply()
+}
+
+// simplify returns a condition with the same meaning as the given
+// condition, but in a simpler form.
+// The given condition is not modified.
+func (s *MkCondSimplifier) simplify(cond *MkCond) *MkCond {
+	switch {
+	case cond.Or != nil:
+		clauses := s.simplifyClauses(cond.Or, true)
+		clauses = s.mergeComparisons(clauses)
+		clauses = s.removeImplied(clauses, true)
+		if len(clauses) == 1 {
+			return clauses[0]
+		}
+		return &MkCond{Or: clauses}
+
+	case cond.And != nil:
+		clauses := s.simplifyClauses(cond.And, false)
+		clauses = s.removeImplied(clauses, false)
+		if len(clauses) == 1 {
+			return clauses[0]
+		}
+		return &MkCond{And: clauses}
+
+	case cond.Not != nil && cond.Not.Not != nil:
+		return s.simplify(cond.Not.Not)
+
+	case cond.Not != nil && cond.Not.Paren != nil:
+		return s.simplify(s.negate(cond.Not.Paren))
+
+	case cond.Not != nil:
+		return &MkCond{Not: s.simplify(cond.Not)}
+
+	case cond.Paren != nil:
+		inner := s.simplify(cond.Paren)
+		if inner.Or == nil && inner.And == nil && (cond.Paren.Or != nil || cond.Paren.And != nil) {
+			return inner
+		}
+		return &MkCond{Paren: inner}
+	}
+	return cond
+}
+
+// simplifyClauses simplifies each of the clauses from an '||' or '&&'
+// condition, flattening the clauses that result in the same operator.
+func (s *MkCondSimplifier) simplifyClauses(clauses []*MkCond, or bool) []*MkCond {
+	var result []*MkCond
+	for _, clause := range clauses {
+		simplified := s.simplify(clause)
+		switch {
+		case or && simplified.Or != nil:
+			result = append(result, simplified.Or...)
+		case !or && simplified.And != nil:
+			result = append(result, simplified.And...)
+		default:
+			result = append(result, simplified)
+		}
+	}
+	return result
+}
+
+// negate returns the negation of the given condition, applying
+// De Morgan's laws.
+// The resulting condition may still contain double negations.
+//
+// The order of the clauses is preserved, therefore the evaluation of
+// the resulting condition stops at the same point as the original
+// condition.
+func (s *MkCondSimplifier) negate(cond *MkCond) *MkCond {
+	negateAll := func(clauses []*MkCond) []*MkCond {
+		negated := make([]*MkCond, len(clauses))
+		for i, clause := range clauses {
+			negated[i] = s.negate(clause)
+		}
+		return negated
+	}
+
+	switch {
+	case cond.Or != nil:
+		return &MkCond{And: negateAll(cond.Or)}
+	case cond.And != nil:
+		return &MkCond{Or: negateAll(cond.And)}
+	case cond.Not != nil:
+		return cond.Not
+	case cond.Paren != nil:
+		return s.negate(cond.Paren)
+	case cond.Compare != nil:
+		cmp := cond.Compare
+		op := map[string]string{
+			"==": "!=", "!=": "==",
+			"<": ">=", ">=": "<",
+			">": "<=", "<=": ">"}[cmp.Op]
+		return &MkCond{Compare: &MkCondCompare{cmp.Left, op, cmp.Right}}
+	}
+	return &MkCond{Not: cond}
+}
+
+// mergeComparisons merges comparisons like '${VAR} == i386 || ${VAR} == i486'
+// into a single condition '${VAR:Mi[34]86}'.
+//
+// This only works if the values differ in a single character,
+// since the patterns in the :M modifier don't have a syntax for
+// alternative words.
+func (s *MkCondSimplifier) mergeComparisons(clauses []*MkCond) []*MkCond {
+
+	// value returns the variable and the literal value from a
+	// comparison of the form '${VAR} == value'.
+	value := func(clause *MkCond) (*MkExpr, string) {
+		cmp := clause.Compare
+		if cmp == nil || cmp.Op != "==" || cmp.Left.Expr == nil ||
+			cmp.Right.Expr != nil || cmp.Right.Num != "" {
+			return nil, ""
+		}
+		str := cmp.Right.Str
+		if str == "" || textproc.NewLexer(str).NextBytesSet(textproc.AlnumU) != str {
+			return nil, ""
+		}
+		expr := cmp.Left.Expr
+		if G.Pkgsrc.VariableType(s.MkLines, expr.varname).IsList() != no {
+			return nil, ""
+		}
+		return expr, str
+	}
+
+	var result []*MkCond
+	done := make(map[int]bool)
+	for i, clause := range clauses {
+		if done[i] {
+			continue
+		}
+		expr, first := value(clause)
+		if expr == nil {
+			result = append(result, clause)
+			continue
+		}
+
+		values := []string{first}
+		indexes := []int{i}
+		for j := i + 1; j < len(clauses); j++ {
+			otherExpr, other := value(clauses[j])
+			if otherExpr != nil && otherExpr.String() == expr.String() && len(other) == len(first) {
+				values = append(values, other)
+				indexes = append(indexes, j)
+			}
+		}
+
+		pattern := s.mergePattern(values)
+		if pattern == "" {
+			result = append(result, clause)
+			continue
+		}
+
+		mayMatchNumber, err := s.mayMatchNumber(pattern)
+		if err != nil {
+			result = append(result, clause)
+			continue
+		}
+
+		for _, index := range indexes {
+			done[index] = true
+		}
+		mods := append(append([]MkExprModifier(nil), expr.modifiers...), MkExprModifier("M"+pattern))
+		term := MkCondTerm{Expr: NewMkExpr(expr.varname, mods...)}
+		if mayMatchNumber {
+			result = append(result, &MkCond{Compare: &MkCondCompare{term, "!=", MkCondTerm{}}})
+		} else {
+			result = append(result, &MkCond{Term: &term})
+		}
+	}
+	return result
+}
+
+// mergePattern returns a pattern that matches exactly the given values,
+// or an empty string if the values differ in more than a single place.
+// All values must have the same length.
+func (s *MkCondSimplifier) mergePattern(values []string) string {
+	if len(values) < 2 {
+		return ""
+	}
+
+	first := values[0]
+	diff := -1
+	chars := make(map[byte]bool)
+	for _, value := range values {
+		for i := range value {
+			if value[i] != first[i] && i != diff {
+				if diff != -1 {
+					return ""
+				}
+				diff = i
+			}
+		}
+	}
+	if diff == -1 {
+		return ""
+	}
+
+	for _, value := range values {
+		chars[value[diff]] = true
+	}
+	var sb strings.Builder
+	for ch := 0; ch < 256; ch++ {
+		if chars[byte(ch)] {
+			sb.WriteByte(byte(ch))
+		}
+	}
+	return first[:diff] + "[" + sb.String() + "]" + first[diff+1:]
+}
+
+// removeImplied removes the clauses that don't influence the outcome of
+// the whole condition since they are implied by other clauses.
+//
+// In an '&&' condition, a clause is redundant if another clause implies it.
+// In an '||' condition, a clause is redundant if it implies another clause.
+// Of two equivalent clauses, the first one is kept.
+func (s *MkCondSimplifier) removeImplied(clauses []*MkCond, or bool) []*MkCond {
+	ck := NewMkCondBranchChecker(s.MkLines)
+	atoms := make([]*condAtom, len(clauses))
+	for i, clause := range clauses {
+		atoms[i] = ck.atom(clause, s.MkLine)
+	}
+
+	redundant := func(i int) bool {
+		for j, other := range atoms {
+			if j == i || atoms[i] == nil || other == nil {
+				continue
+			}
+			weaker, stronger := atoms[i], other
+			if or {
+				weaker, stronger = other, atoms[i]
+			}
+			if stronger.implies(weaker) && (j < i || !weaker.implies(stronger)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result []*MkCond
+	for i, clause := range clauses {
+		if !redundant(i) {
+			result = append(result, clause)
+		}
+	}
+	return result
+}
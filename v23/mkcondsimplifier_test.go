@@ -616,6 +616,8 @@ func (s *Suite) Test_MkCondSimplifier_simplifyWord__complex(c *check.C) {
 		"NOTE: filename.mk:6: PREFS_DEFINED can be "+
 			"compared using the simpler \"${PREFS_DEFINED} == pattern\" "+
 			"instead of matching against \":Mpattern\".",
+		"NOTE: filename.mk:6: \"!!empty(PREFS_DEFINED:Mpattern)\" "+
+			"can be simplified to \"empty(PREFS_DEFINED:Mpattern)\".",
 		"AUTOFIX: filename.mk:6: Replacing \"!empty(PREFS_DEFINED:Mpattern)\" "+
 			"with \"${PREFS_DEFINED} == pattern\".")
 
@@ -672,6 +674,8 @@ func (s *Suite) Test_MkCondSimplifier_simplifyWord__complex(c *check.C) {
 		"NOTE: filename.mk:6: PREFS_DEFINED can be "+
 			"compared using the simpler \"${PREFS_DEFINED} != pattern\" "+
 			"instead of matching against \":Mpattern\".",
+		"NOTE: filename.mk:6: \"!!${PREFS_DEFINED:Mpattern}\" "+
+			"can be simplified to \"${PREFS_DEFINED:Mpattern}\".",
 		"AUTOFIX: filename.mk:6: Replacing \"!${PREFS_DEFINED:Mpattern}\" "+
 			"with \"${PREFS_DEFINED} != pattern\".")
 
@@ -1093,3 +1097,287 @@ func Test_MkCondSimplifier_mayMatchNumber(t *testing.T) {
 		})
 	}
 }
+
+func (s *Suite) Test_MkCondSimplifier_SimplifyCond(c *check.C) {
+	t := NewMkCondSimplifierTester(c, s)
+
+	t.setUp()
+
+	t.testAfterPrefs(
+		".if !(!defined(PREFS) || ${PREFS_DEFINED} != yes)",
+		".if defined(PREFS) && ${PREFS_DEFINED} == yes",
+
+		"NOTE: filename.mk:6: "+
+			"\"!(!defined(PREFS) || ${PREFS_DEFINED} != yes)\" "+
+			"can be simplified to "+
+			"\"defined(PREFS) && ${PREFS_DEFINED} == yes\".",
+		"AUTOFIX: filename.mk:6: "+
+			"Replacing \"!(!defined(PREFS) || ${PREFS_DEFINED} != yes)\" "+
+			"with \"defined(PREFS) && ${PREFS_DEFINED} == yes\".")
+
+	t.testBeforeAndAfterPrefs(
+		".if ${IN_SCOPE_DEFINED} == i386 || ${IN_SCOPE_DEFINED} == i486",
+		".if ${IN_SCOPE_DEFINED:Mi[34]86}",
+
+		"NOTE: filename.mk:6: "+
+			"\"${IN_SCOPE_DEFINED} == i386 || ${IN_SCOPE_DEFINED} == i486\" "+
+			"can be simplified to \"${IN_SCOPE_DEFINED:Mi[34]86}\".",
+		"AUTOFIX: filename.mk:6: "+
+			"Replacing \"${IN_SCOPE_DEFINED} == i386 || ${IN_SCOPE_DEFINED} == i486\" "+
+			"with \"${IN_SCOPE_DEFINED:Mi[34]86}\".")
+
+	// The condition is not in the canonical formatting,
+	// therefore it is not rewritten as a whole.
+	t.testAfterPrefs(
+		".if !!defined(PREFS) && ${PREFS_DEFINED} == \"yes\"",
+		".if !!defined(PREFS) && ${PREFS_DEFINED} == \"yes\"",
+
+		nil...)
+
+	// Already in the simplest form.
+	t.testAfterPrefs(
+		".if defined(PREFS) && ${PREFS_DEFINED} == yes",
+		".if defined(PREFS) && ${PREFS_DEFINED} == yes",
+
+		nil...)
+}
+
+func (s *Suite) Test_MkCondSimplifier_simplify(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID)
+	simplifier := MkCondSimplifier{mklines, mklines.mklines[0]}
+
+	test := func(cond string, expected string) {
+		p := NewMkParser(nil, cond)
+		parsed := p.MkCond()
+		t.CheckEquals(p.EOF(), true)
+		t.CheckEquals(parsed.String(), cond)
+
+		simplified := simplifier.simplify(parsed)
+
+		t.CheckEquals(simplified.String(), expected)
+		t.CheckEquals(parsed.String(), cond)
+	}
+
+	test("defined(VAR)", "defined(VAR)")
+	test("!!defined(VAR)", "defined(VAR)")
+	test("!!!defined(VAR)", "!defined(VAR)")
+	test("!(!defined(VAR))", "defined(VAR)")
+
+	test("!(defined(A) && defined(B))", "!defined(A) || !defined(B)")
+	test("!(defined(A) || defined(B))", "!defined(A) && !defined(B)")
+	test("defined(X) && !(defined(A) && defined(B))",
+		"defined(X) && (!defined(A) || !defined(B))")
+	test("defined(X) && !(defined(A) || defined(B))",
+		"defined(X) && !defined(A) && !defined(B)")
+	test("!(${OPSYS} == NetBSD && ${OS_VERSION} < 9)",
+		"${OPSYS} != NetBSD || ${OS_VERSION} >= 9")
+
+	// The '!' in front of a comparison is left as-is,
+	// see MkCondChecker.checkNotCompare.
+	test("!${OPSYS} == NetBSD", "!${OPSYS} == NetBSD")
+
+	// Parentheses that are not redundant are kept.
+	test("defined(X) && (defined(A) || defined(B))",
+		"defined(X) && (defined(A) || defined(B))")
+	test("(defined(A) || defined(A)) && defined(B)",
+		"defined(A) && defined(B)")
+
+	test("${OPSYS} == NetBSD || ${OPSYS} == NetBSD", "${OPSYS} == NetBSD")
+}
+
+func (s *Suite) Test_MkCondSimplifier_simplifyClauses(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID)
+	simplifier := MkCondSimplifier{mklines, mklines.mklines[0]}
+
+	test := func(cond string, or bool, expected ...string) {
+		parsed := NewMkParser(nil, cond).MkCond()
+		clauses := parsed.And
+		if or {
+			clauses = parsed.Or
+		}
+
+		simplified := simplifier.simplifyClauses(clauses, or)
+
+		var actual []string
+		for _, clause := range simplified {
+			actual = append(actual, clause.String())
+		}
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	test("defined(A) && !(defined(B) || defined(C))", false,
+		"defined(A)", "!defined(B)", "!defined(C)")
+	test("defined(A) || !(defined(B) || defined(C))", true,
+		"defined(A)", "!defined(B) && !defined(C)")
+	test("defined(A) || !(defined(B) && defined(C))", true,
+		"defined(A)", "!defined(B)", "!defined(C)")
+}
+
+func (s *Suite) Test_MkCondSimplifier_negate(c *check.C) {
+	t := s.Init(c)
+
+	test := func(cond string, expected string) {
+		parsed := NewMkParser(nil, cond).MkCond()
+
+		negated := (*MkCondSimplifier).negate(nil, parsed)
+
+		t.CheckEquals(negated.String(), expected)
+	}
+
+	test("defined(A)", "!defined(A)")
+	test("!defined(A)", "defined(A)")
+	test("(defined(A))", "!defined(A)")
+	test("defined(A) && !defined(B)", "!defined(A) || defined(B)")
+	test("defined(A) || !defined(B)", "!defined(A) && defined(B)")
+	test("${A} == value", "${A} != value")
+	test("${A} != value", "${A} == value")
+	test("${A} < 1", "${A} >= 1")
+	test("${A} <= 1", "${A} > 1")
+	test("${A} > 1", "${A} <= 1")
+	test("${A} >= 1", "${A} < 1")
+	test("${A:M*}", "!${A:M*}")
+	test("empty(A)", "!empty(A)")
+	test("exists(/usr)", "!exists(/usr)")
+
+	// The resulting condition may still contain double negations and
+	// redundant parentheses, which are removed by MkCondSimplifier.simplify.
+	test("!!defined(A)", "!defined(A)")
+	test("defined(A) && !(defined(B))", "!defined(A) || (defined(B))")
+	test("(!defined(A))", "defined(A)")
+	test("!defined(A) && defined(B)", "defined(A) || !defined(B)")
+	test("defined(A) && (defined(B) || defined(C))",
+		"!defined(A) || !defined(B) && !defined(C)")
+	test("(defined(A) || defined(B)) && !defined(C)",
+		"!defined(A) && !defined(B) || defined(C)")
+}
+
+func (s *Suite) Test_MkCondSimplifier_mergeComparisons(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID)
+	simplifier := MkCondSimplifier{mklines, mklines.mklines[0]}
+
+	test := func(cond string, expected ...string) {
+		parsed := NewMkParser(nil, cond).MkCond()
+
+		merged := simplifier.mergeComparisons(parsed.Or)
+
+		var actual []string
+		for _, clause := range merged {
+			actual = append(actual, clause.String())
+		}
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	test("${MACHINE_ARCH} == i386 || ${MACHINE_ARCH} == i486 || ${MACHINE_ARCH} == i586",
+		"${MACHINE_ARCH:Mi[345]86}")
+
+	// Other clauses stay in their place,
+	// the merged clause takes the place of the first comparison.
+	test("defined(A) || ${MACHINE_ARCH} == i386 || defined(B) || ${MACHINE_ARCH} == i486",
+		"defined(A)", "${MACHINE_ARCH:Mi[34]86}", "defined(B)")
+
+	// The values differ in more than a single character.
+	test("${MACHINE_ARCH} == i386 || ${MACHINE_ARCH} == x86_64",
+		"${MACHINE_ARCH} == i386", "${MACHINE_ARCH} == x86_64")
+
+	// Different variables are not merged.
+	test("${MACHINE_ARCH} == i386 || ${OPSYS} == i486",
+		"${MACHINE_ARCH} == i386", "${OPSYS} == i486")
+
+	// The modifiers of the expression are kept.
+	test("${OPSYS:tl} == netbsd || ${OPSYS:tl} == netbsc",
+		"${OPSYS:tl:Mnetbs[cd]}")
+
+	// If the pattern may match a number, the result of the expression
+	// must be compared explicitly, as a condition like '.if 0' is false.
+	test("${OS_VERSION} == \"9\" || ${OS_VERSION} == \"8\"",
+		"${OS_VERSION:M[89]} != \"\"")
+
+	// Numbers are compared numerically, not as strings.
+	test("${OS_VERSION} == 9 || ${OS_VERSION} == 8",
+		"${OS_VERSION} == 9", "${OS_VERSION} == 8")
+
+	// A list variable may contain several words,
+	// in which case the :M modifier would match some of them.
+	test("${PKG_OPTIONS} == opt1 || ${PKG_OPTIONS} == opt2",
+		"${PKG_OPTIONS} == opt1", "${PKG_OPTIONS} == opt2")
+
+	// The values must be simple words.
+	test("${PKGPATH} == cat/pkg1 || ${PKGPATH} == cat/pkg2",
+		"${PKGPATH} == cat/pkg1", "${PKGPATH} == cat/pkg2")
+}
+
+func (s *Suite) Test_MkCondSimplifier_mergePattern(c *check.C) {
+	t := s.Init(c)
+
+	test := func(expected string, values ...string) {
+		t.CheckEquals((*MkCondSimplifier).mergePattern(nil, values), expected)
+	}
+
+	test("", "i386")
+	test("", "i386", "i386")
+	test("i[34]86", "i386", "i486")
+	test("i[345]86", "i586", "i386", "i486", "i386")
+	test("[ab]", "b", "a")
+	test("", "i386", "x386", "i486")
+}
+
+func (s *Suite) Test_MkCondSimplifier_removeImplied(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID)
+	simplifier := MkCondSimplifier{mklines, mklines.mklines[0]}
+
+	test := func(cond string, expected ...string) {
+		parsed := NewMkParser(nil, cond).MkCond()
+		or := parsed.Or != nil
+		clauses := parsed.And
+		if or {
+			clauses = parsed.Or
+		}
+
+		remaining := simplifier.removeImplied(clauses, or)
+
+		var actual []string
+		for _, clause := range remaining {
+			actual = append(actual, clause.String())
+		}
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	// In an '&&' condition, the stronger clause is kept.
+	test("${OPSYS:MNet*} && ${OPSYS} == NetBSD",
+		"${OPSYS} == NetBSD")
+	test("${OPSYS} == NetBSD && ${OPSYS} != Linux",
+		"${OPSYS} == NetBSD")
+
+	// In an '||' condition, the weaker clause is kept.
+	test("${OPSYS:MNet*} || ${OPSYS} == NetBSD",
+		"${OPSYS:MNet*}")
+
+	// Of two equivalent clauses, the first one is kept.
+	test("defined(A) && defined(A) && defined(B)",
+		"defined(A)", "defined(B)")
+	test("${OPSYS} == NetBSD || ${OPSYS:MNetBSD}",
+		"${OPSYS} == NetBSD")
+
+	// A guard is not implied by the comparison it protects.
+	test("defined(VAR) && ${VAR} == value",
+		"defined(VAR)", "${VAR} == value")
+
+	// Clauses that are not simple enough are kept.
+	test("exists(/usr) || exists(/usr)",
+		"exists(/usr)", "exists(/usr)")
+}
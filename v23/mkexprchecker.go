@@ -503,18 +503,33 @@ func (ck *MkExprChecker) checkUseAtLoadTime() {
 		return
 	}
 
-	if !ck.MkLines.once.FirstTime("bsd.prefs.mk") {
-		return
-	}
-
 	include := condStr(
 		basename == "buildlink3.mk",
 		"mk/bsd.fast.prefs.mk",
 		"mk/bsd.prefs.mk")
 	currInclude := G.Pkgsrc.File(NewPkgsrcPath(NewPath(include)))
 
+	if !ck.MkLines.once.FirstTime("bsd.prefs.mk") {
+		return
+	}
+
+	varname := ck.expr.varname
+	if ck.vartype.IsUserSettable() && !ck.vartype.IsUsedAtLoadTime() {
+		mkline.Warnf("The user-settable variable %s is undefined until %q is included.",
+			varname, mkline.Rel(currInclude))
+		mkline.Explain(
+			"The variables from mk.conf are loaded by bsd.prefs.mk.",
+			"Before that, this variable is undefined.",
+			"",
+			"The pkgsrc infrastructure only uses this variable at run time,",
+			"for example in shell commands.",
+			"Either include bsd.prefs.mk before this line,",
+			"or use the variable at run time as well.")
+		return
+	}
+
 	mkline.Warnf("To use %s at load time, .include %q first.",
-		ck.expr.varname, mkline.Rel(currInclude))
+		varname, mkline.Rel(currInclude))
 	mkline.Explain(
 		"The user-settable variables and several other variables",
 		"from the pkgsrc infrastructure are only available",
@@ -1087,6 +1087,77 @@ func (s *Suite) Test_MkExprChecker_checkUseAtLoadTime__PKG_SYSCONFDIR(c *check.C
 	t.CheckOutputEmpty()
 }
 
+// For user-settable variables, pkglint knows from scanning the pkgsrc
+// infrastructure whether they are meant to be used at load time.
+func (s *Suite) Test_MkExprChecker_checkUseAtLoadTime__user_settable(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("mk/defaults/mk.conf",
+		MkCvsID,
+		"MANZ=\tyes",
+		"OBJHOSTNAME?=\tno")
+	t.CreateFileLines("mk/manz.mk",
+		MkCvsID,
+		".if ${MANZ:Uno} == yes",
+		".endif")
+	t.CreateFileLines("category/package/filename.mk",
+		MkCvsID,
+		".if ${MANZ:Uno} == yes",
+		".endif",
+		".if ${OBJHOSTNAME:Uno} == yes",
+		".endif")
+	t.CreateFileLines("category/package/other.mk",
+		MkCvsID,
+		".if ${OBJHOSTNAME:Uno} == yes",
+		".endif",
+		".if ${MANZ:Uno} == yes",
+		".endif")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.Check("filename.mk")
+	G.Check("other.mk")
+
+	// The missing bsd.prefs.mk is only warned about once per file.
+	t.CheckOutputLines(
+		"WARN: filename.mk:2: To use MANZ at load time, "+
+			".include \"../../mk/bsd.prefs.mk\" first.",
+		"",
+		"\tThe user-settable variables and several other variables from the",
+		"\tpkgsrc infrastructure are only available after the preferences have",
+		"\tbeen loaded.",
+		"",
+		"\tBefore that, these variables are undefined.",
+		"",
+		"WARN: filename.mk:2: The user-defined variable MANZ "+
+			"is used but not added to BUILD_DEFS.",
+		"",
+		"\tWhen a pkgsrc package is built, many things can be configured by the",
+		"\tpkgsrc user in the mk.conf file. All these configurations should be",
+		"\trecorded in the binary package so the package can be reliably",
+		"\trebuilt. The BUILD_DEFS variable contains a list of all these",
+		"\tuser-settable variables, so add your variable to it, too.",
+		"",
+		"WARN: filename.mk:4: The user-defined variable OBJHOSTNAME "+
+			"is used but not added to BUILD_DEFS.",
+		"WARN: other.mk:2: The user-settable variable OBJHOSTNAME "+
+			"is undefined until \"../../mk/bsd.prefs.mk\" is included.",
+		"",
+		"\tThe variables from mk.conf are loaded by bsd.prefs.mk. Before that,",
+		"\tthis variable is undefined.",
+		"",
+		"\tThe pkgsrc infrastructure only uses this variable at run time, for",
+		"\texample in shell commands. Either include bsd.prefs.mk before this",
+		"\tline, or use the variable at run time as well.",
+		"",
+		"WARN: other.mk:2: The user-defined variable OBJHOSTNAME "+
+			"is used but not added to BUILD_DEFS.",
+		"WARN: other.mk:4: The user-defined variable MANZ "+
+			"is used but not added to BUILD_DEFS.")
+}
+
 func (s *Suite) Test_MkExprChecker_checkUseAtLoadTime__package_settable(c *check.C) {
 	t := s.Init(c)
 
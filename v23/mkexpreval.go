@@ -0,0 +1,784 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/makepat"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MkExprEvaluator computes the value of expressions like ${VAR:Mpattern}
+// in the same way as bmake, based on the variable definitions from a Scope.
+//
+// In contrast to bmake, the evaluator does not know the complete state
+// of the variables. Variables that are not defined in the scope may still
+// be defined elsewhere, for example in the pkgsrc infrastructure or on the
+// command line. Modifiers like :sh, :!cmd! or :Ox depend on the environment.
+// In all these cases, the evaluator computes the value as far as possible
+// but marks it as not fully known.
+//
+// See devel/bmake/files/var.c.
+type MkExprEvaluator struct {
+	scope    *Scope            // optional
+	curdir   string            // the value of ${.CURDIR}, optional
+	parsedir string            // the value of ${.PARSEDIR}, optional
+	fixed    map[string]string // from Define and from the :@var@...@ modifier
+	active   map[string]bool   // to prevent endless recursion
+}
+
+// mkExprValue is the intermediate result when applying the modifiers
+// of an expression one after another.
+type mkExprValue struct {
+	value   string
+	defined bool
+	known   bool
+
+	// The separator for joining the words, see the :ts modifier.
+	sep string
+
+	// Whether the value is treated as a single word, see the :tW modifier.
+	oneWord bool
+}
+
+func NewMkExprEvaluator(scope *Scope, curdir CurrPath, parsedir CurrPath) *MkExprEvaluator {
+	return &MkExprEvaluator{
+		scope,
+		curdir.String(),
+		parsedir.String(),
+		make(map[string]string),
+		make(map[string]bool)}
+}
+
+// Define sets the variable to a fixed value,
+// which takes precedence over the value from the scope.
+func (e *MkExprEvaluator) Define(varname string, value string) {
+	e.fixed[varname] = value
+}
+
+// Eval evaluates the text, which may contain expressions, such as
+// "${PREFIX}/share/${PKGBASE:tl}".
+//
+// It returns the resulting value and whether this value is fully known.
+func (e *MkExprEvaluator) Eval(text string) (string, bool) {
+	return e.expand(text, "", nil)
+}
+
+// EvalExpr evaluates a single expression, including its modifiers.
+func (e *MkExprEvaluator) EvalExpr(expr *MkExpr) (string, bool) {
+	varname, nameKnown := e.Eval(expr.varname)
+
+	var v mkExprValue
+	if expr.IsExpression() {
+		// For ${text:L} and ${cond:?then:else}, the "variable name"
+		// is actually the value, see MkLexer.exprBrace.
+		v = mkExprValue{varname, true, nameKnown, " ", false}
+	} else {
+		value, defined, known := e.value(varname)
+		v = mkExprValue{value, defined, known && nameKnown, " ", false}
+	}
+
+	for _, mod := range expr.modifiers {
+		e.modify(&v, varname, mod)
+	}
+
+	if trace.Tracing {
+		trace.Stepf("EvalExpr %q => %q, known %v", expr.String(), v.value, v.known)
+	}
+	return v.value, v.known
+}
+
+// EvalCond evaluates a condition from an .if or .elif directive.
+//
+// It returns the result and whether the result is known.
+// The result of a condition is known if it depends only on variables whose
+// value is known, even if some of the other variables are unknown,
+// such as in "${KNOWN} == yes || ${UNKNOWN} == yes".
+//
+// See devel/bmake/files/cond.c.
+func (e *MkExprEvaluator) EvalCond(cond *MkCond) (result bool, known bool) {
+	switch {
+	case cond.Or != nil, cond.And != nil:
+		isOr := cond.Or != nil
+		conds := cond.And
+		if isOr {
+			conds = cond.Or
+		}
+		known = true
+		for _, sub := range conds {
+			subResult, subKnown := e.EvalCond(sub)
+			if subKnown && subResult == isOr {
+				return isOr, true
+			}
+			known = known && subKnown
+		}
+		return !isOr && known, known
+
+	case cond.Not != nil:
+		result, known = e.EvalCond(cond.Not)
+		return !result, known
+
+	case cond.Paren != nil:
+		return e.EvalCond(cond.Paren)
+
+	case cond.Defined != "":
+		_, defined, known := e.value(cond.Defined)
+		return defined, known || defined
+
+	case cond.Empty != nil:
+		value, known := e.EvalExpr(cond.Empty)
+		return value == "", known
+
+	case cond.Term != nil:
+		value, known := e.evalCondTerm(cond.Term)
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n != 0, known
+		}
+		// A plain word would be interpreted as "defined(word)".
+		return value != "", known && cond.Term.Str == ""
+
+	case cond.Compare != nil:
+		left, leftKnown := e.evalCondTerm(&cond.Compare.Left)
+		right, rightKnown := e.evalCondTerm(&cond.Compare.Right)
+		known = leftKnown && rightKnown
+
+		ln, lerr := strconv.ParseFloat(left, 64)
+		rn, rerr := strconv.ParseFloat(right, 64)
+		if lerr == nil && rerr == nil {
+			switch cond.Compare.Op {
+			case "<":
+				return ln < rn, known
+			case "<=":
+				return ln <= rn, known
+			case ">":
+				return ln > rn, known
+			case ">=":
+				return ln >= rn, known
+			case "!=":
+				return ln != rn, known
+			}
+			return ln == rn, known
+		}
+
+		switch cond.Compare.Op {
+		case "==":
+			return left == right, known
+		case "!=":
+			return left != right, known
+		}
+	}
+
+	// Function calls like exists(file) or target(name) depend on the
+	// environment, and non-numeric values cannot be compared using < or >.
+	return false, false
+}
+
+func (e *MkExprEvaluator) evalCondTerm(term *MkCondTerm) (string, bool) {
+	switch {
+	case term.Expr != nil:
+		return e.EvalExpr(term.Expr)
+	case term.Num != "":
+		return term.Num, true
+	}
+	return e.expand(term.Str, "", nil)
+}
+
+// value returns the value of the variable, with all nested expressions
+// resolved.
+//
+// A variable that is not defined in the scope may still be defined
+// elsewhere, therefore its value is not known.
+func (e *MkExprEvaluator) value(varname string) (value string, defined bool, known bool) {
+	if value, found := e.fixed[varname]; found {
+		return value, true, true
+	}
+
+	switch varname {
+	case "":
+		// The variable with the empty name is never defined.
+		// It is typically used in expressions like ${:Uvalue}.
+		return "", false, true
+	case ".CURDIR":
+		return e.curdir, e.curdir != "", e.curdir != ""
+	case ".PARSEDIR":
+		return e.parsedir, e.parsedir != "", e.parsedir != ""
+	}
+
+	if e.scope == nil {
+		return "", false, false
+	}
+	raw, found, indeterminate := e.scope.LastValueFound(varname)
+	if !found {
+		return "", false, false
+	}
+	if e.active[varname] {
+		// bmake would fail with "Variable VAR is recursive".
+		return "", true, false
+	}
+
+	e.active[varname] = true
+	value, known = e.Eval(raw)
+	delete(e.active, varname)
+	return value, true, known && !indeterminate
+}
+
+// expand resolves the nested expressions in the text.
+//
+// In modifier arguments, a backslash escapes the characters from escapes.
+// In the replacement of the :S modifier, lhs is given, and each "&"
+// is replaced with it.
+func (e *MkExprEvaluator) expand(text string, escapes string, lhs *string) (string, bool) {
+	if !contains(text, "$") && !contains(text, "\\") && !contains(text, "&") {
+		return text, true
+	}
+
+	var sb strings.Builder
+	known := true
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '\\' && i+1 < len(text) &&
+			(strings.IndexByte(escapes, text[i+1]) >= 0 || lhs != nil && text[i+1] == '&'):
+			sb.WriteByte(text[i+1])
+			i += 2
+
+		case ch == '&' && lhs != nil:
+			sb.WriteString(*lhs)
+			i++
+
+		case hasPrefix(text[i:], "$$"):
+			sb.WriteByte('$')
+			i += 2
+
+		case ch == '$':
+			lexer := NewMkLexer(text[i:], nil)
+			expr := lexer.Expr()
+			if expr == nil {
+				sb.WriteByte(ch)
+				i++
+				break
+			}
+			value, valueKnown := e.EvalExpr(expr)
+			sb.WriteString(value)
+			known = known && valueKnown
+			end := len(text) - len(lexer.Rest())
+			if (text[i+1] == '{' || text[i+1] == '(') && expr.String() != "${"+text[i+2:end-1]+"}" {
+				// A parse error, such as a missing closing brace
+				// or a modifier that the lexer skipped.
+				known = false
+			}
+			i = end
+
+		default:
+			sb.WriteByte(ch)
+			i++
+		}
+	}
+	return sb.String(), known
+}
+
+// modify applies a single modifier to the value.
+//
+// See devel/bmake/files/var.c:/^ApplyModifier/.
+func (e *MkExprEvaluator) modify(v *mkExprValue, varname string, mod MkExprModifier) {
+	text := mod.String()
+
+	switch text {
+	case "L":
+		v.value, v.defined = varname, true
+		return
+	case "P":
+		// Since pkglint doesn't know about targets,
+		// this is the same as :L.
+		v.value, v.defined = varname, true
+		return
+	case "Q":
+		v.value = e.quote(v.value)
+		return
+	case "E", "H", "R", "T":
+		e.modifyWords(v, func(word string) string { return e.pathPart(word, text) })
+		return
+	case "O", "Ox":
+		words := e.words(v)
+		sort.Strings(words)
+		v.value = strings.Join(words, " ")
+		if text == "Ox" {
+			// The words are shuffled randomly.
+			v.known = false
+		}
+		return
+	case "u":
+		words := e.words(v)
+		var uniq []string
+		for i, word := range words {
+			if i == 0 || word != words[i-1] {
+				uniq = append(uniq, word)
+			}
+		}
+		v.value = strings.Join(uniq, " ")
+		return
+	case "tl":
+		v.value = strings.ToLower(v.value)
+		return
+	case "tu":
+		v.value = strings.ToUpper(v.value)
+		return
+	case "tw":
+		v.oneWord = false
+		return
+	case "tW":
+		v.oneWord = true
+		return
+	}
+
+	if text == "range" || hasPrefix(text, "range=") {
+		e.rangeWords(v, text)
+		return
+	}
+
+	switch text[0] {
+	case 'M', 'N':
+		e.match(v, mod)
+		return
+	case 'S', 'C':
+		e.subst(v, mod)
+		return
+	case '@':
+		e.loop(v, text)
+		return
+	case 'U', 'D':
+		if v.defined == (text[0] == 'D') {
+			arg, known := e.expand(text[1:], ":$\\})", nil)
+			v.value = arg
+			v.known = v.known && known
+		}
+		v.defined = true
+		return
+	case '[':
+		e.selectWords(v, text[1:len(text)-1])
+		return
+	case '$':
+		e.modifyIndirect(v, varname, mod)
+		return
+	}
+
+	if text[0] == 't' && hasPrefix(text, "ts") {
+		e.toSep(v, text[2:])
+		return
+	}
+
+	if text[0] != ':' && text[0] != '!' && text[0] != '?' && contains(text, "=") {
+		e.suffixSubst(v, text)
+		return
+	}
+
+	// The remaining modifiers, such as :sh, :!cmd!, :tA, :?then:else
+	// or :::=, depend on the environment or have side effects.
+	v.known = false
+}
+
+func (e *MkExprEvaluator) words(v *mkExprValue) []string {
+	if v.oneWord {
+		return []string{v.value}
+	}
+	return strings.Fields(v.value)
+}
+
+// modifyWords applies the function to each word of the value
+// and joins the results using the current separator.
+// Empty results are skipped.
+func (e *MkExprEvaluator) modifyWords(v *mkExprValue, f func(word string) string) {
+	var result []string
+	for _, word := range e.words(v) {
+		if modified := f(word); modified != "" {
+			result = append(result, modified)
+		}
+	}
+	v.value = strings.Join(result, v.sep)
+}
+
+// pathPart implements the modifiers :H, :T, :E and :R.
+func (e *MkExprEvaluator) pathPart(word string, mod string) string {
+	slash := strings.LastIndexByte(word, '/')
+	base := word[slash+1:]
+	dot := strings.LastIndexByte(base, '.')
+
+	switch mod {
+	case "H":
+		if slash < 0 {
+			return "."
+		}
+		return word[:slash]
+	case "T":
+		return base
+	case "E":
+		if dot < 0 {
+			return ""
+		}
+		return base[dot+1:]
+	default:
+		if dot < 0 {
+			return word
+		}
+		return word[:len(word)-len(base)+dot]
+	}
+}
+
+// quote implements the :Q modifier, which escapes all characters that
+// have a special meaning in the shell.
+func (e *MkExprEvaluator) quote(value string) string {
+	var sb strings.Builder
+	for _, ch := range []byte(value) {
+		if strings.IndexByte(" \t\n\"#$&'()*:;<=>?[\\]^`{|}~", ch) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+// match implements the :M and :N modifiers.
+func (e *MkExprEvaluator) match(v *mkExprValue, mod MkExprModifier) {
+	_, positive, pattern, _ := mod.MatchMatch()
+
+	pattern, known := e.expand(pattern, "", nil)
+	v.known = v.known && known
+
+	pat, err := makepat.Compile(pattern)
+	if err != nil {
+		v.value = ""
+		v.known = false
+		return
+	}
+
+	var matched []string
+	for _, word := range e.words(v) {
+		if pat.Match(word) == positive {
+			matched = append(matched, word)
+		}
+	}
+	v.value = strings.Join(matched, " ")
+}
+
+// subst implements the :S and :C modifiers.
+func (e *MkExprEvaluator) subst(v *mkExprValue, mod MkExprModifier) {
+	ok, isRegex, from, to, options := mod.MatchSubst()
+	if !ok {
+		v.known = false
+		return
+	}
+
+	global := contains(options, "g")
+	once := contains(options, "1")
+	words := e.words(v)
+	if contains(options, "W") {
+		words = []string{v.value}
+	}
+
+	var replace func(word string) (string, bool)
+	if isRegex {
+		pattern, patternKnown := e.expand(from, "$\\", nil)
+		repl, replKnown := e.expand(to, "$\\", nil)
+		v.known = v.known && patternKnown && replKnown
+
+		re, err := regexp.CompilePOSIX(pattern)
+		if err != nil {
+			v.known = false
+			return
+		}
+		replace = func(word string) (string, bool) {
+			result, matched, ok := regexSubst(word, re, repl, global)
+			if !ok {
+				v.known = false
+			}
+			return result, matched
+		}
+
+	} else {
+		left := hasPrefix(from, "^")
+		if left {
+			from = from[1:]
+		}
+		right := hasSuffix(from, "$") && !hasSuffix(from, "\\$")
+		if right {
+			from = from[:len(from)-1]
+		}
+
+		lhs, lhsKnown := e.expand(from, "$\\", nil)
+		rhs, rhsKnown := e.expand(to, "$\\", &lhs)
+		v.known = v.known && lhsKnown && rhsKnown
+
+		replace = func(word string) (string, bool) {
+			return e.substWord(word, left, lhs, right, rhs, global)
+		}
+	}
+
+	var result []string
+	done := false
+	for _, word := range words {
+		if !(once && done) {
+			var matched bool
+			word, matched = replace(word)
+			done = done || matched
+		}
+		if word != "" {
+			result = append(result, word)
+		}
+	}
+	v.value = strings.Join(result, v.sep)
+}
+
+// substWord replaces the literal lhs with rhs in a single word,
+// for the :S modifier.
+func (e *MkExprEvaluator) substWord(word string, left bool, lhs string, right bool, rhs string, global bool) (string, bool) {
+	switch {
+	case left && right:
+		if word == lhs {
+			return rhs, true
+		}
+	case left:
+		if hasPrefix(word, lhs) {
+			return rhs + word[len(lhs):], true
+		}
+	case right:
+		if hasSuffix(word, lhs) {
+			return word[:len(word)-len(lhs)] + rhs, true
+		}
+	case lhs == "":
+		return rhs + word, true
+	case contains(word, lhs):
+		return strings.Replace(word, lhs, rhs, condInt(global, -1, 1)), true
+	}
+	return word, false
+}
+
+// loop implements the :@var@body@ modifier, which evaluates the body
+// once for each word, with the variable set to that word.
+func (e *MkExprEvaluator) loop(v *mkExprValue, text string) {
+	parts := strings.SplitN(text[1:], "@", 2)
+	if len(parts) != 2 {
+		v.known = false
+		return
+	}
+	loopVar := parts[0]
+	body := strings.TrimSuffix(parts[1], "@")
+
+	prev, hasPrev := e.fixed[loopVar]
+	e.modifyWords(v, func(word string) string {
+		e.fixed[loopVar] = word
+		result, known := e.expand(body, "@$\\", nil)
+		v.known = v.known && known
+		return result
+	})
+	if hasPrev {
+		e.fixed[loopVar] = prev
+	} else {
+		delete(e.fixed, loopVar)
+	}
+}
+
+// selectWords implements the :[...] modifier,
+// such as :[#], :[1], :[-1], :[2..3].
+func (e *MkExprEvaluator) selectWords(v *mkExprValue, arg string) {
+	if arg == "#" {
+		v.value = strconv.Itoa(len(e.words(v)))
+		return
+	}
+
+	words := strings.Fields(v.value)
+	index := func(s string) (int, bool) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n == 0 {
+			return 0, false
+		}
+		if n < 0 {
+			n += len(words) + 1
+		}
+		return n, true
+	}
+
+	switch arg {
+	case "0", "*":
+		v.oneWord = true
+		return
+	case "@":
+		v.oneWord = false
+		return
+	}
+
+	bounds := strings.SplitN(arg, "..", 2)
+	first, ok1 := index(bounds[0])
+	last, ok2 := first, ok1
+	if len(bounds) == 2 {
+		last, ok2 = index(bounds[1])
+	}
+	if !ok1 || !ok2 {
+		v.value = ""
+		v.known = false
+		return
+	}
+
+	var selected []string
+	step := condInt(first <= last, 1, -1)
+	for i := first; ; i += step {
+		if i >= 1 && i <= len(words) {
+			selected = append(selected, words[i-1])
+		}
+		if i == last {
+			break
+		}
+	}
+	v.value = strings.Join(selected, v.sep)
+	v.oneWord = false
+}
+
+// rangeWords implements the :range and :range=N modifiers, which replace
+// the value with the numbers from 1 to the number of words, or to N.
+func (e *MkExprEvaluator) rangeWords(v *mkExprValue, text string) {
+	n := len(e.words(v))
+	if hasPrefix(text, "range=") {
+		arg, known := e.expand(text[6:], ":$\\", nil)
+		num, err := strconv.Atoi(arg)
+		if !known || err != nil || num < 0 {
+			v.value = ""
+			v.known = false
+			return
+		}
+		n = num
+	}
+
+	nums := make([]string, n)
+	for i := range nums {
+		nums[i] = strconv.Itoa(i + 1)
+	}
+	v.value = strings.Join(nums, " ")
+	v.oneWord = false
+}
+
+// modifyIndirect implements modifiers like ${VAR:${MODIFIERS}},
+// in which the modifiers come from another expression.
+func (e *MkExprEvaluator) modifyIndirect(v *mkExprValue, varname string, mod MkExprModifier) {
+	text, known := e.Eval(mod.String())
+	v.known = v.known && known
+
+	lexer := NewMkLexer(":"+text, nil)
+	mods := lexer.ExprModifiers(varname, '}')
+	if !lexer.EOF() {
+		v.known = false
+	}
+	for _, mod := range mods {
+		e.modify(v, varname, mod)
+	}
+}
+
+// toSep implements the :ts modifier, which joins the words using
+// the given separator.
+// The separator is also used by the following modifiers.
+func (e *MkExprEvaluator) toSep(v *mkExprValue, sep string) {
+	switch {
+	case sep == "" || len(sep) == 1:
+		break
+	case sep == "\\n":
+		sep = "\n"
+	case sep == "\\t":
+		sep = "\t"
+	case hasPrefix(sep, "\\x"):
+		n, err := strconv.ParseUint(sep[2:], 16, 8)
+		if err != nil {
+			v.known = false
+			return
+		}
+		sep = string(rune(n))
+	default:
+		n, err := strconv.ParseUint(sep[1:], 8, 8)
+		if err != nil || sep[0] != '\\' {
+			v.known = false
+			return
+		}
+		sep = string(rune(n))
+	}
+
+	v.sep = sep
+	v.value = strings.Join(e.words(v), sep)
+}
+
+// suffixSubst implements the System V style substitution :from=to,
+// which replaces the suffix of each word,
+// or the pattern with "%" if from contains a "%".
+func (e *MkExprEvaluator) suffixSubst(v *mkExprValue, text string) {
+	// Find the first "=" outside nested expressions.
+	lexer := NewMkLexer(text, nil)
+	for !lexer.EOF() && lexer.lexer.PeekByte() != '=' {
+		if lexer.Expr() == nil {
+			lexer.lexer.Skip(1)
+		}
+	}
+	eq := len(text) - len(lexer.Rest())
+
+	from, fromKnown := e.expand(text[:eq], "=$\\", nil)
+	to, toKnown := e.expand(text[eq+1:], "$\\", nil)
+	v.known = v.known && fromKnown && toKnown
+
+	e.modifyWords(v, func(word string) string {
+		if pct := strings.IndexByte(from, '%'); pct >= 0 {
+			prefix, suffix := from[:pct], from[pct+1:]
+			if len(word) < len(prefix)+len(suffix) ||
+				!hasPrefix(word, prefix) || !hasSuffix(word, suffix) {
+				return word
+			}
+			stem := word[len(prefix) : len(word)-len(suffix)]
+			return strings.Replace(to, "%", stem, 1)
+		}
+
+		if hasSuffix(word, from) {
+			return word[:len(word)-len(from)] + to
+		}
+		return word
+	})
+}
+
+// regexSubst implements the :C modifier for a single word,
+// using the POSIX semantics for regular expressions.
+//
+// In the replacement, "&" stands for the whole match and "\1" to "\9" for
+// the parenthesized subexpressions.
+// The result is not ok if the replacement refers to a subexpression that
+// doesn't exist in the regular expression.
+//
+// See devel/bmake/files/var.c:/^RegexReplace/.
+func regexSubst(word string, re *regexp.Regexp, repl string, global bool) (result string, matched bool, ok bool) {
+	locs := re.FindAllStringSubmatchIndex(word, condInt(global, -1, 1))
+	if locs == nil {
+		return word, false, true
+	}
+
+	ok = true
+	var sb strings.Builder
+	prev := 0
+	for _, loc := range locs {
+		sb.WriteString(word[prev:loc[0]])
+		for i := 0; i < len(repl); i++ {
+			ch := repl[i]
+			switch {
+			case ch == '\\' && i+1 < len(repl) && (repl[i+1] == '&' || repl[i+1] == '\\'):
+				sb.WriteByte(repl[i+1])
+				i++
+			case ch == '&':
+				sb.WriteString(word[loc[0]:loc[1]])
+			case ch == '\\' && i+1 < len(repl) && repl[i+1] >= '0' && repl[i+1] <= '9':
+				n := int(repl[i+1] - '0')
+				i++
+				if 2*n+1 >= len(loc) {
+					ok = false
+				} else if loc[2*n] >= 0 {
+					sb.WriteString(word[loc[2*n]:loc[2*n+1]])
+				}
+			default:
+				sb.WriteByte(ch)
+			}
+		}
+		prev = loc[1]
+	}
+	sb.WriteString(word[prev:])
+	return sb.String(), true, ok
+}
@@ -0,0 +1,580 @@
+package pkglint
+
+import (
+	"gopkg.in/check.v1"
+	"regexp"
+)
+
+// newEvaluatorTest returns an evaluator whose scope contains the given
+// variable assignments, in the form "VAR=\tvalue".
+func newEvaluatorTest(t *Tester, assignments ...string) *MkExprEvaluator {
+	scope := NewScope()
+	for i, assignment := range assignments {
+		mkline := t.NewMkLine("filename.mk", i+1, assignment)
+		scope.Define(mkline.Varname(), mkline)
+	}
+	return NewMkExprEvaluator(&scope, "category/package", "category/package/../../mk")
+}
+
+func (s *Suite) Test_NewMkExprEvaluator(c *check.C) {
+	t := s.Init(c)
+
+	e := NewMkExprEvaluator(nil, "", "")
+
+	t.CheckEquals(e.curdir, "")
+	t.CheckEquals(e.parsedir, "")
+	t.CheckLen(e.fixed, 0)
+}
+
+func (s *Suite) Test_MkExprEvaluator_Define(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"OPSYS=\tNetBSD")
+
+	e.Define("OPSYS", "Linux")
+	e.Define("MACHINE_ARCH", "x86_64")
+
+	// Variables from Define take precedence over those from the scope.
+	value, known := e.Eval("${OPSYS}-${MACHINE_ARCH}")
+	t.CheckEquals(value, "Linux-x86_64")
+	t.CheckEquals(known, true)
+}
+
+func (s *Suite) Test_MkExprEvaluator_Eval(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"PKGBASE=\tPackage",
+		"PREFIX=\t/usr/pkg")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("plain text", "plain text", true)
+	test("${PREFIX}/share/${PKGBASE:tl}", "/usr/pkg/share/package", true)
+	test("$$HOME", "$HOME", true)
+
+	// The variable may be defined in the pkgsrc infrastructure,
+	// therefore its value is not known.
+	test("${LOCALBASE}/bin", "/bin", false)
+
+	// After a parse error, the value is not known.
+	test("${PREFIX", "/usr/pkg", false)
+	test("$(PREFIX", "/usr/pkg", false)
+	test("$(PREFIX)", "/usr/pkg", true)
+	test("${PREFIX:Xinvalid}", "/usr/pkg", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_EvalExpr(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"OPSYS=\tNetBSD",
+		"VAR.NetBSD=\tnetbsd-value")
+
+	test := func(text string, value string, known bool) {
+		expr := NewMkLexer(text, nil).Expr()
+		actualValue, actualKnown := e.EvalExpr(expr)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${OPSYS}", "NetBSD", true)
+	test("${VAR.${OPSYS}}", "netbsd-value", true)
+	test("${VAR.${UNKNOWN}}", "", false)
+	test("${literal text:L}", "literal text", true)
+	test("${OPSYS:tu:S,NET,Net,}", "NetBSD", true)
+
+	// The condition of the :? modifier is not evaluated.
+	test("${OPSYS == NetBSD:?yes:no}", "OPSYS == NetBSD", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_EvalCond(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"OPSYS=\tNetBSD",
+		"OS_VERSION=\t10.0",
+		"EMPTY=\t# none",
+		"APPENDED+=\tvalue")
+
+	test := func(cond string, result bool, known bool) {
+		mkcond := NewMkParser(nil, cond).MkCond()
+		actualResult, actualKnown := e.EvalCond(mkcond)
+		t.CheckDeepEquals(
+			[]interface{}{actualResult, actualKnown},
+			[]interface{}{result, known})
+	}
+
+	test("${OPSYS} == NetBSD", true, true)
+	test("${OPSYS} != NetBSD", false, true)
+	test("!(${OPSYS} == NetBSD)", false, true)
+	test("${OS_VERSION} >= 9", true, true)
+	test("${OS_VERSION} < 9.5", false, true)
+	test("${OPSYS:MNet*}", true, true)
+	test("defined(OPSYS)", true, true)
+	test("empty(EMPTY)", true, true)
+	test("empty(OPSYS)", false, true)
+
+	// Appending to an undefined variable doesn't add a leading space.
+	test("${APPENDED} == value", true, true)
+
+	// The value of UNKNOWN may come from the pkgsrc infrastructure.
+	test("${UNKNOWN} == yes", false, false)
+	test("defined(UNKNOWN)", false, false)
+
+	// If one of the operands determines the result,
+	// the other operands don't matter.
+	test("${OPSYS} == NetBSD || ${UNKNOWN} == yes", true, true)
+	test("${UNKNOWN} == yes || ${OPSYS} == NetBSD", true, true)
+	test("${OPSYS} == Linux && ${UNKNOWN} == yes", false, true)
+	test("${OPSYS} == NetBSD && ${UNKNOWN} == yes", false, false)
+
+	// Function calls depend on the file system or on the targets.
+	test("exists(/usr/bin/cc)", false, false)
+	test("${OPSYS} < Linux", false, false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_evalCondTerm(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"OPSYS=\tNetBSD")
+
+	test := func(term MkCondTerm, value string, known bool) {
+		actualValue, actualKnown := e.evalCondTerm(&term)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test(MkCondTerm{Expr: NewMkExpr("OPSYS")}, "NetBSD", true)
+	test(MkCondTerm{Num: "123"}, "123", true)
+	test(MkCondTerm{Str: "${OPSYS}-x"}, "NetBSD-x", true)
+	test(MkCondTerm{Str: "${UNKNOWN}-x"}, "-x", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_value(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"DEFAULT?=\tdefault",
+		"DEFAULT?=\tignored",
+		"APPEND=\tfirst",
+		"APPEND+=\tsecond",
+		"NESTED=\t${APPEND:[2]}",
+		"SHELL_CMD!=\techo hello",
+		"RECURSIVE=\t${RECURSIVE}")
+
+	test := func(varname string, value string, defined, known bool) {
+		actualValue, actualDefined, actualKnown := e.value(varname)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualDefined, actualKnown},
+			[]interface{}{value, defined, known})
+	}
+
+	test("DEFAULT", "default", true, true)
+	test("APPEND", "first second", true, true)
+	test("NESTED", "second", true, true)
+	test("SHELL_CMD", "", true, false)
+	test("RECURSIVE", "", true, false)
+	test("UNDEFINED", "", false, false)
+	test("", "", false, true)
+	test(".CURDIR", "category/package", true, true)
+	test(".PARSEDIR", "category/package/../../mk", true, true)
+
+	e.curdir = ""
+	test(".CURDIR", "", false, false)
+
+	e.fixed["DEFAULT"] = "loop"
+	test("DEFAULT", "loop", true, true)
+}
+
+func (s *Suite) Test_MkExprEvaluator_expand(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"VAR=\tvalue")
+
+	test := func(text string, escapes string, lhs *string, value string, known bool) {
+		actualValue, actualKnown := e.expand(text, escapes, lhs)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	lhs := "left"
+
+	test("no expressions", "", nil, "no expressions", true)
+	test("${VAR}-$$-$", "", nil, "value-$-$", true)
+	test("a\\$b\\:c", "$", nil, "a$b\\:c", true)
+	test("[&] [\\&]", "", &lhs, "[left] [&]", true)
+	test("[&] [\\&]", "", nil, "[&] [\\&]", true)
+	test("${UNDEFINED}", "", nil, "", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_modify(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"LIST=\tb a c a a",
+		"FILES=\t/usr/pkg/share/doc/README.txt lib/libfoo.so.1 Makefile",
+		"MIXED=\tMixed Case",
+		"EMPTY=\t# none",
+		"MODS=\tMa*:O")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${LIST:O}", "a a a b c", true)
+	test("${LIST:Ox}", "a a a b c", false)
+	test("${LIST:u}", "b a c a", true)
+	test("${LIST:O:u}", "a b c", true)
+	test("${LIST:Ma}", "a a a", true)
+	test("${LIST:Na}", "b c", true)
+	test("${FILES:H}", "/usr/pkg/share/doc lib .", true)
+	test("${FILES:T}", "README.txt libfoo.so.1 Makefile", true)
+	test("${FILES:E}", "txt 1", true)
+	test("${FILES:R}", "/usr/pkg/share/doc/README lib/libfoo.so Makefile", true)
+	test("${MIXED:tl}", "mixed case", true)
+	test("${MIXED:tu}", "MIXED CASE", true)
+	test("${MIXED:Q}", "Mixed\\ Case", true)
+	test("${MIXED:U}", "Mixed Case", true)
+	test("${UNDEFINED:Ufallback}", "fallback", false)
+	test("${:Ufallback}", "fallback", true)
+	test("${:Ua\\:b}", "a:b", true)
+	test("${MIXED:Ddefined}", "defined", true)
+	test("${:Ddefined}", "", true)
+	test("${:Ufirst:Dsecond}", "second", true)
+	test("${MIXED:L}", "MIXED", true)
+	test("${MIXED:P}", "MIXED", true)
+	test("${EMPTY:U}", "", true)
+	test("${LIST:[#]}", "5", true)
+	test("${LIST:${MODS}}", "a a a", true)
+	test("${LIST:tW:[#]}", "1", true)
+	test("${LIST:tW:tw:[#]}", "5", true)
+	test("${LIST:ts,}", "b,a,c,a,a", true)
+	test("${LIST:@w@<${w}>@}", "<b> <a> <c> <a> <a>", true)
+	test("${FILES:.txt=.html}", "/usr/pkg/share/doc/README.html lib/libfoo.so.1 Makefile", true)
+	test("${LIST:sh}", "b a c a a", false)
+	test("${LIST:tA}", "b a c a a", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_words(c *check.C) {
+	t := s.Init(c)
+
+	e := NewMkExprEvaluator(nil, "", "")
+
+	t.CheckDeepEquals(
+		e.words(&mkExprValue{" a  b\tc ", true, true, " ", false}),
+		[]string{"a", "b", "c"})
+	t.CheckDeepEquals(
+		e.words(&mkExprValue{" a  b\tc ", true, true, " ", true}),
+		[]string{" a  b\tc "})
+}
+
+func (s *Suite) Test_MkExprEvaluator_modifyWords(c *check.C) {
+	t := s.Init(c)
+
+	e := NewMkExprEvaluator(nil, "", "")
+	v := mkExprValue{"a b c", true, true, "-", false}
+
+	e.modifyWords(&v, func(word string) string {
+		return condStr(word == "b", "", word+word)
+	})
+
+	t.CheckEquals(v.value, "aa-cc")
+}
+
+func (s *Suite) Test_MkExprEvaluator_pathPart(c *check.C) {
+	t := s.Init(c)
+
+	e := NewMkExprEvaluator(nil, "", "")
+
+	test := func(word, mod, result string) {
+		t.CheckEquals(e.pathPart(word, mod), result)
+	}
+
+	test("dir.d/file.tar.gz", "H", "dir.d")
+	test("dir.d/file.tar.gz", "T", "file.tar.gz")
+	test("dir.d/file.tar.gz", "E", "gz")
+	test("dir.d/file.tar.gz", "R", "dir.d/file.tar")
+	test("dir.d/file", "E", "")
+	test("dir.d/file", "R", "dir.d/file")
+	test("file", "H", ".")
+	test("/file", "H", "")
+	test("dir/", "T", "")
+}
+
+func (s *Suite) Test_MkExprEvaluator_quote(c *check.C) {
+	t := s.Init(c)
+
+	e := NewMkExprEvaluator(nil, "", "")
+
+	t.CheckEquals(e.quote("plain-text_1.0"), "plain-text_1.0")
+	t.CheckEquals(e.quote("a b"), "a\\ b")
+	t.CheckEquals(e.quote("\"$HOME\" 'single' *.c"), "\\\"\\$HOME\\\"\\ \\'single\\'\\ \\*.c")
+}
+
+func (s *Suite) Test_MkExprEvaluator_match(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"PATTERN=\t*.c",
+		"FILES=\tmain.c main.h util.c")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${FILES:M*.c}", "main.c util.c", true)
+	test("${FILES:N*.c}", "main.h", true)
+	test("${FILES:M${PATTERN}}", "main.c util.c", true)
+	test("${FILES:M[mu]*.[ch]}", "main.c main.h util.c", true)
+	test("${FILES:M${UNKNOWN}}", "", false)
+
+	// Malformed patterns are errors in bmake.
+	test("${FILES:M[}", "", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_subst(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"WORDS=\taaa bab aba",
+		"DISTNAME=\tPackage_1_0")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	// The :S modifier is applied to each word separately.
+	test("${WORDS:S,a,x,}", "xaa bxb xba", true)
+	test("${WORDS:S,a,x,g}", "xxx bxb xbx", true)
+	test("${WORDS:S,a,x,1}", "xaa bab aba", true)
+	test("${WORDS:S,^a,x,}", "xaa bab xba", true)
+	test("${WORDS:S,a$,x,}", "aax bab abx", true)
+	test("${WORDS:S,^aba$,x,}", "aaa bab x", true)
+	test("${WORDS:S,b,[&],g}", "aaa [b]a[b] a[b]a", true)
+	test("${WORDS:S,b,[\\&],g}", "aaa [&]a[&] a[&]a", true)
+	test("${WORDS:S,aaa,,}", "bab aba", true)
+	test("${WORDS:S,,x,}", "xaaa xbab xaba", true)
+	test("${WORDS:S, ,-,W}", "aaa-bab aba", true)
+
+	// The :C modifier uses POSIX extended regular expressions.
+	test("${DISTNAME:C/_/./g}", "Package.1.0", true)
+	test("${DISTNAME:C/^([^_]*)_(.*)/\\2-\\1/}", "1_0-Package", true)
+	test("${DISTNAME:C/[0-9]+/<&>/g:tl}", "package_<1>_<0>", true)
+	test("${WORDS:C/a/x/1}", "xaa bab aba", true)
+	test("${WORDS:C/a|b/x/g}", "xxx xxx xxx", true)
+	test("${WORDS:C/^a/x/g}", "xaa bab xba", true)
+
+	// The replacement refers to a subexpression that doesn't exist.
+	test("${DISTNAME:C/_/\\1/}", "Package1_0", false)
+
+	// Malformed regular expressions are errors in bmake.
+	test("${DISTNAME:C/(/x/}", "Package_1_0", false)
+
+	test("${DISTNAME:S/_/${UNKNOWN}/g}", "Package10", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_substWord(c *check.C) {
+	t := s.Init(c)
+
+	e := NewMkExprEvaluator(nil, "", "")
+
+	test := func(word string, left bool, lhs string, right bool, rhs string, global bool, result string, matched bool) {
+		actualResult, actualMatched := e.substWord(word, left, lhs, right, rhs, global)
+		t.CheckDeepEquals(
+			[]interface{}{actualResult, actualMatched},
+			[]interface{}{result, matched})
+	}
+
+	test("banana", false, "an", false, "AN", false, "bANana", true)
+	test("banana", false, "an", false, "AN", true, "bANANa", true)
+	test("banana", true, "ba", false, "", false, "nana", true)
+	test("banana", true, "na", false, "", false, "banana", false)
+	test("banana", false, "na", true, "NA", false, "banaNA", true)
+	test("banana", true, "banana", true, "", false, "", true)
+	test("banana", true, "", true, "x", false, "banana", false)
+	test("banana", false, "", false, "x", false, "xbanana", true)
+	test("banana", false, "x", false, "y", true, "banana", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_loop(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"PKGS=\tpkg1 pkg2",
+		"VERSION.pkg1=\t1.0",
+		"VERSION.pkg2=\t2.0")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${PKGS:@p@${p}-${VERSION.${p}}@}", "pkg1-1.0 pkg2-2.0", true)
+	test("${PKGS:@p@${p}-${UNKNOWN}@}", "pkg1- pkg2-", false)
+	test("${PKGS:@p@${PKGS:@q@${p}${q}@}@}", "pkg1pkg1 pkg1pkg2 pkg2pkg1 pkg2pkg2", true)
+
+	// The loop variable is only defined inside the loop.
+	test("${PKGS:@p@@}${p}", "", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_selectWords(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"WORDS=\tone two three four")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${WORDS:[#]}", "4", true)
+	test("${WORDS:[1]}", "one", true)
+	test("${WORDS:[-1]}", "four", true)
+	test("${WORDS:[2..3]}", "two three", true)
+	test("${WORDS:[-1..1]}", "four three two one", true)
+	test("${WORDS:[5]}", "", true)
+	test("${WORDS:[0]:[#]}", "1", true)
+	test("${WORDS:[1.2]}", "", false)
+
+	// The words are either a single word or separate words.
+	test("${WORDS:[*]:[#]}", "1", true)
+	test("${WORDS:[*]:[@]:[#]}", "4", true)
+	test("${WORDS:[*]}", "one two three four", true)
+}
+
+func (s *Suite) Test_MkExprEvaluator_rangeWords(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"WORDS=	one two three")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${WORDS:range}", "1 2 3", true)
+	test("${WORDS:range=5}", "1 2 3 4 5", true)
+	test("${WORDS:range=0}", "", true)
+	test("${WORDS:[*]:range}", "1", true)
+	test("${:range=${UNKNOWN}}", "", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_modifyIndirect(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"WORDS=\tb a c",
+		"SORT=\tO",
+		"FIRST=\tO:[1]")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${WORDS:${SORT}}", "a b c", true)
+	test("${WORDS:${FIRST}:tu}", "A", true)
+	test("${WORDS:${UNKNOWN}}", "b a c", false)
+}
+
+func (s *Suite) Test_MkExprEvaluator_toSep(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"WORDS=\ta b c")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${WORDS:ts,}", "a,b,c", true)
+	test("${WORDS:ts}", "abc", true)
+	test("${WORDS:ts\\n}", "a\nb\nc", true)
+	test("${WORDS:ts\\t}", "a\tb\tc", true)
+	test("${WORDS:ts\\072}", "a:b:c", true)
+	test("${WORDS:ts\\x2C}", "a,b,c", true)
+	test("${WORDS:ts\\x}", "a b c", false)
+
+	// The separator is also used by the following modifiers.
+	test("${WORDS:ts,:S,b,B,}", "a,B,c", true)
+}
+
+func (s *Suite) Test_MkExprEvaluator_suffixSubst(c *check.C) {
+	t := s.Init(c)
+
+	e := newEvaluatorTest(t,
+		"SRCS=\tmain.c util.c README",
+		"SUFFIX=\t.o")
+
+	test := func(text string, value string, known bool) {
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	test("${SRCS:.c=.o}", "main.o util.o README", true)
+	test("${SRCS:.c=${SUFFIX}}", "main.o util.o README", true)
+	test("${SRCS:%.c=obj/%.o}", "obj/main.o obj/util.o README", true)
+	test("${SRCS:%=pre-%-post}", "pre-main.c-post pre-util.c-post pre-README-post", true)
+	test("${SRCS:main%=}", "util.c README", true)
+	test("${SRCS:.c=${UNKNOWN}}", "main util README", false)
+}
+
+func (s *Suite) Test_regexSubst(c *check.C) {
+	t := s.Init(c)
+
+	test := func(word string, pattern string, repl string, global bool, result string, matched, ok bool) {
+		re := regexp.MustCompilePOSIX(pattern)
+		actualResult, actualMatched, actualOk := regexSubst(word, re, repl, global)
+		t.CheckDeepEquals(
+			[]interface{}{actualResult, actualMatched, actualOk},
+			[]interface{}{result, matched, ok})
+	}
+
+	test("banana", "an", "AN", false, "bANana", true, true)
+	test("banana", "an", "AN", true, "bANANa", true, true)
+	test("banana", "x", "y", true, "banana", false, true)
+	test("banana", "(b)(a)", "\\2\\1", false, "abnana", true, true)
+	test("banana", "n(a)", "<&\\1>", true, "ba<naa><naa>", true, true)
+	test("banana", "b", "\\&\\\\", false, "&\\anana", true, true)
+	test("banana", "b|(x)", "[\\1]", false, "[]anana", true, true)
+	test("banana", "b", "\\1", false, "anana", true, false)
+
+	// POSIX regular expressions prefer the leftmost-longest match.
+	test("banana", "a|ana", "X", false, "bXna", true, true)
+}
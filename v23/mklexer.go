@@ -260,7 +260,7 @@ func (p *MkLexer) exprModifier(varname string, closing byte) MkExprModifier {
 	mark := lexer.Mark()
 
 	switch lexer.PeekByte() {
-	case 'E', 'H', 'L', 'O', 'Q', 'R', 'T', 's', 't', 'u':
+	case 'E', 'H', 'L', 'O', 'P', 'Q', 'R', 'T', 's', 't', 'u':
 		mod := lexer.NextBytesSet(textproc.Alnum)
 
 		switch mod {
@@ -270,6 +270,7 @@ func (p *MkLexer) exprModifier(varname string, closing byte) MkExprModifier {
 			"L",  // XXX: Shouldn't this be handled specially?
 			"O",  // Order alphabetically
 			"Ox", // Shuffle
+			"P",  // Path of the target with the same name as the variable
 			"Q",  // Quote shell meta-characters
 			"R",  // Strip the file suffix, e.g. path/file.suffix => file
 			"T",  // Basename, e.g. path/file.suffix => file.suffix
@@ -310,7 +311,13 @@ func (p *MkLexer) exprModifier(varname string, closing byte) MkExprModifier {
 		}
 
 	case '[':
-		if lexer.SkipRegexp(regcomp(`^\[(?:[-.\d]+|#)\]`)) {
+		if lexer.SkipRegexp(regcomp(`^\[(?:[-.\d]+|[#*@])\]`)) {
+			return MkExprModifier(lexer.Since(mark))
+		}
+
+	case 'r':
+		if lexer.SkipRegexp(regcomp(`^range(?:=\d+)?`)) &&
+			(lexer.EOF() || lexer.PeekByte() == ':' || lexer.PeekByte() == int(closing)) {
 			return MkExprModifier(lexer.Since(mark))
 		}
 
@@ -618,7 +618,16 @@ func (s *Suite) Test_MkLexer_exprModifier(c *check.C) {
 
 	test("${VAR:R:E:Ox:tA:tW:tw}", "R", "E", "Ox", "tA", "tW", "tw")
 
+	test("${VAR:P:H}", "P", "H")
+
 	test("${VAR:!cmd!}", "!cmd!")
+
+	test("${VAR:[*]:[@]:[#]}", "[*]", "[@]", "[#]")
+
+	test("${VAR:range:range=3}", "range", "range=3")
+
+	// Not the :range modifier, but a System V style substitution.
+	test("${VAR:range=a}", "range=a")
 }
 
 func (s *Suite) Test_MkLexer_exprModifier__S_parse_error(c *check.C) {
@@ -1294,6 +1294,55 @@ func (ind *Indentation) CheckFinish(filename CurrPath) {
 	}
 }
 
+// BranchConditions tracks the .if and .elif lines whose conditions
+// must be true to reach the current line.
+//
+// Contrary to Indentation, it knows that in an .else branch or
+// in a .for loop, there is no condition that is known to be true.
+type BranchConditions struct {
+	// The innermost .if or .elif line for each level of indentation,
+	// or nil for .else and .for.
+	levels []*MkLine
+}
+
+// Track updates the conditions after the given line.
+func (bc *BranchConditions) Track(mkline *MkLine) {
+	if !mkline.IsDirective() {
+		return
+	}
+
+	levels := bc.levels
+	switch mkline.Directive() {
+	case "if", "ifdef", "ifndef", "for":
+		levels = append(levels, nil)
+	case "endif", "endfor":
+		if len(levels) > 0 {
+			levels = levels[:len(levels)-1]
+		}
+	}
+	if len(levels) > 0 {
+		switch mkline.Directive() {
+		case "if", "elif":
+			levels[len(levels)-1] = mkline
+		case "else":
+			levels[len(levels)-1] = nil
+		}
+	}
+	bc.levels = levels
+}
+
+// Lines returns the .if and .elif lines whose conditions are true
+// at the current line, from the outermost to the innermost.
+func (bc *BranchConditions) Lines() []*MkLine {
+	var lines []*MkLine
+	for _, mkline := range bc.levels {
+		if mkline != nil {
+			lines = append(lines, mkline)
+		}
+	}
+	return lines
+}
+
 // VarbaseBytes contains characters that may be used in the main part of variable names.
 // VarparamBytes contains characters that may be used in the parameter part of variable names.
 //
@@ -1623,6 +1623,62 @@ func (s *Suite) Test_Indentation_TrackAfter__lonely_else(c *check.C) {
 	t.CheckOutputEmpty()
 }
 
+func (s *Suite) Test_BranchConditions_Track(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("file.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".  for var in a b",
+		".    if ${var} == a",
+		".    elif ${var} == b",
+		".    else",
+		".    endif",
+		".  endfor",
+		".elif ${OPSYS} == Linux",
+		".else",
+		".endif",
+		".endif") // unbalanced
+
+	var bc BranchConditions
+	var texts []string
+	for _, mkline := range mklines.mklines {
+		bc.Track(mkline)
+		var linenos []string
+		for _, cond := range bc.Lines() {
+			linenos = append(linenos, cond.Linenos())
+		}
+		texts = append(texts, sprintf("%v", linenos))
+	}
+
+	t.CheckDeepEquals(texts, []string{
+		"[]",
+		"[2]",
+		"[2]",
+		"[2 4]",
+		"[2 5]",
+		"[2]",
+		"[2]",
+		"[2]",
+		"[9]",
+		"[]",
+		"[]",
+		"[]"})
+}
+
+func (s *Suite) Test_BranchConditions_Lines(c *check.C) {
+	t := s.Init(c)
+
+	var bc BranchConditions
+
+	t.CheckLen(bc.Lines(), 0)
+
+	mkline := t.NewMkLine("file.mk", 1, ".if ${OPSYS} == NetBSD")
+	bc.Track(mkline)
+
+	t.CheckDeepEquals(bc.Lines(), []*MkLine{mkline})
+}
+
 func (s *Suite) Test_MatchMkInclude(c *check.C) {
 	t := s.Init(c)
 
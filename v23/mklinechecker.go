@@ -222,30 +222,37 @@ func (ck MkLineChecker) checkShellCommand() {
 	mkline := ck.MkLine
 
 	shellCommand := mkline.ShellCommand()
-	if hasPrefix(mkline.Text, "\t\t") {
-		lexer := textproc.NewLexer(mkline.RawText(0))
-		tabs := lexer.NextBytesFunc(func(b byte) bool { return b == '\t' })
-
-		fix := mkline.Autofix()
-		fix.Notef("Shell programs should be indented with a single tab.")
-		fix.Explain(
-			"The first tab in the line marks the line as a shell command.",
-			"Since every line of shell commands starts with a completely new shell environment,",
-			"there is no need to indent some of the commands,",
-			"or to use more horizontal space than necessary.")
-
-		for i := range mkline.raw {
-			if hasPrefix(mkline.RawText(i), tabs) {
-				fix.ReplaceAt(i, 0, tabs, "\t")
-			}
-		}
-		fix.Apply()
-	}
+	ck.checkShellCommandIndentation()
 
 	ck.checkText(shellCommand)
 	NewShellLineChecker(ck.MkLines, mkline).CheckShellCommandLine(shellCommand)
 }
 
+func (ck MkLineChecker) checkShellCommandIndentation() {
+	mkline := ck.MkLine
+	if !hasPrefix(mkline.Text, "\t\t") {
+		return
+	}
+
+	lexer := textproc.NewLexer(mkline.RawText(0))
+	tabs := lexer.NextBytesFunc(func(b byte) bool { return b == '\t' })
+
+	fix := mkline.Autofix()
+	fix.Notef("Shell programs should be indented with a single tab.")
+	fix.Explain(
+		"The first tab in the line marks the line as a shell command.",
+		"Since every line of shell commands starts with a completely new shell environment,",
+		"there is no need to indent some of the commands,",
+		"or to use more horizontal space than necessary.")
+
+	for i := range mkline.raw {
+		if hasPrefix(mkline.RawText(i), tabs) {
+			fix.ReplaceAt(i, 0, tabs, "\t")
+		}
+	}
+	fix.Apply()
+}
+
 func (ck MkLineChecker) checkComment() {
 	mkline := ck.MkLine
 
@@ -450,6 +450,24 @@ func (s *Suite) Test_MkLineChecker_checkShellCommand__indentation(c *check.C) {
 		"                                        # comment, not a shell command")
 }
 
+func (s *Suite) Test_MkLineChecker_checkShellCommandIndentation(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		"do-install:",
+		"\techo 'single tab'",
+		"\t\techo 'two tabs'")
+
+	mklines.ForEach(func(mkline *MkLine) {
+		if mkline.IsShellCommand() {
+			MkLineChecker{mklines, mkline}.checkShellCommandIndentation()
+		}
+	})
+
+	t.CheckOutputLines(
+		"NOTE: filename.mk:3: Shell programs should be indented with a single tab.")
+}
+
 func (s *Suite) Test_MkLineChecker_checkComment(c *check.C) {
 	t := s.Init(c)
 
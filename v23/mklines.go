@@ -485,6 +485,7 @@ func (mklines *MkLines) checkAll() {
 
 	substContext.Finish(mklines.EOFLine())
 	varalign.Finish()
+	NewMkCondBranchChecker(mklines).Check()
 
 	CheckLinesTrailingEmptyLines(mklines.lines)
 }
@@ -1,6 +1,9 @@
 package pkglint
 
-import "github.com/rillig/pkglint/v23/textproc"
+import (
+	"github.com/rillig/pkglint/v23/textproc"
+	"strings"
+)
 
 // MkParser wraps a MkLexer and provides methods for parsing
 // things related to Makefiles.
@@ -399,6 +402,91 @@ type MkCondCallback struct {
 	Expr func(expr *MkExpr)
 }
 
+// String returns the source code representation of the condition,
+// in the canonical formatting, such as '${OPSYS} == NetBSD && defined(VAR)'.
+//
+// Parentheses are inserted where the operator precedence requires them,
+// such as in 'A && (B || C)' or '!(A && B)'.
+func (cond *MkCond) String() string {
+	var sb strings.Builder
+
+	// String literals on the left-hand side of a comparison must always
+	// be quoted, while on the right-hand side, simple words may be
+	// unquoted.
+	term := func(term *MkCondTerm, left bool) string {
+		switch {
+		case term.Expr != nil:
+			return term.Expr.String()
+		case term.Num != "":
+			return term.Num
+		}
+
+		str := term.Str
+		if !left && str != "" &&
+			textproc.NewLexer(str).NextBytesSet(mkCondStringLiteralUnquoted) == str &&
+			!matches(str, `^\d`) {
+			return str
+		}
+		str = strings.Replace(str, "\\", "\\\\", -1)
+		str = strings.Replace(str, "\"", "\\\"", -1)
+		return "\"" + str + "\""
+	}
+
+	var write func(cond *MkCond, prec int)
+	write = func(cond *MkCond, prec int) {
+		// The precedence of the operator in this condition.
+		// 0 is ||, 1 is &&, 2 is everything else.
+		own := 2
+		if cond.Or != nil {
+			own = 0
+		} else if cond.And != nil {
+			own = 1
+		}
+		if own < prec {
+			sb.WriteString("(")
+			defer sb.WriteString(")")
+		}
+
+		switch {
+		case cond.Or != nil:
+			for i, or := range cond.Or {
+				if i > 0 {
+					sb.WriteString(" || ")
+				}
+				write(or, 1)
+			}
+		case cond.And != nil:
+			for i, and := range cond.And {
+				if i > 0 {
+					sb.WriteString(" && ")
+				}
+				write(and, 2)
+			}
+		case cond.Not != nil:
+			sb.WriteString("!")
+			write(cond.Not, 2)
+		case cond.Defined != "":
+			sb.WriteString("defined(" + cond.Defined + ")")
+		case cond.Empty != nil:
+			sb.WriteString("empty(" + cond.Empty.varname + cond.Empty.Mod() + ")")
+		case cond.Term != nil:
+			sb.WriteString(term(cond.Term, true))
+		case cond.Compare != nil:
+			cmp := cond.Compare
+			sb.WriteString(term(&cmp.Left, true) + " " + cmp.Op + " " + term(&cmp.Right, false))
+		case cond.Call != nil:
+			sb.WriteString(cond.Call.Name + "(" + cond.Call.Arg + ")")
+		case cond.Paren != nil:
+			sb.WriteString("(")
+			write(cond.Paren, 0)
+			sb.WriteString(")")
+		}
+	}
+
+	write(cond, 0)
+	return sb.String()
+}
+
 func (cond *MkCond) Walk(callback *MkCondCallback) {
 	(&MkCondWalker{}).Walk(cond, callback)
 }
@@ -398,6 +398,56 @@ func (s *Suite) Test_MkParser_isPkgbasePart(c *check.C) {
 	test("_client", false) // The combination foo-_client looks strange.
 }
 
+func (s *Suite) Test_MkCond_String(c *check.C) {
+	t := s.Init(c)
+
+	test := func(cond string, expected string) {
+		p := NewMkParser(nil, cond)
+		parsed := p.MkCond()
+		t.CheckEquals(p.EOF(), true)
+
+		t.CheckEquals(parsed.String(), expected)
+	}
+	testSame := func(cond string) { test(cond, cond) }
+
+	testSame("defined(VAR)")
+	testSame("!defined(VAR)")
+	testSame("empty(VAR:Mpattern)")
+	testSame("!empty(VAR:M*.c:Q)")
+	testSame("${VAR}")
+	testSame("exists(/usr/bin/cc)")
+	testSame("target(pre-configure)")
+	testSame("${VAR} == value")
+	testSame("${VAR} != \"\"")
+	testSame("${VAR} == \"two words\"")
+	testSame("${VAR} == \"\\\"\\\\\"")
+	testSame("${VAR} >= 0x100")
+	testSame("${VAR} == ${OTHER}")
+	testSame("\"literal\" == ${VAR}")
+	testSame("${VAR} == \"1word\"")
+	testSame("defined(A) && defined(B) || defined(C)")
+	testSame("defined(A) && (defined(B) || defined(C))")
+	testSame("!(defined(A) || defined(B))")
+	testSame("((defined(A)))")
+
+	// The formatting is normalized.
+	test("defined(A)&&defined(B)", "defined(A) && defined(B)")
+	test("${VAR}==\"value\"", "${VAR} == value")
+	test("\"${VAR}\" == value", "${VAR} == value")
+	test("${VAR} == 1.0", "${VAR} == 1.0")
+
+	// Conditions that are constructed in the code may need additional
+	// parentheses to preserve the operator precedence.
+	t.CheckEquals(
+		(&MkCond{And: []*MkCond{
+			{Defined: "A"},
+			{Or: []*MkCond{{Defined: "B"}, {Defined: "C"}}}}}).String(),
+		"defined(A) && (defined(B) || defined(C))")
+	t.CheckEquals(
+		(&MkCond{Not: &MkCond{And: []*MkCond{{Defined: "A"}, {Defined: "B"}}}}).String(),
+		"!(defined(A) && defined(B))")
+}
+
 func (s *Suite) Test_MkCondWalker_Walk(c *check.C) {
 	t := s.Init(c)
 
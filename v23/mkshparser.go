@@ -1,6 +1,9 @@
 package pkglint
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func parseShellProgram(line *Line, program string) (*MkShList, error) {
 	if trace.Tracing {
@@ -65,13 +68,26 @@ type ShellLexer struct {
 	inCasePattern  bool // true inside (pattern1|pattern2|pattern3); works only for simple cases
 	error          string
 	result         *MkShList
+
+	// If wordIndex is not nil, it records for each word the index of the
+	// token it came from. This allows diagnostics in multi-line shell
+	// programs to refer to the correct line.
+	wordIndex map[*ShToken]int
+	ntokens   int
+
+	// The here-documents whose bodies follow after the next newline.
+	hereDocs []*MkShRedirection
+
+	// For a command substitution $$(...), the lexer of the enclosing program.
+	outer *ShellLexer
 }
 
 func NewShellLexer(tokens []string, rest string) *ShellLexer {
 	return &ShellLexer{
 		remaining:      tokens,
 		atCommandStart: true,
-		error:          rest}
+		error:          rest,
+		ntokens:        len(tokens)}
 }
 
 func (lex *ShellLexer) Lex(lval *shyySymType) (ttype int) {
@@ -82,7 +98,7 @@ func (lex *ShellLexer) Lex(lval *shyySymType) (ttype int) {
 	if trace.Tracing {
 		defer func() {
 			if ttype == 0 {
-				trace.Stepf("lex EOF because of a comment")
+				trace.Stepf("lex EOF")
 				return
 			}
 			tname := shyyTokname(int(shyyTok2[ttype-shyyPrivate]))
@@ -97,6 +113,21 @@ func (lex *ShellLexer) Lex(lval *shyySymType) (ttype int) {
 		}()
 	}
 
+	// The bodies of the here-documents directly follow the newline
+	// after their redirections.
+	if len(lex.hereDocs) > 0 && lex.current != "" && strings.Trim(lex.current, "\n") == "" {
+		for _, hereDoc := range lex.hereDocs {
+			if len(lex.remaining) > 0 {
+				hereDoc.HereDoc = lex.remaining[0]
+				lex.remaining = lex.remaining[1:]
+			}
+		}
+		lex.hereDocs = nil
+		if len(lex.remaining) == 0 {
+			return 0
+		}
+	}
+
 	token := lex.ioRedirect
 	lex.ioRedirect = ""
 	if token == "" {
@@ -105,6 +136,11 @@ func (lex *ShellLexer) Lex(lval *shyySymType) (ttype int) {
 		lex.remaining = lex.remaining[1:]
 	}
 
+	// In multi-line shell programs, consecutive newlines form a single token.
+	if strings.Trim(token, "\n") == "" {
+		token = "\n"
+	}
+
 	switch token {
 	case ";":
 		lex.atCommandStart = true
@@ -243,14 +279,18 @@ func (lex *ShellLexer) Lex(lval *shyySymType) (ttype int) {
 		ttype = tkASSIGNMENT_WORD
 		p := NewShTokenizer(nil, token)
 		lval.Word = p.ShToken()
+		lex.recordWord(lval.Word)
+		lex.parseSubshells(lval.Word)
 	case hasPrefix(token, "#"):
-		// This doesn't work for multiline shell programs.
-		// Since pkglint only processes single lines, that's ok.
-		return 0
+		// In a single line, the comment extends to the end of the line.
+		// In a multi-line shell program, it ends before the next newline.
+		return lex.Lex(lval)
 	default:
 		ttype = tkWORD
 		p := NewShTokenizer(nil, token)
 		lval.Word = p.ShToken()
+		lex.recordWord(lval.Word)
+		lex.parseSubshells(lval.Word)
 		lex.atCommandStart = false
 
 		// Inside a case statement, ${PATTERNS:@p@ (${p}) continue ;; @} expands to
@@ -272,6 +312,71 @@ func (lex *ShellLexer) Lex(lval *shyySymType) (ttype int) {
 	return ttype
 }
 
+func (lex *ShellLexer) recordWord(word *ShToken) {
+	if lex.wordIndex != nil {
+		lex.wordIndex[word] = lex.tokenIndex()
+	}
+}
+
+// tokenIndex returns the index of the current token.
+// For the words inside a command substitution,
+// this is the index of the word that contains the command substitution.
+func (lex *ShellLexer) tokenIndex() int {
+	if lex.outer != nil {
+		return lex.outer.tokenIndex()
+	}
+	return lex.ntokens - len(lex.remaining) - 1
+}
+
+// parseSubshells parses the commands from the command substitutions
+// $$(...) in the word, making them available via ShAtom.Subshell.
+//
+// The command substitutions that are nested inside these are parsed
+// by the lexer of the inner program.
+func (lex *ShellLexer) parseSubshells(word *ShToken) {
+	depth := 0
+	var start *ShAtom
+	startOffset := 0
+
+	offset := 0
+	for _, atom := range word.Atoms {
+		switch {
+		case atom.Type == shtSubshell:
+			if depth == 0 {
+				start = atom
+				startOffset = offset + len(atom.MkText)
+			}
+			depth++
+		case depth > 0 && atom.Type == shtOperator && atom.MkText == "(":
+			depth++
+		case depth > 0 && atom.Type == shtOperator && atom.MkText == ")":
+			depth--
+			if depth == 0 {
+				lex.parseSubshell(start, word.MkText[startOffset:offset])
+			}
+		}
+		offset += len(atom.MkText)
+	}
+}
+
+// parseSubshell parses the commands of a single command substitution.
+// If the commands cannot be parsed, the command substitution is treated
+// like plain text.
+func (lex *ShellLexer) parseSubshell(atom *ShAtom, program string) {
+	tokens, rest := splitIntoShellTokens(nil, program)
+	if rest != "" {
+		return
+	}
+
+	inner := NewShellLexer(tokens, rest)
+	inner.wordIndex = lex.wordIndex
+	inner.outer = lex
+	parser := shyyParserImpl{}
+	if parser.Parse(inner) == 0 && inner.result != nil {
+		atom.data = inner.result
+	}
+}
+
 func (lex *ShellLexer) Error(s string) {
 	lex.error = s
 }
@@ -132,6 +132,14 @@ func (s *ShSuite) Test_parseShellProgram__program(c *check.C) {
 			AddNewline().
 			AddCommand(b.SimpleCommand("command3")))
 
+	// In multi-line shell programs, comments end at the end of the line,
+	// and several newlines form a single token.
+	s.test("command1 # comment\n\n\ncommand2",
+		b.List().
+			AddCommand(b.SimpleCommand("command1")).
+			AddNewline().
+			AddCommand(b.SimpleCommand("command2")))
+
 	s.test("if condition; then action; else case selector in pattern) case-item-action ;; esac; fi",
 		b.List().AddCommand(b.If(
 			b.List().AddCommand(b.SimpleCommand("condition")).AddSemicolon(),
@@ -621,15 +629,15 @@ func (s *ShSuite) Test_parseShellProgram__io_redirect(c *check.C) {
 			Name:        b.Token("echo"),
 			Args:        nil,
 			Redirections: []*MkShRedirection{
-				{1, ">", b.Token("output")},
-				{2, ">>", b.Token("append")},
-				{3, ">|", b.Token("clobber")},
-				{4, ">&", b.Token("5")},
-				{6, "<", b.Token("input")},
-				{-1, ">>", b.Token("append")},
-				{-1, "<&", b.Token("input")},
-				{-1, "<>", b.Token("diamond")},
-				{-1, "<<-", b.Token("here")}}}}))
+				{1, ">", b.Token("output"), ""},
+				{2, ">>", b.Token("append"), ""},
+				{3, ">|", b.Token("clobber"), ""},
+				{4, ">&", b.Token("5"), ""},
+				{6, "<", b.Token("input"), ""},
+				{-1, ">>", b.Token("append"), ""},
+				{-1, "<&", b.Token("input"), ""},
+				{-1, "<>", b.Token("diamond"), ""},
+				{-1, "<<-", b.Token("here"), ""}}}}))
 
 	s.test("echo 1> output 2>> append 3>| clobber 4>& 5 6< input >> append <& input <> diamond <<- here",
 		b.List().AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
@@ -637,15 +645,15 @@ func (s *ShSuite) Test_parseShellProgram__io_redirect(c *check.C) {
 			Name:        b.Token("echo"),
 			Args:        nil,
 			Redirections: []*MkShRedirection{
-				{1, ">", b.Token("output")},
-				{2, ">>", b.Token("append")},
-				{3, ">|", b.Token("clobber")},
-				{4, ">&", b.Token("5")},
-				{6, "<", b.Token("input")},
-				{-1, ">>", b.Token("append")},
-				{-1, "<&", b.Token("input")},
-				{-1, "<>", b.Token("diamond")},
-				{-1, "<<-", b.Token("here")}}}}))
+				{1, ">", b.Token("output"), ""},
+				{2, ">>", b.Token("append"), ""},
+				{3, ">|", b.Token("clobber"), ""},
+				{4, ">&", b.Token("5"), ""},
+				{6, "<", b.Token("input"), ""},
+				{-1, ">>", b.Token("append"), ""},
+				{-1, "<&", b.Token("input"), ""},
+				{-1, "<>", b.Token("diamond"), ""},
+				{-1, "<<-", b.Token("here"), ""}}}}))
 
 	s.test("${MAKE} print-summary-data  2>&1 > /dev/stderr",
 		b.List().AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
@@ -653,21 +661,21 @@ func (s *ShSuite) Test_parseShellProgram__io_redirect(c *check.C) {
 			Name:        b.Token("${MAKE}"),
 			Args:        []*ShToken{b.Token("print-summary-data")},
 			Redirections: []*MkShRedirection{
-				{2, ">&", b.Token("1")},
-				{-1, ">", b.Token("/dev/stderr")}}}}))
+				{2, ">&", b.Token("1"), ""},
+				{-1, ">", b.Token("/dev/stderr"), ""}}}}))
 
 	s.test("1> output command",
 		b.List().AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
 			Name: b.Token("command"),
 			Redirections: []*MkShRedirection{
-				{1, ">", b.Token("output")}}}}))
+				{1, ">", b.Token("output"), ""}}}}))
 
 	s.test("ENV=value 1> output command",
 		b.List().AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
 			Assignments: []*ShToken{b.Token("ENV=value")},
 			Name:        b.Token("command"),
 			Redirections: []*MkShRedirection{
-				{1, ">", b.Token("output")}}}}))
+				{1, ">", b.Token("output"), ""}}}}))
 }
 
 func (s *ShSuite) Test_parseShellProgram__redirect_list(c *check.C) {
@@ -689,26 +697,52 @@ func (s *ShSuite) Test_parseShellProgram__redirect_list(c *check.C) {
 
 func (s *ShSuite) Test_parseShellProgram__io_here(c *check.C) {
 	// In pkgsrc Makefiles, the IO here-documents cannot be used since
-	// all the text is joined into a single line. Therefore, these test
-	// cases only show that pkglint can indeed not parse <<EOF
-	// redirections.
+	// all the text is joined into a single line. They are used in the
+	// INSTALL and DEINSTALL scripts and the other shell scripts though.
 	b := s.init(c)
 
+	hereDoc := func(fd int, op, delimiter, lines string) *MkShRedirection {
+		redirection := b.Redirection(fd, op, delimiter)
+		redirection.HereDoc = lines
+		return redirection
+	}
+
 	s.test("<<EOF\ntext\nEOF",
 		b.List().
-			AddCommand(b.SimpleCommand("<<EOF")).
-			AddNewline().
-			AddCommand(b.SimpleCommand("text")). // This is wrong.
-			AddNewline().
-			AddCommand(b.SimpleCommand("EOF"))) // This is wrong.
+			AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
+				Redirections: []*MkShRedirection{
+					hereDoc(-1, "<<", "EOF", "text\nEOF")}}}).
+			AddNewline())
 
 	s.test("1<<EOF\ntext\nEOF",
 		b.List().
-			AddCommand(b.SimpleCommand("1<<EOF")).
-			AddNewline().
-			AddCommand(b.SimpleCommand("text")). // This is wrong.
+			AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
+				Redirections: []*MkShRedirection{
+					hereDoc(1, "<<", "EOF", "text\nEOF")}}}).
+			AddNewline())
+
+	// The text of the here-document is not parsed as shell commands,
+	// and the command after the here-document is parsed normally.
+	s.test("cat <<-'EOF' >file\n\tif then\n\tEOF\necho done",
+		b.List().
+			AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
+				Name: b.Token("cat"),
+				Redirections: []*MkShRedirection{
+					hereDoc(-1, "<<-", "'EOF'", "\tif then\n\tEOF\n"),
+					b.Redirection(-1, ">", "file")}}}).
 			AddNewline().
-			AddCommand(b.SimpleCommand("EOF"))) // This is wrong.
+			AddCommand(b.SimpleCommand("echo", "done")))
+
+	// Multiple here-documents in the same command are read in order.
+	s.test("cat <<A - <<B\na\nA\nb\nB\n",
+		b.List().
+			AddCommand(&MkShCommand{Simple: &MkShSimpleCommand{
+				Name: b.Token("cat"),
+				Args: b.Words("-"),
+				Redirections: []*MkShRedirection{
+					hereDoc(-1, "<<", "A", "a\nA\n"),
+					hereDoc(-1, "<<", "B", "b\nB\n")}}}).
+			AddNewline())
 }
 
 func (s *ShSuite) init(c *check.C) *MkShBuilder {
@@ -893,6 +927,56 @@ func (s *Suite) Test_ShellLexer_Lex__case_patterns(c *check.C) {
 		tkWORD) // No tkESAC since there is no :@ modifier.
 }
 
+func (s *Suite) Test_ShellLexer_Lex__command_substitution(c *check.C) {
+	t := s.Init(c)
+	b := NewMkShBuilder()
+
+	// lex returns the first token from the shell program,
+	// which must be a word.
+	lex := func(shellProgram string) *ShToken {
+		tokens, rest := splitIntoShellTokens(nil, shellProgram)
+		t.CheckEquals(rest, "")
+		lexer := NewShellLexer(tokens, rest)
+		var token shyySymType
+		lexer.Lex(&token)
+		return token.Word
+	}
+
+	test := func(shellProgram string, expected ...*MkShList) {
+		var actual []*MkShList
+		for _, atom := range lex(shellProgram).Atoms {
+			if atom.Type == shtSubshell {
+				actual = append(actual, atom.Subshell())
+			}
+		}
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	test("$$(id -u)",
+		b.List().AddCommand(b.SimpleCommand("id", "-u")))
+
+	test("var=$$(id -u)$$(id -g)",
+		b.List().AddCommand(b.SimpleCommand("id", "-u")),
+		b.List().AddCommand(b.SimpleCommand("id", "-g")))
+
+	// Arithmetic expansions don't contain commands.
+	test("$$((1 + 2))",
+		nil...)
+
+	// Commands that cannot be parsed are treated like plain text.
+	test("$$(if)",
+		nil)
+
+	// The nested command substitutions are parsed by the lexer
+	// of the enclosing command substitution.
+	word := lex("\"$$(echo $$(id -u))\"")
+	t.CheckEquals(word.Atoms[4].MkText, "$$(")
+	t.CheckEquals(word.Atoms[4].Subshell(), (*MkShList)(nil))
+	echo := word.Atoms[1].Subshell().AndOrs[0].Pipes[0].Cmds[0].Simple
+	t.CheckDeepEquals(echo.Args[0].Atoms[0].Subshell(),
+		b.List().AddCommand(b.SimpleCommand("id", "-u")))
+}
+
 type MkShBuilder struct {
 }
 
@@ -1020,5 +1104,5 @@ func (b *MkShBuilder) Words(words ...string) []*ShToken {
 }
 
 func (b *MkShBuilder) Redirection(fd int, op string, target string) *MkShRedirection {
-	return &MkShRedirection{fd, op, b.Token(target)}
+	return &MkShRedirection{fd, op, b.Token(target), ""}
 }
@@ -252,10 +252,15 @@ func (c *StrCommand) String() string {
 //
 //	> sorted
 //	2>&1
+//	<<EOF
 type MkShRedirection struct {
 	Fd     int      // Or -1
-	Op     string   // See io_file in shell.y for possible values
-	Target *ShToken // The filename or &fd
+	Op     string   // See io_file and io_here in shell.y for possible values
+	Target *ShToken // The filename or &fd, or the delimiter of the here-document
+
+	// For the operators << and <<-, the lines of the here-document,
+	// including the line with the delimiter.
+	HereDoc string
 }
 
 // MkShSeparator is one of ; & newline.
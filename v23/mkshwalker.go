@@ -263,6 +263,12 @@ func (w *MkShWalker) walkWord(index int, word *ShToken) {
 		callback(word)
 	}
 
+	for i, atom := range word.Atoms {
+		if list := atom.Subshell(); list != nil {
+			w.walkList(i, list)
+		}
+	}
+
 	w.pop()
 }
 
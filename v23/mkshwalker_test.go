@@ -268,6 +268,47 @@ func (s *Suite) Test_MkShWalker_Walk(c *check.C) {
 		"            Path List.AndOr[0].Pipeline[0].Command[0].SimpleCommand.[]MkShRedirection.Redirection[2]",
 		"            Word /dev/random",
 		"            Path List.AndOr[0].Pipeline[0].Command[0].SimpleCommand.[]MkShRedirection.Redirection[2].ShToken[2]")
+
+	// The commands from command substitutions are visited directly
+	// after the word that contains them, even when they are nested.
+	// Arithmetic expansions are plain words.
+	outputPathFor("SimpleCommand")
+	test(
+		"echo \"$$(expr $$(id -u) + 1)\" $$((1 + 2))",
+
+		"            List with 1 andOrs",
+		"           AndOr with 1 pipelines",
+		"        Pipeline with 1 commands",
+		"         Command ",
+		"   SimpleCommand echo \"$$(expr $$(id -u) + 1)\" $$((1 + 2))",
+		"            Path List.AndOr[0].Pipeline[0].Command[0].SimpleCommand",
+		"            Word echo",
+		"           Words with 2 words",
+		"            Word \"$$(expr $$(id -u) + 1)\"",
+		"            List with 1 andOrs",
+		"           AndOr with 1 pipelines",
+		"        Pipeline with 1 commands",
+		"         Command ",
+		"   SimpleCommand expr $$(id -u) + 1",
+		"            Path List.AndOr[0].Pipeline[0].Command[0].SimpleCommand."+
+			"[]ShToken[1].ShToken[0].List[1].AndOr[0].Pipeline[0].Command[0].SimpleCommand",
+		"            Word expr",
+		"           Words with 3 words",
+		"            Word $$(id -u)",
+		"            List with 1 andOrs",
+		"           AndOr with 1 pipelines",
+		"        Pipeline with 1 commands",
+		"         Command ",
+		"   SimpleCommand id -u",
+		"            Path List.AndOr[0].Pipeline[0].Command[0].SimpleCommand."+
+			"[]ShToken[1].ShToken[0].List[1].AndOr[0].Pipeline[0].Command[0].SimpleCommand."+
+			"[]ShToken[1].ShToken[0].List[0].AndOr[0].Pipeline[0].Command[0].SimpleCommand",
+		"            Word id",
+		"           Words with 1 words",
+		"            Word -u",
+		"            Word +",
+		"            Word 1",
+		"            Word $$((1 + 2))")
 }
 
 func (s *Suite) Test_MkShWalker_Walk__empty_callback(c *check.C) {
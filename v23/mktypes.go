@@ -104,8 +104,16 @@ func (m MkExprModifier) Subst(str string) (bool, string) {
 	}
 
 	if isRegex {
-		// XXX: Maybe implement regular expression substitutions later.
-		return false, ""
+		if containsVarRefLong(from) || containsVarRefLong(to) {
+			return false, ""
+		}
+		pattern := condStr(leftAnchor, "^", "") + from + condStr(rightAnchor, "$", "")
+		re, err := regexp.CompilePOSIX(pattern)
+		if err != nil {
+			return false, ""
+		}
+		result, _, ok := regexSubst(str, re, to, contains(options, "g"))
+		return ok, condStr(ok, result, "")
 	}
 
 	ok, result := m.EvalSubst(str, leftAnchor, from, rightAnchor, to, options)
@@ -173,9 +173,17 @@ func (s *Suite) Test_MkExprModifier_Subst(c *check.C) {
 	// the value is returned unmodified, but successful.
 	test("C,no_match,replacement,", "value", true, "value")
 
-	// As of December 2019, pkglint doesn't know how to handle
-	// complicated :C modifiers.
-	test("C,.*,,", "anything", false, "")
+	// The :C modifier uses POSIX extended regular expressions,
+	// like in bmake.
+	test("C,.*,,", "anything", true, "")
+	test("C,^(.)(.*)$,\\2\\1,", "anything", true, "nythinga")
+	test("C,[aeiou],<&>,g", "anything", true, "<a>nyth<i>ng")
+
+	// The replacement refers to a subexpression that doesn't exist.
+	test("C,a.,\\1,", "anything", false, "")
+
+	// The regular expression is malformed.
+	test("C,(,,", "anything", false, "")
 
 	// When given a modifier that is not actually a :S or :C, Subst
 	// doesn't do anything.
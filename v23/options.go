@@ -1,5 +1,10 @@
 package pkglint
 
+import (
+	"sort"
+	"strings"
+)
+
 // Checks for 'options.mk' files, which define the options that are available
 // to a package, and the effects that these options have.
 
@@ -11,6 +16,8 @@ func CheckLinesOptionsMk(mklines *MkLines, buildlinkID string) {
 		make(map[string]*MkLine),
 		false,
 		make(map[string]*MkLine),
+		nil,
+		BranchConditions{},
 		nil}
 
 	ck.Check()
@@ -28,6 +35,19 @@ type OptionsLinesChecker struct {
 	handledArbitrary          bool
 	handledOptions            map[string]*MkLine
 	optionsInDeclarationOrder []string
+
+	branches BranchConditions
+
+	// The buildlink3.mk files that are only included if some of the
+	// options are enabled.
+	optionalIncludes []optionalInclude
+}
+
+// optionalInclude is an .include line that depends on some options,
+// either PKG_OPTIONS in options.mk or PKG_BUILD_OPTIONS in buildlink3.mk.
+type optionalInclude struct {
+	MkLine  *MkLine
+	Options []string // Sorted, without duplicates
 }
 
 func (ck *OptionsLinesChecker) Check() {
@@ -38,6 +58,7 @@ func (ck *OptionsLinesChecker) Check() {
 	ck.collect()
 
 	ck.checkOptionsMismatch()
+	ck.checkBuildlink3Includes()
 
 	mklines.SaveAutofixChanges()
 }
@@ -70,6 +91,8 @@ func (ck *OptionsLinesChecker) collect() {
 			seenInclude = mkline.IsInclude() && mkline.IncludedFile() == "../../mk/bsd.options.mk"
 		}
 
+		ck.branches.Track(mkline)
+
 		if !seenInclude {
 			ck.handleUpperLine(mkline, seenPkgOptionsVar)
 		} else {
@@ -135,6 +158,11 @@ func (ck *OptionsLinesChecker) handleUpperLine(mkline *MkLine, seenPkgOptionsVar
 }
 
 func (ck *OptionsLinesChecker) handleLowerLine(mkline *MkLine) {
+	if mkline.IsInclude() {
+		ck.handleLowerInclude(mkline)
+		return
+	}
+
 	if !mkline.IsDirective() {
 		return
 	}
@@ -152,6 +180,19 @@ func (ck *OptionsLinesChecker) handleLowerLine(mkline *MkLine) {
 	ck.handleLowerCondition(mkline, cond)
 }
 
+// handleLowerInclude remembers the buildlink3.mk files that are
+// only included if some options are enabled.
+func (ck *OptionsLinesChecker) handleLowerInclude(mkline *MkLine) {
+	if !mkline.IncludedFile().HasBase("buildlink3.mk") {
+		return
+	}
+
+	options := optionsInConditions(ck.branches.Lines(), "PKG_OPTIONS")
+	if len(options) > 0 {
+		ck.optionalIncludes = append(ck.optionalIncludes, optionalInclude{mkline, options})
+	}
+}
+
 func (ck *OptionsLinesChecker) handleLowerCondition(mkline *MkLine, cond *MkCond) {
 
 	recordOption := func(option string) {
@@ -249,3 +290,133 @@ func (ck *OptionsLinesChecker) warnVarorder(mkline *MkLine) {
 		"",
 		"This way, the options.mk files have the same structure and are easy to understand.")
 }
+
+// checkBuildlink3Includes checks that the buildlink3.mk files that are
+// included depending on an option are included by the buildlink3.mk file
+// of the package as well, depending on the same options.
+// Otherwise the packages that depend on this package may miss some
+// libraries or headers.
+func (ck *OptionsLinesChecker) checkBuildlink3Includes() {
+	pkg := ck.mklines.pkg
+	if pkg == nil || len(ck.optionalIncludes) == 0 {
+		return
+	}
+
+	bl3File := pkg.File("buildlink3.mk")
+	if !bl3File.IsFile() {
+		return
+	}
+	bl3Lines := LoadMk(bl3File, pkg, MustSucceed)
+
+	// Only if the buildlink3.mk file looks at the build options,
+	// it is intended to mirror the optional dependencies.
+	usesBuildOptions := false
+	bl3Includes := make(map[PackagePath]optionalInclude)
+	var branches BranchConditions
+	for _, mkline := range bl3Lines.mklines {
+		branches.Track(mkline)
+		if !mkline.IsInclude() {
+			continue
+		}
+		if mkline.IncludedFile().HasBase("pkg-build-options.mk") {
+			usesBuildOptions = true
+		}
+		options := optionsInConditions(branches.Lines(), "PKG_BUILD_OPTIONS.*")
+		bl3Includes[pkg.Rel(mkline.IncludedFileFull())] = optionalInclude{mkline, options}
+	}
+
+	for _, optional := range ck.optionalIncludes {
+		mkline := optional.MkLine
+		options := ck.formatOptions(optional.Options)
+		bl3, found := bl3Includes[pkg.Rel(mkline.IncludedFileFull())]
+
+		switch {
+		case !found && usesBuildOptions:
+			mkline.Warnf("%s is included depending on %s, but not in %s.",
+				mkline.IncludedFile().String(), options, mkline.Rel(bl3File).String())
+
+		case !found, len(bl3.Options) == 0:
+			// Unconditional inclusions are already checked
+			// in Package.checkIncludeConditionally.
+			continue
+
+		case strings.Join(bl3.Options, " ") != strings.Join(optional.Options, " "):
+			mkline.Warnf("%s is included depending on %s, but depending on %s in %s.",
+				mkline.IncludedFile().String(), options,
+				ck.formatOptions(bl3.Options), mkline.RelMkLine(bl3.MkLine))
+
+		default:
+			continue
+		}
+
+		mkline.Explain(
+			"The packages that depend on this package include its buildlink3.mk file.",
+			"If this package is built with the option,",
+			"the dependent packages need the same dependency.",
+			"Otherwise they may not find the libraries or headers",
+			"that this package refers to.",
+			"",
+			"In the buildlink3.mk file, the options of this package",
+			"are available via mk/pkg-build-options.mk.")
+	}
+}
+
+func (ck *OptionsLinesChecker) formatOptions(options []string) string {
+	quoted := make([]string, len(options))
+	for i, option := range options {
+		quoted[i] = sprintf("%q", option)
+	}
+	return condStr(len(options) == 1, "option ", "options ") + strings.Join(quoted, ", ")
+}
+
+// optionsInConditions returns the options that are mentioned in :M
+// modifiers of the variable in the given conditions,
+// such as "opt" in '.if ${PKG_OPTIONS:Mopt}'.
+// Options that must be disabled, as in '.if empty(PKG_OPTIONS:Mopt)',
+// are returned as "!opt".
+//
+// The varcanon is either PKG_OPTIONS or PKG_BUILD_OPTIONS.*.
+func optionsInConditions(conds []*MkLine, varcanon string) []string {
+	options := NewStringSet()
+
+	record := func(expr *MkExpr, negated bool) {
+		if expr == nil || varnameCanon(expr.varname) != varcanon || len(expr.modifiers) != 1 {
+			return
+		}
+		m, positive, pattern, _ := expr.modifiers[0].MatchMatch()
+		if m && positive && !containsExpr(pattern) {
+			options.Add(condStr(negated, "!", "") + pattern)
+		}
+	}
+
+	var walk func(cond *MkCond, negated bool)
+	walk = func(cond *MkCond, negated bool) {
+		switch {
+		case cond == nil:
+			break
+		case cond.Not != nil:
+			walk(cond.Not, !negated)
+		case cond.Empty != nil:
+			record(cond.Empty, !negated)
+		case cond.Term != nil:
+			record(cond.Term.Expr, negated)
+		case cond.Paren != nil:
+			walk(cond.Paren, negated)
+		default:
+			for _, or := range cond.Or {
+				walk(or, negated)
+			}
+			for _, and := range cond.And {
+				walk(and, negated)
+			}
+		}
+	}
+
+	for _, mkline := range conds {
+		walk(mkline.Cond(), false)
+	}
+
+	sorted := options.Elements
+	sort.Strings(sorted)
+	return sorted
+}
@@ -753,6 +753,45 @@ func (s *Suite) Test_CheckLinesOptionsMk__supported_but_not_checked(c *check.C)
 // Up to April 2019, pkglint logged a wrong note saying that OTHER_VARIABLE
 // should have the positive branch first. That note was only ever intended
 // for PKG_OPTIONS.
+func (s *Suite) Test_OptionsLinesChecker_handleLowerInclude(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	t.CreateFileLines("mk/bsd.options.mk",
+		MkCvsID)
+	mklines := t.SetUpFileMkLines("category/package/options.mk",
+		MkCvsID,
+		"",
+		"PKG_OPTIONS_VAR=\tPKG_OPTIONS.package",
+		"PKG_SUPPORTED_OPTIONS=\ta b",
+		"",
+		".include \"../../mk/bsd.options.mk\"",
+		"",
+		".include \"../../devel/unconditional/buildlink3.mk\"",
+		".if ${PKG_OPTIONS:Ma}",
+		".  include \"../../devel/a/buildlink3.mk\"",
+		".  include \"other.mk\"",
+		".elif ${PKG_OPTIONS:Mb}",
+		".  include \"../../devel/b/buildlink3.mk\"",
+		".else",
+		".  include \"../../devel/none/buildlink3.mk\"",
+		".endif")
+
+	ck := OptionsLinesChecker{
+		mklines, "", false, make(map[string]*MkLine),
+		false, make(map[string]*MkLine), nil, BranchConditions{}, nil}
+	ck.collect()
+
+	var includes []string
+	for _, include := range ck.optionalIncludes {
+		includes = append(includes, sprintf("%s %v",
+			include.MkLine.IncludedFile().String(), include.Options))
+	}
+	t.CheckDeepEquals(includes, []string{
+		"../../devel/a/buildlink3.mk [a]",
+		"../../devel/b/buildlink3.mk [b]"})
+}
+
 func (s *Suite) Test_OptionsLinesChecker_handleLowerCondition__foreign_variable(c *check.C) {
 	t := s.Init(c)
 
@@ -779,3 +818,159 @@ func (s *Suite) Test_OptionsLinesChecker_handleLowerCondition__foreign_variable(
 		"WARN: ~/category/package/options.mk:8: Variable \"OTHER_VARIABLE\" is used but not defined.",
 		"WARN: ~/category/package/options.mk:4: Option \"opt\" should be handled below in an .if block.")
 }
+
+func (s *Suite) Test_OptionsLinesChecker_checkBuildlink3Includes(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpOption("a", "")
+	t.SetUpOption("b", "")
+	t.SetUpOption("c", "")
+	t.CreateFileLines("mk/bsd.options.mk",
+		MkCvsID)
+	t.CreateFileLines("mk/pkg-build-options.mk",
+		MkCvsID)
+	t.CreateFileBuildlink3("devel/a/buildlink3.mk")
+	t.CreateFileBuildlink3("devel/b/buildlink3.mk")
+	t.CreateFileBuildlink3("devel/c/buildlink3.mk")
+	t.SetUpPackage("category/package",
+		".include \"options.mk\"")
+	t.CreateFileLines("category/package/options.mk",
+		MkCvsID,
+		"",
+		"PKG_OPTIONS_VAR=\tPKG_OPTIONS.package",
+		"PKG_SUPPORTED_OPTIONS=\ta b c",
+		"",
+		".include \"../../mk/bsd.options.mk\"",
+		"",
+		".if ${PKG_OPTIONS:Ma}",
+		".  include \"../../devel/a/buildlink3.mk\"",
+		".endif",
+		"",
+		".if ${PKG_OPTIONS:Mb}",
+		".  include \"../../devel/b/buildlink3.mk\"",
+		".endif",
+		"",
+		".if ${PKG_OPTIONS:Mc}",
+		".  include \"../../devel/c/buildlink3.mk\"",
+		".endif")
+	t.CreateFileBuildlink3("category/package/buildlink3.mk",
+		"pkgbase := package",
+		".include \"../../mk/pkg-build-options.mk\"",
+		".if ${PKG_BUILD_OPTIONS.package:Ma}",
+		".  include \"../../devel/a/buildlink3.mk\"",
+		".endif",
+		".if ${PKG_BUILD_OPTIONS.package:Mc}",
+		".  include \"../../devel/b/buildlink3.mk\"",
+		".endif")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.Check(".")
+
+	t.CheckOutputLines(
+		"WARN: options.mk:13: ../../devel/b/buildlink3.mk is included "+
+			"depending on option \"b\", "+
+			"but depending on option \"c\" in buildlink3.mk:18.",
+		"WARN: options.mk:17: ../../devel/c/buildlink3.mk is included "+
+			"depending on option \"c\", but not in buildlink3.mk.")
+}
+
+func (s *Suite) Test_OptionsLinesChecker_checkBuildlink3Includes__without_build_options(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpOption("a", "")
+	t.CreateFileLines("mk/bsd.options.mk",
+		MkCvsID)
+	t.CreateFileBuildlink3("devel/a/buildlink3.mk")
+	t.SetUpPackage("category/package",
+		".include \"options.mk\"")
+	t.CreateFileLines("category/package/options.mk",
+		MkCvsID,
+		"",
+		"PKG_OPTIONS_VAR=\tPKG_OPTIONS.package",
+		"PKG_SUPPORTED_OPTIONS=\ta",
+		"",
+		".include \"../../mk/bsd.options.mk\"",
+		"",
+		".if ${PKG_OPTIONS:Ma}",
+		".  include \"../../devel/a/buildlink3.mk\"",
+		".endif")
+	t.CreateFileBuildlink3("category/package/buildlink3.mk")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.Check(".")
+
+	// The buildlink3.mk file doesn't look at the build options at all,
+	// therefore the dependency on devel/a is probably only needed
+	// for building the package itself.
+	t.CheckOutputEmpty()
+}
+
+// If the package Makefile and the buildlink3.mk file use opposite
+// conditions, the dependencies don't match.
+func (s *Suite) Test_OptionsLinesChecker_checkBuildlink3Includes__opposite(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpOption("x", "")
+	t.CreateFileLines("mk/bsd.options.mk",
+		MkCvsID)
+	t.CreateFileLines("mk/pkg-build-options.mk",
+		MkCvsID)
+	t.CreateFileBuildlink3("devel/x/buildlink3.mk")
+	t.SetUpPackage("category/package",
+		".include \"options.mk\"")
+	t.CreateFileLines("category/package/options.mk",
+		MkCvsID,
+		"",
+		"PKG_OPTIONS_VAR=\tPKG_OPTIONS.package",
+		"PKG_SUPPORTED_OPTIONS=\tx",
+		"",
+		".include \"../../mk/bsd.options.mk\"",
+		"",
+		".if empty(PKG_OPTIONS:Mx)",
+		".  include \"../../devel/x/buildlink3.mk\"",
+		".endif")
+	t.CreateFileBuildlink3("category/package/buildlink3.mk",
+		"pkgbase := package",
+		".include \"../../mk/pkg-build-options.mk\"",
+		".if ${PKG_BUILD_OPTIONS.package:Mx}",
+		".  include \"../../devel/x/buildlink3.mk\"",
+		".endif")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.Check(".")
+
+	t.CheckOutputLines(
+		"WARN: options.mk:9: ../../devel/x/buildlink3.mk is included " +
+			"depending on option \"!x\", " +
+			"but depending on option \"x\" in buildlink3.mk:15.")
+}
+
+func (s *Suite) Test_OptionsLinesChecker_formatOptions(c *check.C) {
+	t := s.Init(c)
+
+	var ck OptionsLinesChecker
+
+	t.CheckEquals(ck.formatOptions([]string{"a"}), "option \"a\"")
+	t.CheckEquals(ck.formatOptions([]string{"a", "b"}), "options \"a\", \"b\"")
+}
+
+func (s *Suite) Test_optionsInConditions(c *check.C) {
+	t := s.Init(c)
+
+	mklines := t.NewMkLines("filename.mk",
+		".if ${PKG_OPTIONS:Mb} || !empty(PKG_OPTIONS:Ma)",
+		".if ${PKG_BUILD_OPTIONS.package:Mc} && ${PKG_OPTIONS:Mb}",
+		".if ${PKG_OPTIONS:N*} || ${PKG_OPTIONS:M${OPT}} || ${OTHER:Md}",
+		".if empty(PKG_OPTIONS:Me) && !(${PKG_OPTIONS:Mf}) && !empty(PKG_BUILD_OPTIONS.package:Mg)")
+
+	test := func(varcanon string, expected ...string) {
+		actual := optionsInConditions(mklines.mklines, varcanon)
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	test("PKG_OPTIONS", "!e", "!f", "a", "b")
+	test("PKG_BUILD_OPTIONS.*", "c", "g")
+}
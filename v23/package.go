@@ -81,6 +81,12 @@ type Package struct {
 
 	IgnoreMissingPatches bool // In distinfo, don't warn about patches that cannot be found.
 
+	// Whether the distfiles of the package depend on conditions or loops,
+	// such as when each platform has its own distfile. In such a case,
+	// the distfiles that are currently listed in DISTFILES are not
+	// necessarily all distfiles of the package.
+	conditionalDistfiles bool
+
 	Once Once
 
 	// Contains the basenames of the distfiles that are mentioned in distinfo,
@@ -136,6 +142,10 @@ func (pkg *Package) Check() {
 	if files == nil {
 		return
 	}
+	if G.Dump != "" {
+		NewMakefileDump(pkg, allLines).Write(G.Logger.out, G.Dump)
+		return
+	}
 	pkg.check(files, mklines, allLines)
 }
 
@@ -227,10 +237,8 @@ func (pkg *Package) loadPackageMakefile() (*MkLines, *MkLines) {
 		_ = pkg.parse(hacks, allLines, "", false)
 	}
 
-	// TODO: Is this still necessary? This code is 20 years old and was introduced
-	//  when pkglint loaded the package Makefile including all included files into
-	//  a single string. Maybe it makes sense to print the file inclusion hierarchy
-	//  to quickly see files that cannot be included because of unresolved variables.
+	// For the file inclusion hierarchy, including the files that cannot be
+	// included because of unresolved variables, see --dump=includes.
 	if G.DumpMakefile {
 		G.Logger.out.WriteLine("Whole Makefile (with all included files) follows:")
 		for _, line := range allLines.lines.Lines {
@@ -355,6 +363,13 @@ func (pkg *Package) parseLine(mklines *MkLines, mkline *MkLine, allLines *MkLine
 		if varname == "pkgbase" {
 			pkg.seenPkgbase.FirstTime(mkline.Value())
 		}
+
+		switch varname {
+		case "DISTFILES", "PATCHFILES", "DIST_SUBDIR", "DISTNAME", "EXTRACT_SUFX":
+			if mklines.indentation.IsConditional() {
+				pkg.conditionalDistfiles = true
+			}
+		}
 	}
 	return true
 }
@@ -610,6 +625,8 @@ func (pkg *Package) check(filenames []CurrPath, mklines, allLines *MkLines) {
 		pkg.checkFreeze(filename)
 	}
 
+	pkg.checkFilesdir()
+
 	if pkg.Pkgdir == "." {
 		if havePatches && !haveDistinfo {
 			line := NewLineWhole(pkg.File(pkg.DistinfoFile))
@@ -626,6 +643,18 @@ func (pkg *Package) check(filenames []CurrPath, mklines, allLines *MkLines) {
 	pkg.checkDistfilesInDistinfo(allLines)
 	pkg.checkPkgConfig(allLines)
 	pkg.checkWipCommitMsg()
+	G.InterPackage.AddDependencies(pkg, allLines)
+	G.InterPackage.AddConflicts(pkg, allLines)
+
+	if G.CheckPlatforms {
+		platforms := G.Platforms
+		if G.AllPlatforms {
+			platforms = append(AllPlatforms(), platforms...)
+		} else if len(platforms) == 0 {
+			platforms = DefaultPlatforms()
+		}
+		NewPlatformChecker(pkg, allLines, platforms).Check()
+	}
 }
 
 func (pkg *Package) checkDescr(filenames []CurrPath, mklines *MkLines) {
@@ -811,6 +840,15 @@ func (pkg *Package) checkfilePackageMakefile(filename CurrPath, mklines *MkLines
 		return G.CheckGlobal || !G.Pkgsrc.IsInfra(mkline.Filename())
 	}
 	pkg.redundant.Check(allLines) // Updates the variables in the scope
+
+	loadTime := NewLoadTimeOrderChecker(allLines)
+	loadTime.IsRelevant = func(mkline *MkLine) bool {
+		if G.Pkgsrc.IsInfra(mkline.Filename()) {
+			return G.CheckGlobal
+		}
+		return !pkg.Rel(mkline.Filename()).HasPrefixPath("..")
+	}
+	loadTime.Check()
 	pkg.checkGnuConfigureUseLanguages()
 	pkg.checkUseLanguagesCompilerMk(allLines)
 
@@ -1361,6 +1399,22 @@ func (pkg *Package) checkUpdate() {
 	}
 }
 
+// checkFilesdir checks the shell scripts from FILESDIR.
+// All other files from that directory are independent of pkgsrc
+// and may contain anything.
+func (pkg *Package) checkFilesdir() {
+	if pkg.Rel(pkg.File(pkg.Filesdir)) == "." {
+		return
+	}
+
+	for _, filename := range pkg.File(pkg.Filesdir).ReadPaths() {
+		st, err := filename.Lstat()
+		if err == nil && st.Mode().IsRegular() {
+			CheckFileShellScript(filename, pkg)
+		}
+	}
+}
+
 // checkDirent checks a directory entry based on its filename and its mode
 // (regular file, directory, symlink).
 func (pkg *Package) checkDirent(dirent CurrPath, mode os.FileMode) {
@@ -1610,6 +1664,57 @@ func (pkg *Package) AutofixDistinfo(oldSha1, newSha1 string) {
 	}
 }
 
+// refreshDistinfoPatches replaces the distinfo entry of the patch oldName
+// with the entries for the given patches, which have been regenerated
+// by "pkglint --refresh-patches".
+func (pkg *Package) refreshDistinfoPatches(oldName RelPath, names []RelPath, sha1s map[RelPath]string) {
+	distinfoFilename := pkg.File(pkg.DistinfoFile)
+	lines := Load(distinfoFilename, NotEmpty|LogErrors)
+	if lines == nil {
+		return
+	}
+
+	entry := func(name RelPath) string {
+		return sprintf("SHA1 (%s) = %s", name.String(), sha1s[name])
+	}
+
+	for _, line := range lines.Lines {
+		if !hasPrefix(line.Text, sprintf("SHA1 (%s) = ", oldName.String())) {
+			continue
+		}
+		fix := line.Autofix()
+		fix.Warnf(SilentAutofixFormat)
+		fix.Replace(line.Text, entry(names[0]))
+		for _, name := range names[1:] {
+			fix.InsertBelow(entry(name))
+		}
+		fix.Apply()
+	}
+	lines.SaveAutofixChanges()
+}
+
+// wrksrc returns the directory into which a previous "bmake extract"
+// has extracted the distfiles, or an empty path if there is none.
+//
+// Only the default WRKDIR is considered, which is "work" in the package
+// directory. A WRKOBJDIR from the user's mk.conf is not known to pkglint.
+func (pkg *Package) wrksrc() CurrPath {
+	wrksrc := "${WRKDIR}/${DISTNAME}"
+	if value, found, indeterminate := pkg.vars.LastValueFound("WRKSRC"); found {
+		if indeterminate {
+			return ""
+		}
+		wrksrc = value
+	}
+
+	wrksrc = strings.ReplaceAll(wrksrc, "${WRKDIR}", "work")
+	dir := pkg.File(NewPackagePathString(wrksrc))
+	if containsExpr(dir.String()) || !dir.IsDir() {
+		return ""
+	}
+	return dir
+}
+
 // File returns the (possibly absolute) path to relativeFileName,
 // as resolved from the package's directory.
 // Variables that are known in the package are resolved, e.g. ${PKGDIR}.
@@ -177,8 +177,12 @@ func (s *Suite) Test_Package__using_common_Makefile_overriding_DISTINFO_FILE(c *
 	// Nevertheless, having a DISTINFO_FILE defined without the
 	// corresponding PATCHDIR creates an unneeded uncertainty.
 	t.CheckOutputLines(
-		"WARN: ~/security/pinentry-fltk/Makefile:21: " +
-			"DISTINFO_FILE \"${.CURDIR}/distinfo\" " +
+		"WARN: ~/security/pinentry-fltk/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/security/pinentry-fltk/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
+		"WARN: ~/security/pinentry-fltk/Makefile:21: "+
+			"DISTINFO_FILE \"${.CURDIR}/distinfo\" "+
 			"has no corresponding PATCHDIR.")
 }
 
@@ -326,6 +330,10 @@ func (s *Suite) Test_Package__distinfo_from_other_package(c *check.C) {
 		"WARN: x11/gst-x11/Makefile: This package should have a PLIST file.",
 		"ERROR: x11/gst-x11/Makefile: Each package must define its LICENSE.",
 		"WARN: x11/gst-x11/Makefile: Each package should define a COMMENT.",
+		"WARN: x11/gst-x11/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: x11/gst-x11/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
 		"ERROR: x11/gst-x11/../../multimedia/gst-base/distinfo:3: "+
 			"SHA1 hash of ../../x11/gst-x11/patches/patch-aa differs "+
 			"(distinfo has 1234, patch file has 9a93207561abfef7e7550598c5a08f2c3226995b).",
@@ -1427,13 +1435,16 @@ func (s *Suite) Test_Package_check__DISTINFO_FILE_and_PATCHDIR(c *check.C) {
 		"ERROR: devel/ocaml-dune-configurator/distinfo: "+
 			"Patch \"patches/patch-README\" is not recorded. "+
 			sprintf("Run %q.", bmake("makepatchsum")),
+		"WARN: devel/ocaml-dune-configurator/patches/patch-README: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: devel/ocaml-dune-configurator/patches/patch-README: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
 		"ERROR: devel/ocaml-dune-configurator/../../devel/ocaml-dune/distinfo: "+
 			"Patch \"../../devel/ocaml-dune-configurator/patches/patch-README\" is not recorded. "+
 			sprintf("Run %q.", bmake("makepatchsum")),
 		"WARN: devel/ocaml-dune-configurator/../../devel/ocaml-dune/Makefile.common:4: "+
 			"DISTINFO_FILE \"${.CURDIR}/../../devel/ocaml-dune/distinfo\" "+
-			"has no corresponding PATCHDIR.",
-	)
+			"has no corresponding PATCHDIR.")
 }
 
 func (s *Suite) Test_Package_checkDescr__DESCR_SRC(c *check.C) {
@@ -1795,7 +1806,11 @@ func (s *Suite) Test_Package_checkfilePackageMakefile__META_PACKAGE_with_patch(c
 	// These patches are not used by the meta package itself.
 	// They are just stored there in the "most obvious location",
 	// to be used by the related packages.
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_Package_checkfilePackageMakefile__USE_IMAKE_and_USE_X11(c *check.C) {
@@ -3134,9 +3149,13 @@ func (s *Suite) Test_Package_checkOwnerMaintainer__directory(c *check.C) {
 
 	// No warning for the patches directory, only for regular files.
 	t.CheckOutputLines(
-		"NOTE: ~/category/package: " +
-			"Only commit changes that " +
-			"maintainer@example.org would approve.")
+		"NOTE: ~/category/package: "+
+			"Only commit changes that "+
+			"maintainer@example.org would approve.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_Package_checkOwnerMaintainer__url2pkg(c *check.C) {
@@ -3709,6 +3728,34 @@ func (s *Suite) Test_Package_AutofixDistinfo__missing_file(c *check.C) {
 		"ERROR: ~/category/package/distinfo: Cannot be read.")
 }
 
+func (s *Suite) Test_Package_wrksrc(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.FinishSetUp()
+
+	test := func(wrksrc string, dir RelPath, expected CurrPath) {
+		t.SetUpPackage("category/package",
+			"WRKSRC=\t"+wrksrc)
+		if dir != "" {
+			t.CreateFileLines("category/package/" + dir + "/file")
+		}
+		pkg := NewPackage(t.File("category/package"))
+		_, _, _ = pkg.load()
+
+		t.CheckEquals(pkg.wrksrc(), expected)
+	}
+
+	test("${WRKDIR}/${DISTNAME}", "",
+		"")
+	test("${WRKDIR}/${DISTNAME}", "work/package-1.0",
+		t.File("category/package/work/package-1.0"))
+	test("${WRKDIR}/${DISTNAME}/src", "work/package-1.0/src",
+		t.File("category/package/work/package-1.0/src"))
+	test("${WRKDIR}/${UNKNOWN}", "work/package-1.0",
+		"")
+}
+
 func (s *Suite) Test_Package_Includes(c *check.C) {
 	t := s.Init(c)
 
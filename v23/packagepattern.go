@@ -1,6 +1,10 @@
 package pkglint
 
-import "github.com/rillig/pkglint/v23/pkgver"
+import (
+	"github.com/rillig/pkglint/v23/makepat"
+	"github.com/rillig/pkglint/v23/pkgver"
+	"strings"
+)
 
 // PackagePattern is a pattern that matches zero or more packages including
 // their versions.
@@ -110,6 +114,42 @@ func ParsePackagePattern(p *MkParser) *PackagePattern {
 	return nil
 }
 
+// Matches returns whether the pattern matches the package with the given
+// base name and version, such as "pkgbase" and "1.0".
+//
+// Patterns that contain expressions or curly braces never match.
+func (pp *PackagePattern) Matches(pkgbase, version string) bool {
+	matchGlob := func(pattern, s string) bool {
+		if containsExpr(pattern) || strings.ContainsAny(pattern, "{}") {
+			return false
+		}
+		m, err := makepat.Compile(pattern)
+		return err == nil && m.Match(s)
+	}
+
+	if !matchGlob(pp.Pkgbase, pkgbase) {
+		return false
+	}
+
+	if pp.Wildcard != "" {
+		wildcard := strings.TrimSuffix(pp.Wildcard, "{,nb*}")
+		wildcard = strings.TrimSuffix(wildcard, "{,nb[0-9]*}")
+		return matchGlob(wildcard, version)
+	}
+
+	if containsExpr(pp.Lower) || containsExpr(pp.Upper) {
+		return false
+	}
+	switch {
+	case pp.LowerOp == ">=" && pkgver.Compare(version, pp.Lower) < 0,
+		pp.LowerOp == ">" && pkgver.Compare(version, pp.Lower) <= 0,
+		pp.UpperOp == "<=" && pkgver.Compare(version, pp.Upper) > 0,
+		pp.UpperOp == "<" && pkgver.Compare(version, pp.Upper) >= 0:
+		return false
+	}
+	return true
+}
+
 type PackagePatternChecker struct {
 	Varname string
 	MkLine  *MkLine
@@ -129,6 +129,38 @@ func (s *Suite) Test_ParsePackagePattern(c *check.C) {
 	testNil("{ssh{,6}-[0-9]*,openssh-[0-9]*}")
 }
 
+func (s *Suite) Test_PackagePattern_Matches(c *check.C) {
+	t := s.Init(c)
+
+	test := func(pattern, pkgbase, version string, expected bool) {
+		pp := ParsePackagePattern(NewMkParser(nil, pattern))
+		t.CheckEqualsf(pp.Matches(pkgbase, version), expected,
+			"%s matches %s-%s", pattern, pkgbase, version)
+	}
+
+	test("pkgbase-[0-9]*", "pkgbase", "1.0", true)
+	test("pkgbase-[0-9]*", "other", "1.0", false)
+	test("pkgbase-[0-9]*", "pkgbase", "devel", false)
+	test("pkgbase-1.*", "pkgbase", "1.5", true)
+	test("pkgbase-1.*", "pkgbase", "2.0", false)
+	test("pkgbase-[0-9]*{,nb*}", "pkgbase", "1.0", true)
+	test("py[0-9]*-pkgbase-[0-9]*", "py313-pkgbase", "1.0", true)
+	test("pkgbase>=1.0", "pkgbase", "1.0", true)
+	test("pkgbase>=1.0", "pkgbase", "0.9", false)
+	test("pkgbase>1.0", "pkgbase", "1.0", false)
+	test("pkgbase>1.0", "pkgbase", "1.0.1", true)
+	test("pkgbase<2", "pkgbase", "1.9", true)
+	test("pkgbase<2", "pkgbase", "2.0", false)
+	test("pkgbase<=2", "pkgbase", "2.0", true)
+	test("pkgbase>=1<2", "pkgbase", "1.5", true)
+	test("pkgbase>=1<2", "pkgbase", "2.5", false)
+
+	// Expressions cannot be resolved, therefore they never match.
+	test("${PYPKGPREFIX}-pkgbase-[0-9]*", "py313-pkgbase", "1.0", false)
+	test("pkgbase>=${VERSION}", "pkgbase", "1.0", false)
+	test("pkgbase-${VERSION}", "pkgbase", "1.0", false)
+}
+
 func (s *Suite) Test_PackagePatternChecker_Check(c *check.C) {
 	vt := NewVartypeCheckTester(s.Init(c), BtPackagePattern)
 
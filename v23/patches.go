@@ -2,10 +2,13 @@ package pkglint
 
 // Checks for patch files.
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
 func CheckLinesPatch(lines *Lines, pkg *Package) {
-	(&PatchChecker{lines, NewLinesLexer(lines), false, false}).Check(pkg)
+	(&PatchChecker{lines, NewLinesLexer(lines), false, false, nil}).Check(pkg)
 }
 
 type PatchChecker struct {
@@ -13,6 +16,7 @@ type PatchChecker struct {
 	llex              *LinesLexer
 	seenDocumentation bool
 	previousLineEmpty bool
+	hunks             []*patchHunk
 }
 
 const rePatchUniFileDel = `^---[\t ]([^\t ]+)(?:[\t ]+(.*))?$`
@@ -86,6 +90,10 @@ func (ck *PatchChecker) Check(pkg *Package) {
 	if len(patchedFiles) == 1 {
 		ck.checkCanonicalPatchName(patchedFiles[0])
 	}
+	if nPatched > 0 {
+		ck.checkDocumentation(pkg)
+	}
+	ck.checkWrksrc(pkg)
 
 	CheckLinesTrailingEmptyLines(ck.lines)
 	sha1Before := computePatchSha1Hex(ck.lines)
@@ -94,6 +102,8 @@ func (ck *PatchChecker) Check(pkg *Package) {
 		sha1After := computePatchSha1Hex(linesAfter)
 		pkg.AutofixDistinfo(sha1Before, sha1After)
 	}
+
+	ck.refresh(pkg, patchedFiles)
 }
 
 // See https://www.gnu.org/software/diffutils/manual/html_node/Detailed-Unified.html
@@ -134,6 +144,8 @@ func (ck *PatchChecker) checkUnifiedDiff(patchedFile Path) {
 		ck.checktextUniHunkCr()
 		ck.checktextCvsID(text)
 
+		hunk := &patchHunk{ck.llex.PreviousLine(), patchedFile, linenoDel, linenoAdd, nil, nil}
+
 		for !ck.llex.EOF() && (linesToDel > 0 || linesToAdd > 0 || hasPrefix(ck.llex.CurrentLine().Text, "\\")) {
 			line := ck.llex.CurrentLine()
 			ck.llex.Skip()
@@ -149,6 +161,8 @@ func (ck *PatchChecker) checkUnifiedDiff(patchedFile Path) {
 				linesToAdd--
 				linenoDel++
 				linenoAdd++
+				hunk.old = append(hunk.old, "")
+				hunk.new = append(hunk.new, "")
 
 			case hasPrefix(text, " "), hasPrefix(text, "\t"):
 				linesToDel--
@@ -156,10 +170,14 @@ func (ck *PatchChecker) checkUnifiedDiff(patchedFile Path) {
 				linenoDel++
 				linenoAdd++
 				ck.checktextCvsID(text)
+				context := strings.TrimPrefix(text, " ")
+				hunk.old = append(hunk.old, context)
+				hunk.new = append(hunk.new, context)
 
 			case hasPrefix(text, "-"):
 				linesToDel--
 				linenoDel++
+				hunk.old = append(hunk.old, text[1:])
 
 			case hasPrefix(text, "+"):
 				linesToAdd--
@@ -167,6 +185,7 @@ func (ck *PatchChecker) checkUnifiedDiff(patchedFile Path) {
 				ck.checkConfigure(text[1:], isConfigure)
 				ck.checkAddedLine(text[1:], linenoAdd)
 				linenoAdd++
+				hunk.new = append(hunk.new, text[1:])
 
 			case hasPrefix(text, "\\"):
 				// \ No newline at end of file (or a translation of that message)
@@ -187,6 +206,8 @@ func (ck *PatchChecker) checkUnifiedDiff(patchedFile Path) {
 				linesToDel, condStr(linesToDel != 1, "lines", "line"),
 				linesToAdd, condStr(linesToAdd != 1, "lines", "line"))
 		}
+
+		ck.hunks = append(ck.hunks, hunk)
 	}
 
 	if !hasHunks {
@@ -416,14 +437,26 @@ func (ck *PatchChecker) checktextCvsID(text string) {
 }
 
 func (ck *PatchChecker) checkCanonicalPatchName(patched Path) {
+	if ck.isCanonicalPatchName(patched) {
+		return
+	}
+
+	ck.lines.Whole().Warnf(
+		"The patch file should be named %q to match the patched file %q.",
+		ck.canonicalPatchName(patched), patched.String())
+}
+
+// isCanonicalPatchName returns whether the name of the patch file
+// corresponds to the patched file, at least roughly.
+func (ck *PatchChecker) isCanonicalPatchName(patched Path) bool {
 	patch := ck.lines.BaseName.String()
 	if matches(patch, `^patch-[a-z][a-z]$`) {
 		// This naming scheme is only accepted for historic reasons.
 		// It has absolutely no benefit.
-		return
+		return true
 	}
 	if matches(patch, `^patch-[A-Z]+-[0-9]+`) {
-		return
+		return true
 	}
 
 	// The patch name only needs to correspond very roughly to the patched file.
@@ -435,20 +468,413 @@ func (ck *PatchChecker) checkCanonicalPatchName(patched Path) {
 	patchedNorm := normalize(patched.Clean().String())
 	patchNorm := normalize(strings.TrimPrefix(patch, "patch-"))
 	if patchNorm == patchedNorm {
-		return
-	}
-	if hasSuffix(patchedNorm, patchNorm) && patchNorm == normalize(patched.Base().String()) {
-		return
+		return true
 	}
+	return hasSuffix(patchedNorm, patchNorm) && patchNorm == normalize(patched.Base().String())
+}
 
+// canonicalPatchName returns the name that mkpatches gives to the patch
+// for the patched file.
+func (*PatchChecker) canonicalPatchName(patched Path) RelPath {
 	// See pkgtools/pkgdiff/files/mkpatches, function patch_name.
 	canon1 := replaceAll(patched.Clean().String(), `_`, "__")
 	canon2 := replaceAll(canon1, `[/\s]`, "_")
-	canonicalName := "patch-" + canon2
+	return NewRelPathString("patch-" + canon2)
+}
 
-	ck.lines.Whole().Warnf(
-		"The patch file should be named %q to match the patched file %q.",
-		canonicalName, patched.String())
+// checkDocumentation checks that the comment of the patch says why
+// the patch is needed and whether it has been sent upstream,
+// as recommended by the pkgsrc guide.
+func (ck *PatchChecker) checkDocumentation(pkg *Package) {
+	if !G.WarnExtra {
+		return
+	}
+	comment := ck.comment()
+	if comment == "" {
+		// Already reported by checkBeginDiff.
+		return
+	}
+
+	doc := ck.parseDocumentation(comment)
+	line := ck.lines.Whole()
+	if !doc.reason {
+		line.Warnf("The patch documentation should say why the patch is needed.")
+		line.Explain(
+			"Pkgsrc tries to have as few patches as possible.",
+			"Therefore, each patch should explain in a sentence",
+			"what problem it solves,",
+			"such as \"Fix the build on NetBSD, which doesn't have alloca.h.\"")
+	}
+	if doc.upstream == "" {
+		line.Warnf("The patch documentation should say whether the patch has been sent upstream.")
+		line.Explain(
+			"Each patch should be sent to the upstream maintainers of the package,",
+			"so that they can include it in future versions.",
+			"To prevent duplicate work, the patch should mention",
+			"the corresponding bug report or pull request.",
+			"",
+			"Typical forms are:",
+			"",
+			"\thttps://github.com/org/repo/pull/123",
+			"\tUpstream: not needed",
+			"\tpkgsrc-specific",
+			"",
+			"To see all patches without upstream status, run",
+			"\"pkglint -Cglobal -Wextra -r\" in the pkgsrc root directory.")
+
+		if pkg != nil {
+			G.InterPackage.AddPatchWithoutUpstreamStatus(pkg, ck.lines.Filename)
+		}
+	}
+}
+
+// parseDocumentation extracts the reason for the patch
+// and its upstream status from the comment of the patch.
+//
+// The comment may use header lines in the style of DEP-3,
+// such as "Description:" for the reason and "Upstream-Status:"
+// or "Forwarded:" for the upstream status.
+// Any other text counts as the reason if it has at least a few words,
+// not counting the bug URLs and the phrases about the upstream status.
+func (*PatchChecker) parseDocumentation(comment string) patchDocumentation {
+	const reURL = `\bhttps?://[^\s>)]*[^\s>).,;:]`
+	const reStatus = `(?i)\b(?:(?:sent|reported|submitted|fixed|merged|accepted|taken|backported|forwarded|provided|not needed)\s+)?` +
+		`(?:from|to|by)\s+upstream\b|` +
+		`\b(?:sent|reported|submitted|fixed|merged|accepted|backported|forwarded|not needed)\s+(?:in\s+)?upstream\b|` +
+		`\b(?:pkgsrc|netbsd)[- ]specific\b`
+
+	var doc patchDocumentation
+	var prose []string
+	for _, text := range strings.Split(comment, "\n") {
+		if m, key, value := match2(text, `^(?i)(description|subject|reason|upstream(?:[- ]status)?|forwarded|bug):[\t ]*(.*)$`); m {
+			if value != "" && matches(key, `^(?i)(?:description|subject|reason)$`) {
+				doc.reason = true
+			} else if value != "" {
+				doc.upstream = value
+			}
+			continue
+		}
+
+		if doc.upstream == "" {
+			if m := regcomp(reURL).FindString(text); m != "" {
+				doc.upstream = m
+			} else if m := regcomp(reStatus).FindString(text); m != "" {
+				doc.upstream = m
+			}
+		}
+
+		prose = append(prose, replaceAll(replaceAll(text, reURL, ""), reStatus, ""))
+	}
+
+	if len(regcomp(`[A-Za-z]+`).FindAllString(strings.Join(prose, " "), 3)) == 3 {
+		doc.reason = true
+	}
+	return doc
+}
+
+// checkWrksrc checks the patch against the files that have been extracted
+// by a previous "bmake extract", to save a full "bmake patch" cycle when
+// updating a package.
+//
+// Each hunk must apply cleanly, without fuzz or offset.
+// Hunks that are already applied are reported as well,
+// since upstream may have merged them.
+func (ck *PatchChecker) checkWrksrc(pkg *Package) {
+	if pkg == nil || len(ck.hunks) == 0 {
+		return
+	}
+	wrksrc := pkg.wrksrc()
+	if wrksrc.IsEmpty() {
+		return
+	}
+
+	contents := map[CurrPath][]string{}
+	load := func(filename CurrPath) []string {
+		if lines, ok := contents[filename]; ok {
+			return lines
+		}
+		var lines []string
+		if text, err := filename.ReadString(); err == nil {
+			lines = []string{}
+			if text != "" {
+				lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+			}
+		}
+		contents[filename] = lines
+		return lines
+	}
+
+	var diagnostics []func()
+	applied := 0
+	for _, hunk := range ck.hunks {
+		hunk := hunk
+		if hunk.file.IsAbs() {
+			continue
+		}
+		filename := wrksrc.JoinNoClean(NewRelPath(hunk.file)).CleanPath()
+		if orig := filename + ".orig"; orig.IsFile() {
+			// After "bmake patch", the original file is still available.
+			filename = orig
+		}
+		line := hunk.line
+		lines := load(filename)
+
+		if lines == nil {
+			if hunk.oldStart == 0 && len(hunk.old) == 0 {
+				// The patch creates the file.
+				continue
+			}
+			diagnostics = append(diagnostics, func() {
+				line.Errorf("The patched file %s does not exist.", line.Rel(filename))
+			})
+			continue
+		}
+
+		offset, found := ck.findHunk(lines, hunk.old, hunk.oldStart)
+		if len(hunk.old) == 0 && len(lines) > 0 {
+			found = false
+		}
+		switch {
+		case found && offset == 0:
+			break
+
+		case ck.isApplied(lines, hunk):
+			applied++
+			diagnostics = append(diagnostics, func() {
+				line.Warnf("This hunk is already applied to %s.", line.Rel(filename))
+			})
+
+		case found:
+			diagnostics = append(diagnostics, func() {
+				line.Warnf("This hunk applies to %s only with an offset of %d %s.",
+					line.Rel(filename), offset, condStr(offset == 1 || offset == -1, "line", "lines"))
+				line.Explain(
+					"To make the patch apply cleanly again,",
+					sprintf("run %q and then \"mkpatches\".", bmake("patch")))
+			})
+
+		default:
+			diagnostics = append(diagnostics, func() {
+				line.Errorf("This hunk does not apply cleanly to %s.", line.Rel(filename))
+				line.Explain(
+					"When updating a package, the patched files may have",
+					"changed upstream.",
+					"To adjust the patch, apply it manually,",
+					sprintf("then run %q.", "mkpatches"))
+			})
+		}
+	}
+
+	if applied == len(ck.hunks) {
+		line := ck.lines.Whole()
+		line.Warnf("All changes from this patch are already in %s.", line.Rel(wrksrc))
+		line.Explain(
+			"The upstream authors have probably merged this patch.",
+			"In that case, the patch and its entry in the distinfo file",
+			"should be removed.")
+		return
+	}
+	for _, diagnostic := range diagnostics {
+		diagnostic()
+	}
+}
+
+// findHunk searches the lines of the hunk in the file, starting at the
+// line number from the hunk header and looking in both directions.
+// It returns the offset from the expected line number.
+func (*PatchChecker) findHunk(lines []string, hunk []string, start int) (int, bool) {
+	expected := imax(start-1, 0)
+
+	matchesAt := func(i int) bool {
+		if i < 0 || i+len(hunk) > len(lines) {
+			return false
+		}
+		for j, text := range hunk {
+			actual := lines[i+j]
+			// Context lines that consist only of whitespace
+			// may have lost their leading space.
+			if actual != text && !(text == "" && trimHspace(actual) == "") {
+				return false
+			}
+		}
+		return true
+	}
+
+	for d := 0; d <= len(lines); d++ {
+		if matchesAt(expected - d) {
+			return -d, true
+		}
+		if d > 0 && matchesAt(expected+d) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// isApplied returns whether the changes from the hunk
+// already appear in the file.
+func (ck *PatchChecker) isApplied(lines []string, hunk *patchHunk) bool {
+	if len(hunk.new) == 0 || strings.Join(hunk.old, "\n") == strings.Join(hunk.new, "\n") {
+		return false
+	}
+	_, found := ck.findHunk(lines, hunk.new, hunk.newStart)
+	return found
+}
+
+// refresh regenerates the patch from the files in WRKSRC,
+// in the same form as mkpatches from pkgtools/pkgdiff.
+//
+// This requires that "bmake patch" has been run before,
+// leaving each patched file together with its ".orig" file.
+func (ck *PatchChecker) refresh(pkg *Package, patchedFiles []Path) {
+	if pkg == nil || !G.RefreshPatches || len(patchedFiles) == 0 {
+		return
+	}
+	wrksrc := pkg.wrksrc()
+	if wrksrc.IsEmpty() {
+		return
+	}
+
+	type patchedFile struct {
+		name     Path
+		old, new string
+	}
+	var files []patchedFile
+	for _, patched := range patchedFiles {
+		name := patched.Clean()
+		if name.IsAbs() || name.HasPrefixPath("..") {
+			return
+		}
+		filename := wrksrc.JoinNoClean(NewRelPath(name))
+		oldText, err1 := (filename + ".orig").ReadString()
+		newText, err2 := filename.ReadString()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		if oldText != newText {
+			files = append(files, patchedFile{name, oldText, newText})
+		}
+	}
+	if len(files) == 0 {
+		// Already reported by checkWrksrc.
+		return
+	}
+
+	comment := ck.comment()
+	header := "$" + "NetBSD$\n\n"
+	if comment != "" {
+		header += comment + "\n\n"
+	}
+
+	patches := map[RelPath]string{}
+	oldName := ck.lines.BaseName
+	if len(files) > 1 && matches(ck.lines.Filename.String(), `\bCVE\b`) {
+		text := header
+		for _, file := range files {
+			text += unifiedDiff(NewCurrPath(file.name), file.old, file.new)
+		}
+		patches[oldName] = text
+	} else {
+		for _, file := range files {
+			name := ck.canonicalPatchName(file.name)
+			if len(patchedFiles) == 1 && ck.isCanonicalPatchName(file.name) {
+				name = oldName
+			}
+			patches[name] += header + unifiedDiff(NewCurrPath(file.name), file.old, file.new)
+		}
+	}
+
+	var oldText strings.Builder
+	for _, line := range ck.lines.Lines {
+		oldText.WriteString(line.Text)
+		oldText.WriteString("\n")
+	}
+	if len(patches) == 1 && patches[oldName] == oldText.String() {
+		return
+	}
+
+	var names []RelPath
+	for name := range patches {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	line := ck.lines.Whole()
+	fix := line.Autofix()
+	fix.Notef("This patch differs from the changes in %s.", line.Rel(wrksrc))
+	fix.Explain(
+		"The patch has been edited manually, or the files in WRKSRC",
+		"have been edited after running",
+		sprintf("%q.", bmake("patch")),
+		"",
+		"With --autofix, pkglint regenerates the patch from the files",
+		"in WRKSRC, like \"mkpatches\" from pkgtools/pkgdiff.",
+		"A patch for several files is split into one patch per file,",
+		"and the distinfo file is updated accordingly.")
+	fix.Custom(func(showAutofix, autofix bool) {
+		dir := ck.lines.Filename.Dir()
+		for _, name := range names {
+			fix.Describef(0, "Regenerating %s", line.Rel(dir.JoinNoClean(name)))
+		}
+		if _, ok := patches[oldName]; !ok {
+			fix.Describef(0, "Removing %s", line.Rel(ck.lines.Filename))
+		}
+		if !autofix {
+			return
+		}
+
+		sha1s := map[RelPath]string{}
+		for _, name := range names {
+			filename := dir.JoinNoClean(name)
+			G.fileCache.Evict(filename)
+			tmpName := filename + ".pkglint.tmp"
+			if err := tmpName.WriteString(patches[name]); err != nil {
+				G.Logger.TechErrorf(tmpName, "Cannot write: %s", err)
+				return
+			} else if err := tmpName.Rename(filename); err != nil {
+				G.Logger.TechErrorf(tmpName, "Cannot overwrite with autofixed content: %s", err)
+				return
+			}
+			sha1s[name] = computePatchSha1Hex(Load(filename, MustSucceed))
+		}
+		if _, ok := patches[oldName]; !ok {
+			G.fileCache.Evict(ck.lines.Filename)
+			if err := ck.lines.Filename.Remove(); err != nil {
+				G.Logger.TechErrorf(ck.lines.Filename, "Cannot remove: %s", err)
+				return
+			}
+		}
+		pkg.refreshDistinfoPatches(oldName, names, sha1s)
+	})
+	fix.Apply()
+}
+
+// comment returns the documentation of the patch,
+// which is everything between the CVS ID and the first diff.
+func (ck *PatchChecker) comment() string {
+	var lines []string
+	for i, line := range ck.lines.Lines {
+		text := line.Text
+		if i == 0 && hasPrefix(text, "$"+"NetBSD") {
+			continue
+		}
+		if matches(text, rePatchUniFileDel) || matches(text, `^\+\+\+[\t ]`) ||
+			matches(text, `^\*\*\*[\t ]`) {
+			break
+		}
+		if text != "" && ck.isEmptyLine(text) {
+			continue
+		}
+		lines = append(lines, text)
+	}
+
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
 }
 
 // isEmptyLine tests whether a line provides essentially no interesting content.
@@ -469,3 +895,21 @@ func (*PatchChecker) isConfigure(filename Path) bool {
 	}
 	return false
 }
+
+// patchHunk is a single hunk from a unified diff,
+// as needed for checking the patch against the extracted files.
+type patchHunk struct {
+	line     *Line // The line starting with @@
+	file     Path
+	oldStart int
+	newStart int
+	old      []string // The context lines and the deleted lines
+	new      []string // The context lines and the added lines
+}
+
+// patchDocumentation is the information from the comment of a patch,
+// as needed for checking its documentation.
+type patchDocumentation struct {
+	reason   bool   // Whether the comment says why the patch is needed
+	upstream string // A bug URL, or a phrase like "Upstream: not needed"
+}
@@ -167,7 +167,11 @@ func (s *Suite) Test_CheckLinesPatch__wrong_header_order(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"WARN: patch-WrongOrder:7: Unified diff headers should be first ---, then +++.")
+		"WARN: patch-WrongOrder:7: Unified diff headers should be first ---, then +++.",
+		"WARN: patch-WrongOrder: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-WrongOrder: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // Context diffs are old and deprecated. Therefore, pkglint doesn't check them thoroughly.
@@ -227,7 +231,9 @@ func (s *Suite) Test_CheckLinesPatch__two_patched_files(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"WARN: patch-aa: Contains patches for 2 files, should be only one.")
+		"WARN: patch-aa: Contains patches for 2 files, should be only one.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_CheckLinesPatch__two_patched_files_for_CVE(c *check.C) {
@@ -288,7 +294,9 @@ func (s *Suite) Test_CheckLinesPatch__only_unified_header_but_no_content(c *chec
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: patch-unified:EOF: No patch hunks for \"unified\".")
+		"ERROR: patch-unified:EOF: No patch hunks for \"unified\".",
+		"WARN: patch-unified: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_CheckLinesPatch__only_context_header_but_no_content(c *check.C) {
@@ -330,7 +338,11 @@ func (s *Suite) Test_CheckLinesPatch__no_newline_with_text_following(c *check.C)
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"WARN: patch-aa:12: Empty line or end of file expected.")
+		"WARN: patch-aa:12: Empty line or end of file expected.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_CheckLinesPatch__no_newline(c *check.C) {
@@ -351,7 +363,11 @@ func (s *Suite) Test_CheckLinesPatch__no_newline(c *check.C) {
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // Some patch files may end before reaching the expected line count (in this case 7 lines).
@@ -376,7 +392,11 @@ func (s *Suite) Test_CheckLinesPatch__empty_lines_left_out_at_eof(c *check.C) {
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // In some context lines, the leading space character may be missing.
@@ -399,7 +419,11 @@ func (s *Suite) Test_CheckLinesPatch__context_lines_with_tab_instead_of_space(c
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // Before 2018-01-28, pkglint had panicked when checking an empty
@@ -472,7 +496,11 @@ func (s *Suite) Test_CheckLinesPatch__autogenerated(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: ~/patch-aa:9: This code must not be included in patches.")
+		"ERROR: ~/patch-aa:9: This code must not be included in patches.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_CheckLinesPatch__empty_context_lines_in_hunk(c *check.C) {
@@ -497,7 +525,11 @@ func (s *Suite) Test_CheckLinesPatch__empty_context_lines_in_hunk(c *check.C) {
 	// The last context line is omitted completely because it would also
 	// have trailing whitespace, and if that were removed, would be a
 	// trailing empty line.
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_CheckLinesPatch__invalid_line_in_hunk(c *check.C) {
@@ -519,7 +551,11 @@ func (s *Suite) Test_CheckLinesPatch__invalid_line_in_hunk(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: ~/patch-aa:10: Invalid line in unified patch hunk: <<<<<<<<")
+		"ERROR: ~/patch-aa:10: Invalid line in unified patch hunk: <<<<<<<<",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_Check__missing_CVS_Id(c *check.C) {
@@ -553,7 +589,9 @@ func (s *Suite) Test_PatchChecker_Check__add_file(c *check.C) {
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/patch-aa: " +
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_Check__delete_file(c *check.C) {
@@ -571,7 +609,9 @@ func (s *Suite) Test_PatchChecker_Check__delete_file(c *check.C) {
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/patch-aa: " +
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_Check__absolute_path(c *check.C) {
@@ -593,7 +633,9 @@ func (s *Suite) Test_PatchChecker_Check__absolute_path(c *check.C) {
 	// XXX: Patches must not apply to absolute paths.
 	// The only allowed exception is /dev/null.
 	// ^(---|\+\+\+) /(?!dev/null)
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/patch-aa: " +
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_Check__add_hardcoded_usr_pkg(c *check.C) {
@@ -613,7 +655,9 @@ func (s *Suite) Test_PatchChecker_Check__add_hardcoded_usr_pkg(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: ~/patch-aa:9: Patches must not hard-code the pkgsrc PREFIX.")
+		"ERROR: ~/patch-aa:9: Patches must not hard-code the pkgsrc PREFIX.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkUnifiedDiff__lines_at_end(c *check.C) {
@@ -635,7 +679,11 @@ func (s *Suite) Test_PatchChecker_checkUnifiedDiff__lines_at_end(c *check.C) {
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkUnifiedDiff__line_number_mismatch(c *check.C) {
@@ -659,7 +707,11 @@ func (s *Suite) Test_PatchChecker_checkUnifiedDiff__line_number_mismatch(c *chec
 
 	t.CheckOutputLines(
 		"NOTE: patch-aa:7: The difference between the line numbers 2 and 1 should be 0, not -1.",
-		"NOTE: patch-aa:10: The difference between the line numbers 5 and 7 should be 0, not 2.")
+		"NOTE: patch-aa:10: The difference between the line numbers 5 and 7 should be 0, not 2.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkBeginDiff__multiple_patches_without_documentation(c *check.C) {
@@ -709,7 +761,11 @@ func (s *Suite) Test_PatchChecker_checkConfigure__no_GNU(c *check.C) {
 
 	// No warning since configure.sh is probably not a GNU-style
 	// configure file.
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkConfigure__GNU(c *check.C) {
@@ -729,7 +785,11 @@ func (s *Suite) Test_PatchChecker_checkConfigure__GNU(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: ~/patch-aa:9: This code must not be included in patches.")
+		"ERROR: ~/patch-aa:9: This code must not be included in patches.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // I'm not sure whether configure.in is really relevant for this check.
@@ -752,7 +812,11 @@ func (s *Suite) Test_PatchChecker_checkConfigure__configure_in(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: ~/patch-aa:9: This code must not be included in patches.")
+		"ERROR: ~/patch-aa:9: This code must not be included in patches.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 // I'm not sure whether configure.ac is really relevant for this check.
@@ -775,7 +839,11 @@ func (s *Suite) Test_PatchChecker_checkConfigure__configure_ac(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: ~/patch-aa:9: This code must not be included in patches.")
+		"ERROR: ~/patch-aa:9: This code must not be included in patches.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkAddedLine__interpreter(c *check.C) {
@@ -795,8 +863,12 @@ func (s *Suite) Test_PatchChecker_checkAddedLine__interpreter(c *check.C) {
 	CheckLinesPatch(lines, nil)
 
 	t.CheckOutputLines(
-		"ERROR: patch-aa:9: Patches must not add a hard-coded interpreter " +
-			"(/home/my/pkgsrc/pkg/bin/bash).")
+		"ERROR: patch-aa:9: Patches must not add a hard-coded interpreter "+
+			"(/home/my/pkgsrc/pkg/bin/bash).",
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkAddedLine__interpreter_in_line_2(c *check.C) {
@@ -816,7 +888,11 @@ func (s *Suite) Test_PatchChecker_checkAddedLine__interpreter_in_line_2(c *check
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkAddedLine__interpreter_placeholder(c *check.C) {
@@ -835,7 +911,11 @@ func (s *Suite) Test_PatchChecker_checkAddedLine__interpreter_placeholder(c *che
 
 	CheckLinesPatch(lines, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkAddedAbsPath(c *check.C) {
@@ -845,7 +925,7 @@ func (s *Suite) Test_PatchChecker_checkAddedAbsPath(c *check.C) {
 		lines := t.NewLines("patch-file",
 			CvsID,
 			"",
-			"Demonstrates absolute paths.",
+			"Demonstrates absolute paths, not needed upstream.",
 			"",
 			"--- file.orig",
 			"+++ file",
@@ -1064,7 +1144,11 @@ func (s *Suite) Test_PatchChecker_checktextCvsID(c *check.C) {
 	t.CheckOutputLines(
 		"WARN: ~/patch-aa:7: Remove the CVS tag \"$"+"Id$\".",
 		"WARN: ~/patch-aa:8: Remove the CVS tag \"$"+"Id$\" by reducing the number of context lines using pkgdiff or \"diff -U[210]\".",
-		"WARN: ~/patch-aa:11: Remove the CVS tag \"$"+"Author$\" by reducing the number of context lines using pkgdiff or \"diff -U[210]\".")
+		"WARN: ~/patch-aa:11: Remove the CVS tag \"$"+"Author$\" by reducing the number of context lines using pkgdiff or \"diff -U[210]\".",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_PatchChecker_checkCanonicalPatchName(c *check.C) {
@@ -1151,6 +1235,540 @@ func (s *Suite) Test_PatchChecker_checkCanonicalPatchName(c *check.C) {
 		nil...)
 }
 
+func (s *Suite) Test_PatchChecker_canonicalPatchName(c *check.C) {
+	t := s.Init(c)
+
+	test := func(patched Path, expected RelPath) {
+		t.CheckEquals((*PatchChecker).canonicalPatchName(nil, patched), expected)
+	}
+
+	test("file.c", "patch-file.c")
+	test("./src/main.c", "patch-src_main.c")
+	test("lib/file_name.c", "patch-lib_file__name.c")
+	test("dir/file name", "patch-dir_file_name")
+}
+
+func (s *Suite) Test_PatchChecker_checkDocumentation(c *check.C) {
+	t := s.Init(c)
+
+	test := func(comment []string, diagnostics ...string) {
+		lines := t.NewLines("patch-file",
+			append(append([]string{CvsID, ""}, comment...),
+				"",
+				"--- file.orig",
+				"+++ file",
+				"@@ -1 +1 @@",
+				"-old",
+				"+new")...)
+
+		CheckLinesPatch(lines, nil)
+
+		t.CheckOutput(diagnostics)
+	}
+	comment := func(lines ...string) []string { return lines }
+
+	test(
+		comment(
+			"Fix the build on NetBSD.",
+			"https://github.com/org/repo/pull/123"),
+		nil...)
+
+	test(
+		comment(
+			"Fix the build on NetBSD."),
+		"WARN: patch-file: The patch documentation should say "+
+			"whether the patch has been sent upstream.")
+
+	test(
+		comment(
+			"https://github.com/org/repo/pull/123"),
+		"WARN: patch-file: The patch documentation should say "+
+			"why the patch is needed.")
+
+	test(
+		comment(
+			"Documentation"),
+		"WARN: patch-file: The patch documentation should say "+
+			"why the patch is needed.",
+		"WARN: patch-file: The patch documentation should say "+
+			"whether the patch has been sent upstream.")
+
+	t.SetUpCommandLine("-Wall,no-extra")
+
+	test(
+		comment(
+			"Documentation"),
+		nil...)
+}
+
+func (s *Suite) Test_PatchChecker_checkDocumentation__documented_patch(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileDocumentedPatch("category/package/patches/patch-aa")
+	t.CreateFileDummyPatch("category/package/patches/patch-bb")
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	G.Check(".")
+
+	t.CheckOutputLines(
+		"ERROR: distinfo: Patch \"patches/patch-aa\" is not recorded. "+
+			"Run \""+confMake+" makepatchsum\".",
+		"ERROR: distinfo: Patch \"patches/patch-bb\" is not recorded. "+
+			"Run \""+confMake+" makepatchsum\".",
+		"WARN: patches/patch-bb: The patch documentation should say "+
+			"why the patch is needed.",
+		"WARN: patches/patch-bb: The patch documentation should say "+
+			"whether the patch has been sent upstream.")
+}
+
+func (s *Suite) Test_PatchChecker_parseDocumentation(c *check.C) {
+	t := s.Init(c)
+
+	test := func(comment string, reason bool, upstream string) {
+		doc := (*PatchChecker).parseDocumentation(nil, comment)
+
+		t.CheckEquals(doc.reason, reason)
+		t.CheckEquals(doc.upstream, upstream)
+	}
+
+	test("Fix the build on NetBSD.",
+		true, "")
+	test("Fix the build on NetBSD.\nUpstream: not needed",
+		true, "not needed")
+	test("Fix the build on NetBSD.\nUpstream-Status: Submitted",
+		true, "Submitted")
+	test("Fix the build on NetBSD.\nUpstream:",
+		true, "")
+	test("See https://github.com/org/repo/issues/12.",
+		false, "https://github.com/org/repo/issues/12")
+	test("Use the pkgsrc paths, see <https://example.org/bug/3>.",
+		true, "https://example.org/bug/3")
+	test("Sent upstream.",
+		false, "Sent upstream")
+	test("Taken from upstream.",
+		false, "Taken from upstream")
+	test("Install the man pages into the right directory.\npkgsrc-specific.",
+		true, "pkgsrc-specific")
+	test("Pkgsrc-specific",
+		false, "Pkgsrc-specific")
+	test("Fix for CVE-2020-1234, from upstream.",
+		true, "from upstream")
+	test("Fixed upstream in version 2.0.",
+		false, "Fixed upstream")
+	test("Not needed upstream.",
+		false, "Not needed upstream")
+
+	// A mere mention of upstream is not a status.
+	test("Bug in upstream code.",
+		true, "")
+	test("Upstream",
+		false, "")
+	test("Documentation",
+		false, "")
+	test("Fix alloca.",
+		false, "")
+	test("Description: alloca\nForwarded: https://example.org/bug/3",
+		true, "https://example.org/bug/3")
+	test("Subject:\nBug: https://example.org/bug/3",
+		false, "https://example.org/bug/3")
+	test("Reason: portability\nUpstream-Status: not reported",
+		true, "not reported")
+}
+
+func (s *Suite) Test_PatchChecker_checkWrksrc(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/work/package-1.0/file.c",
+		"line 1",
+		"line 2",
+		"line 3",
+		"line 4",
+		"line 5",
+		"line 6",
+		"",
+		"line 8")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+
+	test := func(patchedFile string, hunks []string, diagnostics ...string) {
+		patchName := "patch-" + patchedFile
+		lines := t.NewLines(t.File("category/package/patches/"+NewRelPathString(patchName)),
+			append([]string{
+				CvsID,
+				"",
+				"Fix the build, not needed upstream.",
+				"",
+				"--- " + patchedFile + ".orig",
+				"+++ " + patchedFile},
+				hunks...)...)
+
+		CheckLinesPatch(lines, pkg)
+
+		t.CheckOutput(diagnostics)
+	}
+	hunks := func(lines ...string) []string { return lines }
+
+	// The hunk applies cleanly.
+	// The context line 7 has lost its leading space.
+	test("file.c",
+		hunks(
+			"@@ -5,4 +5,4 @@",
+			" line 5",
+			"-line 6",
+			"+changed 6",
+			"",
+			" line 8"),
+		nil...)
+
+	test("file.c",
+		hunks(
+			"@@ -3,3 +3,3 @@",
+			" line 4",
+			"-line 5",
+			"+changed 5",
+			" line 6"),
+		"WARN: ~/category/package/patches/patch-file.c:7: "+
+			"This hunk applies to ../work/package-1.0/file.c only with an offset of 1 line.")
+
+	test("file.c",
+		hunks(
+			"@@ -4,3 +4,3 @@",
+			" line 4",
+			"-line five",
+			"+changed 5",
+			" line 6"),
+		"ERROR: ~/category/package/patches/patch-file.c:7: "+
+			"This hunk does not apply cleanly to ../work/package-1.0/file.c.")
+
+	// Upstream has merged the patch.
+	test("file.c",
+		hunks(
+			"@@ -1,3 +1,3 @@",
+			" line 1",
+			"-line two",
+			"+line 2",
+			" line 3",
+			"@@ -6,2 +6,3 @@",
+			" line 6",
+			"+",
+			" line 8"),
+		"WARN: ~/category/package/patches/patch-file.c: "+
+			"All changes from this patch are already in ../work/package-1.0.")
+
+	// Upstream has merged some of the changes.
+	test("file.c",
+		hunks(
+			"@@ -1,3 +1,3 @@",
+			" line 1",
+			"-line two",
+			"+line 2",
+			" line 3",
+			"@@ -5,2 +5,2 @@",
+			"-line 5",
+			"+changed 5",
+			" line 6"),
+		"WARN: ~/category/package/patches/patch-file.c:7: "+
+			"This hunk is already applied to ../work/package-1.0/file.c.")
+
+	test("missing.c",
+		hunks(
+			"@@ -1,1 +1,1 @@",
+			"-old",
+			"+new"),
+		"ERROR: ~/category/package/patches/patch-missing.c:7: "+
+			"The patched file ../work/package-1.0/missing.c does not exist.")
+
+	// The patch creates a new file.
+	test("new.c",
+		hunks(
+			"@@ -0,0 +1,1 @@",
+			"+new"),
+		nil...)
+}
+
+// After "bmake patch", the hunks are checked against the original files.
+func (s *Suite) Test_PatchChecker_checkWrksrc__after_patch(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/work/package-1.0/file.c.orig",
+		"line 1")
+	t.CreateFileLines("category/package/work/package-1.0/file.c",
+		"changed 1")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+	lines := t.NewLines(t.File("category/package/patches/patch-file.c"),
+		CvsID,
+		"",
+		"Fix the build, not needed upstream.",
+		"",
+		"--- file.c.orig",
+		"+++ file.c",
+		"@@ -1 +1 @@",
+		"-line 1",
+		"+changed 1")
+
+	CheckLinesPatch(lines, pkg)
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_PatchChecker_findHunk(c *check.C) {
+	t := s.Init(c)
+
+	lines := []string{"1", "2", "3", "2", "3", "", "7"}
+	test := func(hunk []string, start int, offset int, found bool) {
+		actualOffset, actualFound := (*PatchChecker).findHunk(nil, lines, hunk, start)
+		t.CheckEquals(actualOffset, offset)
+		t.CheckEquals(actualFound, found)
+	}
+
+	test([]string{"2", "3"}, 2, 0, true)
+	test([]string{"2", "3"}, 3, -1, true)
+	test([]string{"2", "3"}, 5, -1, true)
+	test([]string{"2", "3"}, 6, -2, true)
+	test([]string{"3", "2"}, 1, 2, true)
+	test([]string{"", "7"}, 6, 0, true)
+	test([]string{"4"}, 4, 0, false)
+	test([]string{"7", "8"}, 7, 0, false)
+}
+
+func (s *Suite) Test_PatchChecker_isApplied(c *check.C) {
+	t := s.Init(c)
+
+	lines := []string{"1", "new", "3"}
+	test := func(old, new []string, applied bool) {
+		hunk := &patchHunk{nil, "file", 1, 1, old, new}
+		t.CheckEquals((*PatchChecker).isApplied(nil, lines, hunk), applied)
+	}
+
+	test([]string{"1", "old", "3"}, []string{"1", "new", "3"}, true)
+	test([]string{"1", "new", "3"}, []string{"1", "newer", "3"}, false)
+
+	// A hunk that doesn't change anything is not considered applied.
+	test([]string{"1", "new"}, []string{"1", "new"}, false)
+
+	// A hunk that only removes lines is not detected.
+	test([]string{"removed"}, nil, false)
+}
+
+func (s *Suite) Test_PatchChecker_refresh(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (distfile-1.0.tar.gz) = 12341234",
+		"SHA512 (distfile-1.0.tar.gz) = 12341234",
+		"Size (distfile-1.0.tar.gz) = 12341234",
+		"SHA1 (patch-file.c) = 1234")
+	t.CreateFileLines("category/package/patches/patch-file.c",
+		CvsID,
+		"",
+		"Documentation.",
+		"",
+		"--- file.c.orig\t2020-01-01 00:00:00.000000000 +0000",
+		"+++ file.c\t2020-01-01 00:00:00.000000000 +0000",
+		"@@ -1,3 +1,3 @@",
+		" line 1",
+		"-line 2",
+		"+changed 2",
+		" line 3")
+	t.CreateFileLines("category/package/work/package-1.0/file.c.orig",
+		"line 1",
+		"line 2",
+		"line 3")
+	t.CreateFileLines("category/package/work/package-1.0/file.c",
+		"line 1",
+		"changed 2",
+		"changed again",
+		"line 3")
+	t.SetUpCommandLine("-Wall", "--refresh-patches", "--autofix")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+
+	CheckLinesPatch(Load(t.File("category/package/patches/patch-file.c"), MustSucceed), pkg)
+
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/package/distinfo:6: "+
+			"Replacing \"SHA1 (patch-file.c) = 1234\" "+
+			"with \"SHA1 (patch-file.c) = 4786405c7df49430462e4c19631af89225150250\".",
+		"AUTOFIX: ~/category/package/patches/patch-file.c: "+
+			"Regenerating patch-file.c")
+	t.CheckFileLines("category/package/patches/patch-file.c",
+		CvsID,
+		"",
+		"Documentation.",
+		"",
+		"--- file.c.orig",
+		"+++ file.c",
+		"@@ -1,3 +1,4 @@",
+		" line 1",
+		"-line 2",
+		"+changed 2",
+		"+changed again",
+		" line 3")
+	t.CheckFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (distfile-1.0.tar.gz) = 12341234",
+		"SHA512 (distfile-1.0.tar.gz) = 12341234",
+		"Size (distfile-1.0.tar.gz) = 12341234",
+		"SHA1 (patch-file.c) = 4786405c7df49430462e4c19631af89225150250")
+}
+
+func (s *Suite) Test_PatchChecker_refresh__split(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (distfile-1.0.tar.gz) = 12341234",
+		"SHA512 (distfile-1.0.tar.gz) = 12341234",
+		"Size (distfile-1.0.tar.gz) = 12341234",
+		"SHA1 (patch-aa) = 1234")
+	t.CreateFileLines("category/package/patches/patch-aa",
+		CvsID,
+		"",
+		"diff -u a.c.orig a.c",
+		"Fix the build, not needed upstream.",
+		"",
+		"--- a.c.orig",
+		"+++ a.c",
+		"@@ -1 +1 @@",
+		"-old a",
+		"+new a",
+		"--- src/b.c.orig",
+		"+++ src/b.c",
+		"@@ -1 +1 @@",
+		"-old b",
+		"+new b")
+	t.CreateFileLines("category/package/work/package-1.0/a.c.orig",
+		"old a")
+	t.CreateFileLines("category/package/work/package-1.0/a.c",
+		"new a")
+	t.CreateFileLines("category/package/work/package-1.0/src/b.c.orig",
+		"old b")
+	t.CreateFileLines("category/package/work/package-1.0/src/b.c",
+		"new b")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+
+	test := func(args ...string) {
+		t.SetUpCommandLine(append([]string{"-Wall", "--refresh-patches"}, args...)...)
+		CheckLinesPatch(Load(t.File("category/package/patches/patch-aa"), MustSucceed), pkg)
+	}
+
+	test()
+
+	t.CheckOutputLines(
+		"WARN: ~/category/package/patches/patch-aa: Contains patches for 2 files, should be only one.",
+		"NOTE: ~/category/package/patches/patch-aa: "+
+			"This patch differs from the changes in ../work/package-1.0.")
+
+	test("--show-autofix")
+
+	t.CheckOutputLines(
+		"NOTE: ~/category/package/patches/patch-aa: "+
+			"This patch differs from the changes in ../work/package-1.0.",
+		"AUTOFIX: ~/category/package/patches/patch-aa: Regenerating patch-a.c",
+		"AUTOFIX: ~/category/package/patches/patch-aa: Regenerating patch-src_b.c",
+		"AUTOFIX: ~/category/package/patches/patch-aa: Removing patch-aa")
+
+	test("--autofix")
+
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/package/distinfo:6: "+
+			"Replacing \"SHA1 (patch-aa) = 1234\" "+
+			"with \"SHA1 (patch-a.c) = d779a7ba08350a741bb79d3487d12865607c830f\".",
+		"AUTOFIX: ~/category/package/distinfo:6: "+
+			"Inserting a line \"SHA1 (patch-src_b.c) = f2a3d45b2d6e25394ce914d79ca3da4aadc84af1\" "+
+			"below this line.",
+		"AUTOFIX: ~/category/package/patches/patch-aa: Regenerating patch-a.c",
+		"AUTOFIX: ~/category/package/patches/patch-aa: Regenerating patch-src_b.c",
+		"AUTOFIX: ~/category/package/patches/patch-aa: Removing patch-aa")
+	t.CheckFileLines("category/package/patches/patch-a.c",
+		CvsID,
+		"",
+		"Fix the build, not needed upstream.",
+		"",
+		"--- a.c.orig",
+		"+++ a.c",
+		"@@ -1 +1 @@",
+		"-old a",
+		"+new a")
+	t.CheckFileLines("category/package/patches/patch-src_b.c",
+		CvsID,
+		"",
+		"Fix the build, not needed upstream.",
+		"",
+		"--- src/b.c.orig",
+		"+++ src/b.c",
+		"@@ -1 +1 @@",
+		"-old b",
+		"+new b")
+	t.CheckEquals(t.File("category/package/patches/patch-aa").IsFile(), false)
+	t.CheckFileLines("category/package/distinfo",
+		CvsID,
+		"",
+		"BLAKE2s (distfile-1.0.tar.gz) = 12341234",
+		"SHA512 (distfile-1.0.tar.gz) = 12341234",
+		"Size (distfile-1.0.tar.gz) = 12341234",
+		"SHA1 (patch-a.c) = d779a7ba08350a741bb79d3487d12865607c830f",
+		"SHA1 (patch-src_b.c) = f2a3d45b2d6e25394ce914d79ca3da4aadc84af1")
+}
+
+func (s *Suite) Test_PatchChecker_comment(c *check.C) {
+	t := s.Init(c)
+
+	test := func(lines []string, comment string) {
+		ck := PatchChecker{lines: t.NewLines("patch-file", lines...)}
+
+		t.CheckEquals(ck.comment(), comment)
+	}
+	lines := func(lines ...string) []string { return lines }
+
+	test(
+		lines(
+			CvsID,
+			"",
+			"Index: file",
+			"===================================================================",
+			"",
+			"First line.",
+			"",
+			"Second paragraph.",
+			"",
+			"--- file.orig",
+			"+++ file"),
+		"First line.\n\nSecond paragraph.")
+
+	test(
+		lines(
+			CvsID,
+			"--- file.orig",
+			"+++ file"),
+		"")
+
+	// Without CVS ID, the comment starts in the first line.
+	test(
+		lines(
+			"Comment",
+			"",
+			"--- file.orig",
+			"+++ file"),
+		"Comment")
+}
+
 // Autogenerated "comments" from Git or other tools don't count as real
 // comments since they don't convey any intention of a human developer.
 func (s *Suite) Test_PatchChecker_isEmptyLine(c *check.C) {
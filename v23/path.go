@@ -324,6 +324,10 @@ func (p CurrPath) Rename(newName CurrPath) error {
 	return os.Rename(string(p), string(newName))
 }
 
+func (p CurrPath) Remove() error {
+	return os.Remove(string(p))
+}
+
 func (p CurrPath) Lstat() (os.FileInfo, error) { return os.Lstat(string(p)) }
 
 func (p CurrPath) Stat() (os.FileInfo, error) { return os.Stat(string(p)) }
@@ -843,6 +843,19 @@ func (s *Suite) Test_CurrPath_Rename(c *check.C) {
 		"line 1")
 }
 
+func (s *Suite) Test_CurrPath_Remove(c *check.C) {
+	t := s.Init(c)
+
+	f := t.CreateFileLines("filename",
+		"line 1")
+
+	err := f.Remove()
+
+	assertNil(err, "Remove")
+	t.CheckEquals(f.Exists(), false)
+	t.CheckNotNil(f.Remove())
+}
+
 func (s *Suite) Test_CurrPath_Lstat(c *check.C) {
 	t := s.Init(c)
 
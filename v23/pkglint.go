@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"sort"
 	"strings"
 )
 
@@ -21,7 +22,15 @@ const confVersion = "@VERSION@"
 
 // Pkglint is a container for all global variables of this Go package.
 type Pkglint struct {
-	CheckGlobal bool
+	CheckGlobal,
+	CheckPlatforms bool
+
+	Platforms    []Platform // For -Cplatforms; empty means DefaultPlatforms.
+	AllPlatforms bool       // For -Cplatforms; the full matrix from AllPlatforms.
+
+	// For --dump; one of "ast", "includes" or "scope".
+	// Instead of checking the packages, write their parsed Makefile as JSON.
+	Dump string
 
 	WarnError,
 	WarnExtra,
@@ -32,7 +41,8 @@ type Pkglint struct {
 	DumpMakefile,
 	Import,
 	Network,
-	Recursive bool
+	Recursive,
+	RefreshPatches bool
 
 	Project Project
 	Pkgsrc  *Pkgsrc // Global data, mostly extracted from mk/*.
@@ -115,6 +125,12 @@ func (p *Pkglint) Main(stdout io.Writer, stderr io.Writer, args []string) (exitC
 		}
 	}()
 
+	if len(args) > 1 {
+		if command := p.commands()[args[1]]; command != nil {
+			return command(args[1:])
+		}
+	}
+
 	if exitcode := p.ParseCommandLine(args); exitcode != -1 {
 		return exitcode
 	}
@@ -130,6 +146,9 @@ func (p *Pkglint) Main(stdout io.Writer, stderr io.Writer, args []string) (exitC
 	}
 
 	p.Pkgsrc.checkToplevelUnusedLicenses()
+	p.InterPackage.CheckDependencyCycles()
+	p.InterPackage.CheckConflicts()
+	p.InterPackage.ReportPatchesWithoutUpstreamStatus()
 
 	p.Logger.ShowSummary(args)
 	if p.WarnError && p.Logger.warnings != 0 {
@@ -232,9 +251,11 @@ func (p *Pkglint) ParseCommandLine(args []string) int {
 
 	var showHelp bool
 	var showVersion bool
+	var platforms []string
 
 	check := opts.AddFlagGroup('C', "check", "check,...", "enable or disable specific checks")
 	opts.AddFlagVar('d', "debug", &trace.Tracing, false, "log verbose call traces for debugging")
+	opts.AddStrVar('D', "dump", &p.Dump, "", "write the parsed Makefile as JSON: ast, includes or scope")
 	opts.AddFlagVar('e', "explain", &lopts.Explain, false, "explain the diagnostics or give further help")
 	opts.AddFlagVar('f', "show-autofix", &lopts.ShowAutofix, false, "show what pkglint can fix automatically")
 	opts.AddFlagVar('F', "autofix", &lopts.Autofix, false, "try to automatically fix some errors")
@@ -244,14 +265,17 @@ func (p *Pkglint) ParseCommandLine(args []string) int {
 	opts.AddFlagVar('i', "import", &p.Import, false, "prepare the import of a wip package")
 	opts.AddFlagVar('n', "network", &p.Network, false, "enable checks that need network access")
 	opts.AddStrList('o', "only", &lopts.Only, "only log diagnostics containing the given text")
+	opts.AddStrList('P', "platform", &platforms, "evaluate -Cplatforms for OPSYS-OS_VERSION-MACHINE_ARCH[:compiler] or all")
 	opts.AddFlagVar('p', "profiling", &p.Profiling, false, "profile the executing program")
 	opts.AddFlagVar('q', "quiet", &lopts.Quiet, false, "don't show a summary line when finishing")
 	opts.AddFlagVar('r', "recursive", &p.Recursive, false, "check subdirectories, too")
+	opts.AddFlagVar(0, "refresh-patches", &p.RefreshPatches, false, "regenerate the patches from the files in WRKSRC")
 	opts.AddFlagVar('s', "source", &lopts.ShowSource, false, "show the source lines together with diagnostics")
 	opts.AddFlagVar('V', "version", &showVersion, false, "show the version number of pkglint")
 	warn := opts.AddFlagGroup('W', "warning", "warning,...", "enable or disable groups of warnings")
 
 	check.AddFlagVar("global", &p.CheckGlobal, false, "inter-package checks")
+	check.AddFlagVar("platforms", &p.CheckPlatforms, false, "evaluate conditions for a matrix of platforms")
 
 	warn.AddFlagVarNoAll("error", &p.WarnError, false, "treat warnings as errors")
 	warn.AddFlagVar("extra", &p.WarnExtra, false, "enable some extra warnings")
@@ -277,6 +301,64 @@ func (p *Pkglint) ParseCommandLine(args []string) int {
 		return 0
 	}
 
+	switch p.Dump {
+	case "":
+	case "ast", "includes", "scope":
+		// The summary would make the output invalid JSON.
+		lopts.Quiet = true
+	default:
+		p.Logger.TechErrorf("", "Invalid dump %q, must be ast, includes or scope.", p.Dump)
+		return 1
+	}
+
+	for _, arg := range platforms {
+		if arg == "all" {
+			p.AllPlatforms = true
+			continue
+		}
+		platform, ok := NewPlatform(arg)
+		if !ok {
+			p.Logger.TechErrorf("", "Invalid platform %q, must be OPSYS-OS_VERSION-MACHINE_ARCH[:compiler].", arg)
+			return 1
+		}
+		p.Platforms = append(p.Platforms, platform)
+	}
+
+	for _, arg := range remainingArgs {
+		p.Todo.Push(NewCurrPathSlash(arg))
+	}
+	if p.Todo.IsEmpty() {
+		p.Todo.Push(".")
+	}
+
+	return -1
+}
+
+// commands returns the subcommands of pkglint, such as "pkglint graph".
+// Instead of checking the given directories, these commands load the
+// packages and do something else with them.
+//
+// The first argument of each command is the name of the command itself.
+func (p *Pkglint) commands() map[string]func(args []string) int {
+	return map[string]func(args []string) int{
+		"fmt":      mainFmt,
+		"graph":    mainGraph,
+		"revbump":  mainRevbump,
+		"show-var": mainShowVar,
+	}
+}
+
+// parseCommandArgs parses the command line of a subcommand of pkglint
+// and pushes the remaining arguments to the queue of directories.
+//
+// If the command is finished already, it returns the exit code,
+// otherwise -1.
+func (p *Pkglint) parseCommandArgs(opts *getopt.Options, args []string, usage string) int {
+	remainingArgs, exitCode := p.parseCommandOptions(opts, args, usage)
+	if exitCode != -1 {
+		return exitCode
+	}
+
 	for _, arg := range remainingArgs {
 		p.Todo.Push(NewCurrPathSlash(arg))
 	}
@@ -287,6 +369,80 @@ func (p *Pkglint) ParseCommandLine(args []string) int {
 	return -1
 }
 
+// parseCommandOptions parses the options of a subcommand of pkglint,
+// for those subcommands whose remaining arguments are not directories.
+//
+// If the command is finished already, it returns the exit code,
+// otherwise -1.
+func (p *Pkglint) parseCommandOptions(opts *getopt.Options, args []string, usage string) ([]string, int) {
+	opts.AddFlagVar('d', "debug", &trace.Tracing, false, "log verbose call traces for debugging")
+	return p.parseOptions(opts, args, usage)
+}
+
+// parseOptions parses the options of a subcommand of pkglint,
+// adding only the --help option.
+// This is for subcommands that need the -d option for themselves.
+//
+// If the command is finished already, it returns the exit code,
+// otherwise -1.
+func (p *Pkglint) parseOptions(opts *getopt.Options, args []string, usage string) ([]string, int) {
+	var showHelp bool
+	opts.AddFlagVar('h', "help", &showHelp, false, "show a detailed usage message")
+
+	remainingArgs, err := opts.Parse(args)
+	if err != nil {
+		errOut := p.Logger.err.out
+		_, _ = fmt.Fprintln(errOut, err)
+		_, _ = fmt.Fprintln(errOut, "")
+		opts.Help(errOut, usage)
+		return nil, 1
+	}
+
+	if showHelp {
+		opts.Help(p.Logger.out.out, usage)
+		return nil, 0
+	}
+
+	return remainingArgs, -1
+}
+
+// packageDirs returns the package directories in or below the given
+// directory, which is either a package directory, a category directory
+// or the pkgsrc root directory.
+// For the latter two, the subdirectories are taken from the SUBDIR
+// variable in the Makefile, just like in the recursive pkgsrc targets.
+func (p *Pkglint) packageDirs(dir CurrPath) []CurrPath {
+	switch p.findPkgsrcTopdir(dir) {
+	case "../..":
+		return []CurrPath{dir}
+	case "..", ".":
+		break
+	default:
+		NewLineWhole(dir).Errorf("Cannot check directories outside a pkgsrc tree.")
+		return nil
+	}
+
+	mklines := LoadMk(dir.JoinNoClean("Makefile"), nil, NotEmpty|LogErrors)
+	if mklines == nil {
+		return nil
+	}
+
+	var dirs []CurrPath
+	mklines.ForEach(func(mkline *MkLine) {
+		if !mkline.IsVarassign() || mkline.Varname() != "SUBDIR" {
+			return
+		}
+		subdir := NewRelPathString(mkline.Value())
+		if containsExpr(subdir.String()) || NewPath(mkline.Value()).IsAbs() {
+			return
+		}
+		if sub := dir.JoinNoClean(subdir); sub.JoinNoClean("Makefile").IsFile() {
+			dirs = append(dirs, p.packageDirs(sub.CleanPath())...)
+		}
+	})
+	return dirs
+}
+
 // Check checks a directory entry, which can be a regular file,
 // a directory or a symlink (only allowed for the working directory).
 //
@@ -654,6 +810,7 @@ func (p *Pkglint) checkReg(filename CurrPath, basename RelPath, depth int, pkg *
 
 	case basename == "DEINSTALL" || basename == "INSTALL":
 		CheckFileOther(filename)
+		CheckFileShellScript(filename, pkg)
 
 	case basename.HasPrefixText("MESSAGE"):
 		if lines := Load(filename, NotEmpty|LogErrors); lines != nil {
@@ -699,7 +856,9 @@ func (p *Pkglint) checkReg(filename CurrPath, basename RelPath, depth int, pkg *
 		_ = (&Changes{}).parseFile(filename, true)
 
 	case filename.Dir().HasBase("files"):
-		// Skip files directly in the files/ directory, but not those further down.
+		// Of the files directly in the files/ directory, only the shell
+		// scripts are checked, but not the files further down.
+		CheckFileShellScript(filename, pkg)
 
 	case basename == "spec":
 		if !p.Pkgsrc.Rel(filename).HasPrefixPath("regress") {
@@ -881,6 +1040,35 @@ type InterPackage struct {
 	usedLicenses map[string]struct{} // Maps "license name" => true (inter-package check).
 	bl3Names     map[string]Location // Maps buildlink3 identifiers to their first occurrence.
 	descr        map[[sha1.Size]byte][]CurrPath
+	deps         *DependencyGraph // The dependencies between the packages, for -Cglobal.
+	conflicts    []*conflictingPackage
+
+	// The patches whose documentation doesn't mention the upstream status,
+	// for -Cglobal -Wextra.
+	patchesWithoutUpstream []patchWithoutUpstream
+}
+
+// patchWithoutUpstream is a patch whose documentation doesn't say
+// whether the patch has been sent upstream.
+type patchWithoutUpstream struct {
+	Maintainer string
+	Patch      CurrPath
+}
+
+// conflictingPackage is the summary of a package that is needed to check
+// whether the CONFLICTS declarations between packages are symmetric.
+type conflictingPackage struct {
+	Pkgpath    PkgsrcPath
+	Pkgbase    string
+	Pkgversion string
+	Makefile   CurrPath
+	Conflicts  []conflictsPattern
+}
+
+// conflictsPattern is a single package pattern from a CONFLICTS line.
+type conflictsPattern struct {
+	Pattern *PackagePattern
+	MkLine  *MkLine
 }
 
 func (ip *InterPackage) Enable() {
@@ -888,7 +1076,10 @@ func (ip *InterPackage) Enable() {
 		make(map[string]*Hash),
 		make(map[string]struct{}),
 		make(map[string]Location),
-		make(map[[sha1.Size]byte][]CurrPath)}
+		make(map[[sha1.Size]byte][]CurrPath),
+		&DependencyGraph{},
+		nil,
+		nil}
 
 	// This is the only license that is added by an infrastructure file,
 	// mk/djbware.mk. The correct way to handle this situation would be
@@ -936,6 +1127,221 @@ func (ip *InterPackage) Bl3(name string, loc *Location) *Location {
 	return nil
 }
 
+// AddDependencies remembers the dependencies of the package,
+// to check them for cycles after all packages have been checked.
+func (ip *InterPackage) AddDependencies(pkg *Package, allLines *MkLines) {
+	if ip.deps == nil || !G.CheckGlobal {
+		return
+	}
+
+	ip.deps.Packages = append(ip.deps.Packages, pkg.Pkgpath)
+	ip.deps.collect(pkg, allLines)
+}
+
+// CheckDependencyCycles reports the packages that depend on each other,
+// directly or indirectly.
+// Such packages cannot be built at all.
+func (ip *InterPackage) CheckDependencyCycles() {
+	if ip.deps == nil {
+		return
+	}
+
+	for _, cycle := range ip.deps.Cycles() {
+		mkline := cycle[0].MkLine
+
+		path := cycle[0].From.String()
+		for _, e := range cycle {
+			path += sprintf(" -> %s (%s in %s)", e.To.String(), e.Kind, mkline.RelMkLine(e.MkLine))
+		}
+
+		mkline.Errorf("Dependency cycle: %s.", path)
+		mkline.Explain(
+			"A package cannot be built if it depends on itself,",
+			"be it directly or via other packages.",
+			"",
+			"To break the cycle, remove one of the dependencies,",
+			"or make them depend on conditions that exclude each other,",
+			"such as different values of OPSYS.")
+	}
+}
+
+// AddConflicts remembers the CONFLICTS of the package,
+// to check after all packages have been checked
+// whether the conflicting packages declare the conflict as well.
+func (ip *InterPackage) AddConflicts(pkg *Package, allLines *MkLines) {
+	if !ip.Enabled() || !G.CheckGlobal || pkg.EffectivePkgnameLine == nil {
+		return
+	}
+
+	cp := conflictingPackage{
+		pkg.Pkgpath,
+		pkg.EffectivePkgbase,
+		pkg.EffectivePkgversion,
+		pkg.File("Makefile"),
+		nil}
+
+	for _, mkline := range allLines.mklines {
+		if !mkline.IsVarassign() || mkline.Varname() != "CONFLICTS" ||
+			G.Pkgsrc.IsInfra(mkline.Filename()) {
+			continue
+		}
+
+		value := resolveExprs(mkline.Value(), nil, pkg)
+		for _, field := range mkline.ValueFields(value) {
+			for _, alt := range expandCurlyBraces(field) {
+				parser := NewMkParser(nil, alt)
+				pattern := ParsePackagePattern(parser)
+				if pattern != nil && parser.EOF() && !containsExpr(alt) {
+					cp.Conflicts = append(cp.Conflicts, conflictsPattern{pattern, mkline})
+				}
+			}
+		}
+	}
+
+	ip.conflicts = append(ip.conflicts, &cp)
+}
+
+// CheckConflicts checks that whenever package A conflicts with package B,
+// package B also conflicts with package A.
+//
+// In --autofix mode, the missing CONFLICTS line is added to the
+// package Makefile of B.
+func (ip *InterPackage) CheckConflicts() {
+	byPkgbase := make(map[string][]*conflictingPackage)
+	for _, cp := range ip.conflicts {
+		byPkgbase[cp.Pkgbase] = append(byPkgbase[cp.Pkgbase], cp)
+	}
+
+	// candidates returns the packages that may match the pattern.
+	candidates := func(pattern *PackagePattern) []*conflictingPackage {
+		if strings.ContainsAny(pattern.Pkgbase, "*?[\\") {
+			return ip.conflicts
+		}
+		return byPkgbase[pattern.Pkgbase]
+	}
+
+	conflictsWith := func(cp, other *conflictingPackage) bool {
+		for _, conflict := range cp.Conflicts {
+			if conflict.Pattern.Matches(other.Pkgbase, other.Pkgversion) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var reported Once
+	for _, cp := range ip.conflicts {
+		for _, conflict := range cp.Conflicts {
+			for _, other := range candidates(conflict.Pattern) {
+				if other.Pkgpath == cp.Pkgpath ||
+					!conflict.Pattern.Matches(other.Pkgbase, other.Pkgversion) ||
+					conflictsWith(other, cp) ||
+					!reported.FirstTimeSlice(cp.Pkgpath.String(), other.Pkgpath.String()) {
+					continue
+				}
+
+				ip.warnAsymmetricConflict(conflict.MkLine, cp, other)
+			}
+		}
+	}
+}
+
+func (ip *InterPackage) warnAsymmetricConflict(mkline *MkLine, cp, other *conflictingPackage) {
+	otherMakefile := mkline.Rel(other.Makefile)
+	mkline.Warnf("The conflicting package %s should also list %q in its CONFLICTS in %s.",
+		other.Pkgpath.String(), cp.Pkgbase+"-[0-9]*", otherMakefile.String())
+	mkline.Explain(
+		"If package A conflicts with package B,",
+		"then B also conflicts with A.",
+		"To make this visible to the users of both packages,",
+		"both packages should declare the conflict.")
+
+	if !G.Logger.IsAutofix() {
+		return
+	}
+
+	mklines := LoadMk(other.Makefile, nil, MustSucceed)
+	var anchor, pkgMk *MkLine
+	for _, mkline := range mklines.mklines {
+		if mkline.IsVarassign() && mkline.Varname() == "CONFLICTS" {
+			anchor = mkline
+		}
+		if mkline.IsInclude() && mkline.IncludedFile() == "../../mk/bsd.pkg.mk" {
+			pkgMk = mkline
+		}
+	}
+
+	conflict := "CONFLICTS+=\t" + cp.Pkgbase + "-[0-9]*"
+	switch {
+	case anchor != nil:
+		fix := anchor.Autofix()
+		fix.Silent()
+		fix.InsertBelow(conflict)
+		fix.Apply()
+	case pkgMk != nil:
+		fix := pkgMk.Autofix()
+		fix.Silent()
+		fix.InsertAbove(conflict)
+		fix.InsertAbove("")
+		fix.Apply()
+	default:
+		// Without a sensible place for the new line, leave it to the
+		// maintainer of the other package.
+		return
+	}
+
+	mklines.SaveAutofixChanges()
+}
+
+// AddPatchWithoutUpstreamStatus remembers the patch for the report
+// from ReportPatchesWithoutUpstreamStatus.
+func (ip *InterPackage) AddPatchWithoutUpstreamStatus(pkg *Package, patch CurrPath) {
+	if !ip.Enabled() || !G.CheckGlobal {
+		return
+	}
+
+	maintainer := pkg.vars.LastValue("MAINTAINER")
+	if maintainer == "" {
+		maintainer = "pkgsrc-users@NetBSD.org"
+	}
+	ip.patchesWithoutUpstream = append(ip.patchesWithoutUpstream,
+		patchWithoutUpstream{maintainer, patch})
+}
+
+// ReportPatchesWithoutUpstreamStatus lists the patches whose
+// documentation doesn't say whether they have been sent upstream,
+// grouped by the maintainer of the package.
+func (ip *InterPackage) ReportPatchesWithoutUpstreamStatus() {
+	if len(ip.patchesWithoutUpstream) == 0 {
+		return
+	}
+
+	byMaintainer := make(map[string][]PkgsrcPath)
+	for _, p := range ip.patchesWithoutUpstream {
+		byMaintainer[p.Maintainer] = append(byMaintainer[p.Maintainer], G.Pkgsrc.Rel(p.Patch))
+	}
+	var maintainers []string
+	for maintainer := range byMaintainer {
+		maintainers = append(maintainers, maintainer)
+	}
+	sort.Strings(maintainers)
+
+	out := G.Logger.out
+	out.Separate()
+	out.WriteLine("Patches without upstream status, by maintainer:")
+	for _, maintainer := range maintainers {
+		patches := byMaintainer[maintainer]
+		sort.Slice(patches, func(i, j int) bool { return patches[i] < patches[j] })
+
+		out.Separate()
+		out.WriteLine(sprintf("%s (%d)", maintainer, len(patches)))
+		for _, patch := range patches {
+			out.WriteLine("\t" + patch.String())
+		}
+	}
+	out.Separate()
+}
+
 func (ip *InterPackage) CheckDuplicateDescr(filename CurrPath) {
 	descr := ip.descr
 	if descr == nil {
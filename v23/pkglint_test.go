@@ -1,6 +1,7 @@
 package pkglint
 
 import (
+	"github.com/rillig/pkglint/v23/getopt"
 	"gopkg.in/check.v1"
 	"os"
 	"path"
@@ -50,6 +51,7 @@ func (s *Suite) Test_Pkglint_Main__help(c *check.C) {
 		"",
 		"  -C, --check=check,...       enable or disable specific checks",
 		"  -d, --debug                 log verbose call traces for debugging",
+		"  -D, --dump                  write the parsed Makefile as JSON: ast, includes or scope",
 		"  -e, --explain               explain the diagnostics or give further help",
 		"  -f, --show-autofix          show what pkglint can fix automatically",
 		"  -F, --autofix               try to automatically fix some errors",
@@ -59,17 +61,20 @@ func (s *Suite) Test_Pkglint_Main__help(c *check.C) {
 		"  -i, --import                prepare the import of a wip package",
 		"  -n, --network               enable checks that need network access",
 		"  -o, --only                  only log diagnostics containing the given text",
+		"  -P, --platform              evaluate -Cplatforms for OPSYS-OS_VERSION-MACHINE_ARCH[:compiler] or all",
 		"  -p, --profiling             profile the executing program",
 		"  -q, --quiet                 don't show a summary line when finishing",
 		"  -r, --recursive             check subdirectories, too",
+		"  --refresh-patches           regenerate the patches from the files in WRKSRC",
 		"  -s, --source                show the source lines together with diagnostics",
 		"  -V, --version               show the version number of pkglint",
 		"  -W, --warning=warning,...   enable or disable groups of warnings",
 		"",
 		"  Flags for -C, --check:",
-		"    all      all of the following",
-		"    none     none of the following",
-		"    global   inter-package checks (disabled)",
+		"    all         all of the following",
+		"    none        none of the following",
+		"    global      inter-package checks (disabled)",
+		"    platforms   evaluate conditions for a matrix of platforms (disabled)",
 		"",
 		"  Flags for -W, --warning:",
 		"    all       all of the following",
@@ -245,7 +250,9 @@ func (s *Suite) Test_Pkglint_Main__complete_package(c *check.C) {
 			"(distinfo has asdfasdf, patch file has bcfb79696cb6bf4d2222a6d78a530e11bf1c0cea).",
 		"WARN: ~/sysutils/checkperms/patches/patch-checkperms.c:12: Premature end of patch hunk "+
 			"(expected 1 line to be deleted and 0 lines to be added).",
-		"3 errors, 2 warnings and 1 note found.",
+		"WARN: ~/sysutils/checkperms/patches/patch-checkperms.c: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
+		"3 errors, 3 warnings and 1 note found.",
 		t.Shquote("(Run \"pkglint -e -Wall -Call %s\" to show explanations.)", "sysutils/checkperms"),
 		t.Shquote("(Run \"pkglint -fs -Wall -Call %s\" to show what can be fixed automatically.)", "sysutils/checkperms"),
 		t.Shquote("(Run \"pkglint -F -Wall -Call %s\" to automatically fix some issues.)", "sysutils/checkperms"))
@@ -429,6 +436,189 @@ func (s *Suite) Test_Pkglint_ParseCommandLine__only(c *check.C) {
 		confVersion)
 }
 
+func (s *Suite) Test_Pkglint_ParseCommandLine__platform(c *check.C) {
+	t := s.Init(c)
+
+	exitcode := G.ParseCommandLine([]string{"pkglint", "-Cplatforms",
+		"--platform=NetBSD-10.0-x86_64", "-P", "Linux-*-*:clang"})
+
+	t.CheckEquals(exitcode, -1)
+	t.CheckEquals(G.CheckPlatforms, true)
+	t.CheckDeepEquals(G.Platforms, []Platform{
+		{"NetBSD", "10.0", "x86_64", ""},
+		{"Linux", "", "", "clang"}})
+	t.CheckEquals(G.AllPlatforms, false)
+}
+
+func (s *Suite) Test_Pkglint_ParseCommandLine__all_platforms(c *check.C) {
+	t := s.Init(c)
+
+	exitcode := G.ParseCommandLine([]string{"pkglint", "-Cplatforms", "-P", "all"})
+
+	t.CheckEquals(exitcode, -1)
+	t.CheckEquals(G.AllPlatforms, true)
+	t.CheckLen(G.Platforms, 0)
+}
+
+func (s *Suite) Test_Pkglint_ParseCommandLine__invalid_platform(c *check.C) {
+	t := s.Init(c)
+
+	exitcode := G.ParseCommandLine([]string{"pkglint", "--platform=NetBSD"})
+
+	t.CheckEquals(exitcode, 1)
+	t.CheckOutputLines(
+		"ERROR: Invalid platform \"NetBSD\", " +
+			"must be OPSYS-OS_VERSION-MACHINE_ARCH[:compiler].")
+}
+
+func (s *Suite) Test_Pkglint_ParseCommandLine__invalid_dump(c *check.C) {
+	t := s.Init(c)
+
+	exitcode := G.ParseCommandLine([]string{"pkglint", "--dump=json"})
+
+	t.CheckEquals(exitcode, 1)
+	t.CheckOutputLines(
+		"ERROR: Invalid dump \"json\", must be ast, includes or scope.")
+}
+
+func (s *Suite) Test_Pkglint_commands(c *check.C) {
+	t := s.Init(c)
+
+	commands := G.commands()
+
+	t.CheckNotNil(commands["graph"])
+	t.CheckNotNil(commands["revbump"])
+	t.CheckNotNil(commands["show-var"])
+	t.CheckNil(commands["category/package"])
+}
+
+func (s *Suite) Test_Pkglint_parseCommandArgs(c *check.C) {
+	t := s.Init(c)
+
+	opts := getopt.NewOptions()
+	exitCode := G.parseCommandArgs(opts, []string{"cmd", "dir1", "dir2"}, "cmd dir...")
+
+	t.CheckEquals(exitCode, -1)
+	t.CheckEquals(G.Todo.Pop(), NewCurrPath("dir1"))
+	t.CheckEquals(G.Todo.Pop(), NewCurrPath("dir2"))
+	t.CheckEquals(G.Todo.IsEmpty(), true)
+}
+
+func (s *Suite) Test_Pkglint_parseCommandArgs__default_dir(c *check.C) {
+	t := s.Init(c)
+
+	opts := getopt.NewOptions()
+	exitCode := G.parseCommandArgs(opts, []string{"cmd"}, "cmd dir...")
+
+	t.CheckEquals(exitCode, -1)
+	t.CheckEquals(G.Todo.Pop(), NewCurrPath("."))
+}
+
+func (s *Suite) Test_Pkglint_parseCommandArgs__unknown_option(c *check.C) {
+	t := s.Init(c)
+
+	opts := getopt.NewOptions()
+	exitCode := G.parseCommandArgs(opts, []string{"cmd", "--unknown"}, "cmd dir...")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"cmd: unknown option: --unknown",
+		"",
+		"usage: cmd dir...",
+		"",
+		"  -d, --debug   log verbose call traces for debugging",
+		"  -h, --help    show a detailed usage message")
+}
+
+func (s *Suite) Test_Pkglint_parseCommandOptions(c *check.C) {
+	t := s.Init(c)
+
+	opts := getopt.NewOptions()
+	args, exitCode := G.parseCommandOptions(opts, []string{"cmd", "VAR1", "VAR2"}, "cmd var...")
+
+	t.CheckEquals(exitCode, -1)
+	t.CheckDeepEquals(args, []string{"VAR1", "VAR2"})
+	t.CheckEquals(G.Todo.IsEmpty(), true)
+}
+
+func (s *Suite) Test_Pkglint_parseCommandOptions__help(c *check.C) {
+	t := s.Init(c)
+
+	opts := getopt.NewOptions()
+	args, exitCode := G.parseCommandOptions(opts, []string{"cmd", "--help"}, "cmd var...")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckLen(args, 0)
+	t.CheckOutputLines(
+		"usage: cmd var...",
+		"",
+		"  -d, --debug   log verbose call traces for debugging",
+		"  -h, --help    show a detailed usage message")
+}
+
+func (s *Suite) Test_Pkglint_parseOptions(c *check.C) {
+	t := s.Init(c)
+
+	opts := getopt.NewOptions()
+	var diff bool
+	opts.AddFlagVar('d', "diff", &diff, false, "display diffs")
+	args, exitCode := G.parseOptions(opts, []string{"cmd", "-d", "file"}, "cmd file...")
+
+	t.CheckEquals(exitCode, -1)
+	t.CheckDeepEquals(args, []string{"file"})
+	t.CheckEquals(diff, true)
+}
+
+func (s *Suite) Test_Pkglint_packageDirs(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package1")
+	t.SetUpPackage("category/package2")
+	t.SetUpPackage("other/package")
+	t.CreateFileLines("Makefile",
+		MkCvsID,
+		"",
+		"SUBDIR+=	category",
+		"SUBDIR+=	other",
+		"SUBDIR+=	${UNKNOWN}",
+		"SUBDIR+=	nonexistent",
+		"#SUBDIR+=	commented")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	test := func(dir CurrPath, expected ...CurrPath) {
+		t.CheckDeepEquals(G.packageDirs(dir), expected)
+	}
+
+	test("category/package1",
+		"category/package1")
+	test("category",
+		"category/package1",
+		"category/package2")
+	test(".",
+		"category/package1",
+		"category/package2",
+		"other/package")
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_Pkglint_packageDirs__errors(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.CreateFileLines("category/Makefile")
+	t.CreateFileLines("outside/pkgsrc/tree/file")
+	t.FinishSetUp()
+
+	t.CheckLen(G.packageDirs(t.File("category")), 0)
+	t.CheckLen(G.packageDirs(t.File("outside/pkgsrc/tree")), 0)
+
+	t.CheckOutputLines(
+		"ERROR: ~/category/Makefile: Must not be empty.",
+		"ERROR: ~/outside/pkgsrc/tree: Cannot check directories outside a pkgsrc tree.")
+}
+
 func (s *Suite) Test_Pkglint_Check__outside(c *check.C) {
 	t := s.Init(c)
 
@@ -657,6 +847,10 @@ func (s *Suite) Test_Pkglint_checkdirPackage__patch_without_distinfo(c *check.C)
 
 	t.CheckOutputLines(
 		"WARN: ~/category/package/distinfo: A package that downloads files should have a distinfo file.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: ~/category/package/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.",
 		"WARN: ~/category/package/distinfo: A package with patches should have a distinfo file.")
 }
 
@@ -1205,7 +1399,11 @@ func (s *Suite) Test_Pkglint_checkReg__patch_for_makefile_fragment(c *check.C) {
 
 	G.checkReg(t.File("patches/patch-compiler.mk"), "patch-compiler.mk", 4, nil)
 
-	t.CheckOutputEmpty()
+	t.CheckOutputLines(
+		"WARN: patches/patch-compiler.mk: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-compiler.mk: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_Pkglint_checkReg__file_in_files(c *check.C) {
@@ -1342,7 +1540,11 @@ func (s *Suite) Test_Pkglint_checkRegCvsSubst__full_package(c *check.C) {
 
 	t.CheckOutputLines(
 		"ERROR: Makefile: The CVS keyword substitution must be the default one.",
-		"ERROR: patches/patch-any: The CVS keyword substitution must be the default one.")
+		"ERROR: patches/patch-any: The CVS keyword substitution must be the default one.",
+		"WARN: patches/patch-any: "+
+			"The patch documentation should say why the patch is needed.",
+		"WARN: patches/patch-any: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
 }
 
 func (s *Suite) Test_Pkglint_checkExecutable(c *check.C) {
@@ -1592,3 +1794,373 @@ func (s *Suite) Test_InterPackage_Bl3__same_identifier(c *check.C) {
 			"BUILDLINK_PKGSRCDIR.package1 must be set to the package's own path "+
 			"(../../category/package2), not ../../category/package1.")
 }
+
+func (s *Suite) Test_InterPackage_AddDependencies(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib")
+	t.SetUpPackage("devel/lib")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+
+	// Without -Cglobal, the dependencies are not collected.
+	t.CheckLen(G.InterPackage.deps.Edges, 0)
+
+	t.SetUpCommandLine("-Cglobal")
+	G.InterPackage.Enable()
+	G.Check("category/package")
+
+	t.CheckDeepEquals(G.InterPackage.deps.Packages, []PkgsrcPath{"category/package"})
+	t.CheckLen(G.InterPackage.deps.Edges, 1)
+}
+
+func (s *Suite) Test_InterPackage_CheckDependencyCycles(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal")
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib")
+	t.SetUpPackage("devel/lib",
+		"TOOL_DEPENDS+=\ttool>=1.0:../../devel/tool")
+	t.SetUpPackage("devel/tool",
+		".include \"../../category/package/buildlink3.mk\"")
+	t.CreateFileBuildlink3("category/package/buildlink3.mk")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+	G.Check("devel/lib")
+	G.Check("devel/tool")
+	G.InterPackage.CheckDependencyCycles()
+
+	t.CheckOutputLines(
+		"WARN: devel/lib/DESCR: DESCR file is the same as \"../../category/package/DESCR\".",
+		"WARN: devel/tool/DESCR: DESCR file is the same as \"../../devel/lib/DESCR\".",
+		"ERROR: category/package/Makefile:20: Dependency cycle: "+
+			"category/package "+
+			"-> devel/lib (DEPENDS in line 20) "+
+			"-> devel/tool (TOOL_DEPENDS in ../../devel/lib/Makefile:20) "+
+			"-> category/package (buildlink3 in ../../devel/tool/Makefile:20).")
+}
+
+func (s *Suite) Test_InterPackage_CheckDependencyCycles__exclusive(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal")
+	t.SetUpPackage("category/package",
+		".if ${OPSYS} == NetBSD",
+		"DEPENDS+=\tlib>=1.0:../../devel/lib",
+		".endif")
+	t.SetUpPackage("devel/lib",
+		".if ${OPSYS} == Linux",
+		"DEPENDS+=\tpackage>=1.0:../../category/package",
+		".endif")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+	G.Check("devel/lib")
+	G.InterPackage.CheckDependencyCycles()
+
+	// The dependencies cannot be active at the same time,
+	// therefore they don't form a cycle.
+	t.CheckOutputLines(
+		"WARN: devel/lib/DESCR: DESCR file is the same as \"../../category/package/DESCR\".")
+}
+
+func (s *Suite) Test_InterPackage_CheckDependencyCycles__disabled(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal")
+	t.SetUpPackage("category/package",
+		"DEPENDS+=\tpackage>=1.0:../../category/package")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.Check("category/package")
+	G.InterPackage.CheckDependencyCycles()
+
+	// Without the inter-package checks, there is no dependency graph.
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_InterPackage_AddConflicts(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal")
+	t.SetUpPackage("category/package",
+		"CONFLICTS+=\tother-[0-9]* {old,older}>=1.0",
+		"CONFLICTS+=\t${UNKNOWN}-[0-9]*")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+
+	t.CheckLen(G.InterPackage.conflicts, 1)
+	cp := G.InterPackage.conflicts[0]
+	t.CheckEquals(cp.Pkgpath, PkgsrcPath("category/package"))
+	t.CheckEquals(cp.Pkgbase, "package")
+	t.CheckEquals(cp.Pkgversion, "1.0")
+	var patterns []string
+	for _, conflict := range cp.Conflicts {
+		patterns = append(patterns, conflict.Pattern.Pkgbase)
+	}
+	t.CheckDeepEquals(patterns, []string{"other", "old", "older"})
+}
+
+func (s *Suite) Test_InterPackage_AddConflicts__disabled(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"CONFLICTS+=\tother-[0-9]*")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+
+	// Without -Cglobal, the conflicts are not collected.
+	t.CheckLen(G.InterPackage.conflicts, 0)
+}
+
+func (s *Suite) Test_InterPackage_CheckConflicts(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal")
+	t.SetUpPackage("category/package",
+		"CONFLICTS+=\tother-[0-9]*",
+		"CONFLICTS+=\tmutual-[0-9]*",
+		"CONFLICTS+=\tunchecked-[0-9]*")
+	t.SetUpPackage("category/other",
+		"DISTNAME=\tother-2.0")
+	t.SetUpPackage("category/mutual",
+		"DISTNAME=\tmutual-1.0",
+		"CONFLICTS+=\tpackage>=1.0")
+	t.CreateFileLines("category/other/DESCR", "other")
+	t.CreateFileLines("category/mutual/DESCR", "mutual")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+	G.Check("category/other")
+	G.Check("category/mutual")
+	G.InterPackage.CheckConflicts()
+
+	t.CheckOutputLines(
+		"WARN: category/package/Makefile:20: The conflicting package category/other " +
+			"should also list \"package-[0-9]*\" in its CONFLICTS in ../../category/other/Makefile.")
+}
+
+func (s *Suite) Test_InterPackage_warnAsymmetricConflict(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal", "--autofix")
+	t.SetUpPackage("category/package",
+		"CONFLICTS+=\tother-[0-9]* third-[0-9]*")
+	t.CreateFileLines("category/other/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tother-2.0",
+		"CATEGORIES=\tcategory",
+		"",
+		"CONFLICTS+=\tunrelated-[0-9]*",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+	t.CreateFileLines("category/third/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tthird-2.0",
+		"CATEGORIES=\tcategory",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+	G.Check("category/other")
+	G.Check("category/third")
+	t.CheckOutputEmpty()
+	G.InterPackage.CheckConflicts()
+
+	t.CheckOutputLines(
+		"AUTOFIX: category/other/Makefile:6: "+
+			"Inserting a line \"CONFLICTS+=\\tpackage-[0-9]*\" below this line.",
+		"AUTOFIX: category/third/Makefile:6: "+
+			"Inserting a line \"CONFLICTS+=\\tpackage-[0-9]*\" above this line.",
+		"AUTOFIX: category/third/Makefile:6: "+
+			"Inserting a line \"\" above this line.")
+	t.CheckFileLines("category/other/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tother-2.0",
+		"CATEGORIES=\tcategory",
+		"",
+		"CONFLICTS+=\tunrelated-[0-9]*",
+		"CONFLICTS+=\tpackage-[0-9]*",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+	t.CheckFileLines("category/third/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tthird-2.0",
+		"CATEGORIES=\tcategory",
+		"",
+		"CONFLICTS+=\tpackage-[0-9]*",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+}
+
+// If the other package has no CONFLICTS line, the CONFLICTS line is
+// inserted above the include of bsd.pkg.mk, even if that is not the
+// last line. Without that include, there is no sensible place for the
+// new line, and the Makefile is left unchanged.
+func (s *Suite) Test_InterPackage_warnAsymmetricConflict__no_anchor(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Cglobal", "--autofix")
+	t.SetUpPackage("category/package",
+		"CONFLICTS+=\tother-[0-9]* third-[0-9]*")
+	t.CreateFileLines("category/other/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tother-2.0",
+		"CATEGORIES=\tcategory",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"",
+		"# end of file")
+	t.CreateFileLines("category/third/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tthird-2.0",
+		"CATEGORIES=\tcategory",
+		".include \"../../mk/bsd.prefs.mk\"")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+	G.Check("category/other")
+	G.Check("category/third")
+	_ = t.Output()
+	G.InterPackage.CheckConflicts()
+
+	t.CheckOutputLines(
+		"AUTOFIX: category/other/Makefile:6: "+
+			"Inserting a line \"CONFLICTS+=\\tpackage-[0-9]*\" above this line.",
+		"AUTOFIX: category/other/Makefile:6: "+
+			"Inserting a line \"\" above this line.")
+	t.CheckFileLines("category/other/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tother-2.0",
+		"CATEGORIES=\tcategory",
+		"",
+		"CONFLICTS+=\tpackage-[0-9]*",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"",
+		"# end of file")
+	t.CheckFileLines("category/third/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=\tthird-2.0",
+		"CATEGORIES=\tcategory",
+		".include \"../../mk/bsd.prefs.mk\"")
+}
+
+func (s *Suite) Test_InterPackage_AddPatchWithoutUpstreamStatus(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "-Cglobal")
+	t.SetUpPackage("category/package",
+		"MAINTAINER=\tmaintainer@example.org")
+	t.CreateFileLines("category/package/patches/patch-aa",
+		CvsID,
+		"",
+		"Fix the build.",
+		"",
+		"--- aa.orig",
+		"+++ aa",
+		"@@ -1 +1 @@",
+		"-old",
+		"+new")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+
+	t.CheckOutputLines(
+		"ERROR: category/package/distinfo: "+
+			"Patch \"patches/patch-aa\" is not recorded. Run \""+confMake+" makepatchsum\".",
+		"WARN: category/package/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
+	t.CheckDeepEquals(G.InterPackage.patchesWithoutUpstream, []patchWithoutUpstream{
+		{"maintainer@example.org", "category/package/patches/patch-aa"}})
+}
+
+func (s *Suite) Test_InterPackage_AddPatchWithoutUpstreamStatus__disabled(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/patches/patch-aa",
+		CvsID,
+		"",
+		"Fix the build.",
+		"",
+		"--- aa.orig",
+		"+++ aa",
+		"@@ -1 +1 @@",
+		"-old",
+		"+new")
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	G.Check("category/package")
+
+	t.CheckOutputLines(
+		"ERROR: category/package/distinfo: "+
+			"Patch \"patches/patch-aa\" is not recorded. Run \""+confMake+" makepatchsum\".",
+		"WARN: category/package/patches/patch-aa: "+
+			"The patch documentation should say whether the patch has been sent upstream.")
+	// Without -Cglobal, the patches are not collected.
+	t.CheckLen(G.InterPackage.patchesWithoutUpstream, 0)
+}
+
+func (s *Suite) Test_InterPackage_ReportPatchesWithoutUpstreamStatus(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.Chdir(".")
+	t.FinishSetUp()
+
+	G.InterPackage.Enable()
+	ip := &G.InterPackage
+	ip.patchesWithoutUpstream = []patchWithoutUpstream{
+		{"pkgsrc-users@NetBSD.org", "category/zzz/patches/patch-aa"},
+		{"maintainer@example.org", "category/package/patches/patch-b"},
+		{"pkgsrc-users@NetBSD.org", "category/aaa/patches/patch-aa"},
+		{"maintainer@example.org", "category/package/patches/patch-a"}}
+
+	ip.ReportPatchesWithoutUpstreamStatus()
+
+	t.CheckOutputLines(
+		"Patches without upstream status, by maintainer:",
+		"",
+		"maintainer@example.org (2)",
+		"\tcategory/package/patches/patch-a",
+		"\tcategory/package/patches/patch-b",
+		"",
+		"pkgsrc-users@NetBSD.org (2)",
+		"\tcategory/aaa/patches/patch-aa",
+		"\tcategory/zzz/patches/patch-aa")
+}
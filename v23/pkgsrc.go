@@ -43,8 +43,9 @@ type Pkgsrc struct {
 	// to BUILD_DEFS.
 	UserDefinedVars Scope
 
-	deprecated map[string]string
-	types      VarTypeRegistry
+	deprecated  map[string]string
+	types       VarTypeRegistry
+	portability PortabilityRegistry
 }
 
 func NewPkgsrc(dir CurrPath) *Pkgsrc {
@@ -61,7 +62,8 @@ func NewPkgsrc(dir CurrPath) *Pkgsrc {
 		make(map[string][]string),
 		NewScope(),
 		make(map[string]string),
-		NewVarTypeRegistry()}
+		NewVarTypeRegistry(),
+		NewPortabilityRegistry()}
 }
 
 // LoadInfrastructure reads the pkgsrc infrastructure files to
@@ -75,6 +77,7 @@ func (src *Pkgsrc) LoadInfrastructure() {
 	infra := G.Infrastructure
 	G.Infrastructure = true
 	src.Types().Init(src)
+	src.Portability().Init()
 	src.loadMasterSites()
 	src.loadPkgOptions()
 	src.changes.load(src)
@@ -543,6 +546,8 @@ func (src *Pkgsrc) loadUntypedVars() {
 		}
 	}
 
+	usedAtLoadTime := make(map[string]bool)
+
 	handleMkFile := func(path CurrPath) {
 		mklines := LoadMk(path, nil, MustSucceed)
 		mklines.collectVariables(false, true) // FIXME
@@ -557,6 +562,7 @@ func (src *Pkgsrc) loadUntypedVars() {
 				define(varnameCanon(varname), data.used)
 			}
 		})
+		src.collectLoadTimeUses(mklines, usedAtLoadTime)
 	}
 
 	handleFile := func(pathName string, info os.FileInfo, err error) error {
@@ -570,6 +576,66 @@ func (src *Pkgsrc) loadUntypedVars() {
 
 	err := filepath.Walk(src.File("mk").String(), handleFile)
 	assertNil(err, "Walk error in pkgsrc infrastructure")
+
+	src.classifyUserDefinedVars(usedAtLoadTime)
+}
+
+// collectLoadTimeUses remembers the variables that are used at load time
+// after bsd.prefs.mk has been included, since only from that point on,
+// the user-defined variables from mk.conf are available.
+//
+// Most files from the infrastructure don't include bsd.prefs.mk
+// themselves, since bsd.pkg.mk includes them after bsd.prefs.mk.
+// In bsd.prefs.mk itself, the user-defined variables are available
+// after including ${MAKECONF}.
+func (src *Pkgsrc) collectLoadTimeUses(mklines *MkLines, usedAtLoadTime map[string]bool) {
+	isPrefs := func(mkline *MkLine) bool {
+		if !mkline.IsInclude() {
+			return false
+		}
+		included := mkline.IncludedFile()
+		if mkline.Basename == "bsd.prefs.mk" {
+			return contains(included.String(), "MAKECONF")
+		}
+		return included.HasBase("bsd.prefs.mk") || included.HasBase("bsd.fast.prefs.mk")
+	}
+
+	afterPrefs := true
+	for _, mkline := range mklines.mklines {
+		if isPrefs(mkline) {
+			afterPrefs = false
+			break
+		}
+	}
+
+	for _, mkline := range mklines.mklines {
+		if isPrefs(mkline) {
+			afterPrefs = true
+		}
+		if !afterPrefs {
+			continue
+		}
+		mkline.ForEachUsed(func(expr *MkExpr, time EctxTime) {
+			if time == EctxLoadTime {
+				usedAtLoadTime[expr.varname] = true
+			}
+		})
+	}
+}
+
+// classifyUserDefinedVars marks the user-defined variables from
+// mk/defaults/mk.conf that the pkgsrc infrastructure uses at load time.
+//
+// A package that uses one of the other user-defined variables
+// at load time probably does something the infrastructure
+// doesn't expect.
+func (src *Pkgsrc) classifyUserDefinedVars(usedAtLoadTime map[string]bool) {
+	for _, varname := range src.UserDefinedVars.varnames() {
+		vartype := src.Types().Canon(varname)
+		if vartype != nil && vartype.IsUserSettable() && usedAtLoadTime[varname] {
+			vartype.options |= UsedAtLoadTime
+		}
+	}
 }
 
 func (src *Pkgsrc) loadDefaultBuildDefs() {
@@ -657,6 +723,10 @@ func (src *Pkgsrc) Types() *VarTypeRegistry {
 	return &src.types
 }
 
+func (src *Pkgsrc) Portability() *PortabilityRegistry {
+	return &src.portability
+}
+
 // Latest returns the latest package matching the given pattern.
 // It searches the category for subdirectories matching the given
 // regular expression, takes the latest of them and replaces its
@@ -4,6 +4,7 @@ import (
 	"gopkg.in/check.v1"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 func (s *Suite) Test_Pkgsrc__frozen(c *check.C) {
@@ -506,6 +507,91 @@ func (s *Suite) Test_Pkgsrc_loadUntypedVars__tools(c *check.C) {
 			"Unknown shell command \"optional-tool\".")
 }
 
+func (s *Suite) Test_Pkgsrc_collectLoadTimeUses(c *check.C) {
+	t := s.Init(c)
+
+	test := func(filename RelPath, lines []string, expected ...string) {
+		mklines := t.NewMkLines(t.File(filename), lines...)
+		usedAtLoadTime := make(map[string]bool)
+
+		G.Pkgsrc.collectLoadTimeUses(mklines, usedAtLoadTime)
+
+		var actual []string
+		for varname := range usedAtLoadTime {
+			actual = append(actual, varname)
+		}
+		sort.Strings(actual)
+		t.CheckDeepEquals(actual, expected)
+	}
+
+	t.SetUpPkgsrc()
+	t.FinishSetUp()
+
+	// Files without an include of bsd.prefs.mk are included by
+	// bsd.pkg.mk, after bsd.prefs.mk.
+	test("mk/plain.mk",
+		[]string{
+			MkCvsID,
+			".if ${AFTER:Uno} == yes",
+			".endif",
+			"do-build:",
+			"\techo ${RUNTIME}"},
+		"AFTER")
+
+	test("mk/prefs.mk",
+		[]string{
+			MkCvsID,
+			".if ${BEFORE:Uno} == yes",
+			".endif",
+			".include \"bsd.fast.prefs.mk\"",
+			".for i in ${AFTER}",
+			".endfor"},
+		"AFTER")
+
+	test("mk/bsd.prefs.mk",
+		[]string{
+			MkCvsID,
+			".if ${BEFORE:Uno} == yes",
+			".endif",
+			".include \"${MAKECONF}\"",
+			"VAR:=\t${AFTER}"},
+		"AFTER", "MAKECONF")
+}
+
+func (s *Suite) Test_Pkgsrc_classifyUserDefinedVars(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPkgsrc()
+	t.CreateFileLines("mk/defaults/mk.conf",
+		MkCvsID,
+		"MANZ=	yes",
+		"#MAKE_JOBS=	4",
+		"OBJHOSTNAME?=	no")
+	t.CreateFileLines("mk/manz.mk",
+		MkCvsID,
+		".if ${MANZ:Uno} == yes",
+		".endif",
+		"JOBS:=	${MAKE_JOBS:U1}")
+	t.CreateFileLines("mk/objdir.mk",
+		MkCvsID,
+		"do-build:",
+		"	echo ${OBJHOSTNAME}")
+	t.FinishSetUp()
+
+	test := func(varname string, usedAtLoadTime bool) {
+		vartype := G.Pkgsrc.VariableType(nil, varname)
+		t.CheckEquals(vartype.IsUsedAtLoadTime(), usedAtLoadTime)
+	}
+
+	test("MANZ", true)
+	test("MAKE_JOBS", true)
+	test("OBJHOSTNAME", false)
+
+	// Variables that are not user-settable are never marked,
+	// even if they are used at load time.
+	test("OPSYS", false)
+}
+
 func (s *Suite) Test_Pkgsrc_Latest__multiple_candidates(c *check.C) {
 	t := s.Init(c)
 
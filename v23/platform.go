@@ -0,0 +1,588 @@
+package pkglint
+
+import (
+	"sort"
+	"strings"
+)
+
+// Platform is a combination of operating system, hardware architecture
+// and compiler, for evaluating the conditions in the makefiles
+// of a package, see -Cplatforms.
+//
+// An empty field means that the value is not known.
+type Platform struct {
+	Opsys       string // e.g. "NetBSD"
+	OsVersion   string // e.g. "10.0"
+	MachineArch string // e.g. "x86_64"
+	Compiler    string // e.g. "gcc"
+}
+
+// NewPlatform parses a platform of the form OPSYS-OS_VERSION-MACHINE_ARCH,
+// optionally followed by ":compiler".
+// Any of the parts may be "*" to leave it unspecified.
+func NewPlatform(s string) (Platform, bool) {
+	compiler := ""
+	if colon := strings.IndexByte(s, ':'); colon >= 0 {
+		s, compiler = s[:colon], s[colon+1:]
+	}
+
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return Platform{}, false
+	}
+
+	known := func(s string) string { return condStr(s == "*", "", s) }
+	return Platform{known(parts[0]), known(parts[1]), known(parts[2]), known(compiler)}, true
+}
+
+func (p Platform) String() string {
+	unknown := func(s string) string { return condStr(s == "", "*", s) }
+	str := sprintf("%s-%s-%s", unknown(p.Opsys), unknown(p.OsVersion), unknown(p.MachineArch))
+	if p.Compiler != "" {
+		str += ":" + p.Compiler
+	}
+	return str
+}
+
+// Define sets the variables that describe the platform,
+// such as OPSYS or MACHINE_ARCH, in the evaluator.
+func (p Platform) Define(e *MkExprEvaluator) {
+	define := func(varname, value string) {
+		if value != "" {
+			e.Define(varname, value)
+		}
+	}
+
+	define("OPSYS", p.Opsys)
+	define("LOWER_OPSYS", strings.ToLower(p.Opsys))
+	define("OS_VERSION", p.OsVersion)
+	define("MACHINE_ARCH", p.MachineArch)
+	define("PKGSRC_COMPILER", p.Compiler)
+	if p.Opsys != "" && p.OsVersion != "" && p.MachineArch != "" {
+		define("MACHINE_PLATFORM", p.Opsys+"-"+p.OsVersion+"-"+p.MachineArch)
+	}
+}
+
+// DefaultPlatforms returns the platforms for -Cplatforms if none are
+// given on the command line.
+//
+// Evaluating the makefiles of each package for the full matrix from
+// AllPlatforms takes too long, therefore this is a representative set:
+// each known operating system on x86_64 and aarch64, each with GCC and
+// Clang, plus NetBSD and Linux on each of the other hardware
+// architectures. This way, each value of OPSYS and MACHINE_ARCH occurs
+// at least once.
+//
+// A condition that combines another operating system with one of the
+// other architectures, such as SunOS on sparc64, is not taken on any
+// of these platforms. To check these as well, use --platform=all.
+func DefaultPlatforms() []Platform {
+	opsyses := strings.Fields(G.Pkgsrc.VariableType(nil, "OPSYS").basicType.AllowedEnums())
+	compilers := []string{"gcc", "clang"}
+
+	var platforms []Platform
+	for _, opsys := range opsyses {
+		for _, arch := range []string{"x86_64", "aarch64"} {
+			for _, compiler := range compilers {
+				platforms = append(platforms, Platform{opsys, "", arch, compiler})
+			}
+		}
+	}
+	for _, arch := range strings.Fields(archValues) {
+		if arch != "x86_64" && arch != "aarch64" {
+			platforms = append(platforms,
+				Platform{"NetBSD", "", arch, "gcc"},
+				Platform{"Linux", "", arch, "gcc"})
+		}
+	}
+	return platforms
+}
+
+// AllPlatforms returns the full matrix for -Cplatforms, which is selected
+// by "--platform=all".
+// These are all combinations of the known operating systems and
+// the common hardware architectures, each with GCC and Clang,
+// leaving the OS version unspecified.
+func AllPlatforms() []Platform {
+	opsyses := strings.Fields(G.Pkgsrc.VariableType(nil, "OPSYS").basicType.AllowedEnums())
+	archs := strings.Fields(archValues)
+
+	var platforms []Platform
+	for _, opsys := range opsyses {
+		for _, arch := range archs {
+			for _, compiler := range []string{"gcc", "clang"} {
+				platforms = append(platforms, Platform{opsys, "", arch, compiler})
+			}
+		}
+	}
+	return platforms
+}
+
+// platformVarnames are the variables that are set by Platform.Define.
+var platformVarnames = map[string]bool{
+	"OPSYS":            true,
+	"LOWER_OPSYS":      true,
+	"OS_VERSION":       true,
+	"MACHINE_ARCH":     true,
+	"MACHINE_PLATFORM": true,
+	"PKGSRC_COMPILER":  true,
+}
+
+// PlatformChecker evaluates the makefiles of a package once for each
+// platform from a matrix, to find code that only applies to some of the
+// platforms, although it should apply to all of them, or vice versa.
+type PlatformChecker struct {
+	pkg       *Package
+	mklines   *MkLines // The package Makefile, including the included files.
+	platforms []Platform
+
+	// For each of the platforms, the lines that are possibly evaluated.
+	live []map[*MkLine]bool
+
+	reached map[*MkLine]bool // The branches that are reached on at least one platform.
+	taken   map[*MkLine]bool // The branches that are taken on at least one platform.
+
+	// For each variable that is used in a line, the platforms on which
+	// the variable is not defined.
+	undefined map[*MkLine]map[string][]Platform
+}
+
+func NewPlatformChecker(pkg *Package, mklines *MkLines, platforms []Platform) *PlatformChecker {
+	return &PlatformChecker{
+		pkg,
+		mklines,
+		platforms,
+		nil,
+		make(map[*MkLine]bool),
+		make(map[*MkLine]bool),
+		make(map[*MkLine]map[string][]Platform)}
+}
+
+func (ck *PlatformChecker) Check() {
+	if trace.Tracing {
+		defer trace.Call0()()
+	}
+
+	ck.evaluateAll()
+
+	ck.checkDeadBranches()
+	ck.checkUndefined()
+	ck.checkBuildlink3Includes()
+	ck.checkPlistFiles()
+	ck.checkPlistConditions()
+}
+
+// evaluateAll evaluates the makefiles of the package once for each
+// platform, remembering the results for the individual checks.
+func (ck *PlatformChecker) evaluateAll() {
+	conditional := ck.conditionalVars()
+	for _, platform := range ck.platforms {
+		live := ck.evaluate(ck.mklines, platform)
+		ck.live = append(ck.live, live)
+		ck.collectUndefined(platform, live, conditional)
+	}
+}
+
+// ownFile returns whether the line comes from the package itself,
+// as opposed to the pkgsrc infrastructure or other packages.
+func (ck *PlatformChecker) ownFile(mkline *MkLine) bool {
+	return !ck.pkg.Rel(mkline.Filename()).HasPrefixPath("..")
+}
+
+// evaluate walks through the lines for the given platform and
+// returns the lines that are possibly evaluated on this platform.
+func (ck *PlatformChecker) evaluate(mklines *MkLines, platform Platform) map[*MkLine]bool {
+	e := NewMkExprEvaluator(nil, "", "")
+	platform.Define(e)
+
+	type level struct {
+		outer bool // Whether the enclosing code is possibly live.
+		done  bool // Whether an earlier branch is definitely taken.
+		live  bool // Whether the current branch is possibly taken.
+	}
+	levels := []level{{true, false, true}}
+	live := make(map[*MkLine]bool)
+
+	branch := func(mkline *MkLine, top *level) {
+		top.live = false
+		if top.outer && !top.done {
+			result, known := true, false
+			if mkline.Directive() == "if" || mkline.Directive() == "elif" {
+				result, known = e.EvalCond(mkline.Cond())
+			}
+			top.live = result || !known
+			top.done = result && known
+		}
+		ck.reached[mkline] = ck.reached[mkline] || top.outer
+		ck.taken[mkline] = ck.taken[mkline] || top.live
+	}
+
+	for _, mkline := range mklines.mklines {
+		top := &levels[len(levels)-1]
+		if !mkline.IsDirective() {
+			live[mkline] = top.live
+			continue
+		}
+
+		switch directive := mkline.Directive(); {
+		case hasPrefix(directive, "if"):
+			levels = append(levels, level{top.live, false, false})
+			branch(mkline, &levels[len(levels)-1])
+		case directive == "for":
+			levels = append(levels, level{top.live, false, top.live})
+		case len(levels) == 1:
+			break
+		case hasPrefix(directive, "elif"):
+			branch(mkline, top)
+		case directive == "else":
+			top.live = top.outer && !top.done
+			ck.reached[mkline] = ck.reached[mkline] || top.outer
+			ck.taken[mkline] = ck.taken[mkline] || top.live
+		case directive == "endif", directive == "endfor":
+			levels = levels[:len(levels)-1]
+		}
+	}
+	return live
+}
+
+// mentionsPlatform returns whether the condition depends on
+// one of the variables that describe the platform.
+func (ck *PlatformChecker) mentionsPlatform(mkline *MkLine) bool {
+	if !mkline.IsDirective() || !mkline.NeedsCond() || mkline.Cond() == nil {
+		return false
+	}
+	mentions := false
+	mkline.Cond().Walk(&MkCondCallback{
+		Defined: func(varname string) {
+			mentions = mentions || platformVarnames[varname]
+		},
+		Expr: func(expr *MkExpr) {
+			mentions = mentions || platformVarnames[expr.varname]
+		}})
+	return mentions
+}
+
+// conditionalVars returns the variables that the package defines only
+// inside conditional code, mapped to their assignments.
+func (ck *PlatformChecker) conditionalVars() map[string][]*MkLine {
+	assignments := make(map[string][]*MkLine)
+	unconditional := make(map[string]bool)
+
+	depth := 0
+	for _, mkline := range ck.mklines.mklines {
+		switch {
+		case mkline.IsDirective():
+			directive := mkline.Directive()
+			if hasPrefix(directive, "if") || directive == "for" {
+				depth++
+			} else if (directive == "endif" || directive == "endfor") && depth > 0 {
+				depth--
+			}
+
+		case mkline.IsVarassign():
+			varname := mkline.Varname()
+			if depth == 0 || !ck.ownFile(mkline) {
+				unconditional[varname] = true
+			}
+			assignments[varname] = append(assignments[varname], mkline)
+		}
+	}
+
+	for varname := range assignments {
+		if unconditional[varname] || G.Pkgsrc.Types().IsDefinedCanon(varname) {
+			delete(assignments, varname)
+		}
+	}
+	return assignments
+}
+
+// collectUndefined remembers the variables that are used on the platform
+// but are not defined on it.
+func (ck *PlatformChecker) collectUndefined(platform Platform, live map[*MkLine]bool, conditional map[string][]*MkLine) {
+	defined := func(varname string) bool {
+		for _, assignment := range conditional[varname] {
+			if live[assignment] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, mkline := range ck.mklines.mklines {
+		if !live[mkline] || !ck.ownFile(mkline) {
+			continue
+		}
+		mkline.ForEachUsed(func(expr *MkExpr, _ EctxTime) {
+			varname := expr.varname
+			if conditional[varname] == nil || defined(varname) ||
+				expr.HasModifier("U") || expr.HasModifier("D") {
+				return
+			}
+			if ck.undefined[mkline] == nil {
+				ck.undefined[mkline] = make(map[string][]Platform)
+			}
+			platforms := ck.undefined[mkline][varname]
+			if len(platforms) == 0 || platforms[len(platforms)-1] != platform {
+				ck.undefined[mkline][varname] = append(platforms, platform)
+			}
+		})
+	}
+}
+
+func (ck *PlatformChecker) checkDeadBranches() {
+	var chain []*MkLine // The .if and .elif lines of the current chain.
+	var chains [][]*MkLine
+
+	for _, mkline := range ck.mklines.mklines {
+		if !mkline.IsDirective() {
+			continue
+		}
+
+		directive := mkline.Directive()
+		switch {
+		case hasPrefix(directive, "if"):
+			chains = append(chains, chain)
+			chain = []*MkLine{mkline}
+		case hasPrefix(directive, "elif"):
+			chain = append(chain, mkline)
+		case directive == "endif" && len(chains) > 0:
+			chain = chains[len(chains)-1]
+			chains = chains[:len(chains)-1]
+		}
+
+		if !ck.reached[mkline] || ck.taken[mkline] || !ck.ownFile(mkline) {
+			continue
+		}
+
+		if directive == "else" {
+			mentions := false
+			for _, cond := range chain {
+				mentions = mentions || ck.mentionsPlatform(cond)
+			}
+			if !mentions {
+				continue
+			}
+		} else if !ck.mentionsPlatform(mkline) {
+			continue
+		}
+
+		mkline.Warnf("This branch is not taken on any of the %d platforms.", len(ck.platforms))
+		mkline.Explain(
+			"The conditions have been evaluated for each of the platforms from",
+			"the matrix, which is given by the --platform option.",
+			"On none of these platforms,",
+			"the code in this branch is actually used.",
+			"",
+			"Either the condition has a typo,",
+			"or the code is obsolete and should be removed.")
+	}
+}
+
+func (ck *PlatformChecker) checkUndefined() {
+	for _, mkline := range ck.mklines.mklines {
+		undefined := ck.undefined[mkline]
+		var varnames []string
+		for varname := range undefined {
+			varnames = append(varnames, varname)
+		}
+		sort.Strings(varnames)
+
+		for _, varname := range varnames {
+			mkline.Warnf("%s is used here but is not defined on %s.",
+				varname, ck.describe(undefined[varname]))
+			mkline.Explain(
+				"The variable is only defined inside conditional code,",
+				"but it is used on platforms where none of these conditions apply.",
+				"",
+				"Either define the variable for all platforms,",
+				"or use it only on those platforms where it is defined,",
+				"or provide a default value using the :U modifier.")
+		}
+	}
+}
+
+// checkBuildlink3Includes compares the platforms on which the package
+// Makefile includes the buildlink3.mk file of another package
+// to the platforms on which the buildlink3.mk file of this package
+// includes it.
+//
+// The cases where the inclusion is conditional in one of these files
+// but unconditional in the other are already covered by
+// Package.checkIncludeConditionally.
+func (ck *PlatformChecker) checkBuildlink3Includes() {
+	bl3File := ck.pkg.File("buildlink3.mk")
+	if !bl3File.IsFile() {
+		return
+	}
+	bl3 := LoadMk(bl3File, ck.pkg, NotEmpty)
+	if bl3 == nil {
+		return
+	}
+
+	includes := func(mklines *MkLines) map[RelPath]*MkLine {
+		result := make(map[RelPath]*MkLine)
+		for _, mkline := range mklines.mklines {
+			if mkline.IsInclude() && mkline.IncludedFile().HasBase("buildlink3.mk") && ck.ownFile(mkline) {
+				if result[mkline.IncludedFile()] == nil {
+					result[mkline.IncludedFile()] = mkline
+				}
+			}
+		}
+		return result
+	}
+	pkgIncludes := includes(ck.mklines)
+	bl3Includes := includes(bl3)
+
+	var pkgPlatforms, bl3Platforms = make(map[*MkLine][]Platform), make(map[*MkLine][]Platform)
+	for i, platform := range ck.platforms {
+		pkgLive := ck.live[i]
+		bl3Live := ck.evaluate(bl3, platform)
+		for _, mkline := range pkgIncludes {
+			if pkgLive[mkline] {
+				pkgPlatforms[mkline] = append(pkgPlatforms[mkline], platform)
+			}
+		}
+		for _, mkline := range bl3Includes {
+			if bl3Live[mkline] {
+				bl3Platforms[mkline] = append(bl3Platforms[mkline], platform)
+			}
+		}
+	}
+
+	for _, bl3Include := range bl3.mklines {
+		if !bl3Include.IsInclude() || bl3Includes[bl3Include.IncludedFile()] != bl3Include {
+			continue
+		}
+		included := bl3Include.IncludedFileFull()
+		pkgInclude := pkgIncludes[bl3Include.IncludedFile()]
+		if pkgInclude == nil {
+			continue
+		}
+
+		inPkg := pkgPlatforms[pkgInclude]
+		inBl3 := bl3Platforms[bl3Include]
+		all := len(ck.platforms)
+		if len(inPkg) == all || len(inBl3) == all || ck.samePlatforms(inPkg, inBl3) {
+			continue
+		}
+
+		bl3Include.Warnf("%s is included on %s here, but on %s in %s.",
+			ck.pkg.Rel(included).String(), ck.describe(inBl3),
+			ck.describe(inPkg), bl3Include.RelMkLine(pkgInclude))
+		bl3Include.Explain(
+			"The dependencies of the package must be the same as those",
+			"that are passed to the packages that use this package.",
+			"Therefore the conditions for including the buildlink3.mk file",
+			"must apply to the same platforms.")
+	}
+}
+
+// checkPlistFiles checks that the platform-specific PLIST files,
+// such as PLIST.Linux or PLIST.NetBSD-x86_64, apply to at least one
+// of the platforms.
+func (ck *PlatformChecker) checkPlistFiles() {
+	for _, file := range ck.pkg.File(ck.pkg.Pkgdir).ReadPaths() {
+		basename := file.Base()
+		if !basename.HasPrefixText("PLIST.") {
+			continue
+		}
+
+		rank := NewPlistRank(basename)
+		if rank.Rank != 3 || rank.Opsys == "" && rank.Arch == "" {
+			continue
+		}
+
+		used := false
+		for _, platform := range ck.platforms {
+			if (rank.Opsys == "" || platform.Opsys == "" || rank.Opsys == platform.Opsys ||
+				rank.Opsys == strings.ToLower(platform.Opsys)) &&
+				(rank.Arch == "" || platform.MachineArch == "" || rank.Arch == platform.MachineArch) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			NewLineWhole(file).Warnf("This file is not used on any of the %d platforms.", len(ck.platforms))
+		}
+	}
+}
+
+// checkPlistConditions checks that each condition of the form ${PLIST.id}
+// from the PLIST files is set on at least one of the platforms,
+// as otherwise the PLIST entries are never installed.
+func (ck *PlatformChecker) checkPlistConditions() {
+	assignments := make(map[string][]*MkLine)
+	for _, mkline := range ck.mklines.mklines {
+		if !mkline.IsVarassign() || !hasPrefix(mkline.Varname(), "PLIST.") {
+			continue
+		}
+		if containsExpr(mkline.Varname()) {
+			// The conditions cannot be determined reliably.
+			return
+		}
+		assignments[mkline.Varname()] = append(assignments[mkline.Varname()], mkline)
+	}
+
+	set := func(cond string) bool {
+		for _, live := range ck.live {
+			for _, mkline := range assignments[cond] {
+				if live[mkline] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var seen Once
+	for _, file := range ck.pkg.File(ck.pkg.Pkgdir).ReadPaths() {
+		if !file.Base().HasPrefixText("PLIST") {
+			continue
+		}
+		lines := Load(file, 0)
+		if lines == nil {
+			continue
+		}
+
+		for _, pline := range (*PlistChecker)(nil).newLines(lines) {
+			for _, cond := range pline.conditions {
+				if assignments[cond] == nil || !seen.FirstTime(cond) || set(cond) {
+					continue
+				}
+				pline.Line.Warnf("%s is not set on any of the %d platforms.", cond, len(ck.platforms))
+				pline.Line.Explain(
+					"The variable for this condition is only set in conditional code,",
+					"and none of the platforms from the matrix satisfies these conditions.",
+					"Therefore, the PLIST entries that depend on this condition",
+					"are never installed.")
+			}
+		}
+	}
+}
+
+func (ck *PlatformChecker) samePlatforms(a, b []Platform) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// describe returns a short description of the platforms,
+// such as "NetBSD-*-x86_64:gcc" or "3 of 12 platforms, e.g. Linux-*-i386:gcc".
+func (ck *PlatformChecker) describe(platforms []Platform) string {
+	switch len(platforms) {
+	case 0:
+		return "none of the platforms"
+	case 1:
+		return platforms[0].String()
+	case len(ck.platforms):
+		return "all platforms"
+	}
+	return sprintf("%d of %d platforms, e.g. %s",
+		len(platforms), len(ck.platforms), platforms[0].String())
+}
@@ -0,0 +1,599 @@
+package pkglint
+
+import (
+	"gopkg.in/check.v1"
+	"strings"
+)
+
+// newPlatformCheckerTest returns a checker for the given package makefile
+// lines, evaluated for the given platforms.
+func newPlatformCheckerTest(t *Tester, platforms []string, lines ...string) *PlatformChecker {
+	t.SetUpPackage("category/package", lines...)
+	t.Chdir("category/package")
+	t.FinishSetUp()
+
+	pkg := NewPackage(".")
+	_, _, allLines := pkg.load()
+
+	var ps []Platform
+	for _, platform := range platforms {
+		p, ok := NewPlatform(platform)
+		t.CheckEquals(ok, true)
+		ps = append(ps, p)
+	}
+	return NewPlatformChecker(pkg, allLines, ps)
+}
+
+func (s *Suite) Test_NewPlatform(c *check.C) {
+	t := s.Init(c)
+
+	test := func(s string, platform Platform, ok bool) {
+		actualPlatform, actualOk := NewPlatform(s)
+		t.CheckDeepEquals(
+			[]interface{}{actualPlatform, actualOk},
+			[]interface{}{platform, ok})
+	}
+
+	test("NetBSD-10.0-x86_64", Platform{"NetBSD", "10.0", "x86_64", ""}, true)
+	test("NetBSD-10.0-x86_64:clang", Platform{"NetBSD", "10.0", "x86_64", "clang"}, true)
+	test("Linux-*-*", Platform{"Linux", "", "", ""}, true)
+	test("*-*-*:*", Platform{}, true)
+
+	test("NetBSD", Platform{}, false)
+	test("NetBSD-10.0", Platform{}, false)
+	test("NetBSD-10.0-x86_64-extra", Platform{}, false)
+}
+
+func (s *Suite) Test_Platform_String(c *check.C) {
+	t := s.Init(c)
+
+	test := func(platform Platform, str string) {
+		t.CheckEquals(platform.String(), str)
+	}
+
+	test(Platform{"NetBSD", "10.0", "x86_64", ""}, "NetBSD-10.0-x86_64")
+	test(Platform{"NetBSD", "", "x86_64", "gcc"}, "NetBSD-*-x86_64:gcc")
+	test(Platform{}, "*-*-*")
+}
+
+func (s *Suite) Test_Platform_Define(c *check.C) {
+	t := s.Init(c)
+
+	test := func(platform Platform, text string, value string, known bool) {
+		e := NewMkExprEvaluator(nil, "", "")
+		platform.Define(e)
+		actualValue, actualKnown := e.Eval(text)
+		t.CheckDeepEquals(
+			[]interface{}{actualValue, actualKnown},
+			[]interface{}{value, known})
+	}
+
+	netbsd := Platform{"NetBSD", "10.0", "x86_64", "gcc"}
+	test(netbsd, "${OPSYS} ${LOWER_OPSYS} ${OS_VERSION}", "NetBSD netbsd 10.0", true)
+	test(netbsd, "${MACHINE_ARCH} ${PKGSRC_COMPILER}", "x86_64 gcc", true)
+	test(netbsd, "${MACHINE_PLATFORM}", "NetBSD-10.0-x86_64", true)
+
+	// Unknown parts of the platform are left undefined.
+	linux := Platform{"Linux", "", "aarch64", ""}
+	test(linux, "${OPSYS}-${MACHINE_ARCH}", "Linux-aarch64", true)
+	test(linux, "${OS_VERSION}", "", false)
+	test(linux, "${MACHINE_PLATFORM}", "", false)
+}
+
+func (s *Suite) Test_DefaultPlatforms(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+
+	platforms := DefaultPlatforms()
+
+	t.CheckDeepEquals(platforms[0], Platform{"Cygwin", "", "x86_64", "gcc"})
+	t.CheckDeepEquals(platforms[1], Platform{"Cygwin", "", "x86_64", "clang"})
+	t.CheckDeepEquals(platforms[2], Platform{"Cygwin", "", "aarch64", "gcc"})
+	t.CheckDeepEquals(platforms[24], Platform{"NetBSD", "", "alpha", "gcc"})
+	t.CheckDeepEquals(platforms[25], Platform{"Linux", "", "alpha", "gcc"})
+	t.CheckLen(platforms, 6*2*2+2*(len(strings.Fields(archValues))-2))
+
+	// Each operating system and each architecture occurs at least once.
+	opsyses := make(map[string]bool)
+	archs := make(map[string]bool)
+	for _, platform := range platforms {
+		opsyses[platform.Opsys] = true
+		archs[platform.MachineArch] = true
+	}
+	t.CheckLen(opsyses, 6)
+	t.CheckLen(archs, len(strings.Fields(archValues)))
+}
+
+func (s *Suite) Test_AllPlatforms(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+
+	platforms := AllPlatforms()
+
+	t.CheckDeepEquals(platforms[0], Platform{"Cygwin", "", "aarch64", "gcc"})
+	t.CheckDeepEquals(platforms[1], Platform{"Cygwin", "", "aarch64", "clang"})
+	t.CheckLen(platforms, 6*len(strings.Fields(archValues))*2)
+}
+
+func (s *Suite) Test_NewPlatformChecker(c *check.C) {
+	t := s.Init(c)
+
+	ck := NewPlatformChecker(nil, nil, nil)
+
+	t.CheckLen(ck.reached, 0)
+	t.CheckLen(ck.taken, 0)
+	t.CheckLen(ck.undefined, 0)
+}
+
+func (s *Suite) Test_PlatformChecker_Check(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "-Cplatforms",
+		"--platform=NetBSD-*-x86_64",
+		"--platform=Linux-*-x86_64")
+	t.SetUpPackage("category/package",
+		".include \"../../mk/bsd.prefs.mk\"",
+		"",
+		".if ${OPSYS} == NetBSD",
+		"NETBSD_FLAGS=\t-DNETBSD",
+		".elif ${OPSYS} == SunOS",
+		"SUNOS_FLAGS=\t-DSUNOS",
+		".endif",
+		"",
+		"CPPFLAGS+=\t${NETBSD_FLAGS}")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"WARN: ~/category/package/Makefile:25: "+
+			"Variable \"SUNOS_FLAGS\" is defined but not used.",
+		"WARN: ~/category/package/Makefile:24: "+
+			"This branch is not taken on any of the 2 platforms.",
+		"WARN: ~/category/package/Makefile:28: "+
+			"NETBSD_FLAGS is used here but is not defined on Linux-*-x86_64.")
+}
+
+// Without -Cplatforms, the checks are not run at all.
+func (s *Suite) Test_PlatformChecker_Check__disabled(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		".include \"../../mk/bsd.prefs.mk\"",
+		"",
+		".if ${OPSYS} == SunOS && ${MACHINE_ARCH} == x86_64",
+		".endif")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_PlatformChecker_Check__default_platforms(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "-Cplatforms")
+	t.SetUpPackage("category/package",
+		".include \"../../mk/bsd.prefs.mk\"",
+		"",
+		".if ${OPSYS} == NetBSD",
+		".elif ${MACHINE_ARCH} == vax",
+		".elif ${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64",
+		".endif")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"WARN: ~/category/package/Makefile:24: " +
+			"This branch is not taken on any of the " +
+			sprintf("%d", 6*2*2+2*(len(strings.Fields(archValues))-2)) + " platforms.")
+}
+
+// With --platform=all, the conditions are evaluated for the full matrix,
+// which also covers the less common combinations of operating system
+// and hardware architecture.
+func (s *Suite) Test_PlatformChecker_Check__all_platforms(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "-Cplatforms", "-P", "all")
+	t.SetUpPackage("category/package",
+		".include \"../../mk/bsd.prefs.mk\"",
+		"",
+		".if ${OPSYS} == SunOS && ${MACHINE_ARCH} == sparc64",
+		".elif ${OPSYS} == NetBSD",
+		".elif ${OPSYS} == NetBSD && ${MACHINE_ARCH} == x86_64",
+		".endif")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"WARN: ~/category/package/Makefile:24: " +
+			"This branch is not taken on any of the " +
+			sprintf("%d", 6*len(strings.Fields(archValues))*2) + " platforms.")
+}
+
+func (s *Suite) Test_PlatformChecker_evaluateAll(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-*"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		".if ${OPSYS} == NetBSD",
+		"NETBSD_FLAGS=\t-DNETBSD",
+		".endif",
+		"CPPFLAGS+=\t${NETBSD_FLAGS}")
+	flags := ck.mklines.mklines[22]
+	t.CheckEquals(flags.Varname(), "NETBSD_FLAGS")
+
+	ck.evaluateAll()
+
+	t.CheckLen(ck.live, 2)
+	t.CheckEquals(ck.live[0][flags], true)
+	t.CheckEquals(ck.live[1][flags], false)
+	t.CheckLen(ck.undefined, 1)
+}
+
+func (s *Suite) Test_PlatformChecker_ownFile(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, nil)
+
+	t.CheckEquals(ck.ownFile(t.NewMkLine("Makefile", 1, "")), true)
+	t.CheckEquals(ck.ownFile(t.NewMkLine("options.mk", 1, "")), true)
+	t.CheckEquals(ck.ownFile(t.NewMkLine("../../mk/bsd.prefs.mk", 1, "")), false)
+}
+
+func (s *Suite) Test_PlatformChecker_evaluate(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, nil)
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		"NETBSD=\tyes",
+		".elif ${OPSYS} == Linux",
+		"LINUX=\tyes",
+		".else",
+		"OTHER=\tyes",
+		".endif",
+		".if ${UNKNOWN} == yes",
+		".  for i in 1 2 3",
+		"UNKNOWN=\tyes",
+		".  endfor",
+		".endif",
+		".if exists(/usr/bin/cc)",
+		"EXISTS=\tyes",
+		".endif")
+
+	test := func(platform string, liveLines ...int) {
+		p, _ := NewPlatform(platform)
+		live := ck.evaluate(mklines, p)
+		var actual []int
+		for i, mkline := range mklines.mklines {
+			if live[mkline] {
+				actual = append(actual, i+1)
+			}
+		}
+		t.CheckDeepEquals(actual, liveLines)
+	}
+
+	test("NetBSD-*-*", 1, 3, 11, 15)
+	test("Linux-*-*", 1, 5, 11, 15)
+	test("SunOS-*-*", 1, 7, 11, 15)
+
+	// If the operating system is not known,
+	// each of the branches may be taken.
+	test("*-*-*", 1, 3, 5, 7, 11, 15)
+
+	t.CheckEquals(ck.reached[mklines.mklines[3]], true)
+	t.CheckEquals(ck.taken[mklines.mklines[3]], true)
+}
+
+func (s *Suite) Test_PlatformChecker_evaluate__nested(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, nil)
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		".if ${OPSYS} == NetBSD",
+		".  if ${MACHINE_ARCH} == vax",
+		"VAX=\tyes",
+		".  endif",
+		".endif",
+		".endif")
+
+	p, _ := NewPlatform("Linux-*-vax")
+	live := ck.evaluate(mklines, p)
+
+	t.CheckEquals(live[mklines.mklines[3]], false)
+
+	// The inner condition is not reached at all,
+	// therefore it doesn't count as dead code.
+	t.CheckEquals(ck.reached[mklines.mklines[2]], false)
+	t.CheckEquals(ck.taken[mklines.mklines[2]], false)
+
+	// The extra .endif is ignored.
+	t.CheckEquals(live[mklines.mklines[6]], false)
+}
+
+func (s *Suite) Test_PlatformChecker_mentionsPlatform(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, nil)
+
+	test := func(text string, mentions bool) {
+		mkline := t.NewMkLine("filename.mk", 1, text)
+		t.CheckEquals(ck.mentionsPlatform(mkline), mentions)
+	}
+
+	test(".if ${OPSYS} == NetBSD", true)
+	test(".elif !empty(MACHINE_PLATFORM:MNetBSD-*)", true)
+	test(".if defined(PKGSRC_COMPILER)", true)
+	test(".if ${PKGNAME} == package", false)
+	test(".else", false)
+	test(".for i in ${OPSYS}", false)
+	test("VAR=\t${OPSYS}", false)
+}
+
+func (s *Suite) Test_PlatformChecker_conditionalVars(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, nil,
+		".include \"../../mk/bsd.prefs.mk\"",
+		".if ${OPSYS} == NetBSD",
+		"ONLY_NETBSD=\tyes",
+		"BOTH=\tyes",
+		".endif",
+		"BOTH=\tyes",
+		".for i in 1 2 3",
+		"IN_LOOP=\tyes",
+		".endfor",
+		".if ${OPSYS} == Linux",
+		"CONFIGURE_ARGS+=\t--linux",
+		".endif")
+
+	conditional := ck.conditionalVars()
+
+	varnames := make(map[string]bool)
+	for varname := range conditional {
+		varnames[varname] = true
+	}
+	t.CheckDeepEquals(keysSorted(varnames), []string{"IN_LOOP", "ONLY_NETBSD"})
+	t.CheckEquals(conditional["ONLY_NETBSD"][0].Linenos(), "22")
+}
+
+func (s *Suite) Test_PlatformChecker_collectUndefined(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-*"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		".if ${OPSYS} == NetBSD",
+		"NETBSD_FLAGS=\t-DNETBSD",
+		".endif",
+		"CFLAGS+=\t${NETBSD_FLAGS} ${NETBSD_FLAGS:U}",
+		"CPPFLAGS+=\t${NETBSD_FLAGS:D-DHAVE_NETBSD}")
+
+	conditional := ck.conditionalVars()
+	for _, platform := range ck.platforms {
+		live := ck.evaluate(ck.mklines, platform)
+		ck.collectUndefined(platform, live, conditional)
+	}
+
+	t.CheckLen(ck.undefined, 1)
+	for mkline, undefined := range ck.undefined {
+		t.CheckEquals(mkline.Linenos(), "24")
+		t.CheckDeepEquals(undefined["NETBSD_FLAGS"], []Platform{{"Linux", "", "", ""}})
+	}
+}
+
+func (s *Suite) Test_PlatformChecker_checkDeadBranches(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-*"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		".if ${OPSYS} == NetBSD || ${OPSYS} == Linux",
+		".else",
+		".endif",
+		".if ${OPSYS} == SunOS",
+		".  if ${MACHINE_ARCH} == sparc",
+		".  endif",
+		".endif",
+		".if ${PKGNAME} == nothing",
+		".else",
+		".endif")
+
+	for _, platform := range ck.platforms {
+		ck.evaluate(ck.mklines, platform)
+	}
+	ck.checkDeadBranches()
+
+	// The nested .if in line 25 is not reached at all,
+	// therefore it is not reported separately.
+	//
+	// The condition in line 28 doesn't depend on the platform,
+	// therefore it is not reported.
+	t.CheckOutputLines(
+		"WARN: Makefile:22: This branch is not taken on any of the 2 platforms.",
+		"",
+		"\tThe conditions have been evaluated for each of the platforms from",
+		"\tthe matrix, which is given by the --platform option. On none of",
+		"\tthese platforms, the code in this branch is actually used.",
+		"",
+		"\tEither the condition has a typo, or the code is obsolete and should",
+		"\tbe removed.",
+		"",
+		"WARN: Makefile:24: This branch is not taken on any of the 2 platforms.")
+}
+
+func (s *Suite) Test_PlatformChecker_checkUndefined(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-*", "SunOS-*-*"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		".if ${OPSYS} == NetBSD",
+		"NETBSD_FLAGS=\t-DNETBSD",
+		"OS_FLAGS=\t-DNETBSD",
+		".endif",
+		"CFLAGS+=\t${OS_FLAGS} ${NETBSD_FLAGS}")
+
+	conditional := ck.conditionalVars()
+	for _, platform := range ck.platforms {
+		live := ck.evaluate(ck.mklines, platform)
+		ck.collectUndefined(platform, live, conditional)
+	}
+	ck.checkUndefined()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:25: NETBSD_FLAGS is used here but is not defined "+
+			"on 2 of 3 platforms, e.g. Linux-*-*.",
+		"",
+		"\tThe variable is only defined inside conditional code, but it is used",
+		"\ton platforms where none of these conditions apply.",
+		"",
+		"\tEither define the variable for all platforms, or use it only on",
+		"\tthose platforms where it is defined, or provide a default value",
+		"\tusing the :U modifier.",
+		"",
+		"WARN: Makefile:25: OS_FLAGS is used here but is not defined "+
+			"on 2 of 3 platforms, e.g. Linux-*-*.")
+}
+
+func (s *Suite) Test_PlatformChecker_checkBuildlink3Includes(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileBuildlink3("category/package/buildlink3.mk",
+		".include \"../../mk/bsd.fast.prefs.mk\"",
+		".if ${OPSYS} == NetBSD",
+		".include \"../../devel/netbsd-only/buildlink3.mk\"",
+		".endif",
+		".if ${OPSYS} != Linux",
+		".include \"../../devel/not-linux/buildlink3.mk\"",
+		".endif")
+	t.CreateFileBuildlink3("devel/netbsd-only/buildlink3.mk")
+	t.CreateFileBuildlink3("devel/not-linux/buildlink3.mk")
+	t.CreateFileLines("mk/bsd.fast.prefs.mk",
+		MkCvsID)
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-*", "SunOS-*-*"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		".if ${OPSYS} == NetBSD",
+		".include \"../../devel/netbsd-only/buildlink3.mk\"",
+		".endif",
+		".if ${OPSYS} == NetBSD",
+		".include \"../../devel/not-linux/buildlink3.mk\"",
+		".endif")
+	ck.evaluateAll()
+
+	ck.checkBuildlink3Includes()
+
+	t.CheckOutputLines(
+		"WARN: buildlink3.mk:17: ../../devel/not-linux/buildlink3.mk " +
+			"is included on 2 of 3 platforms, e.g. NetBSD-*-* here, " +
+			"but on NetBSD-*-* in Makefile:25.")
+}
+
+func (s *Suite) Test_PlatformChecker_checkPlistFiles(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("category/package/PLIST.Linux",
+		PlistCvsID)
+	t.CreateFileLines("category/package/PLIST.SunOS",
+		PlistCvsID)
+	t.CreateFileLines("category/package/PLIST.x86_64",
+		PlistCvsID)
+	t.CreateFileLines("category/package/PLIST.linux-i386",
+		PlistCvsID)
+	t.CreateFileLines("category/package/PLIST.other",
+		PlistCvsID)
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-x86_64"})
+
+	ck.checkPlistFiles()
+
+	t.CheckOutputLines(
+		"WARN: PLIST.SunOS: This file is not used on any of the 2 platforms.",
+		"WARN: PLIST.linux-i386: This file is not used on any of the 2 platforms.")
+}
+
+func (s *Suite) Test_PlatformChecker_checkPlistConditions(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*", "Linux-*-x86_64"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		"PLIST_VARS+=\tlinux sunos doc undefined",
+		".if ${OPSYS} == Linux",
+		"PLIST.linux=\tyes",
+		".elif ${OPSYS} == SunOS",
+		"PLIST.sunos=\tyes",
+		".endif",
+		"PLIST.doc=\tyes")
+	t.CreateFileLines("PLIST",
+		PlistCvsID,
+		"${PLIST.linux}bin/linux-only",
+		"${PLIST.linux}bin/linux-only-2",
+		"${PLIST.sunos}bin/sunos-only",
+		"${PLIST.sunos}bin/sunos-only-2",
+		"${PLIST.doc}share/doc/package/README",
+		"${PLIST.undefined}bin/undefined")
+	ck.evaluateAll()
+
+	ck.checkPlistConditions()
+
+	// PLIST.undefined is not reported here since it is never set at all,
+	// which is already reported by PlistChecker.checkCond.
+	t.CheckOutputLines(
+		"WARN: PLIST:4: PLIST.sunos is not set on any of the 2 platforms.")
+}
+
+// If the name of a PLIST variable is computed,
+// it cannot be determined reliably on which platforms it is set.
+func (s *Suite) Test_PlatformChecker_checkPlistConditions__computed(c *check.C) {
+	t := s.Init(c)
+
+	ck := newPlatformCheckerTest(t, []string{"NetBSD-*-*"},
+		".include \"../../mk/bsd.prefs.mk\"",
+		"PLIST_VARS+=\tsunos",
+		".if ${OPSYS} == SunOS",
+		"PLIST.sunos=\tyes",
+		".endif",
+		"PLIST.${OPSYS:tl}=\tyes")
+	t.CreateFileLines("PLIST",
+		PlistCvsID,
+		"${PLIST.sunos}bin/sunos-only")
+	ck.evaluateAll()
+
+	ck.checkPlistConditions()
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_PlatformChecker_samePlatforms(c *check.C) {
+	t := s.Init(c)
+
+	ck := NewPlatformChecker(nil, nil, nil)
+	netbsd := Platform{"NetBSD", "", "", ""}
+	linux := Platform{"Linux", "", "", ""}
+
+	t.CheckEquals(ck.samePlatforms(nil, nil), true)
+	t.CheckEquals(ck.samePlatforms([]Platform{netbsd}, []Platform{netbsd}), true)
+	t.CheckEquals(ck.samePlatforms([]Platform{netbsd}, []Platform{linux}), false)
+	t.CheckEquals(ck.samePlatforms([]Platform{netbsd}, []Platform{netbsd, linux}), false)
+}
+
+func (s *Suite) Test_PlatformChecker_describe(c *check.C) {
+	t := s.Init(c)
+
+	netbsd := Platform{"NetBSD", "", "", ""}
+	linux := Platform{"Linux", "", "", ""}
+	sunos := Platform{"SunOS", "", "", ""}
+	ck := NewPlatformChecker(nil, nil, []Platform{netbsd, linux, sunos})
+
+	t.CheckEquals(ck.describe(nil), "none of the platforms")
+	t.CheckEquals(ck.describe([]Platform{linux}), "Linux-*-*")
+	t.CheckEquals(ck.describe([]Platform{linux, sunos}), "2 of 3 platforms, e.g. Linux-*-*")
+	t.CheckEquals(ck.describe([]Platform{netbsd, linux, sunos}), "all platforms")
+}
@@ -0,0 +1,159 @@
+package pkglint
+
+import "github.com/rillig/pkglint/v23/textproc"
+
+// PortabilityRegistry collects the command line options of the tools
+// that are not available on all platforms, such as the options that
+// only GNU sed or GNU find provide.
+//
+// Each project defines its own options, see Project.Portability.
+type PortabilityRegistry struct {
+	options map[string][]*ToolOption // tool name => options
+
+	// For the tools whose options end at the first operand,
+	// the single-letter options that take an argument.
+	argLetters map[string]string // tool name => option letters
+}
+
+func NewPortabilityRegistry() PortabilityRegistry {
+	return PortabilityRegistry{
+		make(map[string][]*ToolOption),
+		make(map[string]string)}
+}
+
+// ToolOption is a command line option of a tool that is not portable.
+type ToolOption struct {
+	Tool string // The name of the tool, such as "sed"
+
+	// The option, such as "-i", "--in-place" or "-printf".
+	//
+	// Options consisting of a single letter can be combined with other
+	// options, as in "sed -ni".
+	Option string
+
+	// The pkgsrc tool that provides the GNU implementation, such as "gsed".
+	// If the package uses this tool, the option can be used.
+	GnuTool string
+
+	// How to achieve the same effect portably.
+	Instead string
+}
+
+func (reg *PortabilityRegistry) Define(tool, option, gnuTool, instead string) {
+	opt := ToolOption{tool, option, gnuTool, instead}
+	reg.options[tool] = append(reg.options[tool], &opt)
+}
+
+// Options returns the options of the tool that are not portable.
+func (reg *PortabilityRegistry) Options(tool string) []*ToolOption {
+	return reg.options[tool]
+}
+
+// DefineArgLetters declares that the options of the tool end at the
+// first operand, as in "xargs rm -rf", where "-rf" is not an option
+// of xargs.
+//
+// The letters are the single-letter options that take an argument,
+// such as "ef" for sed, since that argument is not an operand.
+func (reg *PortabilityRegistry) DefineArgLetters(tool, letters string) {
+	reg.argLetters[tool] = letters
+}
+
+// ArgLetters returns the single-letter options of the tool that take
+// an argument, and whether the options of the tool end at the first
+// operand.
+func (reg *PortabilityRegistry) ArgLetters(tool string) (string, bool) {
+	letters, optionsFirst := reg.argLetters[tool]
+	return letters, optionsFirst
+}
+
+// Init defines the options of the common tools that are not portable.
+func (reg *PortabilityRegistry) Init() {
+	sedInPlace := "Write to a temporary file and move it back instead, or use the SUBST framework."
+	reg.Define("sed", "-i", "gsed", sedInPlace)
+	reg.Define("sed", "--in-place", "gsed", sedInPlace)
+	reg.Define("sed", "-r", "gsed", "Use -E instead.")
+	reg.Define("sed", "--regexp-extended", "gsed", "Use -E instead.")
+	reg.Define("sed", "-z", "gsed", "")
+
+	reg.Define("grep", "-P", "ggrep", "Use -E instead.")
+	reg.Define("grep", "--perl-regexp", "ggrep", "Use -E instead.")
+
+	reg.Define("find", "-printf", "", "Use -exec with printf or stat instead.")
+	reg.Define("find", "-regextype", "", "Use -name or -path instead.")
+	reg.Define("find", "-wholename", "", "Use -path instead.")
+	reg.Define("find", "-executable", "", "Use -perm instead.")
+
+	reg.Define("xargs", "-r", "", "Make sure that the input is not empty instead.")
+	reg.Define("xargs", "--no-run-if-empty", "", "Make sure that the input is not empty instead.")
+	reg.Define("xargs", "-d", "", "Convert the delimiters to newlines using tr instead.")
+
+	reg.Define("cp", "-a", "", "Use -R -p instead.")
+	reg.Define("cp", "--archive", "", "Use -R -p instead.")
+	reg.Define("cp", "--parents", "", "Create the directories using mkdir -p instead.")
+	reg.Define("cp", "-t", "", "Put the target directory at the end instead.")
+
+	reg.Define("install", "-D", "", "Add the directory to INSTALLATION_DIRS instead.")
+	reg.Define("install", "-t", "", "Put the target directory at the end instead.")
+
+	reg.Define("tar", "--transform", "gtar", "Use -s instead.")
+	reg.Define("tar", "--wildcards", "gtar", "")
+
+	reg.Define("date", "-d", "", "Only GNU date can parse dates.")
+	reg.Define("date", "--date", "", "Only GNU date can parse dates.")
+
+	reg.Define("stat", "-c", "", "Use ls or find instead.")
+	reg.Define("stat", "--format", "", "Use ls or find instead.")
+	reg.Define("stat", "--printf", "", "Use ls or find instead.")
+
+	reg.Define("readlink", "-f", "", "Use cd and pwd -P instead.")
+	reg.Define("readlink", "-e", "", "Use cd and pwd -P instead.")
+	reg.Define("readlink", "-m", "", "Use cd and pwd -P instead.")
+	reg.Define("readlink", "--canonicalize", "", "Use cd and pwd -P instead.")
+
+	reg.Define("mktemp", "--tmpdir", "", "Use a template like ${WRKDIR}/tmp.XXXXXX instead.")
+	reg.Define("mktemp", "--suffix", "", "Use a template like ${WRKDIR}/tmp.XXXXXX instead.")
+
+	reg.Define("sort", "-V", "", "Sort the components of the version numbers using -t. -n instead.")
+	reg.Define("sort", "--version-sort", "", "Sort the components of the version numbers using -t. -n instead.")
+
+	reg.Define("ln", "-r", "", "Pass the relative path to ln -s instead.")
+	reg.Define("ln", "--relative", "", "Pass the relative path to ln -s instead.")
+
+	reg.Define("mkdir", "--parents", "", "Use -p instead.")
+
+	reg.Define("echo", "-e", "", "Use printf instead.")
+
+	reg.DefineArgLetters("sed", "efl")
+	reg.DefineArgLetters("grep", "ABCDdefm")
+	reg.DefineArgLetters("xargs", "EIJLnPRsS")
+	reg.DefineArgLetters("cp", "St")
+	reg.DefineArgLetters("install", "BfgmoSt")
+	reg.DefineArgLetters("date", "dfrv")
+	reg.DefineArgLetters("stat", "cft")
+	reg.DefineArgLetters("readlink", "")
+	reg.DefineArgLetters("mktemp", "p")
+	reg.DefineArgLetters("sort", "koSTt")
+	reg.DefineArgLetters("ln", "St")
+	reg.DefineArgLetters("mkdir", "m")
+	reg.DefineArgLetters("echo", "")
+}
+
+// Matches tests whether the command line argument uses the option.
+func (opt *ToolOption) Matches(arg string) bool {
+	if len(opt.Option) == 2 && opt.Option[1] != '-' {
+		if len(arg) < 2 || arg[0] != '-' || arg[1] == '-' {
+			return false
+		}
+
+		// In "sed -ni", the i is an option, but in "sed -es/n/i/", it is not.
+		for i := 1; i < len(arg) && textproc.Alpha.Contains(arg[i]); i++ {
+			if arg[i] == opt.Option[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	return arg == opt.Option || hasPrefix(arg, opt.Option+"=")
+}
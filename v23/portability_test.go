@@ -0,0 +1,109 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_NewPortabilityRegistry(c *check.C) {
+	t := s.Init(c)
+
+	reg := NewPortabilityRegistry()
+
+	t.CheckLen(reg.Options("sed"), 0)
+}
+
+func (s *Suite) Test_PortabilityRegistry_Define(c *check.C) {
+	t := s.Init(c)
+
+	reg := NewPortabilityRegistry()
+	reg.Define("tool", "-x", "gtool", "Use -y instead.")
+	reg.Define("tool", "--long", "", "")
+
+	t.CheckDeepEquals(reg.Options("tool"), []*ToolOption{
+		{"tool", "-x", "gtool", "Use -y instead."},
+		{"tool", "--long", "", ""}})
+}
+
+func (s *Suite) Test_PortabilityRegistry_Options(c *check.C) {
+	t := s.Init(c)
+
+	reg := NewPortabilityRegistry()
+	reg.Define("tool", "-x", "", "")
+
+	t.CheckLen(reg.Options("tool"), 1)
+	t.CheckLen(reg.Options("other"), 0)
+}
+
+func (s *Suite) Test_PortabilityRegistry_DefineArgLetters(c *check.C) {
+	t := s.Init(c)
+
+	reg := NewPortabilityRegistry()
+	reg.DefineArgLetters("tool", "ef")
+
+	t.CheckDeepEquals(reg.argLetters, map[string]string{"tool": "ef"})
+}
+
+func (s *Suite) Test_PortabilityRegistry_ArgLetters(c *check.C) {
+	t := s.Init(c)
+
+	reg := NewPortabilityRegistry()
+	reg.DefineArgLetters("tool", "ef")
+	reg.DefineArgLetters("plain", "")
+
+	test := func(tool string, letters string, optionsFirst bool) {
+		actualLetters, actualOptionsFirst := reg.ArgLetters(tool)
+		t.CheckEquals(actualLetters, letters)
+		t.CheckEquals(actualOptionsFirst, optionsFirst)
+	}
+
+	test("tool", "ef", true)
+	test("plain", "", true)
+	test("other", "", false)
+}
+
+func (s *Suite) Test_PortabilityRegistry_Init(c *check.C) {
+	t := s.Init(c)
+
+	reg := NewPortabilityRegistry()
+	reg.Init()
+
+	t.CheckDeepEquals(reg.Options("sed")[0], &ToolOption{"sed", "-i", "gsed",
+		"Write to a temporary file and move it back instead, or use the SUBST framework."})
+	t.CheckLen(reg.Options("cat"), 0)
+
+	// Each option either has a portable replacement, or there is
+	// a GNU tool that provides it.
+	for _, options := range reg.options {
+		for _, opt := range options {
+			t.CheckEquals(opt.Instead != "" || opt.GnuTool != "", true)
+		}
+	}
+}
+
+func (s *Suite) Test_ToolOption_Matches(c *check.C) {
+	t := s.Init(c)
+
+	test := func(option, arg string, expected bool) {
+		opt := ToolOption{"tool", option, "", ""}
+		t.CheckEquals(opt.Matches(arg), expected)
+	}
+
+	test("-i", "-i", true)
+	test("-i", "-i.bak", true)
+	test("-i", "-ni", true)
+	test("-i", "-n", false)
+	test("-i", "i", false)
+	test("-i", "-", false)
+	test("-i", "--in-place", false)
+
+	// The letters after an option argument are not options.
+	test("-i", "-es/n/i/", false)
+
+	test("--in-place", "--in-place", true)
+	test("--in-place", "--in-place=.bak", true)
+	test("--in-place", "--in-placeholder", false)
+
+	// The options of find consist of several letters,
+	// even though they start with a single hyphen.
+	test("-printf", "-printf", true)
+	test("-printf", "-print", false)
+	test("-printf", "-p", false)
+}
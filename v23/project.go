@@ -15,16 +15,24 @@ type Project interface {
 
 	// Types determines the types of variables.
 	Types() *VarTypeRegistry
+
+	// Portability determines the command line options of the tools
+	// that are not available on all platforms.
+	Portability() *PortabilityRegistry
 }
 
 type NetBSDProject struct {
-	types VarTypeRegistry
+	types       VarTypeRegistry
+	portability PortabilityRegistry
 }
 
 func NewNetBSDProject() *NetBSDProject {
-	return &NetBSDProject{
+	p := NetBSDProject{
 		NewVarTypeRegistry(),
+		NewPortabilityRegistry(),
 	}
+	p.portability.Init()
+	return &p
 }
 
 func (p NetBSDProject) Deprecated(string) string {
@@ -34,3 +42,7 @@ func (p NetBSDProject) Deprecated(string) string {
 func (p NetBSDProject) Types() *VarTypeRegistry {
 	return &p.types
 }
+
+func (p *NetBSDProject) Portability() *PortabilityRegistry {
+	return &p.portability
+}
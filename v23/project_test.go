@@ -33,3 +33,33 @@ func (s *Suite) Test_NetBSDProject_Types(c *check.C) {
 	t.CheckEquals(project.Types().Canon("VAR").basicType, BtUnknown)
 	t.CheckEquals(project.Types().Canon("UNDEFINED"), (*Vartype)(nil))
 }
+
+func (s *Suite) Test_NetBSDProject_Portability(c *check.C) {
+	t := s.Init(c)
+
+	project := NewNetBSDProject()
+
+	t.CheckEquals(project.Portability(), project.Portability())
+	t.CheckEquals(len(project.Portability().Options("sed")) > 0, true)
+	t.CheckEquals(len(project.Portability().Options("unknown")), 0)
+}
+
+// Outside pkgsrc, the options of the tools are checked as well.
+func (s *Suite) Test_NetBSDProject_Portability__outside_pkgsrc(c *check.C) {
+	t := s.Init(c)
+
+	G.Pkgsrc = nil
+	G.Project = NewNetBSDProject()
+	mklines := t.NewMkLines("filename.mk",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\tsed -i -e s,from,to, file")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: filename.mk:4: Unknown shell command \"sed\".",
+		"WARN: filename.mk:4: The option \"-i\" of sed is not portable. "+
+			"Write to a temporary file and move it back instead, or use the SUBST framework.")
+}
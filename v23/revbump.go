@@ -0,0 +1,208 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/getopt"
+	"sort"
+	"strconv"
+)
+
+// Revbump finds the packages that include the buildlink3.mk file of a
+// given package, directly or indirectly.
+// When the given package changes its ABI, the PKGREVISION of all these
+// packages needs to be bumped.
+//
+// See "pkglint revbump".
+type Revbump struct {
+	Target     PkgsrcPath // The package that has changed, e.g. "devel/lib".
+	Dependents []*Package
+}
+
+func NewRevbump(target PkgsrcPath) *Revbump {
+	return &Revbump{target, nil}
+}
+
+// AddPackage loads the package from the given directory and remembers it
+// if it includes the buildlink3.mk file of the target package.
+func (r *Revbump) AddPackage(dir CurrPath) {
+	if trace.Tracing {
+		defer trace.Call(dir)()
+	}
+
+	pkg := NewPackage(dir)
+	if pkg.Pkgpath == r.Target {
+		return
+	}
+	files, _, _ := pkg.load()
+	if files == nil {
+		return
+	}
+	if r.includes(pkg, r.Target) {
+		r.Dependents = append(r.Dependents, pkg)
+	}
+}
+
+// includes returns whether the package includes the buildlink3.mk file
+// of the other package, directly or indirectly.
+func (r *Revbump) includes(pkg *Package, other PkgsrcPath) bool {
+	bl3 := pkg.Rel(G.Pkgsrc.File(other.JoinNoClean("buildlink3.mk")))
+	return pkg.included.Seen(bl3)
+}
+
+// Sort orders the dependents so that each package comes after all the
+// dependents whose buildlink3.mk file it includes.
+//
+// Since the included files contain the indirect inclusions as well,
+// a package that includes the buildlink3.mk file of another dependent
+// always includes more dependents than that other dependent.
+func (r *Revbump) Sort() {
+	included := make(map[*Package]int)
+	for _, pkg := range r.Dependents {
+		for _, other := range r.Dependents {
+			if other != pkg && r.includes(pkg, other.Pkgpath) {
+				included[pkg]++
+			}
+		}
+	}
+
+	sort.SliceStable(r.Dependents, func(i, j int) bool {
+		pi, pj := r.Dependents[i], r.Dependents[j]
+		if included[pi] != included[pj] {
+			return included[pi] < included[pj]
+		}
+		return pi.Pkgpath < pj.Pkgpath
+	})
+}
+
+// Bump increments the PKGREVISION in the file that defines it,
+// which is usually the package Makefile, but may also be an included file
+// such as Makefile.common.
+// If the package doesn't have a PKGREVISION yet, it is added to the
+// package Makefile.
+//
+// The changes are only written to disk in --autofix mode.
+func (r *Revbump) Bump(pkg *Package) {
+	mklines := pkg.Makefile
+
+	if first := pkg.vars.FirstDefinition("PKGREVISION"); first != nil {
+		last := pkg.vars.LastDefinition("PKGREVISION")
+		if first.Filename() != last.Filename() {
+			G.Logger.TechErrorf(mklines.lines.Filename,
+				"Cannot bump PKGREVISION automatically since it is defined in %s and %s.",
+				pkg.Rel(first.Filename()), pkg.Rel(last.Filename()))
+			return
+		}
+		if first.Filename() != mklines.lines.Filename {
+			mklines = LoadMk(first.Filename(), pkg, MustSucceed)
+		}
+	}
+
+	var pkgrevisions []*MkLine
+	var anchor *MkLine
+	for _, mkline := range mklines.mklines {
+		if !mkline.IsVarassign() {
+			continue
+		}
+		switch mkline.Varname() {
+		case "PKGREVISION":
+			pkgrevisions = append(pkgrevisions, mkline)
+		case "CATEGORIES":
+			if anchor == nil {
+				anchor = mkline
+			}
+		}
+	}
+
+	switch {
+	case len(pkgrevisions) == 1:
+		mkline := pkgrevisions[0]
+		value := mkline.Value()
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || mkline.Op() != opAssign {
+			G.Logger.TechErrorf(mkline.Location.Filename,
+				"Cannot bump PKGREVISION %q automatically.", value)
+			return
+		}
+
+		fix := mkline.Autofix()
+		fix.Notef("PKGREVISION is bumped from %s to %d.", value, n+1)
+		fix.ReplaceAfter(mkline.ValueAlign(), value, strconv.Itoa(n+1))
+		fix.Apply()
+
+	case len(pkgrevisions) > 1:
+		G.Logger.TechErrorf(mklines.lines.Filename,
+			"Cannot bump PKGREVISION automatically since it is defined %d times.",
+			len(pkgrevisions))
+		return
+
+	case anchor == nil:
+		G.Logger.TechErrorf(mklines.lines.Filename,
+			"Cannot add PKGREVISION automatically since CATEGORIES is not defined.")
+		return
+
+	default:
+		// See VarorderChecker, PKGREVISION comes directly before CATEGORIES.
+		fix := anchor.Autofix()
+		fix.Notef("PKGREVISION is added.")
+		fix.InsertAbove("PKGREVISION=\t1")
+		fix.Apply()
+	}
+
+	mklines.SaveAutofixChanges()
+}
+
+// mainRevbump implements "pkglint revbump", which lists the packages
+// that depend on the buildlink3.mk file of the given package,
+// in the order in which they need to be rebuilt.
+// In --autofix mode, it also bumps their PKGREVISION.
+func mainRevbump(args []string) int {
+	p := &G
+	opts := getopt.NewOptions()
+	var target string
+	opts.AddStrVar('f', "for", &target, "", "the package whose dependents are listed")
+	opts.AddFlagVar('F', "autofix", &p.Logger.Opts.Autofix, false, "bump PKGREVISION in the dependents")
+
+	usage := "pkglint revbump --for category/package [options] dir..."
+	if exitCode := p.parseCommandArgs(opts, args, usage); exitCode != -1 {
+		return exitCode
+	}
+
+	p.prepareMainLoop()
+	if p.Pkgsrc == nil {
+		G.Logger.TechFatalf(p.Todo.Front(), "Must be inside a pkgsrc tree.")
+	}
+
+	// The package is usually given relative to the pkgsrc root,
+	// as in "devel/lib", but an absolute directory works as well.
+	var targetPath PkgsrcPath
+	if NewPath(target).IsAbs() {
+		targetPath = G.Pkgsrc.Rel(NewCurrPathString(target))
+	} else {
+		targetPath = NewPkgsrcPath(NewPath(target).CleanPath())
+	}
+	if target == "" || !G.Pkgsrc.File(targetPath.JoinNoClean("buildlink3.mk")).IsFile() {
+		p.Logger.TechErrorf("", "The package %q must have a buildlink3.mk file.", target)
+		return 1
+	}
+
+	r := NewRevbump(targetPath)
+	for !p.Todo.IsEmpty() {
+		for _, dir := range p.packageDirs(p.Todo.Pop()) {
+			r.AddPackage(dir)
+		}
+	}
+
+	r.Sort()
+	for _, pkg := range r.Dependents {
+		p.Logger.out.WriteLine(pkg.Pkgpath.String())
+	}
+	if p.Logger.Opts.Autofix {
+		for _, pkg := range r.Dependents {
+			r.Bump(pkg)
+		}
+	}
+
+	if p.Logger.errors != 0 {
+		return 1
+	}
+	return 0
+}
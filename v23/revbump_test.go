@@ -0,0 +1,371 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_NewRevbump(c *check.C) {
+	t := s.Init(c)
+
+	r := NewRevbump("devel/lib")
+
+	t.CheckEquals(r.Target, PkgsrcPath("devel/lib"))
+	t.CheckLen(r.Dependents, 0)
+}
+
+func (s *Suite) Test_Revbump_AddPackage(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("devel/lib")
+	t.CreateFileBuildlink3("devel/lib/buildlink3.mk")
+	t.SetUpPackage("devel/direct",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.CreateFileBuildlink3("devel/direct/buildlink3.mk",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.SetUpPackage("devel/indirect",
+		".include \"../../devel/direct/buildlink3.mk\"")
+	t.SetUpPackage("devel/unrelated")
+	t.FinishSetUp()
+
+	r := NewRevbump("devel/lib")
+	r.AddPackage(t.File("devel/direct"))
+	r.AddPackage(t.File("devel/indirect"))
+	r.AddPackage(t.File("devel/lib"))
+	r.AddPackage(t.File("devel/unrelated"))
+
+	var pkgpaths []PkgsrcPath
+	for _, pkg := range r.Dependents {
+		pkgpaths = append(pkgpaths, pkg.Pkgpath)
+	}
+	t.CheckDeepEquals(pkgpaths, []PkgsrcPath{"devel/direct", "devel/indirect"})
+}
+
+func (s *Suite) Test_Revbump_AddPackage__missing_Makefile(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("devel/lib")
+	t.Remove("devel/lib/Makefile")
+	t.FinishSetUp()
+
+	r := NewRevbump("devel/other")
+	r.AddPackage(t.File("devel/lib"))
+
+	t.CheckLen(r.Dependents, 0)
+	t.CheckOutputLines(
+		"ERROR: ~/devel/lib/Makefile: Cannot be read.")
+}
+
+func (s *Suite) Test_Revbump_includes(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.CreateFileBuildlink3("devel/lib/buildlink3.mk")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+	r := NewRevbump("devel/lib")
+
+	t.CheckEquals(r.includes(pkg, "devel/lib"), true)
+	t.CheckEquals(r.includes(pkg, "devel/other"), false)
+}
+
+func (s *Suite) Test_Revbump_Sort(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileBuildlink3("devel/lib/buildlink3.mk")
+	t.CreateFileBuildlink3("devel/b/buildlink3.mk",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.CreateFileBuildlink3("devel/c/buildlink3.mk",
+		".include \"../../devel/b/buildlink3.mk\"")
+	t.SetUpPackage("devel/a",
+		".include \"../../devel/c/buildlink3.mk\"")
+	t.SetUpPackage("devel/b",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.SetUpPackage("devel/c",
+		".include \"../../devel/b/buildlink3.mk\"")
+	t.SetUpPackage("devel/d",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.FinishSetUp()
+
+	r := NewRevbump("devel/lib")
+	r.AddPackage(t.File("devel/a"))
+	r.AddPackage(t.File("devel/b"))
+	r.AddPackage(t.File("devel/c"))
+	r.AddPackage(t.File("devel/d"))
+	r.Sort()
+
+	var pkgpaths []PkgsrcPath
+	for _, pkg := range r.Dependents {
+		pkgpaths = append(pkgpaths, pkg.Pkgpath)
+	}
+	t.CheckDeepEquals(pkgpaths, []PkgsrcPath{
+		"devel/b", "devel/d", "devel/c", "devel/a"})
+}
+
+func (s *Suite) Test_Revbump_Bump(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.SetUpPackage("category/package",
+		"PKGREVISION=\t3")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+	NewRevbump("devel/lib").Bump(pkg)
+
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/package/Makefile:20: Replacing \"3\" with \"4\".")
+	t.CheckFileLinesDetab("category/package/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=       package-1.0",
+		"#PKGNAME=       package-1.0",
+		"CATEGORIES=     category",
+		"MASTER_SITES=   # none",
+		"",
+		"MAINTAINER=     pkgsrc-users@NetBSD.org",
+		"HOMEPAGE=       # none",
+		"COMMENT=        Dummy package",
+		"LICENSE=        2-clause-bsd",
+		"",
+		".include \"suppress-varorder.mk\"",
+		"",
+		"# filler",
+		"# filler",
+		"# filler",
+		"# filler",
+		"",
+		"PKGREVISION=    4",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+}
+
+func (s *Suite) Test_Revbump_Bump__insert(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.SetUpPackage("category/package")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+	NewRevbump("devel/lib").Bump(pkg)
+
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/package/Makefile:5: " +
+			"Inserting a line \"PKGREVISION=\\t1\" above this line.")
+	t.CheckFileLinesDetab("category/package/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=       package-1.0",
+		"#PKGNAME=       package-1.0",
+		"PKGREVISION=    1",
+		"CATEGORIES=     category",
+		"MASTER_SITES=   # none",
+		"",
+		"MAINTAINER=     pkgsrc-users@NetBSD.org",
+		"HOMEPAGE=       # none",
+		"COMMENT=        Dummy package",
+		"LICENSE=        2-clause-bsd",
+		"",
+		".include \"suppress-varorder.mk\"",
+		"",
+		"# filler",
+		"# filler",
+		"# filler",
+		"# filler",
+		"",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+}
+
+func (s *Suite) Test_Revbump_Bump__included(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.SetUpPackage("category/package",
+		".include \"../../category/common/Makefile.common\"")
+	t.CreateFileLines("category/common/Makefile.common",
+		MkCvsID,
+		"# used by category/package/Makefile",
+		"",
+		"PKGREVISION=\t3")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+	NewRevbump("devel/lib").Bump(pkg)
+
+	// The PKGREVISION is bumped in the file that defines it,
+	// instead of adding a second one to the package Makefile.
+	t.CheckOutputLines(
+		"AUTOFIX: ~/category/common/Makefile.common:4: Replacing \"3\" with \"4\".")
+	t.CheckFileLines("category/common/Makefile.common",
+		MkCvsID,
+		"# used by category/package/Makefile",
+		"",
+		"PKGREVISION=\t4")
+	t.CheckFileLinesDetab("category/package/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=       package-1.0",
+		"#PKGNAME=       package-1.0",
+		"CATEGORIES=     category",
+		"MASTER_SITES=   # none",
+		"",
+		"MAINTAINER=     pkgsrc-users@NetBSD.org",
+		"HOMEPAGE=       # none",
+		"COMMENT=        Dummy package",
+		"LICENSE=        2-clause-bsd",
+		"",
+		".include \"suppress-varorder.mk\"",
+		"",
+		"# filler",
+		"# filler",
+		"# filler",
+		"# filler",
+		"",
+		".include \"../../category/common/Makefile.common\"",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+}
+
+func (s *Suite) Test_Revbump_Bump__show_autofix(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--show-autofix")
+	t.SetUpPackage("category/package",
+		"PKGREVISION=\t3")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, _ = pkg.load()
+	NewRevbump("devel/lib").Bump(pkg)
+
+	t.CheckOutputLines(
+		"NOTE: ~/category/package/Makefile:20: PKGREVISION is bumped from 3 to 4.",
+		"AUTOFIX: ~/category/package/Makefile:20: Replacing \"3\" with \"4\".")
+	t.CheckFileLinesDetab("category/package/Makefile",
+		MkCvsID,
+		"",
+		"DISTNAME=       package-1.0",
+		"#PKGNAME=       package-1.0",
+		"CATEGORIES=     category",
+		"MASTER_SITES=   # none",
+		"",
+		"MAINTAINER=     pkgsrc-users@NetBSD.org",
+		"HOMEPAGE=       # none",
+		"COMMENT=        Dummy package",
+		"LICENSE=        2-clause-bsd",
+		"",
+		".include \"suppress-varorder.mk\"",
+		"",
+		"# filler",
+		"# filler",
+		"# filler",
+		"# filler",
+		"",
+		"PKGREVISION=    3",
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+}
+
+func (s *Suite) Test_Revbump_Bump__errors(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--autofix")
+	t.SetUpPackage("category/expr",
+		"PKGREVISION=\t${REV}")
+	t.SetUpPackage("category/twice",
+		"PKGREVISION=\t1",
+		"PKGREVISION=\t2")
+	t.SetUpPackage("category/split",
+		"PKGREVISION=\t1",
+		".include \"Makefile.common\"")
+	t.CreateFileLines("category/split/Makefile.common",
+		MkCvsID,
+		"",
+		"PKGREVISION=\t2")
+	t.SetUpPackage("category/nocat")
+	t.CreateFileLines("category/nocat/Makefile",
+		MkCvsID,
+		"",
+		".include \"../../mk/bsd.pkg.mk\"")
+	t.FinishSetUp()
+
+	for _, pkgpath := range []RelPath{"category/expr", "category/twice", "category/split", "category/nocat"} {
+		pkg := NewPackage(t.File(pkgpath))
+		_, _, _ = pkg.load()
+		NewRevbump("devel/lib").Bump(pkg)
+	}
+
+	t.CheckOutputLines(
+		"ERROR: ~/category/expr/Makefile: Cannot bump PKGREVISION \"${REV}\" automatically.",
+		"ERROR: ~/category/twice/Makefile: "+
+			"Cannot bump PKGREVISION automatically since it is defined 2 times.",
+		"ERROR: ~/category/split/Makefile: "+
+			"Cannot bump PKGREVISION automatically since it is defined in Makefile and Makefile.common.",
+		"ERROR: ~/category/nocat/Makefile: "+
+			"Cannot add PKGREVISION automatically since CATEGORIES is not defined.")
+}
+
+func (s *Suite) Test_mainRevbump(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("devel/lib")
+	t.CreateFileBuildlink3("devel/lib/buildlink3.mk")
+	t.SetUpPackage("category/package",
+		".include \"../../devel/lib/buildlink3.mk\"")
+	t.SetUpPackage("category/other")
+
+	exitCode := t.Main("revbump", "--for", "devel/lib", "category")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"category/package")
+}
+
+func (s *Suite) Test_mainRevbump__autofix(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("devel/lib")
+	t.CreateFileBuildlink3("devel/lib/buildlink3.mk")
+	t.SetUpPackage("category/package",
+		".include \"../../devel/lib/buildlink3.mk\"")
+
+	exitCode := t.Main("revbump", "--for=devel/lib", "--autofix", "category/package")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"category/package",
+		"AUTOFIX: ~/category/package/Makefile:5: "+
+			"Inserting a line \"PKGREVISION=\\t1\" above this line.")
+}
+
+func (s *Suite) Test_mainRevbump__missing_buildlink3(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("devel/lib")
+
+	exitCode := t.Main("revbump", "--for=devel/lib", "devel")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"ERROR: The package \"devel/lib\" must have a buildlink3.mk file.")
+}
+
+func (s *Suite) Test_mainRevbump__help(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("revbump", "--help")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"usage: pkglint revbump --for category/package [options] dir...",
+		"",
+		"  -f, --for       the package whose dependents are listed",
+		"  -F, --autofix   bump PKGREVISION in the dependents",
+		"  -d, --debug     log verbose call traces for debugging",
+		"  -h, --help      show a detailed usage message")
+}
@@ -29,6 +29,7 @@ type scopeVar struct {
 	fallback       string
 	usedAtLoadTime bool
 	indeterminate  bool
+	assigned       bool // Whether the value comes from an assignment.
 }
 
 func NewScope() Scope {
@@ -89,6 +90,9 @@ func (s *Scope) def(name string, mkline *MkLine) {
 		return
 	}
 
+	assigned := v.assigned
+	v.assigned = true
+
 	switch mkline.Op() {
 	case opAssignAppend:
 		value := mkline.Value()
@@ -96,7 +100,13 @@ func (s *Scope) def(name string, mkline *MkLine) {
 			trace.Stepf("Scope.Define.append %s: %s = %q + %q",
 				mkline.String(), name, v.value, value)
 		}
-		v.value += " " + value
+		// Like in bmake, appending to an undefined variable defines it
+		// without a leading space.
+		if assigned {
+			v.value += " " + value
+		} else {
+			v.value = value
+		}
 	case opAssignDefault:
 		if v.value == "" && !v.indeterminate {
 			v.value = mkline.Value()
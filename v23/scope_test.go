@@ -125,6 +125,19 @@ func (s *Suite) Test_Scope_def(c *check.C) {
 	t.CheckNil(scope.FirstDefinition("VAR.*"))
 }
 
+// In a .for loop, the same line appends to the variable several times.
+func (s *Suite) Test_Scope_def__append_same_line(c *check.C) {
+	t := s.Init(c)
+
+	scope := NewScope()
+	mkline := t.NewMkLine("filename.mk", 3, "VAR+=\tvalue")
+
+	scope.def("VAR", mkline)
+	scope.def("VAR", mkline)
+
+	t.CheckEquals(scope.LastValue("VAR"), "value value")
+}
+
 func (s *Suite) Test_Scope_Fallback(c *check.C) {
 	t := s.Init(c)
 
@@ -0,0 +1,647 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/textproc"
+	"strings"
+)
+
+// SedCommand is a single command from a sed script.
+//
+// Examples:
+//
+//	s,from,to,g
+//	/^#/d
+//	1,/^$/!p
+//	y/abc/ABC/
+type SedCommand struct {
+	// The text of the command, including the addresses.
+	Text string
+
+	// The addresses, such as "1", "$$" or "/regex/".
+	// There are at most 2 addresses.
+	// GNU sed also allows "first~step" and, as the second address,
+	// "+lines" and "~multiple".
+	Addrs   []string
+	Negated bool
+
+	// The command, such as 's', 'd' or '{'.
+	Name byte
+
+	// For the s and y commands, the delimiter and the text between
+	// the delimiters, which still contains the escaped delimiters.
+	Delim       byte
+	Pattern     string
+	Replacement string
+	Flags       string
+
+	// For the a, i and c commands, the text to be output.
+	// For the b, t, r, w and : commands, the label or the filename.
+	Arg string
+
+	// For the a, i and c commands, whether the text is on the same
+	// line as the command, which is a GNU extension.
+	OneLine bool
+}
+
+// SedParser splits a sed script into its commands.
+//
+// The script is given as it appears in the makefile, after removing
+// the shell quotes. Therefore, it may contain expressions like ${VAR}
+// and shell variables like $${var}, which are treated as opaque text.
+//
+// See https://pubs.opengroup.org/onlinepubs/9699919799/utilities/sed.html.
+type SedParser struct {
+	lexer *textproc.Lexer
+
+	// Whether $$var and $${var} are shell variables.
+	// In single quotes, they are literal text instead.
+	shellVars bool
+}
+
+func NewSedParser(script string) *SedParser {
+	return &SedParser{textproc.NewLexer(script), true}
+}
+
+// Script parses the commands of the sed script,
+// up to the first syntax error, see Rest.
+func (p *SedParser) Script() []*SedCommand {
+	var cmds []*SedCommand
+
+	lexer := p.lexer
+	for {
+		lexer.SkipBytesFunc(func(b byte) bool { return b == ' ' || b == '\t' || b == '\n' || b == ';' })
+		if lexer.EOF() {
+			break
+		}
+
+		mark := lexer.Mark()
+
+		// An expression or a shell variable may contain whole commands.
+		// A plain $$ followed by a letter is rather the address of the
+		// last line, as in $$d.
+		rest := lexer.Rest()
+		if (!hasPrefix(rest, "$$") || hasPrefix(rest, "$${")) && p.skipExpr() {
+			lexer.SkipHspace()
+			if lexer.EOF() || lexer.PeekByte() == ';' || lexer.PeekByte() == '\n' {
+				continue
+			}
+			lexer.Reset(mark)
+		}
+
+		cmd := p.command()
+		if cmd == nil {
+			lexer.Reset(mark)
+			break
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds
+}
+
+// Rest returns the part of the script that could not be parsed.
+func (p *SedParser) Rest() string { return p.lexer.Rest() }
+
+func (p *SedParser) command() *SedCommand {
+	lexer := p.lexer
+	mark := lexer.Mark()
+	var cmd SedCommand
+
+	if addr := p.address(); addr != "" {
+		cmd.Addrs = append(cmd.Addrs, addr)
+		if lexer.SkipByte(',') {
+			addr2 := p.address()
+			if addr2 == "" && (lexer.PeekByte() == '+' || lexer.PeekByte() == '~') {
+				addr2Mark := lexer.Mark()
+				lexer.Skip(1)
+				if lexer.NextBytesSet(textproc.Digit) != "" {
+					addr2 = lexer.Since(addr2Mark)
+				}
+			}
+			if addr2 == "" {
+				return nil
+			}
+			cmd.Addrs = append(cmd.Addrs, addr2)
+		}
+	}
+
+	lexer.SkipHspace()
+	if lexer.SkipByte('!') {
+		cmd.Negated = true
+		lexer.SkipHspace()
+	}
+
+	if lexer.EOF() {
+		return nil
+	}
+	cmd.Name = lexer.NextByte()
+
+	switch cmd.Name {
+	case 's', 'y':
+		if lexer.EOF() || lexer.PeekByte() == '\\' || lexer.PeekByte() == '\n' {
+			return nil
+		}
+		cmd.Delim = lexer.NextByte()
+		pattern, ok1 := p.delimited(cmd.Delim)
+		replacement, ok2 := p.delimited(cmd.Delim)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		cmd.Pattern = pattern
+		cmd.Replacement = replacement
+		if cmd.Name == 's' {
+			cmd.Flags = lexer.NextBytesSet(textproc.NewByteSet("0-9gpIiMme"))
+			if lexer.SkipByte('w') {
+				cmd.Flags += "w"
+				lexer.SkipHspace()
+				cmd.Arg = lexer.NextBytesFunc(func(b byte) bool { return b != '\n' })
+			}
+		}
+
+	case 'a', 'i', 'c':
+		p.text(&cmd)
+
+	case 'b', 't', ':', 'r', 'w':
+		lexer.SkipHspace()
+		cmd.Arg = lexer.NextBytesFunc(func(b byte) bool { return b != '\n' && b != ';' && b != '}' })
+
+	case '#':
+		lexer.NextBytesFunc(func(b byte) bool { return b != '\n' })
+
+	case '{', '}', '=', 'd', 'D', 'g', 'G', 'h', 'H', 'l', 'n', 'N', 'p', 'P', 'q', 'x':
+		break
+
+	default:
+		return nil
+	}
+
+	lexer.SkipHspace()
+	if !lexer.EOF() && cmd.Name != '{' && !strings.Contains(";\n}", lexer.Rest()[:1]) {
+		return nil
+	}
+
+	cmd.Text = lexer.Since(mark)
+	return &cmd
+}
+
+// address parses a line number, the last line "$$",
+// or a regular expression like "/regex/" or "\,regex,".
+// It also parses the GNU form "first~step".
+func (p *SedParser) address() string {
+	lexer := p.lexer
+	mark := lexer.Mark()
+
+	switch {
+	case lexer.NextBytesSet(textproc.Digit) != "":
+		stepMark := lexer.Mark()
+		if lexer.SkipByte('~') && lexer.NextBytesSet(textproc.Digit) == "" {
+			lexer.Reset(stepMark)
+		}
+
+	case lexer.SkipString("$$"),
+		p.skipExpr():
+		break
+
+	case lexer.SkipByte('/'):
+		if _, ok := p.delimited('/'); !ok {
+			lexer.Reset(mark)
+		}
+
+	case lexer.SkipByte('\\'):
+		if lexer.EOF() {
+			lexer.Reset(mark)
+			break
+		}
+		if _, ok := p.delimited(lexer.NextByte()); !ok {
+			lexer.Reset(mark)
+		}
+	}
+
+	return lexer.Since(mark)
+}
+
+// delimited parses the text up to the unescaped delimiter,
+// and skips the delimiter.
+func (p *SedParser) delimited(delim byte) (string, bool) {
+	lexer := p.lexer
+	mark := lexer.Mark()
+
+	for !lexer.EOF() {
+		switch {
+		case p.skipExpr():
+			break
+		case lexer.SkipString("$$"):
+			break
+		case lexer.SkipByte('\\'):
+			lexer.Skip(1)
+		case lexer.PeekByte() == int(delim):
+			text := lexer.Since(mark)
+			lexer.Skip(1)
+			return text, true
+		case lexer.PeekByte() == '\n':
+			return "", false
+		default:
+			lexer.Skip(1)
+		}
+	}
+	return "", false
+}
+
+// text parses the text of the a, i and c commands.
+func (p *SedParser) text(cmd *SedCommand) {
+	lexer := p.lexer
+
+	lexer.SkipHspace()
+	if lexer.SkipString("\\\n") || lexer.Rest() == "\\" {
+		lexer.SkipByte('\\')
+	} else {
+		cmd.OneLine = true
+		lexer.SkipByte('\\')
+	}
+
+	mark := lexer.Mark()
+	for !lexer.EOF() && lexer.PeekByte() != '\n' {
+		lexer.SkipByte('\\')
+		lexer.Skip(1)
+	}
+	cmd.Arg = lexer.Since(mark)
+}
+
+// skipExpr skips an expression like ${VAR} or a shell variable like
+// $${var} or $$var, since their values are not known.
+func (p *SedParser) skipExpr() bool {
+	lexer := p.lexer
+	rest := lexer.Rest()
+
+	if p.shellVars && hasPrefix(rest, "$${") {
+		if end := strings.IndexByte(rest, '}'); end > 0 {
+			return lexer.Skip(end + 1)
+		}
+		return false
+	}
+	if p.shellVars && hasPrefix(rest, "$$") && len(rest) > 2 && textproc.AlnumU.Contains(rest[2]) && !textproc.Digit.Contains(rest[2]) {
+		name := textproc.NewLexer(rest[2:]).NextBytesSet(textproc.AlnumU)
+		return lexer.Skip(2 + len(name))
+	}
+
+	if hasPrefix(rest, "${") || hasPrefix(rest, "$(") {
+		mkLexer := NewMkLexer(rest, nil)
+		if mkLexer.Expr() != nil {
+			return lexer.Skip(len(rest) - len(mkLexer.lexer.Rest()))
+		}
+	}
+	return false
+}
+
+// SedChecker checks the commands of a sed script for syntax errors and
+// for constructs that only work in some implementations of sed.
+type SedChecker struct {
+	diag Diagnoser
+
+	// Whether the regular expressions are extended (sed -E).
+	extended bool
+
+	// Whether the script is run by GNU sed,
+	// which allows some additional constructs.
+	gnu bool
+
+	// Whether the script refers to shell variables,
+	// see SedParser.shellVars.
+	shellVars bool
+}
+
+func NewSedChecker(diag Diagnoser, extended bool, gnu bool) *SedChecker {
+	return &SedChecker{diag, extended, gnu, false}
+}
+
+// Check checks the sed script, after its shell quotes have been removed.
+func (ck *SedChecker) Check(script string) {
+	if trace.Tracing {
+		defer trace.Call1(script)()
+	}
+
+	p := ck.parser(script)
+	for _, cmd := range p.Script() {
+		ck.checkCommand(cmd)
+	}
+	if rest := p.Rest(); rest != "" {
+		ck.checkRest(rest)
+	}
+}
+
+// CheckWord checks the sed script from a shell word,
+// which may still contain the shell quotes.
+func (ck *SedChecker) CheckWord(mkline *MkLine, word string, warn bool) {
+	for _, atom := range NewShTokenizer(nil, word).ShAtoms() {
+		if atom.Type == shtShExpr && atom.Quoting != shqSquot {
+			ck.shellVars = true
+		}
+	}
+
+	ck.Check(mkline.UnquoteShell(word, warn))
+}
+
+// parser returns a parser for the script or a part of it.
+func (ck *SedChecker) parser(text string) *SedParser {
+	p := NewSedParser(text)
+	p.shellVars = ck.shellVars
+	return p
+}
+
+func (ck *SedChecker) checkCommand(cmd *SedCommand) {
+	gnuAddr := false
+	for _, addr := range cmd.Addrs {
+		switch {
+		case matches(addr, `^(?:[0-9]+~|[+~])[0-9]+$`):
+			gnuAddr = true
+		case hasPrefix(addr, "/"):
+			ck.checkRegex(addr[1:len(addr)-1], '/')
+		case hasPrefix(addr, "\\"):
+			ck.checkRegex(addr[2:len(addr)-1], addr[1])
+		}
+	}
+
+	if gnuAddr && !ck.gnu {
+		ck.diag.Warnf("The sed command %q only works with GNU sed.", cmd.Text)
+		ck.diag.Explain(
+			"The addresses \"first~step\", \"addr,+lines\" and \"addr,~multiple\"",
+			"are GNU extensions.",
+			"POSIX only allows line numbers, \"$\" and regular expressions.")
+	}
+
+	switch cmd.Name {
+	case 's':
+		groups := -1
+		if cmd.Pattern != "" {
+			groups = ck.checkRegex(cmd.Pattern, cmd.Delim)
+		}
+		ck.checkReplacement(cmd.Replacement, cmd.Delim, groups)
+		ck.checkFlags(cmd)
+
+	case 'y':
+		ck.checkTransliteration(cmd)
+
+	case 'a', 'i', 'c':
+		if cmd.OneLine && !ck.gnu {
+			ck.diag.Warnf("The sed command %q only works with GNU sed.", cmd.Text)
+			ck.diag.Explain(
+				"POSIX requires that the text of the a, i and c commands",
+				"starts on the line after the command.",
+				"",
+				"To write this portably, use two separate -e options:",
+				"the first one contains the command followed by a backslash,",
+				"the second one contains the text.")
+		}
+	}
+}
+
+// checkRegex checks a regular expression from an address or from an
+// s command and returns the number of its subexpressions.
+func (ck *SedChecker) checkRegex(re string, delim byte) int {
+	plain := ck.unescape(re, delim)
+
+	groups := 0
+	if ck.extended {
+		lexer := textproc.NewLexer(plain)
+		for !lexer.EOF() {
+			switch {
+			case lexer.SkipByte('\\'):
+				lexer.Skip(1)
+			case lexer.SkipByte('['):
+				skipBracketExpression(lexer)
+			case lexer.SkipByte('('):
+				groups++
+			default:
+				lexer.Skip(1)
+			}
+		}
+	} else {
+		// In sed, \n matches a newline in the pattern space.
+		allowedAfterBackslash := textproc.NewByteSet(")({}1-9.[\\*^$n")
+		groups = checkBasicRegularExpression(ck.diag, plain, allowedAfterBackslash)
+	}
+
+	ck.checkDollar(re, plain)
+	return groups
+}
+
+// unescape returns the regular expression without the escaped delimiters,
+// replacing the expressions and shell variables with a placeholder.
+func (ck *SedChecker) unescape(re string, delim byte) string {
+	var sb strings.Builder
+	p := ck.parser(re)
+	lexer := p.lexer
+
+	for !lexer.EOF() {
+		switch {
+		case p.skipExpr():
+			sb.WriteByte('x')
+		case lexer.SkipString("$$"):
+			sb.WriteByte('$')
+		case lexer.SkipString("\\$$"):
+			sb.WriteString("\\$")
+		case lexer.SkipByte('\\'):
+			if lexer.EOF() {
+				sb.WriteByte('\\')
+				break
+			}
+			ch := lexer.NextByte()
+			if ch == delim && !strings.Contains(".[\\*^$", string(ch)) {
+				sb.WriteByte(ch)
+			} else {
+				sb.WriteByte('\\')
+				sb.WriteByte(ch)
+			}
+		default:
+			sb.WriteByte(lexer.NextByte())
+		}
+	}
+	return sb.String()
+}
+
+// checkDollar warns about an unescaped "$" in the middle of an extended
+// regular expression, where it would only match at the end of the line.
+//
+// In basic regular expressions, such a "$" is a literal character,
+// as in the common pattern "s,$${prefix},...,".
+func (ck *SedChecker) checkDollar(re string, plain string) {
+	if !ck.extended {
+		return
+	}
+
+	lexer := textproc.NewLexer(plain)
+	for !lexer.EOF() {
+		switch {
+		case lexer.SkipByte('\\'):
+			lexer.Skip(1)
+
+		case lexer.SkipByte('['):
+			skipBracketExpression(lexer)
+
+		case lexer.SkipByte('$'):
+			rest := lexer.Rest()
+			if rest == "" || rest[0] == ')' || rest[0] == '|' {
+				break
+			}
+
+			ck.diag.Warnf("The sed pattern %q can never match because of the unescaped \"$\" in the middle.", re)
+			ck.diag.Explain(
+				"In extended regular expressions, an unescaped \"$\" only matches",
+				"at the end of the line.",
+				"Since the pattern continues after the \"$\", it can never match.",
+				"",
+				"To match a literal dollar sign, write \"[$$]\" or \"\\$$\"",
+				"in the makefile.")
+			return
+
+		default:
+			lexer.Skip(1)
+		}
+	}
+}
+
+// checkReplacement checks the replacement of an s command for
+// back-references to subexpressions that don't exist and for
+// escape sequences that only work in GNU sed.
+//
+// The number of groups is -1 if it is not known.
+func (ck *SedChecker) checkReplacement(repl string, delim byte, groups int) {
+	p := ck.parser(repl)
+	lexer := p.lexer
+
+	for !lexer.EOF() {
+		switch {
+		case p.skipExpr(), lexer.SkipString("$$"):
+			break
+
+		case lexer.SkipByte('\\'):
+			if lexer.EOF() {
+				break
+			}
+			ch := lexer.NextByte()
+			switch {
+			case ch >= '1' && ch <= '9':
+				if groups >= 0 && int(ch-'0') > groups {
+					ck.diag.Errorf("The back-reference %q in the sed replacement %q "+
+						"refers to a subexpression that does not exist.",
+						"\\"+string(ch), repl)
+				}
+
+			case ch == '&', ch == '\\', ch == '\n', ch == delim:
+				break
+
+			case !ck.gnu && (textproc.Alnum.Contains(ch) || strings.IndexByte("+?|(){}", ch) >= 0):
+				ck.diag.Warnf("The escape sequence %q in the sed replacement %q only works with GNU sed.",
+					"\\"+string(ch), repl)
+				ck.diag.Explain(
+					"In the replacement of the s command, POSIX only defines",
+					"the escape sequences \\1 to \\9, \\&, \\\\, the escaped delimiter",
+					"and the escaped newline.",
+					"GNU sed additionally interprets \\n as a newline, \\t as a tab,",
+					"and \\U and \\L to change the case.",
+					"Other implementations of sed output the plain character instead.")
+			}
+
+		default:
+			lexer.Skip(1)
+		}
+	}
+}
+
+func (ck *SedChecker) checkFlags(cmd *SedCommand) {
+	if ck.gnu {
+		return
+	}
+
+	for _, flag := range cmd.Flags {
+		if strings.ContainsRune("IiMme", flag) {
+			ck.diag.Warnf("The flag %q of the sed command %q only works with GNU sed.",
+				string(flag), cmd.Text)
+			return
+		}
+	}
+}
+
+// checkTransliteration checks that the two strings of the y command
+// have the same length.
+func (ck *SedChecker) checkTransliteration(cmd *SedCommand) {
+	length := func(s string) int {
+		n := 0
+		p := ck.parser(s)
+		for !p.lexer.EOF() {
+			if p.skipExpr() {
+				return -1
+			}
+			p.lexer.SkipByte('\\')
+			if !p.lexer.SkipString("$$") {
+				p.lexer.Skip(1)
+			}
+			n++
+		}
+		return n
+	}
+
+	from := length(cmd.Pattern)
+	to := length(cmd.Replacement)
+	if from >= 0 && to >= 0 && from != to {
+		ck.diag.Errorf("The strings of the sed command %q must have the same length.", cmd.Text)
+	}
+}
+
+// checkRest reports the part of the sed script that could not be parsed.
+func (ck *SedChecker) checkRest(rest string) {
+	if m, delim := match1(rest, `^(?:\d+|/[^/]*/)?\s*!?\s*[sy]([^\\\n])`); m {
+		n := 0
+		p := ck.parser(rest)
+		for !p.lexer.EOF() {
+			switch {
+			case p.skipExpr():
+				break
+			case p.lexer.SkipByte('\\'):
+				p.lexer.Skip(1)
+			case p.lexer.SkipString(delim):
+				n++
+			default:
+				p.lexer.Skip(1)
+			}
+		}
+
+		if n > 3 {
+			ck.diag.Errorf("The delimiter %q must be escaped in the sed command %q.", delim, rest)
+			ck.diag.Explain(
+				"In the s and y commands, the delimiter must be escaped",
+				"with a backslash when it appears in the pattern or the replacement,",
+				"even inside a bracket expression like [^,].",
+				"",
+				"Alternatively, choose a different delimiter",
+				"that does not appear in the command.")
+			return
+		}
+	}
+
+	ck.diag.Errorf("Invalid sed command %q.", rest)
+}
+
+// skipBracketExpression skips a bracket expression like [a-z] or []abc]
+// or [[:alpha:]] in a regular expression. The opening bracket has
+// already been skipped.
+func skipBracketExpression(lexer *textproc.Lexer) {
+	lexer.SkipByte('^')
+	lexer.SkipByte(']')
+	for !lexer.EOF() {
+		switch {
+		case lexer.SkipByte('['):
+			// Character classes, collating symbols and equivalence classes.
+			if !lexer.EOF() && strings.IndexByte(":.=", byte(lexer.PeekByte())) >= 0 {
+				end := string(lexer.NextByte()) + "]"
+				if i := strings.Index(lexer.Rest(), end); i >= 0 {
+					lexer.Skip(i + len(end))
+				}
+			}
+		case lexer.SkipByte(']'):
+			return
+		default:
+			lexer.Skip(1)
+		}
+	}
+}
@@ -0,0 +1,583 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_NewSedParser(c *check.C) {
+	t := s.Init(c)
+
+	p := NewSedParser("s,from,to,")
+
+	t.CheckEquals(p.Rest(), "s,from,to,")
+}
+
+func (s *Suite) Test_SedParser_Script(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, rest string, texts ...string) {
+		p := NewSedParser(script)
+		cmds := p.Script()
+
+		var actual []string
+		for _, cmd := range cmds {
+			actual = append(actual, cmd.Text)
+		}
+		t.CheckDeepEquals(actual, texts)
+		t.CheckEquals(p.Rest(), rest)
+	}
+
+	test("", "")
+	test("s,from,to,", "",
+		"s,from,to,")
+	test("s,a,b,;s,c,d,g", "",
+		"s,a,b,",
+		"s,c,d,g")
+	test("1d\n$$d", "",
+		"1d",
+		"$$d")
+	test("/^#/d; s,a,b,", "",
+		"/^#/d",
+		"s,a,b,")
+
+	// An expression may contain one or more complete sed commands.
+	test("${SED_SCRIPT}; s,a,b,", "",
+		"s,a,b,")
+
+	// An expression at the beginning may also be a line number.
+	test("${LINE}d", "",
+		"${LINE}d")
+
+	// Parsing stops at the first syntax error.
+	test("s,a,b,; s,c,d; s,e,f,", "s,c,d; s,e,f,",
+		"s,a,b,")
+}
+
+func (s *Suite) Test_SedParser_Rest(c *check.C) {
+	t := s.Init(c)
+
+	p := NewSedParser("p; unknown")
+	cmds := p.Script()
+
+	t.CheckLen(cmds, 1)
+	t.CheckEquals(p.Rest(), "unknown")
+}
+
+func (s *Suite) Test_SedParser_command(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, expected *SedCommand) {
+		p := NewSedParser(script)
+		cmd := p.command()
+
+		if expected != nil {
+			expected.Text = script
+		}
+		t.CheckDeepEquals(cmd, expected)
+	}
+
+	test("s,from,to,g",
+		&SedCommand{Name: 's', Delim: ',', Pattern: "from", Replacement: "to", Flags: "g"})
+	test("s/a\\/b/c/2p",
+		&SedCommand{Name: 's', Delim: '/', Pattern: "a\\/b", Replacement: "c", Flags: "2p"})
+	test("s,a,b,w out.txt",
+		&SedCommand{Name: 's', Delim: ',', Pattern: "a", Replacement: "b", Flags: "w", Arg: "out.txt"})
+	test("y/abc/ABC/",
+		&SedCommand{Name: 'y', Delim: '/', Pattern: "abc", Replacement: "ABC"})
+	test("1,/^$$/!d",
+		&SedCommand{Addrs: []string{"1", "/^$$/"}, Negated: true, Name: 'd'})
+	test("/start/,/end/ {",
+		&SedCommand{Addrs: []string{"/start/", "/end/"}, Name: '{'})
+	test("a\\\ntext",
+		&SedCommand{Name: 'a', Arg: "text"})
+	test("i text",
+		&SedCommand{Name: 'i', Arg: "text", OneLine: true})
+	test(":label",
+		&SedCommand{Name: ':', Arg: "label"})
+	test("b end",
+		&SedCommand{Name: 'b', Arg: "end"})
+	test("# comment",
+		&SedCommand{Name: '#'})
+
+	// GNU extensions for the addresses.
+	test("/a/,+3d",
+		&SedCommand{Addrs: []string{"/a/", "+3"}, Name: 'd'})
+	test("0~2d",
+		&SedCommand{Addrs: []string{"0~2"}, Name: 'd'})
+	test("1,~4p",
+		&SedCommand{Addrs: []string{"1", "~4"}, Name: 'p'})
+
+	// Missing second address.
+	test("1,d", nil)
+	test("1,+d", nil)
+
+	// Missing command.
+	test("1,2", nil)
+
+	// The backslash cannot be used as delimiter.
+	test("s\\a\\b\\", nil)
+
+	// Missing final delimiter.
+	test("s,from,to", nil)
+
+	// Unescaped delimiter.
+	test("s,[^,]*,,", nil)
+
+	// Unknown command.
+	test("z", nil)
+
+	// Trailing text after the command.
+	test("p p", nil)
+}
+
+func (s *Suite) Test_SedParser_address(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, addr string, rest string) {
+		p := NewSedParser(script)
+
+		t.CheckEquals(p.address(), addr)
+		t.CheckEquals(p.Rest(), rest)
+	}
+
+	test("123p", "123", "p")
+	test("$$p", "$$", "p")
+	test("${LINE}p", "${LINE}", "p")
+	test("/regex/p", "/regex/", "p")
+	test("/a\\/b/p", "/a\\/b/", "p")
+	test("\\,regex,p", "\\,regex,", "p")
+	test("p", "", "p")
+
+	// GNU extension.
+	test("0~2p", "0~2", "p")
+	test("1~p", "1", "~p")
+
+	// Unfinished addresses.
+	test("/regex", "", "/regex")
+	test("\\,regex", "", "\\,regex")
+	test("\\", "", "\\")
+}
+
+func (s *Suite) Test_SedParser_delimited(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, delim byte, text string, ok bool, rest string) {
+		p := NewSedParser(script)
+
+		actualText, actualOK := p.delimited(delim)
+
+		t.CheckEquals(actualText, text)
+		t.CheckEquals(actualOK, ok)
+		t.CheckEquals(p.Rest(), rest)
+	}
+
+	test("from,to,", ',', "from", true, "to,")
+	test("a\\,b,rest", ',', "a\\,b", true, "rest")
+
+	// The delimiter inside an expression does not count.
+	test("${VAR:S,a,b,},rest", ',', "${VAR:S,a,b,}", true, "rest")
+
+	// A literal dollar sign, followed by the delimiter.
+	test("a$$,rest", ',', "a$$", true, "rest")
+
+	// A shell variable.
+	test("$${var},rest", ',', "$${var}", true, "rest")
+
+	// A newline ends the text.
+	test("from\n,", ',', "", false, "\n,")
+
+	test("unfinished", ',', "", false, "")
+}
+
+func (s *Suite) Test_SedParser_text(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, arg string, oneLine bool, rest string) {
+		p := NewSedParser(script)
+		var cmd SedCommand
+
+		p.text(&cmd)
+
+		t.CheckEquals(cmd.Arg, arg)
+		t.CheckEquals(cmd.OneLine, oneLine)
+		t.CheckEquals(p.Rest(), rest)
+	}
+
+	test("\\\ntext\nrest", "text", false, "\nrest")
+	test("\\\nline 1\\\nline 2\nrest", "line 1\\\nline 2", false, "\nrest")
+
+	// The text is given in a separate -e option.
+	test("\\", "", false, "")
+
+	// GNU extensions.
+	test(" text", "text", true, "")
+	test("\\text", "text", true, "")
+}
+
+func (s *Suite) Test_SedParser_skipExpr(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, skipped bool, rest string) {
+		p := NewSedParser(script)
+
+		t.CheckEquals(p.skipExpr(), skipped)
+		t.CheckEquals(p.Rest(), rest)
+	}
+
+	test("${VAR}rest", true, "rest")
+	test("$(VAR)rest", true, "rest")
+	test("${VAR:S,a,b,}rest", true, "rest")
+	test("$${var}rest", true, "rest")
+	test("$$var,rest", true, ",rest")
+	test("$$1rest", false, "$$1rest")
+	test("$$,rest", false, "$$,rest")
+	test("$$", false, "$$")
+	test("$${unclosed", false, "$${unclosed")
+	test("${unclosed", true, "")
+	test("text", false, "text")
+}
+
+func (s *Suite) Test_NewSedChecker(c *check.C) {
+	t := s.Init(c)
+
+	mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+	ck := NewSedChecker(mkline, true, false)
+
+	t.CheckEquals(ck.extended, true)
+	t.CheckEquals(ck.gnu, false)
+}
+
+func (s *Suite) Test_SedChecker_Check(c *check.C) {
+	t := s.Init(c)
+
+	mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+	ck := NewSedChecker(mkline, false, false)
+
+	ck.Check("s,\\(a\\),\\2,; /x/d; s,[^,]*,,")
+
+	t.CheckOutputLines(
+		"ERROR: filename.mk:123: The back-reference \"\\\\2\" in the sed replacement "+
+			"\"\\\\2\" refers to a subexpression that does not exist.",
+		"ERROR: filename.mk:123: The delimiter \",\" must be escaped "+
+			"in the sed command \"s,[^,]*,,\".")
+}
+
+func (s *Suite) Test_SedChecker_CheckWord(c *check.C) {
+	t := s.Init(c)
+
+	test := func(word string, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, true, false)
+
+		ck.CheckWord(mkline, word, false)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	// In single quotes, the shell passes $b literally to sed.
+	test("'s,a$$b,,'",
+		"WARN: filename.mk:123: The sed pattern \"a$$b\" can never match "+
+			"because of the unescaped \"$\" in the middle.")
+
+	// In double quotes, the shell expands the variable,
+	// so its value is unknown.
+	test("\"s,a$$b,,\"",
+		nil...)
+	test("s,a$${b},,",
+		nil...)
+}
+
+func (s *Suite) Test_SedChecker_parser(c *check.C) {
+	t := s.Init(c)
+
+	mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+	ck := NewSedChecker(mkline, false, false)
+
+	t.CheckEquals(ck.parser("$$b").skipExpr(), false)
+
+	ck.shellVars = true
+
+	t.CheckEquals(ck.parser("$$b").skipExpr(), true)
+}
+
+func (s *Suite) Test_SedChecker_checkCommand(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, gnu bool, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, false, gnu)
+
+		ck.Check(script)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("/a\\+/d", false,
+		"WARN: filename.mk:123: In a basic regular expression, "+
+			"a backslash followed by \"+\" is undefined.")
+	test("\\,a\\+,d", false,
+		"WARN: filename.mk:123: In a basic regular expression, "+
+			"a backslash followed by \"+\" is undefined.")
+
+	// An empty pattern reuses the previous regular expression,
+	// therefore the number of its subexpressions is not known.
+	test("/\\(a\\)/s,,\\1,", false,
+		nil...)
+
+	test("y/abc/AB/", false,
+		"ERROR: filename.mk:123: The strings of the sed command "+
+			"\"y/abc/AB/\" must have the same length.")
+
+	test("a text", false,
+		"WARN: filename.mk:123: The sed command \"a text\" only works with GNU sed.")
+	test("a text", true,
+		nil...)
+	test("a\\\ntext", false,
+		nil...)
+
+	test("/a/,+3d", false,
+		"WARN: filename.mk:123: The sed command \"/a/,+3d\" only works with GNU sed.")
+	test("0~2d", false,
+		"WARN: filename.mk:123: The sed command \"0~2d\" only works with GNU sed.")
+	test("1,~4p", false,
+		"WARN: filename.mk:123: The sed command \"1,~4p\" only works with GNU sed.")
+	test("0~4,+1d", false,
+		"WARN: filename.mk:123: The sed command \"0~4,+1d\" only works with GNU sed.")
+	test("/a/,+3d", true,
+		nil...)
+	test("0~2d", true,
+		nil...)
+}
+
+func (s *Suite) Test_SedChecker_checkRegex(c *check.C) {
+	t := s.Init(c)
+
+	test := func(re string, delim byte, extended bool, groups int, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, extended, false)
+
+		t.CheckEquals(ck.checkRegex(re, delim), groups)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("\\(a\\)\\(b\\)", ',', false, 2,
+		nil...)
+	test("\\(a\\)\\2", ',', false, 1,
+		"ERROR: filename.mk:123: In a basic regular expression, "+
+			"the back-reference \"\\\\2\" refers to a subexpression "+
+			"that is not defined before.")
+
+	// In sed, \n matches a newline.
+	test("a\\nb", ',', false, 0,
+		nil...)
+
+	// An escaped delimiter is a plain character.
+	test("a\\,b", ',', false, 0,
+		nil...)
+
+	test("a\\+b", ',', false, 0,
+		"WARN: filename.mk:123: In a basic regular expression, "+
+			"a backslash followed by \"+\" is undefined.")
+
+	// Extended regular expressions are not checked for escape sequences.
+	test("(a)(b|[(])\\+", ',', true, 2,
+		nil...)
+
+	// In single quotes, $$b is not a shell variable.
+	test("a$$b$$", ',', true, 0,
+		"WARN: filename.mk:123: The sed pattern \"a$$b$$\" can never match "+
+			"because of the unescaped \"$\" in the middle.")
+	test("a$$ b", ',', true, 0,
+		"WARN: filename.mk:123: The sed pattern \"a$$ b\" can never match "+
+			"because of the unescaped \"$\" in the middle.")
+
+	// In basic regular expressions, a "$" in the middle is a literal.
+	test("a$$b$$", ',', false, 0,
+		nil...)
+	test("$${prefix}/man", ',', false, 0,
+		nil...)
+	test("$$(CC)", ',', false, 0,
+		nil...)
+	test("$$(PREFIX)/lib", ',', false, 0,
+		nil...)
+}
+
+func (s *Suite) Test_SedChecker_unescape(c *check.C) {
+	t := s.Init(c)
+
+	test := func(re string, delim byte, plain string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, false, false)
+
+		t.CheckEquals(ck.unescape(re, delim), plain)
+	}
+
+	test("a\\,b", ',', "a,b")
+	test("a\\.b", '.', "a\\.b")
+	test("^$$", ',', "^$")
+	test("\\$$", ',', "\\$")
+	test("${VAR}$${var}$$var", ',', "x${var}$var")
+	test("a\\", ',', "a\\")
+}
+
+func (s *Suite) Test_SedChecker_checkDollar(c *check.C) {
+	t := s.Init(c)
+
+	test := func(plain string, extended bool, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, extended, false)
+
+		ck.checkDollar(plain, plain)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("^$", false,
+		nil...)
+	test("a\\$b", false,
+		nil...)
+	test("a[$]b", false,
+		nil...)
+	test("\\(a$\\)", false,
+		nil...)
+	test("(a$|b$)", true,
+		nil...)
+	test("a$b", false,
+		nil...)
+	test("(a$)b", false,
+		nil...)
+	test("a$b", true,
+		"WARN: filename.mk:123: The sed pattern \"a$b\" can never match "+
+			"because of the unescaped \"$\" in the middle.")
+	test("(a$|b)c", true,
+		nil...)
+}
+
+func (s *Suite) Test_SedChecker_checkReplacement(c *check.C) {
+	t := s.Init(c)
+
+	test := func(repl string, groups int, gnu bool, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, false, gnu)
+
+		ck.checkReplacement(repl, ',', groups)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("\\1\\&\\\\\\,&", 1, false,
+		nil...)
+	test("\\2", 1, false,
+		"ERROR: filename.mk:123: The back-reference \"\\\\2\" in the sed replacement "+
+			"\"\\\\2\" refers to a subexpression that does not exist.")
+	test("\\2", -1, false,
+		nil...)
+	test("a\\nb", 0, false,
+		"WARN: filename.mk:123: The escape sequence \"\\\\n\" "+
+			"in the sed replacement \"a\\\\nb\" only works with GNU sed.")
+	test("a\\+", 0, false,
+		"WARN: filename.mk:123: The escape sequence \"\\\\+\" "+
+			"in the sed replacement \"a\\\\+\" only works with GNU sed.")
+	test("\\U\\1", 1, true,
+		nil...)
+
+	// Other escaped characters are output as-is.
+	test("\\.\\$$", 0, false,
+		nil...)
+
+	test("${VAR}$${var}$$\\", 0, false,
+		nil...)
+}
+
+func (s *Suite) Test_SedChecker_checkFlags(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, gnu bool, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, false, gnu)
+
+		ck.Check(script)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("s,a,b,gp", false,
+		nil...)
+	test("s,a,b,gI", false,
+		"WARN: filename.mk:123: The flag \"I\" of the sed command "+
+			"\"s,a,b,gI\" only works with GNU sed.")
+	test("s,a,b,gI", true,
+		nil...)
+}
+
+func (s *Suite) Test_SedChecker_checkTransliteration(c *check.C) {
+	t := s.Init(c)
+
+	test := func(script string, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, false, false)
+
+		ck.Check(script)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("y/abc/ABC/",
+		nil...)
+	test("y/a\\/c/A\\\\C/",
+		nil...)
+	test("y/$$/x/",
+		nil...)
+	test("y/abc/${UPPER}/",
+		nil...)
+	test("y/ab/ABC/",
+		"ERROR: filename.mk:123: The strings of the sed command "+
+			"\"y/ab/ABC/\" must have the same length.")
+}
+
+func (s *Suite) Test_SedChecker_checkRest(c *check.C) {
+	t := s.Init(c)
+
+	test := func(rest string, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		ck := NewSedChecker(mkline, false, false)
+
+		ck.checkRest(rest)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("s,[^,]*,,",
+		"ERROR: filename.mk:123: The delimiter \",\" must be escaped "+
+			"in the sed command \"s,[^,]*,,\".")
+	test("/x/ s/a/b/c/",
+		"ERROR: filename.mk:123: The delimiter \"/\" must be escaped "+
+			"in the sed command \"/x/ s/a/b/c/\".")
+
+	// Escaped delimiters and those in expressions don't count.
+	test("s,\\,${VAR:S,a,b,},x",
+		"ERROR: filename.mk:123: Invalid sed command \"s,\\\\,${VAR:S,a,b,},x\".")
+
+	test("s,from,to",
+		"ERROR: filename.mk:123: Invalid sed command \"s,from,to\".")
+	test("unknown",
+		"ERROR: filename.mk:123: Invalid sed command \"unknown\".")
+}
+
+func (s *Suite) Test_skipBracketExpression(c *check.C) {
+	t := s.Init(c)
+
+	test := func(re string, rest string) {
+		lexer := NewSedParser(re).lexer
+
+		skipBracketExpression(lexer)
+
+		t.CheckEquals(lexer.Rest(), rest)
+	}
+
+	test("a-z]rest", "rest")
+	test("^]a]rest", "rest")
+	test("]a]rest", "rest")
+	test("[:alpha:]]rest", "rest")
+	test("[.].]]rest", "rest")
+	test("unfinished", "")
+}
@@ -30,10 +30,12 @@ func (scc *SimpleCommandChecker) Check() {
 
 	scc.checkCommandStart()
 	scc.checkRegexReplace()
+	scc.checkSedScripts()
 	scc.checkAutoMkdirs()
 	scc.checkInstallMulti()
 	scc.checkPaxPe()
 	scc.checkEchoN()
+	scc.checkPortableOptions()
 }
 
 func (scc *SimpleCommandChecker) checkCommandStart() {
@@ -233,6 +235,49 @@ func (scc *SimpleCommandChecker) checkRegexReplace() {
 	}
 }
 
+// checkSedScripts checks the scripts that are passed to sed,
+// either using the -e option or as the first argument.
+func (scc *SimpleCommandChecker) checkSedScripts() {
+	if trace.Tracing {
+		defer trace.Call0()()
+	}
+
+	name := scc.toolName()
+	if name != "sed" && name != "gsed" {
+		return
+	}
+
+	_, gnuUsable := G.Tool(scc.mklines, "gsed", scc.time)
+	gnu := name == "gsed" || gnuUsable
+	extended := false
+	hasScript := false
+	var scripts []string
+
+	args := scc.strcmd.Args
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case (arg == "-e" || arg == "-f") && i+1 < len(args):
+			i++
+			if arg == "-e" {
+				scripts = append(scripts, args[i])
+			}
+			hasScript = true
+		case arg == "-E" || arg == "-r":
+			extended = true
+		case hasPrefix(arg, "-"):
+			break
+		case !hasScript:
+			scripts = append(scripts, arg)
+			hasScript = true
+		}
+	}
+
+	for _, script := range scripts {
+		NewSedChecker(scc, extended, gnu).CheckWord(scc.mkline, script, false)
+	}
+}
+
 func (scc *SimpleCommandChecker) checkAutoMkdirs() {
 	if trace.Tracing {
 		defer trace.Call0()()
@@ -370,6 +415,125 @@ func (scc *SimpleCommandChecker) checkEchoN() {
 	}
 }
 
+// checkPortableOptions checks for command line options that are only
+// available in some implementations of the tools, such as "sed -i".
+//
+// See PortabilityRegistry.
+func (scc *SimpleCommandChecker) checkPortableOptions() {
+	if trace.Tracing {
+		defer trace.Call0()()
+	}
+
+	tool := scc.toolName()
+	options := G.Project.Portability().Options(tool)
+	if len(options) == 0 {
+		return
+	}
+
+	for _, arg := range scc.optionArgs(tool) {
+		for _, opt := range options {
+			if !opt.Matches(arg) {
+				continue
+			}
+			if opt.GnuTool != "" {
+				if _, usable := G.Tool(scc.mklines, opt.GnuTool, scc.time); usable {
+					continue
+				}
+			}
+
+			scc.warnPortableOption(opt)
+		}
+	}
+}
+
+// optionArgs returns the arguments of the command that may be options
+// of the tool, leaving out the operands and the arguments of other
+// commands, such as the command that xargs or find -exec runs.
+func (scc *SimpleCommandChecker) optionArgs(tool string) []string {
+	args := scc.strcmd.Args
+	var options []string
+
+	if tool == "find" {
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "-exec" || arg == "-execdir" || arg == "-ok" || arg == "-okdir":
+				for i+1 < len(args) && !matches(args[i+1], `^(?:\\;|';'|";"|\+)$`) {
+					i++
+				}
+			case hasPrefix(arg, "-"):
+				options = append(options, arg)
+			}
+		}
+		return options
+	}
+
+	letters, optionsFirst := G.Project.Portability().ArgLetters(tool)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if optionsFirst && (!hasPrefix(arg, "-") || arg == "-") {
+			break
+		}
+
+		options = append(options, arg)
+
+		if optionsFirst && !hasPrefix(arg, "--") {
+			for j := 1; j < len(arg); j++ {
+				if strings.IndexByte(letters, arg[j]) >= 0 {
+					if j == len(arg)-1 {
+						i++ // Skip the argument of the option.
+					}
+					break
+				}
+			}
+		}
+	}
+	return options
+}
+
+func (scc *SimpleCommandChecker) warnPortableOption(opt *ToolOption) {
+	useTools := sprintf("USE_TOOLS+= %s", opt.GnuTool)
+
+	instead := opt.Instead
+	if opt.GnuTool != "" && instead == "" {
+		instead = sprintf("Add %q instead.", useTools)
+	}
+
+	scc.Warnf("The option %q of %s is not portable. %s", opt.Option, opt.Tool, instead)
+
+	explanation := []string{
+		"Not all platforms that pkgsrc supports use the GNU implementations",
+		"of the tools. Command line options that are only available in some",
+		"implementations make the build fail on the other platforms."}
+	if opt.GnuTool != "" && opt.Instead != "" {
+		explanation = append(explanation,
+			"",
+			sprintf("Alternatively, adding %q makes the GNU implementation", useTools),
+			"of the tool available to the package.")
+	}
+	scc.Explain(explanation...)
+}
+
+// toolName returns the name of the tool that is run by the command,
+// for looking up its properties in the PortabilityRegistry.
+func (scc *SimpleCommandChecker) toolName() string {
+	command := scc.strcmd.Name
+
+	if tool, _ := G.Tool(scc.mklines, command, scc.time); tool != nil {
+		return tool.Name
+	}
+	if matches(command, `^\$\{INSTALL(?:_[A-Z]+)?\}$`) {
+		return "install"
+	}
+	if !containsExpr(command) {
+		return path.Base(command)
+	}
+	return ""
+}
+
 func (scc *SimpleCommandChecker) Errorf(format string, args ...interface{}) {
 	scc.mkline.Errorf(format, args...)
 }
@@ -678,6 +842,7 @@ func (ck *ShellLineChecker) CheckShellCommand(shellcmd string, pSetE *bool, time
 	}
 
 	line := ck.mkline.Line
+	setE := *pSetE
 	program, err := parseShellProgram(line, shellcmd)
 	// XXX: This code is duplicated in checkWordQuoting.
 	if err != nil && contains(shellcmd, "$$(") { // Hack until the shell parser can handle subshells.
@@ -713,6 +878,10 @@ func (ck *ShellLineChecker) CheckShellCommand(shellcmd string, pSetE *bool, time
 	}
 
 	walker.Walk(program)
+
+	if ck.mkline.IsShellCommand() {
+		NewShellFlowChecker(ck, setE).Check(program)
+	}
 }
 
 func (ck *ShellLineChecker) CheckWord(token string, checkQuoting bool, time ToolTime) {
@@ -873,20 +1042,7 @@ func (ck *ShellLineChecker) checkShExprPlain(atom *ShAtom, checkQuoting bool) {
 		ck.Warnf("The $@ shell variable should only be used in double quotes.")
 
 	} else if G.WarnQuoting && checkQuoting && ck.variableNeedsQuoting(shVarname) {
-		ck.Warnf("Unquoted shell variable %q.", shVarname)
-		ck.Explain(
-			"When a shell variable contains whitespace, it is expanded (split into multiple words)",
-			"when it is written as $variable in a shell script.",
-			"If that is not intended, it should be surrounded by quotation marks, like \"$variable\".",
-			"This way it always expands to a single word, preserving all whitespace and other special characters.",
-			"",
-			"Example:",
-			"\tfname=\"Curriculum vitae.doc\"",
-			"\tcp $filename /tmp",
-			"\t# tries to copy the two files \"Curriculum\" and \"Vitae.doc\"",
-			"",
-			"\tcp \"$filename\" /tmp",
-			"\t# copies one file, as intended")
+		warnUnquotedShellVariable(ck.mkline, shVarname)
 	}
 
 	if shVarname == "?" {
@@ -896,6 +1052,23 @@ func (ck *ShellLineChecker) checkShExprPlain(atom *ShAtom, checkQuoting bool) {
 	}
 }
 
+func warnUnquotedShellVariable(diag Diagnoser, shVarname string) {
+	diag.Warnf("Unquoted shell variable %q.", shVarname)
+	diag.Explain(
+		"When a shell variable contains whitespace, it is expanded (split into multiple words)",
+		"when it is written as $variable in a shell script.",
+		"If that is not intended, it should be surrounded by quotation marks, like \"$variable\".",
+		"This way it always expands to a single word, preserving all whitespace and other special characters.",
+		"",
+		"Example:",
+		"\tfname=\"Curriculum vitae.doc\"",
+		"\tcp $filename /tmp",
+		"\t# tries to copy the two files \"Curriculum\" and \"Vitae.doc\"",
+		"",
+		"\tcp \"$filename\" /tmp",
+		"\t# copies one file, as intended")
+}
+
 func (ck *ShellLineChecker) variableNeedsQuoting(shVarname string) bool {
 	switch shVarname {
 	case "#", "?", "$":
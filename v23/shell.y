@@ -354,25 +354,25 @@ io_redirect : tkIO_NUMBER io_here {
 }
 
 io_file : tkLT filename {
-	$$ = &MkShRedirection{-1, "<", $2}
+	$$ = &MkShRedirection{-1, "<", $2, ""}
 }
 io_file : tkLTAND filename {
-	$$ = &MkShRedirection{-1, "<&", $2}
+	$$ = &MkShRedirection{-1, "<&", $2, ""}
 }
 io_file : tkGT filename {
-	$$ = &MkShRedirection{-1, ">", $2}
+	$$ = &MkShRedirection{-1, ">", $2, ""}
 }
 io_file : tkGTAND filename {
-	$$ = &MkShRedirection{-1, ">&", $2}
+	$$ = &MkShRedirection{-1, ">&", $2, ""}
 }
 io_file : tkGTGT filename {
-	$$ = &MkShRedirection{-1, ">>", $2}
+	$$ = &MkShRedirection{-1, ">>", $2, ""}
 }
 io_file : tkLTGT filename {
-	$$ = &MkShRedirection{-1, "<>", $2}
+	$$ = &MkShRedirection{-1, "<>", $2, ""}
 }
 io_file : tkGTPIPE filename {
-	$$ = &MkShRedirection{-1, ">|", $2}
+	$$ = &MkShRedirection{-1, ">|", $2, ""}
 }
 
 filename : tkWORD { /* Apply rule 2 */
@@ -380,10 +380,12 @@ filename : tkWORD { /* Apply rule 2 */
 }
 
 io_here : tkLTLT here_end {
-	$$ = &MkShRedirection{-1, "<<", $2}
+	$$ = &MkShRedirection{-1, "<<", $2, ""}
+	shyylex.(*ShellLexer).hereDocs = append(shyylex.(*ShellLexer).hereDocs, $$)
 }
 io_here : tkLTLTDASH here_end {
-	$$ = &MkShRedirection{-1, "<<-", $2}
+	$$ = &MkShRedirection{-1, "<<-", $2, ""}
+	shyylex.(*ShellLexer).hereDocs = append(shyylex.(*ShellLexer).hereDocs, $$)
 }
 
 here_end : tkWORD { /* Apply rule 3 */
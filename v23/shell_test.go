@@ -356,6 +356,66 @@ func (s *Suite) Test_SimpleCommandChecker_checkRegexReplace(c *check.C) {
 	G.Testing = true
 }
 
+func (s *Suite) Test_SimpleCommandChecker_checkSedScripts(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	t.SetUpTool("sed", "SED", AtRunTime)
+	t.SetUpTool("gsed", "", Nowhere)
+	test := func(cmd string, diagnostics ...string) {
+		mklines := t.NewMkLines("Makefile",
+			MkCvsID,
+			"pre-configure:",
+			"	"+cmd)
+
+		mklines.Check()
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("${SED} -e 's,\\(a\\),\\2,' filename",
+		"ERROR: Makefile:3: The back-reference \"\\\\2\" in the sed replacement "+
+			"\"\\\\2\" refers to a subexpression that does not exist.")
+
+	// Without -e, the first argument is the sed script.
+	test("${SED} -n 's,[^,]*,,' filename",
+		"ERROR: Makefile:3: The delimiter \",\" must be escaped "+
+			"in the sed command \"s,[^,]*,,\".")
+
+	test("${SED} -E -e 's,(a)|(b),\\2,' filename",
+		nil...)
+
+	test("${SED} -e 's,a$$b$$,\\n,' filename",
+		"WARN: Makefile:3: The escape sequence \"\\\\n\" in the sed replacement "+
+			"\"\\\\n\" only works with GNU sed.")
+
+	// In basic regular expressions, a "$" in the middle is a literal.
+	test("${SED} -e 's,$${prefix}/man,$${prefix}/${PKGMANDIR},' filename",
+		nil...)
+	test("${SED} -e 's,$$(CC),${CC},' filename",
+		"WARN: Makefile:3: Use ${CC:Q} instead of ${CC} "+
+			"and make sure the variable appears outside of any quoting characters.")
+	test("${SED} -e 's,$$(PREFIX)/lib,${PREFIX}/lib,' filename",
+		nil...)
+	test("${SED} -E -e 's,a$$b,,' filename",
+		"WARN: Makefile:3: The sed pattern \"a$$b\" can never match "+
+			"because of the unescaped \"$\" in the middle.")
+
+	// The script is read from a file and is therefore not checked here.
+	test("${SED} -f script.sed 's,[^,]*,,'",
+		nil...)
+
+	test("${SED} -e '/a/,+3d' filename",
+		"WARN: Makefile:3: The sed command \"/a/,+3d\" only works with GNU sed.")
+
+	// In GNU sed, the replacement may contain \n.
+	t.SetUpTool("gsed", "", AtRunTime)
+	test("${SED} -e 's,a,\\n,' filename",
+		nil...)
+	test("${SED} -e '/a/,+3d' -e '0~2d' filename",
+		nil...)
+}
+
 func (s *Suite) Test_SimpleCommandChecker_checkAutoMkdirs(c *check.C) {
 	t := s.Init(c)
 
@@ -614,6 +674,132 @@ func (s *Suite) Test_SimpleCommandChecker_checkEchoN(c *check.C) {
 		"WARN: Makefile:4: Use ${ECHO_N} instead of \"echo -n\".")
 }
 
+func (s *Suite) Test_SimpleCommandChecker_checkPortableOptions(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	G.Project.Portability().Init()
+	t.SetUpTool("find", "FIND", AtRunTime)
+	t.SetUpTool("sed", "SED", AtRunTime)
+	t.SetUpTool("gsed", "GSED", Nowhere)
+	t.SetUpTool("xargs", "XARGS", AtRunTime)
+	t.SetUpTool("rm", "RM", AtRunTime)
+
+	test := func(lines ...string) {
+		mklines := t.NewMkLines("Makefile",
+			append([]string{MkCvsID, ""}, lines...)...)
+
+		mklines.Check()
+	}
+
+	test(
+		"pre-configure:",
+		"	${RUN} ${SED} -i -e s,from,to, file",
+		"	${RUN} sed -ni -e p file",
+		"	${RUN} ${SED} -n -e 's/-i//' file",
+		"	${RUN} ${FIND} . -printf '%p\\n'; ${XARGS} -r echo",
+		"	${RUN} ${SED} -e s,from,to, -- -i")
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: The option \"-i\" of sed is not portable. "+
+			"Write to a temporary file and move it back instead, or use the SUBST framework.",
+		"WARN: Makefile:5: The option \"-i\" of sed is not portable. "+
+			"Write to a temporary file and move it back instead, or use the SUBST framework.",
+		"WARN: Makefile:7: The option \"-printf\" of find is not portable. "+
+			"Use -exec with printf or stat instead.",
+		"WARN: Makefile:7: The option \"-r\" of xargs is not portable. "+
+			"Make sure that the input is not empty instead.")
+
+	// The options of the command that xargs runs are not options of xargs.
+	test(
+		"pre-configure:",
+		"	${RUN} ${XARGS} rm -rf < files",
+		"	${RUN} ${XARGS} ${RM} -f -d < files",
+		"	${RUN} ${XARGS} -n 1 ${SED} -i -e s,a,b, < files",
+		"	${RUN} ${XARGS} -n1 -r ${RM} < files")
+
+	t.CheckOutputLines(
+		"WARN: Makefile:7: The option \"-r\" of xargs is not portable. " +
+			"Make sure that the input is not empty instead.")
+
+	// The command that find runs has its own options.
+	test(
+		"pre-configure:",
+		"	${RUN} ${FIND} . -name '*.orig' -exec ${SED} -i -e s,a,b, {} \\;",
+		"	${RUN} ${FIND} . -name '*.orig' -exec rm -f {} + -printf '%p'")
+
+	t.CheckOutputLines(
+		"WARN: Makefile:5: The option \"-printf\" of find is not portable. " +
+			"Use -exec with printf or stat instead.")
+
+	// With GNU sed, the sed tool provides the GNU options.
+	test(
+		"USE_TOOLS+=\tgsed",
+		"",
+		"pre-configure:",
+		"	${RUN} ${SED} -i -e s,from,to, file")
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_SimpleCommandChecker_warnPortableOption(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	t.SetUpTool("tool", "TOOL", AtRunTime)
+	G.Project.Portability().Define("tool", "-x", "gtool", "Use -y instead.")
+	G.Project.Portability().Define("tool", "-z", "gtool", "")
+	G.Project.Portability().Define("tool", "-p", "", "Use -q instead.")
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"do-install:",
+		"	${RUN} ${TOOL} -x -z -p")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: The option \"-x\" of tool is not portable. Use -y instead.",
+		"",
+		"	Not all platforms that pkgsrc supports use the GNU implementations",
+		"	of the tools. Command line options that are only available in some",
+		"	implementations make the build fail on the other platforms.",
+		"",
+		"	Alternatively, adding \"USE_TOOLS+= gtool\" makes the GNU",
+		"	implementation of the tool available to the package.",
+		"",
+		"WARN: Makefile:4: The option \"-z\" of tool is not portable. "+
+			"Add \"USE_TOOLS+= gtool\" instead.",
+		"",
+		"	Not all platforms that pkgsrc supports use the GNU implementations",
+		"	of the tools. Command line options that are only available in some",
+		"	implementations make the build fail on the other platforms.",
+		"",
+		"WARN: Makefile:4: The option \"-p\" of tool is not portable. Use -q instead.")
+}
+
+func (s *Suite) Test_SimpleCommandChecker_toolName(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("sed", "SED", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID)
+
+	test := func(command string, expected string) {
+		cmd := &MkShSimpleCommand{Name: NewShToken(command, &ShAtom{shtText, command, shqPlain, nil})}
+		scc := NewSimpleCommandChecker(cmd, RunTime, mklines.mklines[0], mklines)
+
+		t.CheckEquals(scc.toolName(), expected)
+	}
+
+	test("sed", "sed")
+	test("${SED}", "sed")
+	test("${INSTALL}", "install")
+	test("${INSTALL_DATA}", "install")
+	test("/usr/bin/readlink", "readlink")
+	test("${UNKNOWN}", "")
+}
+
 // Before 2020-03-25, pkglint ran into a parse error since it didn't
 // know that _ULIMIT_CMD brings its own semicolon.
 func (s *Suite) Test_ShellLineChecker__skip_ULIMIT_CMD(c *check.C) {
@@ -695,6 +881,7 @@ func (s *Suite) Test_ShellLineChecker_canFail(c *check.C) {
 	t.SetUpTool("dirname", "", AtRunTime)
 	t.SetUpTool("echo", "", AtRunTime)
 	t.SetUpTool("env", "", AtRunTime)
+	t.SetUpTool("expr", "", AtRunTime)
 	t.SetUpTool("ggrep", "", AtRunTime)
 	t.SetUpTool("grep", "GREP", AtRunTime)
 	t.SetUpTool("sed", "", AtRunTime)
@@ -847,7 +1034,7 @@ func (s *Suite) Test_ShellLineChecker_checkPipeExitcode(c *check.C) {
 		"\t cat | echo | right-side",
 		"\t echo | cat | right-side",
 		"\t sed s,s,s, filename | right-side",
-		"\t sed s,s,s < input | right-side",
+		"\t sed s,s,s, < input | right-side",
 		"\t ./unknown | right-side",
 		"\t var=value | right-side",
 		"\t if :; then :; fi | right-side",
@@ -1053,7 +1240,7 @@ func (s *Suite) Test_ShellLineChecker_CheckShellCommandLine__chdir(c *check.C) {
 		// In subshells, chdir is ok.
 		"\t(cd ..)",
 		// In pipes, chdir is ok.
-		"\t{ cd .. && echo sender; } | { cd .. && sed s,sender,receiver; }",
+		"\t{ cd .. && echo sender; } | { cd .. && sed s,sender,receiver,; }",
 		// The && operator does not run in a subshell.
 		// It might be possible to warn here about chdir.
 		"\tcd .. && echo",
@@ -1297,6 +1484,7 @@ func (s *Suite) Test_ShellLineChecker_CheckShellCommandLine__sed_and_mv_autofix_
 func (s *Suite) Test_ShellLineChecker_CheckShellCommandLine__subshell(c *check.C) {
 	t := s.Init(c)
 
+	t.SetUpTool("uname", "", AtRunTime)
 	ck := t.NewShellLineChecker("\t${RUN} uname=$$(uname)")
 
 	ck.CheckShellCommandLine(ck.mkline.ShellCommand())
@@ -1444,17 +1632,37 @@ func (s *Suite) Test_ShellLineChecker_CheckShellCommand__subshell(c *check.C) {
 
 	mklines.Check()
 
-	// XXX: Fix the parse errors (nested subshells).
-	// XXX: Fix the duplicate diagnostic in line 6.
+	// The commands inside the command substitutions are checked
+	// like all other commands, even when they are nested.
+	//
 	// TODO: "(" is not a shell command, it's an operator.
 	t.CheckOutputLines(
 		"WARN: Makefile:4: The shell command \"(\" should not be hidden.",
-		"WARN: Makefile:5: Internal pkglint error in ShTokenizer.ShAtom at \"$$(echo 1024))\" (quoting=S).",
-		"WARN: Makefile:5: Invoking subshells via $(...) is not portable enough.",
-		"WARN: Makefile:6: Internal pkglint error in ShTokenizer.ShAtom at \"$$(echo 1024)))\" (quoting=S).",
+		"WARN: Makefile:5: Unknown shell command \"uname\".",
 		"WARN: Makefile:6: The shell command \"(\" should not be hidden.",
-		"WARN: Makefile:6: Internal pkglint error in ShTokenizer.ShAtom at \"$$(echo 1024)))\" (quoting=S).",
-		"WARN: Makefile:6: Invoking subshells via $(...) is not portable enough.")
+		"WARN: Makefile:6: Unknown shell command \"uname\".")
+}
+
+// The commands from command substitutions inside an arithmetic expansion
+// are checked like the commands at the top level.
+func (s *Suite) Test_ShellLineChecker_CheckShellCommand__subshell_in_arithmetic(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\techo $$(uname -r)",
+		"\techo $$((1 + $$(uname -r)))",
+		"\techo \"$$(( $$(echo 1) * ($$(uname -r) + 1) ))\"")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: Unknown shell command \"uname\".",
+		"WARN: Makefile:5: Unknown shell command \"uname\".",
+		"WARN: Makefile:6: Unknown shell command \"uname\".")
 }
 
 func (s *Suite) Test_ShellLineChecker_CheckShellCommand__case_patterns_from_variable(c *check.C) {
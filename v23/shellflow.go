@@ -0,0 +1,446 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/regex"
+	"strings"
+)
+
+// ShellFlowChecker follows the shell variables and the current working
+// directory through the commands of a single shell command line from a
+// make target, to find commands that depend on each other in a way that
+// is probably not intended.
+//
+// Since make runs each shell command line in a separate shell, the
+// analysis does not carry the variables across the boundaries between
+// the lines.
+type ShellFlowChecker struct {
+	ck *ShellLineChecker
+
+	// Whether the shell is in "set -e" mode.
+	setE bool
+
+	// The shell variables, in the order of their first appearance.
+	varnames []string
+	vars     map[string]*shellFlowVar
+
+	// The cd commands whose failure is not handled.
+	cds []*shellFlowCd
+
+	// The sequence number of the current event, to determine whether
+	// a variable is used before it is assigned.
+	seq int
+
+	walker *MkShWalker
+}
+
+// shellFlowVar records the assignments and uses of a shell variable.
+type shellFlowVar struct {
+	assigns []shellFlowEvent
+	uses    []shellFlowEvent
+
+	// Variables that are exported or used by the shell itself
+	// are used even if they don't appear in the shell program.
+	implicitlyUsed bool
+}
+
+// shellFlowEvent is an assignment or a use of a shell variable.
+type shellFlowEvent struct {
+	seq   int
+	loops []interface{} // The enclosing *MkShFor and *MkShLoop
+
+	// For uses, whether the use explicitly handles the case
+	// of an unset variable, as in ${var:-default}.
+	guarded bool
+}
+
+// shellFlowCd is a cd command whose failure is not handled.
+type shellFlowCd struct {
+	cmd *MkShSimpleCommand
+
+	// The list containing the cd command, and the index
+	// of the AndOr containing the cd command.
+	list  *MkShList
+	index int
+}
+
+func NewShellFlowChecker(ck *ShellLineChecker, setE bool) *ShellFlowChecker {
+	return &ShellFlowChecker{ck, setE, nil, make(map[string]*shellFlowVar), nil, 0, nil}
+}
+
+// Check walks the shell program and reports the problems from the
+// data flow that cannot be found by looking at each command in isolation.
+func (fc *ShellFlowChecker) Check(program *MkShList) {
+	if trace.Tracing {
+		defer trace.Call0()()
+	}
+
+	fc.walker = NewMkShWalker()
+	fc.walker.Callback.SimpleCommand = fc.simpleCommand
+	fc.walker.Callback.For = fc.forClause
+	fc.walker.Callback.Varname = func(varname string) { fc.assign(varname) }
+	fc.walker.Callback.Word = fc.word
+	fc.walker.Callback.Redirect = fc.redirect
+	fc.walker.Walk(program)
+
+	fc.checkVars()
+}
+
+func (fc *ShellFlowChecker) simpleCommand(cmd *MkShSimpleCommand) {
+	strcmd := NewStrCommand(cmd)
+	scc := NewSimpleCommandChecker(cmd, RunTime, fc.ck.mkline, fc.ck.MkLines)
+	tool := scc.toolName()
+
+	// The commands in a command substitution are only run for
+	// their output, which the enclosing command checks anyway.
+	inSubst := false
+	for _, elem := range fc.walker.Context {
+		if _, ok := elem.Element.(*ShToken); ok {
+			inSubst = true
+		}
+	}
+
+	switch {
+	case strcmd.Name == "set" && strcmd.AnyArgMatches(`^-.*e`):
+		fc.setE = true
+
+	case strcmd.Name == "cd" && !inSubst:
+		fc.rememberCd(cmd)
+
+	case strcmd.Name == "read":
+		for _, arg := range strcmd.Args {
+			if !hasPrefix(arg, "-") {
+				fc.assign(arg)
+			}
+		}
+
+	case strcmd.Name == "export", strcmd.Name == "readonly",
+		strcmd.Name == "unset", strcmd.Name == "local":
+		for _, arg := range strcmd.Args {
+			varname, _, _ := strings.Cut(arg, "=")
+			fc.variable(varname).implicitlyUsed = true
+		}
+	}
+
+	if !inSubst && fc.isDestructive(tool, strcmd) {
+		fc.checkCd(strcmd)
+	}
+
+	fc.checkInstallDestination(tool, strcmd)
+}
+
+func (fc *ShellFlowChecker) forClause(forClause *MkShFor) {
+	for _, value := range forClause.Values {
+		if cmd := fc.lsCommand(value); cmd != "" {
+			fc.ck.Warnf("Use a glob pattern instead of looping over the output of %q.", cmd)
+			fc.ck.Explain(
+				"The output of ls is split into words at whitespace,",
+				"therefore file names containing spaces are not handled correctly.",
+				"Depending on the platform, ls may also replace",
+				"special characters in the file names.",
+				"",
+				"Instead of \"for f in $$(ls *.txt)\", write \"for f in *.txt\".")
+		}
+	}
+}
+
+// lsCommand returns the command name if the word is a command
+// substitution that runs ls, otherwise the empty string.
+func (fc *ShellFlowChecker) lsCommand(word *ShToken) string {
+	isLs := func(name string) bool { return name == "ls" || name == "${LS}" }
+
+	for i, atom := range word.Atoms {
+		if list := atom.Subshell(); list != nil {
+			cmd := list.AndOrs[0].Pipes[0].Cmds[0].Simple
+			if cmd != nil && cmd.Name != nil && isLs(cmd.Name.MkText) {
+				return cmd.Name.MkText
+			}
+		}
+		if atom.MkText == "`" && atom.Quoting == shqBackt &&
+			i+1 < len(word.Atoms) && isLs(word.Atoms[i+1].MkText) {
+			return word.Atoms[i+1].MkText
+		}
+	}
+	return ""
+}
+
+func (fc *ShellFlowChecker) word(word *ShToken) {
+	fc.seq++
+	fc.use(word)
+
+	// In "var=value cmd", the variable is only assigned
+	// in the environment of the command.
+	ctx := fc.walker.Context
+	cmd, _ := fc.walker.Parent(2).(*MkShSimpleCommand)
+	if cmd != nil && cmd.Name == nil && ctx[len(ctx)-2].Index == 0 {
+		varname, _, _ := strings.Cut(word.MkText, "=")
+		fc.seq++
+		fc.assign(varname)
+	}
+}
+
+func (fc *ShellFlowChecker) redirect(redirect *MkShRedirection) {
+	fc.seq++
+	for _, m := range regcomp(`\$\$\{?([A-Za-z_]\w*)`).FindAllStringSubmatch(redirect.HereDoc, -1) {
+		fc.addUse(m[1], false)
+	}
+
+	if hasPrefix(redirect.Op, ">") || redirect.Op == "<>" {
+		fc.checkInstallWrite(redirect.Target.MkText)
+	}
+}
+
+func (fc *ShellFlowChecker) use(word *ShToken) {
+	for _, atom := range word.Atoms {
+		switch {
+		case atom.Type == shtShExpr && atom.Quoting != shqSquot && atom.Quoting != shqBacktSquot &&
+			atom.Quoting != shqSubshSquot && atom.Quoting != shqDquotBacktSquot:
+			guarded := matches(atom.MkText, `^\$\$\{\w+:?[-=+?]`)
+			fc.addUse(atom.ShVarname(), guarded)
+
+		case atom.IsArith():
+			for _, varname := range regcomp(`[A-Za-z_]\w*`).FindAllString(atom.MkText, -1) {
+				fc.addUse(varname, false)
+			}
+		}
+	}
+}
+
+func (fc *ShellFlowChecker) addUse(varname string, guarded bool) {
+	if !matches(varname, `^[A-Za-z_]\w*$`) {
+		return
+	}
+	v := fc.variable(varname)
+	v.uses = append(v.uses, shellFlowEvent{fc.seq, fc.loops(), guarded})
+}
+
+func (fc *ShellFlowChecker) assign(varname string) {
+	if !matches(varname, `^[A-Za-z_]\w*$`) {
+		return
+	}
+	v := fc.variable(varname)
+	v.assigns = append(v.assigns, shellFlowEvent{fc.seq, fc.loops(), false})
+}
+
+func (fc *ShellFlowChecker) variable(varname string) *shellFlowVar {
+	v := fc.vars[varname]
+	if v == nil {
+		v = &shellFlowVar{}
+		switch varname {
+		case "IFS", "PATH", "CDPATH", "HOME", "OPTIND", "PS4", "LANG", "LC_ALL":
+			v.implicitlyUsed = true
+		}
+		fc.vars[varname] = v
+		fc.varnames = append(fc.varnames, varname)
+	}
+	return v
+}
+
+// loops returns the loops that enclose the current element.
+func (fc *ShellFlowChecker) loops() []interface{} {
+	var loops []interface{}
+	for _, elem := range fc.walker.Context {
+		switch elem.Element.(type) {
+		case *MkShFor, *MkShLoop:
+			loops = append(loops, elem.Element)
+		}
+	}
+	return loops
+}
+
+func (fc *ShellFlowChecker) checkVars() {
+	for _, varname := range fc.varnames {
+		v := fc.vars[varname]
+		if len(v.assigns) == 0 {
+			continue
+		}
+
+		if len(v.uses) == 0 && !v.implicitlyUsed && fc.usedInLaterLine(varname) {
+			fc.ck.Warnf("The shell variable %q is assigned but never used.", varname)
+			fc.ck.Explain(
+				"Each shell command line of a make target is run in a separate shell.",
+				"Therefore a shell variable that is assigned in one line",
+				"is not available in the following lines.",
+				"",
+				"To use the variable in the following lines, join the lines",
+				"by ending each of them with a backslash.")
+			continue
+		}
+
+		if v.usedBeforeAssigned() {
+			fc.ck.Warnf("The shell variable %q is used before it is assigned.", varname)
+			fc.ck.Explain(
+				"Before the first assignment, the variable has the value",
+				"from the environment, which is usually empty.",
+				"",
+				"If this is intended, use ${var:-} to make this explicit.")
+		}
+	}
+}
+
+// usedInLaterLine returns whether one of the following shell command
+// lines of the same target uses the variable, which means that the
+// author expected the variable to be still available there.
+func (fc *ShellFlowChecker) usedInLaterLine(varname string) bool {
+	later := false
+	for _, mkline := range fc.ck.MkLines.mklines {
+		switch {
+		case mkline == fc.ck.mkline:
+			later = true
+		case !later, mkline.IsComment():
+			break
+		case !mkline.IsShellCommand():
+			return false
+		case matches(mkline.ShellCommand(), regex.Pattern(`\$\$\{?`+varname+`\b`)):
+			return true
+		}
+	}
+	return false
+}
+
+func (v *shellFlowVar) usedBeforeAssigned() bool {
+	first := v.assigns[0]
+
+	sameLoop := func(use shellFlowEvent) bool {
+		for _, assign := range v.assigns {
+			for _, loop := range assign.loops {
+				for _, useLoop := range use.loops {
+					if loop == useLoop {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+
+	for _, use := range v.uses {
+		if use.seq < first.seq && !use.guarded && !sameLoop(use) {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberCd remembers the cd command if its failure is not handled.
+func (fc *ShellFlowChecker) rememberCd(cmd *MkShSimpleCommand) {
+	ctx := fc.walker.Context
+	if len(ctx) < 5 {
+		return
+	}
+	pipeline, ok1 := ctx[len(ctx)-3].Element.(*MkShPipeline)
+	pipeIndex := ctx[len(ctx)-3].Index
+	andor, ok2 := ctx[len(ctx)-4].Element.(*MkShAndOr)
+	list, ok3 := ctx[len(ctx)-5].Element.(*MkShList)
+	if !ok1 || !ok2 || !ok3 {
+		return
+	}
+
+	if pipeline.Negated || len(pipeline.Cmds) > 1 {
+		return
+	}
+	for _, op := range andor.Ops[pipeIndex:] {
+		if op == "||" {
+			return
+		}
+	}
+
+	// In "set -e" mode, the shell exits when the last command
+	// of an AndOr fails, but not for the other commands.
+	if fc.setE && pipeIndex == len(andor.Pipes)-1 {
+		return
+	}
+
+	fc.cds = append(fc.cds, &shellFlowCd{cmd, list, ctx[len(ctx)-4].Index})
+}
+
+func (fc *ShellFlowChecker) isDestructive(tool string, strcmd *StrCommand) bool {
+	switch tool {
+	case "rm":
+		return strcmd.AnyArgMatches(`^-[A-Za-z]*[Rfr]`)
+	case "find":
+		return strcmd.HasOption("-delete")
+	}
+	return false
+}
+
+// checkCd warns if the destructive command is run after a cd command
+// whose failure is not handled.
+func (fc *ShellFlowChecker) checkCd(strcmd *StrCommand) {
+	ctx := fc.walker.Context
+	for _, cd := range fc.cds {
+		for i, elem := range ctx[:len(ctx)-1] {
+			if elem.Element != cd.list || ctx[i+1].Index <= cd.index {
+				continue
+			}
+
+			fc.ck.Warnf("If %q fails, %q runs in the wrong directory.",
+				NewStrCommand(cd.cmd).String(), strcmd.String())
+			fc.ck.Explain(
+				"When the directory cannot be changed, the following commands",
+				"are run in the current directory instead, and in this case",
+				"they delete the wrong files.",
+				"",
+				"To prevent this, write \"cd dir && command\",",
+				"or \"cd dir || exit 1\".")
+			return
+		}
+	}
+}
+
+// checkInstallDestination checks that the commands in the install
+// targets do not write outside ${DESTDIR}.
+func (fc *ShellFlowChecker) checkInstallDestination(tool string, strcmd *StrCommand) {
+	var args []string
+	for _, arg := range strcmd.Args {
+		if !hasPrefix(arg, "-") {
+			args = append(args, arg)
+		}
+	}
+
+	switch {
+	case tool == "install" && strcmd.HasOption("-d"),
+		matches(strcmd.Name, `^\$\{INSTALL_[A-Z]+_DIR\}$`),
+		tool == "mkdir":
+		for _, arg := range args {
+			// These directories are already reported by
+			// SimpleCommandChecker.checkAutoMkdirs,
+			// which suggests INSTALLATION_DIRS instead.
+			if !matches(arg, `^\$\{PREFIX(?::Q)?\}/+[^/]`) {
+				fc.checkInstallWrite(arg)
+			}
+		}
+
+	case tool == "touch", tool == "rm", tool == "rmdir":
+		for _, arg := range args {
+			fc.checkInstallWrite(arg)
+		}
+
+	case tool == "install", tool == "cp", tool == "mv", tool == "ln":
+		if len(args) >= 2 {
+			fc.checkInstallWrite(args[len(args)-1])
+		}
+	}
+}
+
+func (fc *ShellFlowChecker) checkInstallWrite(dest string) {
+	if !matches(fc.ck.MkLines.checkAllData.target, `^(?:pre|do|post)-install$`) {
+		return
+	}
+
+	path := strings.TrimLeft(dest, "\"'")
+	if hasPrefix(path, "/dev/") ||
+		!matches(path, `^(?:/|\$\{(?:PREFIX|LOCALBASE|VARBASE|PKG_SYSCONFDIR|PKG_SYSCONFBASE)(?::Q)?\})`) {
+		return
+	}
+
+	fc.ck.Warnf("Writing to %q outside ${DESTDIR} fails in unprivileged builds.", dest)
+	fc.ck.Explain(
+		"In the install phase, the files of the package are installed",
+		"into the staging directory ${DESTDIR}, from which the binary package",
+		"is created.",
+		"Files that are written outside ${DESTDIR} are not part of the package,",
+		"and writing them fails in unprivileged builds.",
+		"",
+		"To fix this, write to ${DESTDIR}${PREFIX} instead of ${PREFIX}.",
+		"Temporary files belong in ${WRKDIR}.")
+}
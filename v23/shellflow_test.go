@@ -0,0 +1,531 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_NewShellFlowChecker(c *check.C) {
+	t := s.Init(c)
+
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+
+	t.CheckEquals(fc.setE, true)
+	t.CheckLen(fc.vars, 0)
+}
+
+func (s *Suite) Test_ShellFlowChecker_Check(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} var=value",
+		"\t${RUN} ${ECHO} \"$$var\"",
+		"\t${RUN} var=value; ${ECHO} \"$$var\"")
+
+	mklines.Check()
+
+	// Each shell command line is run in its own shell,
+	// therefore the variable from line 4 is not available in line 5.
+	t.CheckOutputLines(
+		"WARN: Makefile:4: The shell variable \"var\" is assigned but never used.")
+}
+
+// Variable assignments in shell-like variables are not checked,
+// since their values are often only fragments of a shell program.
+func (s *Suite) Test_ShellFlowChecker_Check__varassign(c *check.C) {
+	t := s.Init(c)
+
+	ck := t.NewShellLineChecker("VAR=\tvar=value")
+	setE := true
+
+	ck.CheckShellCommand("var=value", &setE, RunTime)
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_ShellFlowChecker_simpleCommand(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	t.SetUpTool("rm", "RM", AtRunTime)
+	test := func(cmd string, diagnostics ...string) {
+		mklines := t.NewMkLines("Makefile",
+			MkCvsID,
+			"",
+			"pre-configure:",
+			"\t"+cmd)
+
+		mklines.Check()
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("${RUN} read line; ${ECHO} \"$$line\"",
+		nil...)
+
+	test("${RUN} read -r line; ${ECHO} \"$$line\"",
+		nil...)
+
+	// Exported variables are used by the commands that are run later.
+	test("${RUN} CFLAGS=-O2; export CFLAGS",
+		nil...)
+
+	test("${RUN} export CFLAGS=-O2",
+		nil...)
+
+	test("${RUN} unset var; var=value",
+		nil...)
+
+	// After "set -e", the shell exits if the cd fails.
+	test("set -e; cd dir; ${RM} -rf *",
+		nil...)
+}
+
+func (s *Suite) Test_ShellFlowChecker_forClause(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	t.SetUpTool("ls", "LS", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} for f in $$(ls *.txt); do ${ECHO} \"$$f\"; done",
+		"\t${RUN} for f in `${LS}`; do ${ECHO} \"$$f\"; done",
+		"\t${RUN} for f in *.txt; do ${ECHO} \"$$f\"; done",
+		"\t${RUN} for f in $$(${ECHO} *.txt); do ${ECHO} \"$$f\"; done")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: Use a glob pattern instead of looping over the output of \"ls\".",
+		"WARN: Makefile:5: Use a glob pattern instead of looping over the output of \"${LS}\".")
+}
+
+func (s *Suite) Test_ShellFlowChecker_lsCommand(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("ls", "LS", AtRunTime)
+	t.SetUpTool("sort", "SORT", AtRunTime)
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+
+	test := func(text string, expected string) {
+		program, err := parseShellProgram(ck.mkline.Line, "echo "+text)
+		assertNil(err, "")
+		word := program.AndOrs[0].Pipes[0].Cmds[0].Simple.Args[0]
+
+		t.CheckEquals(fc.lsCommand(word), expected)
+	}
+
+	test("$$(ls)", "ls")
+	test("$$(${LS} -1 | ${SORT})", "${LS}")
+	test("\"$$(ls)\"", "ls")
+	test("`ls`", "ls")
+	test("$$(${SORT} file)", "")
+	test("ls", "")
+}
+
+func (s *Suite) Test_ShellFlowChecker_word(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	t.SetUpTool("make", "MAKE", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} CC=gcc ${MAKE}",
+		"\t${RUN} i=0; i=$$((i + 1)); ${ECHO} \"$$i\"",
+		"\t${RUN} dir=$${dir:-/tmp}; ${ECHO} \"$$dir\"")
+
+	mklines.Check()
+
+	// In line 4, the variable is passed to the environment of the command.
+	// In line 5, the variable is used in the second assignment.
+	// In line 6, the variable is used before it is assigned,
+	// but the default value makes this explicit.
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_ShellFlowChecker_redirect(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	t.SetUpTool("cat", "CAT", AtRunTime)
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"do-install:",
+		"\t${RUN} ${ECHO} hello > ${PREFIX}/share/hello",
+		"\t${RUN} ${ECHO} hello > ${DESTDIR}${PREFIX}/share/hello",
+		"\t${RUN} ${ECHO} hello >> /etc/shells",
+		"\t${RUN} ${ECHO} hello 2> /dev/null",
+		"\t${RUN} ${CAT} < /etc/shells")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: Writing to \"${PREFIX}/share/hello\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		"WARN: Makefile:6: Writing to \"/etc/shells\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.")
+}
+
+func (s *Suite) Test_ShellFlowChecker_use(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+	fc.walker = NewMkShWalker()
+
+	test := func(text string, expected ...string) {
+		fc.vars = make(map[string]*shellFlowVar)
+		fc.varnames = nil
+		fc.use(NewShToken(text, NewShTokenizer(nil, text).ShAtoms()...))
+
+		t.CheckDeepEquals(fc.varnames, expected)
+	}
+
+	test("$$var", "var")
+	test("\"$${var}\"", "var")
+	test("$$1 $$? $$@")
+	test("$$((a + b * 2))", "a", "b")
+	// The words of the command substitution are not variables.
+	test("$$((a + $$(sed q) * b))", "a", "b")
+	test("'$$var'")
+	test("${MAKE_VAR}")
+}
+
+func (s *Suite) Test_ShellFlowChecker_addUse(c *check.C) {
+	t := s.Init(c)
+
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+	fc.walker = NewMkShWalker()
+
+	fc.addUse("var", false)
+	fc.addUse("var", true)
+	fc.addUse("1", false)
+
+	t.CheckDeepEquals(fc.varnames, []string{"var"})
+	t.CheckLen(fc.vars["var"].uses, 2)
+}
+
+func (s *Suite) Test_ShellFlowChecker_assign(c *check.C) {
+	t := s.Init(c)
+
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+	fc.walker = NewMkShWalker()
+
+	fc.assign("var")
+	fc.assign("${MAKE_VAR}")
+
+	t.CheckDeepEquals(fc.varnames, []string{"var"})
+	t.CheckLen(fc.vars["var"].assigns, 1)
+}
+
+func (s *Suite) Test_ShellFlowChecker_variable(c *check.C) {
+	t := s.Init(c)
+
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+
+	v := fc.variable("var")
+
+	t.CheckEquals(fc.variable("var"), v)
+	t.CheckEquals(v.implicitlyUsed, false)
+	t.CheckEquals(fc.variable("IFS").implicitlyUsed, true)
+	t.CheckDeepEquals(fc.varnames, []string{"var", "IFS"})
+}
+
+func (s *Suite) Test_ShellFlowChecker_loops(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} for f in *; do ${ECHO} \"$$prev\"; prev=$$f; done",
+		"\t${RUN} while :; do ${ECHO} \"$$n\"; n=1; done",
+		"\t${RUN} for f in *; do ${ECHO} \"$$f\" \"$$n\"; done; n=1")
+
+	mklines.Check()
+
+	// In the loops, the use in the next iteration
+	// sees the value from the previous iteration.
+	t.CheckOutputLines(
+		"WARN: Makefile:6: The shell variable \"n\" is used before it is assigned.")
+}
+
+func (s *Suite) Test_ShellFlowChecker_checkVars(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} ${ECHO} \"$$var\"; var=value; ${ECHO} \"$$var\"",
+		"\t${RUN} unused=value",
+		"\t${RUN} IFS=:",
+		"\t${RUN} ${ECHO} \"$$HOME\" \"$$unused\"")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: The shell variable \"var\" is used before it is assigned.",
+		"",
+		"\tBefore the first assignment, the variable has the value from the",
+		"\tenvironment, which is usually empty.",
+		"",
+		"\tIf this is intended, use ${var:-} to make this explicit.",
+		"",
+		"WARN: Makefile:5: The shell variable \"unused\" is assigned but never used.",
+		"",
+		"\tEach shell command line of a make target is run in a separate shell.",
+		"\tTherefore a shell variable that is assigned in one line is not",
+		"\tavailable in the following lines.",
+		"",
+		"\tTo use the variable in the following lines, join the lines by ending",
+		"\teach of them with a backslash.",
+		"")
+}
+
+func (s *Suite) Test_ShellFlowChecker_usedInLaterLine(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} var=value",
+		"\t${RUN} other=value",
+		"# comment",
+		"\t${RUN} ${ECHO} \"$${var}\"",
+		"",
+		"post-configure:",
+		"\t${RUN} ${ECHO} \"$$other\"")
+
+	mklines.Check()
+
+	// The variable "other" is only used in a different target,
+	// which is not what the author of line 5 intended,
+	// since the lines of different targets are far apart.
+	t.CheckOutputLines(
+		"WARN: Makefile:4: The shell variable \"var\" is assigned but never used.")
+}
+
+func (s *Suite) Test_shellFlowVar_usedBeforeAssigned(c *check.C) {
+	t := s.Init(c)
+
+	loop := &MkShLoop{}
+	test := func(v *shellFlowVar, expected bool) {
+		t.CheckEquals(v.usedBeforeAssigned(), expected)
+	}
+
+	test(&shellFlowVar{
+		assigns: []shellFlowEvent{{2, nil, false}},
+		uses:    []shellFlowEvent{{1, nil, false}}},
+		true)
+
+	test(&shellFlowVar{
+		assigns: []shellFlowEvent{{1, nil, false}},
+		uses:    []shellFlowEvent{{2, nil, false}}},
+		false)
+
+	test(&shellFlowVar{
+		assigns: []shellFlowEvent{{2, nil, false}},
+		uses:    []shellFlowEvent{{1, nil, true}}},
+		false)
+
+	test(&shellFlowVar{
+		assigns: []shellFlowEvent{{2, []interface{}{loop}, false}},
+		uses:    []shellFlowEvent{{1, []interface{}{loop}, false}}},
+		false)
+
+	test(&shellFlowVar{
+		assigns: []shellFlowEvent{{2, []interface{}{loop}, false}},
+		uses:    []shellFlowEvent{{1, []interface{}{&MkShLoop{}}, false}}},
+		true)
+}
+
+func (s *Suite) Test_ShellFlowChecker_rememberCd(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	t.SetUpTool("rm", "RM", AtRunTime)
+	test := func(cmd string, diagnostics ...string) {
+		mklines := t.NewMkLines("Makefile",
+			MkCvsID,
+			"",
+			"pre-configure:",
+			"\t"+cmd)
+
+		mklines.Check()
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("${RUN} cd dir; ${RM} -rf *",
+		nil...)
+
+	test("${RUN} cd dir && ${ECHO} ok; ${RM} -rf *",
+		"WARN: Makefile:4: If \"cd dir\" fails, \"${RM} -rf *\" runs in the wrong directory.")
+
+	test("${RUN} cd dir || exit 1; ${RM} -rf *",
+		nil...)
+
+	test("${RUN} cd dir && ${ECHO} ok || exit 1; ${RM} -rf *",
+		nil...)
+
+	test("cd dir; ${RM} -rf *",
+		"WARN: Makefile:4: Switch to \"set -e\" mode before using a semicolon "+
+			"(after \"cd dir\") to separate commands.",
+		"WARN: Makefile:4: If \"cd dir\" fails, \"${RM} -rf *\" runs in the wrong directory.")
+
+	test("cd dir && ${RM} -rf *",
+		nil...)
+
+	test("! cd dir; ${RM} -rf *",
+		"WARN: Makefile:4: Switch to \"set -e\" mode before using a semicolon "+
+			"(after \"cd dir\") to separate commands.")
+
+	// In command substitutions, the cd is not checked.
+	test("x=$$(cd dir; ${RM} -rf y)",
+		"WARN: Makefile:4: Switch to \"set -e\" mode before using a semicolon "+
+			"(after \"cd dir\") to separate commands.")
+}
+
+func (s *Suite) Test_ShellFlowChecker_isDestructive(c *check.C) {
+	t := s.Init(c)
+
+	ck := t.NewShellLineChecker("\techo")
+	fc := NewShellFlowChecker(ck, true)
+
+	test := func(tool string, args []string, expected bool) {
+		strcmd := &StrCommand{nil, tool, args}
+		t.CheckEquals(fc.isDestructive(tool, strcmd), expected)
+	}
+
+	test("rm", []string{"-rf", "*"}, true)
+	test("rm", []string{"-R", "dir"}, true)
+	test("rm", []string{"-f", "file"}, true)
+	test("rm", []string{"file"}, false)
+	test("find", []string{".", "-name", "*.o", "-delete"}, true)
+	test("find", []string{".", "-name", "*.o"}, false)
+	test("echo", []string{"-rf"}, false)
+}
+
+func (s *Suite) Test_ShellFlowChecker_checkCd(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	t.SetUpTool("find", "FIND", AtRunTime)
+	t.SetUpTool("rm", "RM", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"pre-configure:",
+		"\t${RUN} cd dir && :; for f in *; do ${RM} -f \"$$f\"; done",
+		"\t${RUN} (cd dir && :); ${FIND} . -delete",
+		"\t${RUN} ${RM} -rf *; cd dir && :")
+
+	mklines.Check()
+
+	// In line 5, the cd only affects the subshell.
+	// In line 6, the destructive command runs before the cd.
+	t.CheckOutputLines(
+		"WARN: Makefile:4: If \"cd dir\" fails, \"${RM} -f \\\"$$f\\\"\" runs in the wrong directory.",
+		"",
+		"\tWhen the directory cannot be changed, the following commands are run",
+		"\tin the current directory instead, and in this case they delete the",
+		"\twrong files.",
+		"",
+		"\tTo prevent this, write \"cd dir && command\", or \"cd dir || exit 1\".",
+		"")
+}
+
+func (s *Suite) Test_ShellFlowChecker_checkInstallDestination(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVartypes()
+	t.SetUpTool("cp", "CP", AtRunTime)
+	t.SetUpTool("ln", "LN", AtRunTime)
+	t.SetUpTool("mkdir", "MKDIR", AtRunTime)
+	t.SetUpTool("touch", "TOUCH", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"post-install:",
+		"\t${RUN} ${INSTALL_DATA} file ${PREFIX}/share/pkgbase/",
+		"\t${RUN} ${INSTALL_DATA} file ${DESTDIR}${PREFIX}/share/pkgbase/",
+		"\t${RUN} ${INSTALL_DATA_DIR} ${PKG_SYSCONFDIR}",
+		"\t${RUN} ${INSTALL} -d -m 755 /var/db/pkgbase",
+		"\t${RUN} ${LN} -s ${PREFIX}/bin/program ${WRKDIR}/program",
+		"\t${RUN} ${LN} -s program ${PREFIX}/bin/alias",
+		"\t${RUN} ${MKDIR} -p \"${LOCALBASE}/share\"",
+		"\t${RUN} ${INSTALL_DATA_DIR} ${PREFIX}/share/pkgbase",
+		"\t${RUN} ${TOUCH} ${WRKDIR}/.installed",
+		"",
+		"post-build:",
+		"\t${RUN} ${TOUCH} ${PREFIX}/share/pkgbase/file")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: Writing to \"${PREFIX}/share/pkgbase/\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		"WARN: Makefile:6: Writing to \"${PKG_SYSCONFDIR}\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		"WARN: Makefile:7: Writing to \"/var/db/pkgbase\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		"WARN: Makefile:9: Writing to \"${PREFIX}/bin/alias\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		"WARN: Makefile:10: Writing to \"\\\"${LOCALBASE}/share\\\"\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		// The directories below ${PREFIX} are already
+		// covered by checkAutoMkdirs.
+		"NOTE: Makefile:11: You can use \"INSTALLATION_DIRS+= share/pkgbase\" "+
+			"instead of \"${INSTALL_DATA_DIR}\".")
+}
+
+func (s *Suite) Test_ShellFlowChecker_checkInstallWrite(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall", "--explain")
+	t.SetUpVartypes()
+	t.SetUpTool("echo", "ECHO", AtRunTime)
+	mklines := t.NewMkLines("Makefile",
+		MkCvsID,
+		"",
+		"do-install:",
+		"\t${RUN} ${ECHO} > ${VARBASE}/log/pkgbase",
+		"\t${RUN} ${ECHO} > '/tmp/file'",
+		"\t${RUN} ${ECHO} > relative/file")
+
+	mklines.Check()
+
+	t.CheckOutputLines(
+		"WARN: Makefile:4: Writing to \"${VARBASE}/log/pkgbase\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.",
+		"",
+		"\tIn the install phase, the files of the package are installed into",
+		"\tthe staging directory ${DESTDIR}, from which the binary package is",
+		"\tcreated. Files that are written outside ${DESTDIR} are not part of",
+		"\tthe package, and writing them fails in unprivileged builds.",
+		"",
+		"\tTo fix this, write to ${DESTDIR}${PREFIX} instead of ${PREFIX}.",
+		"\tTemporary files belong in ${WRKDIR}.",
+		"",
+		"WARN: Makefile:5: Writing to \"'/tmp/file'\" "+
+			"outside ${DESTDIR} fails in unprivileged builds.")
+}
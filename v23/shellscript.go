@@ -0,0 +1,409 @@
+package pkglint
+
+import (
+	"path"
+	"strings"
+)
+
+// Checks for shell scripts that are not embedded in makefiles,
+// such as the INSTALL and DEINSTALL scripts and the rc.d scripts
+// and other shell scripts from the files/ directory.
+
+// CheckFileShellScript checks the INSTALL and DEINSTALL scripts as well as
+// the shell scripts from the files/ directory.
+// Other files from the files/ directory are skipped.
+func CheckFileShellScript(filename CurrPath, pkg *Package) {
+	if trace.Tracing {
+		defer trace.Call(filename)()
+	}
+
+	basename := filename.Base()
+	installScript := basename == "INSTALL" || basename == "DEINSTALL"
+
+	lines := Load(filename, 0)
+	if lines == nil {
+		return
+	}
+
+	// The INSTALL and DEINSTALL scripts are fragments of the +INSTALL
+	// and +DEINSTALL scripts, which are always run by /bin/sh.
+	isShell, posix := true, true
+	if !installScript {
+		isShell, posix = shellScriptInterpreter(lines)
+	}
+	if !isShell {
+		return
+	}
+
+	ck := ShellScriptChecker{lines, pkg, posix, false, nil, nil}
+	ck.Check()
+
+	if !installScript {
+		// The INSTALL and DEINSTALL scripts are already checked
+		// by CheckFileOther.
+		CheckLinesTrailingEmptyLines(lines)
+	}
+}
+
+// shellScriptInterpreter determines from the "#!" line whether the file is
+// a shell script and whether that script is run by a POSIX shell,
+// as opposed to bash or ksh.
+func shellScriptInterpreter(lines *Lines) (isShell, posix bool) {
+	if lines.Len() == 0 || !hasPrefix(lines.Lines[0].Text, "#!") {
+		return lines.BaseName.HasSuffixText(".sh"), true
+	}
+
+	interpreter := strings.Fields(lines.Lines[0].Text[2:])
+	if len(interpreter) >= 2 && path.Base(interpreter[0]) == "env" {
+		interpreter = interpreter[1:]
+	}
+	if len(interpreter) == 0 {
+		return false, false
+	}
+
+	switch path.Base(interpreter[0]) {
+	case "sh", "@SH@", "@RCD_SCRIPTS_SHELL@":
+		return true, true
+	case "bash", "ksh", "ksh93", "mksh", "zsh", "@BASH@", "@KSH@":
+		return true, false
+	}
+	return false, false
+}
+
+// ShellScriptChecker checks a shell script that is not part of a
+// makefile, using the same shell parser as for the shell commands
+// in makefiles.
+type ShellScriptChecker struct {
+	lines *Lines
+	pkg   *Package
+
+	// Whether the script is run by /bin/sh, which on many platforms
+	// only provides the POSIX features.
+	posix bool
+
+	// Whether the script is an rc.d script that uses the rc.subr framework.
+	rcd bool
+
+	// For each line, whether it is part of a here-document.
+	hereDoc []bool
+
+	// For each word of the parsed shell program, the line on which it appears.
+	wordLines map[*ShToken]*Line
+}
+
+func (ck *ShellScriptChecker) Check() {
+	ck.checkPlaceholders()
+	ck.rcd = ck.isRcd()
+
+	program := ck.program()
+	if ck.posix {
+		ck.checkBashismsText()
+	}
+
+	list := ck.parse(program)
+	if list == nil {
+		return
+	}
+
+	walker := NewMkShWalker()
+	walker.Callback.SimpleCommand = ck.checkSimpleCommand
+	walker.Walk(list)
+}
+
+// isRcd returns whether the script is an rc.d script,
+// by looking for the typical commands from rc.subr.
+func (ck *ShellScriptChecker) isRcd() bool {
+	for _, line := range ck.lines.Lines {
+		if matches(line.Text, `^\s*(?:\.\s+/etc/rc\.subr(?:$|[\s;])|run_rc_command\b)`) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPlaceholders checks that each placeholder of the form @VARNAME@ is
+// replaced with its actual value when the package is built or installed.
+func (ck *ShellScriptChecker) checkPlaceholders() {
+	if ck.pkg == nil {
+		return
+	}
+
+	defined := ck.definedPlaceholders()
+	reported := make(map[string]bool)
+
+	for _, line := range ck.lines.Lines {
+		for _, m := range regcomp(`@([A-Z][0-9A-Z_]*)@`).FindAllStringSubmatch(line.Text, -1) {
+			name := m[1]
+			if filesSubstPlaceholders[name] || defined[name] || reported[name] {
+				continue
+			}
+			reported[name] = true
+
+			line.Warnf("The placeholder @%s@ is neither in FILES_SUBST nor in SUBST_VARS.", name)
+			line.Explain(
+				"Placeholders of the form @VARNAME@ are only replaced with",
+				"their actual values if the package says so.",
+				"",
+				"For the INSTALL and DEINSTALL scripts and for the rc.d scripts,",
+				"this is done by adding VARNAME=${VARNAME:Q} to FILES_SUBST.",
+				"For other files, the SUBST framework can do this,",
+				"by adding VARNAME to SUBST_VARS.",
+				"",
+				seeGuide("The SUBST framework", "fixes.subst"))
+		}
+	}
+}
+
+// definedPlaceholders returns the placeholders that the package
+// substitutes via FILES_SUBST, SUBST_VARS or SUBST_SED.
+func (ck *ShellScriptChecker) definedPlaceholders() map[string]bool {
+	defined := make(map[string]bool)
+
+	ck.pkg.vars.forEach(func(varname string, data *scopeVar) {
+		for _, field := range strings.Fields(data.value) {
+			switch {
+			case varname == "FILES_SUBST":
+				if m, name := match1(field, `^(\w+)=`); m {
+					defined[name] = true
+				}
+			case hasPrefix(varname, "SUBST_VARS."):
+				defined[field] = true
+			}
+		}
+
+		for _, m := range regcomp(`@(\w+)@`).FindAllStringSubmatch(data.value, -1) {
+			defined[m[1]] = true
+		}
+	})
+
+	return defined
+}
+
+// program returns the text of the shell script in the form that is
+// understood by the shell parser, which is the same as in makefiles.
+//
+// It also remembers which lines belong to here-documents,
+// for the checks that work on the plain text of the lines.
+func (ck *ShellScriptChecker) program() string {
+	ck.hereDoc = make([]bool, ck.lines.Len())
+
+	texts := make([]string, ck.lines.Len())
+	delimiter := ""
+	stripTabs := false
+	for i, line := range ck.lines.Lines {
+		text := line.Text
+
+		if delimiter != "" {
+			ck.hereDoc[i] = true
+			end := text
+			if stripTabs {
+				end = strings.TrimLeft(end, "\t")
+			}
+			if end == delimiter {
+				delimiter = ""
+			}
+		} else if !hasPrefix(strings.TrimLeft(text, " \t"), "#") {
+			m, dash, word := match2(text, `<<(-?)[\t ]*\\?["']?(\w+)`)
+			if m {
+				delimiter = word
+				stripTabs = dash != ""
+			}
+		}
+
+		texts[i] = strings.ReplaceAll(text, "$", "$$")
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// checkBashismsText checks for syntax that is only available in bash and
+// ksh but not in the POSIX shell.
+//
+// The bashisms that affect a whole command are checked in
+// checkBashismsCommand.
+func (ck *ShellScriptChecker) checkBashismsText() {
+	for i, line := range ck.lines.Lines {
+		text := line.Text
+		if ck.hereDoc[i] || hasPrefix(strings.TrimLeft(text, " \t"), "#") {
+			continue
+		}
+
+		if matches(text, `^[\t ]*function[\t ]+\w+`) {
+			ck.warnBashism(line, "The keyword \"function\" is not available in POSIX sh.")
+		}
+		if matches(text, `\$\{\w+/`) {
+			ck.warnBashism(line, "The pattern substitution ${var/pattern/replacement} is not available in POSIX sh.")
+		}
+		if matches(text, `\$\{\w+:\d`) {
+			ck.warnBashism(line, "The substring expansion ${var:offset:length} is not available in POSIX sh.")
+		}
+		if contains(text, "&>") {
+			ck.warnBashism(line, "The redirection \"&>\" is not available in POSIX sh.")
+		}
+	}
+}
+
+// parse splits the program into tokens and parses them,
+// remembering for each word the line on which it appears.
+func (ck *ShellScriptChecker) parse(program string) *MkShList {
+	lineno := 0
+	counted := 0
+	lineAt := func(offset int) *Line {
+		lineno += strings.Count(program[counted:offset], "\n")
+		counted = offset
+		return ck.lines.Lines[lineno]
+	}
+
+	p := NewShTokenizer(nil, program)
+	var tokens []string
+	var tokenLines []*Line
+	for {
+		token := p.ShToken()
+		if token == nil {
+			break
+		}
+		end := len(program) - len(p.Rest())
+		tokens = append(tokens, token.MkText)
+		tokenLines = append(tokenLines, lineAt(end-len(token.MkText)))
+	}
+
+	if rest := p.Rest(); rest != "" {
+		if ck.posix {
+			lineAt(len(program)-len(rest)).Warnf("Cannot parse shell script at %q.",
+				shorten(strings.ReplaceAll(rest, "$$", "$"), 20))
+		}
+		return nil
+	}
+
+	// The parser requires at least one command, while a script that
+	// consists of comments and empty lines only is valid as well.
+	empty := true
+	for _, token := range tokens {
+		if !hasPrefix(token, "#") && token != ";" && strings.Trim(token, "\n") != "" {
+			empty = false
+		}
+	}
+	if empty {
+		return nil
+	}
+
+	lexer := NewShellLexer(tokens, "")
+	lexer.wordIndex = make(map[*ShToken]int)
+	parser := shyyParserImpl{}
+	if parser.Parse(lexer) != 0 {
+		if ck.posix {
+			index := len(tokens) - len(lexer.remaining) - 1
+			tokenLines[index].Warnf("Syntax error in shell script near %q.",
+				strings.ReplaceAll(lexer.current, "$$", "$"))
+		}
+		return nil
+	}
+
+	ck.wordLines = make(map[*ShToken]*Line)
+	for word, index := range lexer.wordIndex {
+		ck.wordLines[word] = tokenLines[index]
+	}
+	return lexer.result
+}
+
+func (ck *ShellScriptChecker) checkSimpleCommand(cmd *MkShSimpleCommand) {
+	if cmd.Name == nil {
+		return
+	}
+
+	if ck.posix {
+		ck.checkBashismsCommand(cmd)
+	}
+
+	if G.WarnQuoting && !ck.isRcdIdiom(cmd) {
+		for _, arg := range cmd.Args {
+			ck.checkWordQuoting(arg)
+		}
+	}
+}
+
+// isRcdIdiom returns whether the command is one of the standard commands
+// from rc.subr, such as "load_rc_config $name", whose arguments are
+// traditionally not quoted.
+func (ck *ShellScriptChecker) isRcdIdiom(cmd *MkShSimpleCommand) bool {
+	if !ck.rcd {
+		return false
+	}
+	switch cmd.Name.MkText {
+	case "load_rc_config", "run_rc_command":
+		return true
+	}
+	return false
+}
+
+func (ck *ShellScriptChecker) checkBashismsCommand(cmd *MkShSimpleCommand) {
+	line := ck.wordLines[cmd.Name]
+	strcmd := NewStrCommand(cmd)
+
+	switch strcmd.Name {
+	case "[[", "declare", "let", "popd", "pushd", "shopt", "source", "typeset":
+		ck.warnBashism(line, "The command %q is not available in POSIX sh.", strcmd.Name)
+
+	case "[", "test":
+		if strcmd.HasOption("==") {
+			ck.warnBashism(line, "The operator \"==\" is not available in POSIX sh. Use \"=\" instead.")
+		}
+
+	case "echo":
+		if len(strcmd.Args) > 0 && matches(strcmd.Args[0], `^-[En]*e[En]*$`) {
+			ck.warnBashism(line, "The option \"-e\" of echo is not portable. Use printf instead.")
+		}
+	}
+}
+
+// checkWordQuoting checks that the shell variables in a command argument
+// are quoted, like in the shell commands from makefiles.
+//
+// See ShellLineChecker.checkShExprPlain.
+func (ck *ShellScriptChecker) checkWordQuoting(word *ShToken) {
+	for _, atom := range word.Atoms {
+		if atom.Type != shtShExpr || atom.Quoting != shqPlain {
+			continue
+		}
+
+		shVarname := atom.ShVarname()
+		// In rc.d scripts, the positional parameters are the commands
+		// such as "start" or "stop", and the variables "name" and "rcvar"
+		// are simple identifiers. None of them contains whitespace.
+		if ck.rcd && (matches(shVarname, `^\d$`) || shVarname == "name" || shVarname == "rcvar") {
+			continue
+		}
+		if (*ShellLineChecker).variableNeedsQuoting(nil, shVarname) {
+			warnUnquotedShellVariable(ck.wordLines[word], shVarname)
+		}
+	}
+}
+
+func (ck *ShellScriptChecker) warnBashism(line *Line, format string, args ...interface{}) {
+	line.Warnf(format, args...)
+	line.Explain(
+		"This script is run by /bin/sh, which on many platforms",
+		"only provides the features of the POSIX shell.",
+		"",
+		"Either rewrite this part of the script using only POSIX features,",
+		"or let the script be run by bash explicitly.")
+}
+
+// filesSubstPlaceholders contains the placeholders that the pkgsrc
+// infrastructure adds to FILES_SUBST for every package.
+var filesSubstPlaceholders = map[string]bool{
+	"AWK": true, "BASENAME": true, "CAT": true, "CHGRP": true,
+	"CHMOD": true, "CHOWN": true, "CMP": true, "CONF_DEPENDS": true,
+	"CP": true, "DIRNAME": true, "ECHO": true, "ECHO_N": true,
+	"EGREP": true, "EXPR": true, "FALSE": true, "FIND": true,
+	"GREP": true, "HEAD": true, "ID": true, "LN": true,
+	"LOCALBASE": true, "LS": true, "MKDIR": true, "MV": true,
+	"PERL5": true, "PKGBASE": true, "PKGMANDIR": true, "PKGNAME": true,
+	"PKG_ADMIN": true, "PKG_INFO": true, "PKG_INSTALLATION_TYPE": true,
+	"PKG_SYSCONFBASE": true, "PKG_SYSCONFBASEDIR": true, "PKG_SYSCONFDIR": true,
+	"PREFIX": true, "PWD_CMD": true, "RCD_SCRIPTS_SHELL": true, "RM": true,
+	"RMDIR": true, "SED": true, "SETENV": true, "SH": true,
+	"SORT": true, "SU": true, "TEST": true, "TOUCH": true,
+	"TR": true, "TRUE": true, "VARBASE": true, "X11BASE": true,
+	"XARGS": true,
+}
@@ -0,0 +1,553 @@
+package pkglint
+
+import (
+	"gopkg.in/check.v1"
+	"sort"
+)
+
+func (s *Suite) Test_CheckFileShellScript__INSTALL(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/INSTALL",
+		"# $NetBSD$",
+		"",
+		"case ${STAGE} in",
+		"POST-INSTALL)",
+		"\tif [ -f @PKG_SYSCONFDIR@/package.conf ]; then",
+		"\t\t${ECHO} \"Config file exists\"",
+		"\tfi",
+		"\t;;",
+		"esac",
+		"")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"NOTE: ~/category/package/INSTALL:10: Trailing empty lines.")
+}
+
+func (s *Suite) Test_CheckFileShellScript__INSTALL_empty(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.CreateFileLines("category/package/INSTALL")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputLines(
+		"ERROR: ~/category/package/INSTALL: Must not be empty.")
+}
+
+// Just for code coverage.
+func (s *Suite) Test_CheckFileShellScript__no_tracing(c *check.C) {
+	t := s.Init(c)
+
+	t.DisableTracing()
+
+	CheckFileShellScript(t.File("INSTALL"), nil)
+
+	// The error is reported by CheckFileOther instead.
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_CheckFileShellScript__files(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"RCD_SCRIPTS=\tpackage")
+	t.CreateFileLines("category/package/files/package.sh",
+		"#!@RCD_SCRIPTS_SHELL@",
+		"#",
+		"# PROVIDE: package",
+		"# REQUIRE: DAEMON",
+		"",
+		"if [ -f /etc/rc.subr ]; then",
+		"\t. /etc/rc.subr",
+		"fi",
+		"",
+		"name=\"package\"",
+		"rcvar=$name",
+		"command=\"@PREFIX@/sbin/${name}d\"",
+		"pidfile=\"@VARBASE@/run/${name}.pid\"",
+		"required_files=\"@PKG_SYSCONFDIR@/${name}.conf\"",
+		"command_args=\"-c @DAEMON_CONF@\"",
+		"",
+		"load_rc_config $name",
+		"run_rc_command \"$1\"")
+	t.CreateFileLines("category/package/files/helper",
+		"#! /usr/bin/env bash",
+		"[[ -f file ]] && echo $var")
+	t.CreateFileLines("category/package/files/script.pl",
+		"#! @PERL5@",
+		"print \"@UNDEFINED@\\n\";")
+	t.CreateFileLines("category/package/files/README.pkgsrc",
+		"This file is not a shell script; @UNDEFINED@.")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	// The file script.pl is not a shell script and is therefore not checked.
+	// The same applies to README.pkgsrc.
+	t.CheckOutputLines(
+		"WARN: ~/category/package/files/helper:2: Unquoted shell variable \"var\".",
+		"WARN: ~/category/package/files/package.sh:15: "+
+			"The placeholder @DAEMON_CONF@ is neither in FILES_SUBST nor in SUBST_VARS.")
+}
+
+// Shell scripts that consist of comments only are valid,
+// even though the shell grammar requires at least one command.
+func (s *Suite) Test_CheckFileShellScript__comments_only(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"RCD_SCRIPTS=\tpackage")
+	t.CreateFileLines("category/package/files/package.sh",
+		"#!@RCD_SCRIPTS_SHELL@")
+	t.CreateFileLines("category/package/files/comments.sh",
+		"#!/bin/sh",
+		"",
+		"# nothing here",
+		"",
+		";")
+	t.FinishSetUp()
+
+	G.Check(t.File("category/package"))
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_CheckFileShellScript__without_package(c *check.C) {
+	t := s.Init(c)
+
+	t.CreateFileLines("files/script.sh",
+		"echo \"@UNDEFINED@\"",
+		"echo $var")
+
+	CheckFileShellScript(t.File("files/script.sh"), nil)
+
+	// Without a package, pkglint cannot know which placeholders
+	// are defined.
+	t.CheckOutputLines(
+		"WARN: ~/files/script.sh:2: Unquoted shell variable \"var\".")
+}
+
+func (s *Suite) Test_shellScriptInterpreter(c *check.C) {
+	t := s.Init(c)
+
+	test := func(filename CurrPath, firstLine string, isShell, posix bool) {
+		var lines *Lines
+		if firstLine != "" {
+			lines = t.NewLines(filename, firstLine)
+		} else {
+			lines = t.NewLines(filename)
+		}
+
+		actualIsShell, actualPosix := shellScriptInterpreter(lines)
+
+		t.CheckDeepEquals(
+			[]bool{actualIsShell, actualPosix},
+			[]bool{isShell, posix})
+	}
+
+	test("script", "#! /bin/sh", true, true)
+	test("script", "#!/bin/sh -e", true, true)
+	test("script", "#!@SH@", true, true)
+	test("script", "#!@RCD_SCRIPTS_SHELL@", true, true)
+	test("script", "#! /usr/bin/env sh", true, true)
+	test("script", "#!/bin/bash", true, false)
+	test("script", "#!/usr/bin/env bash", true, false)
+	test("script", "#!@KSH@", true, false)
+	test("script", "#!@PERL5@", false, false)
+	test("script", "#!/usr/bin/env", false, false)
+	test("script", "#!", false, false)
+
+	// Without an interpreter line, the filename decides.
+	test("script.sh", "echo", true, true)
+	test("script.sh", "", true, true)
+	test("script", "echo", false, true)
+	test("script.pl", "", false, true)
+}
+
+func (s *Suite) Test_ShellScriptChecker_Check(c *check.C) {
+	t := s.Init(c)
+
+	lines := t.NewLines("script.sh",
+		"#! /bin/sh",
+		"",
+		"if [[ -f $1 ]]; then",
+		"\tsource $1",
+		"fi",
+		"",
+		"cat <<EOF",
+		"In here-documents, $variables are not checked.",
+		"if then",
+		"EOF",
+		"",
+		"dir=\"$(dirname $1)\"",
+		"echo \"$(( $(wc -l < $1) + 1 ))\"")
+	ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+
+	ck.Check()
+
+	// The commands in command substitutions are checked as well.
+	// Arithmetic expansions are not analyzed further.
+	t.CheckOutputLines(
+		"WARN: script.sh:3: The command \"[[\" is not available in POSIX sh.",
+		"WARN: script.sh:3: Unquoted shell variable \"1\".",
+		"WARN: script.sh:4: The command \"source\" is not available in POSIX sh.",
+		"WARN: script.sh:4: Unquoted shell variable \"1\".",
+		"WARN: script.sh:12: Unquoted shell variable \"1\".")
+}
+
+func (s *Suite) Test_ShellScriptChecker_isRcd(c *check.C) {
+	t := s.Init(c)
+
+	test := func(text string, rcd bool) {
+		lines := t.NewLines("script.sh",
+			"#!/bin/sh",
+			text)
+		ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+
+		t.CheckEquals(ck.isRcd(), rcd)
+	}
+
+	test("\t. /etc/rc.subr", true)
+	test("run_rc_command \"$1\"", true)
+	test("echo run_rc_command", false)
+	test(". /etc/rc.subr.local", false)
+	test("# . /etc/rc.subr", false)
+}
+
+func (s *Suite) Test_ShellScriptChecker_checkPlaceholders(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"FILES_SUBST+=\tFILES_VAR=${FILES_VAR:Q} OTHER=other",
+		"SUBST_CLASSES+=\tvars sed",
+		"SUBST_STAGE.vars=\tpre-configure",
+		"SUBST_FILES.vars=\tscript.sh",
+		"SUBST_VARS.vars=\tSUBST_VAR",
+		"SUBST_STAGE.sed=\tpre-configure",
+		"SUBST_FILES.sed=\tscript.sh",
+		"SUBST_SED.sed=\t-e s,@SED_VAR@,value,")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	pkg.load()
+	lines := t.NewLines("script.sh",
+		"echo @PREFIX@ @FILES_VAR@ @OTHER@ @SUBST_VAR@ @SED_VAR@",
+		"echo @UNDEFINED@ @UNDEFINED@ @lowercase@",
+		"echo @UNDEFINED@")
+	ck := ShellScriptChecker{lines, pkg, true, false, nil, nil}
+
+	ck.checkPlaceholders()
+
+	// Each undefined placeholder is only reported once.
+	t.CheckOutputLines(
+		"WARN: script.sh:2: The placeholder @UNDEFINED@ " +
+			"is neither in FILES_SUBST nor in SUBST_VARS.")
+}
+
+func (s *Suite) Test_ShellScriptChecker_definedPlaceholders(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"FILES_SUBST+=\tFILES_VAR=${FILES_VAR:Q}",
+		"FILES_SUBST+=\tOTHER=other",
+		"SUBST_VARS.vars=\tSUBST_VAR OTHER_SUBST_VAR",
+		"SUBST_SED.sed=\t-e s,@SED_VAR@,value,")
+	t.FinishSetUp()
+	pkg := NewPackage(t.File("category/package"))
+	pkg.load()
+	ck := ShellScriptChecker{nil, pkg, true, false, nil, nil}
+
+	defined := ck.definedPlaceholders()
+
+	t.CheckDeepEquals(defined, map[string]bool{
+		"FILES_VAR":       true,
+		"OTHER":           true,
+		"SUBST_VAR":       true,
+		"OTHER_SUBST_VAR": true,
+		"SED_VAR":         true})
+}
+
+func (s *Suite) Test_ShellScriptChecker_program(c *check.C) {
+	t := s.Init(c)
+
+	lines := t.NewLines("script.sh",
+		"echo $var ${var}",
+		"cat <<EOF >file",
+		"here-document with $var and ' and \"",
+		"EOF",
+		"cat <<-'EOF'",
+		"\tindented",
+		"\tEOF",
+		"# <<EOF in a comment",
+		"echo done")
+	ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+
+	program := ck.program()
+
+	t.CheckEquals(program, ""+
+		"echo $$var $${var}\n"+
+		"cat <<EOF >file\n"+
+		"here-document with $$var and ' and \"\n"+
+		"EOF\n"+
+		"cat <<-'EOF'\n"+
+		"\tindented\n"+
+		"\tEOF\n"+
+		"# <<EOF in a comment\n"+
+		"echo done")
+	t.CheckDeepEquals(ck.hereDoc,
+		[]bool{false, false, true, true, false, true, true, false, false})
+}
+
+func (s *Suite) Test_ShellScriptChecker_checkBashismsText(c *check.C) {
+	t := s.Init(c)
+
+	lines := t.NewLines("script.sh",
+		"function name {",
+		"echo ${var/from/to} ${var//from/to}",
+		"echo ${var:1:2} ${var:-1}",
+		"command &> /dev/null",
+		"# function in a comment",
+		"cat <<EOF",
+		"function name in a here-document",
+		"EOF",
+		"echo ${var%/*} ${var#*:} 2>&1")
+	ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+	_ = ck.program()
+
+	ck.checkBashismsText()
+
+	t.CheckOutputLines(
+		"WARN: script.sh:1: The keyword \"function\" is not available in POSIX sh.",
+		"WARN: script.sh:2: The pattern substitution ${var/pattern/replacement} "+
+			"is not available in POSIX sh.",
+		"WARN: script.sh:3: The substring expansion ${var:offset:length} "+
+			"is not available in POSIX sh.",
+		"WARN: script.sh:4: The redirection \"&>\" is not available in POSIX sh.")
+}
+
+func (s *Suite) Test_ShellScriptChecker_parse(c *check.C) {
+	t := s.Init(c)
+
+	// parse returns the words from the parsed program,
+	// each prefixed with its line number.
+	parse := func(posix bool, text ...string) []string {
+		lines := t.NewLines("script.sh", text...)
+		ck := ShellScriptChecker{lines, nil, posix, false, nil, nil}
+
+		list := ck.parse(ck.program())
+
+		if list == nil {
+			return nil
+		}
+		var words []string
+		for word, line := range ck.wordLines {
+			words = append(words, sprintf("%d %s", line.Location.lineno, word.MkText))
+		}
+		sort.Strings(words)
+		return words
+	}
+
+	words := parse(true,
+		"if true; then",
+		"\techo \\",
+		"\t    continued",
+		"fi # comment",
+		"",
+		"echo \"multi-line",
+		"string\" 'also",
+		"quoted'; echo $var")
+
+	t.CheckDeepEquals(words, []string{
+		"1 true",
+		"2 echo",
+		"3 continued",
+		"6 \"multi-line\nstring\"",
+		"6 echo",
+		"7 'also\nquoted'",
+		"8 $$var",
+		"8 echo"})
+	t.CheckOutputEmpty()
+
+	words = parse(true,
+		"if true; then",
+		"\techo",
+		"done")
+
+	t.CheckNil(words)
+	t.CheckOutputLines(
+		"WARN: script.sh:3: Syntax error in shell script near \"done\".")
+
+	words = parse(true,
+		"#!/bin/sh",
+		"# nothing here",
+		"",
+		";")
+
+	t.CheckNil(words)
+	t.CheckOutputEmpty()
+
+	words = parse(true,
+		"echo ok",
+		"echo \"unfinished")
+
+	t.CheckNil(words)
+	t.CheckOutputLines(
+		"WARN: script.sh:2: Cannot parse shell script at \"\\\"unfinished\".")
+
+	// Scripts for bash or ksh may use syntax that pkglint doesn't know.
+	words = parse(false,
+		"if true; then",
+		"\techo",
+		"done")
+
+	t.CheckNil(words)
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_ShellScriptChecker_checkSimpleCommand(c *check.C) {
+	t := s.Init(c)
+
+	test := func(posix bool, text ...string) {
+		lines := t.NewLines("script.sh", text...)
+		ck := ShellScriptChecker{lines, nil, posix, false, nil, nil}
+		list := ck.parse(ck.program())
+
+		walker := NewMkShWalker()
+		walker.Callback.SimpleCommand = ck.checkSimpleCommand
+		walker.Walk(list)
+	}
+
+	test(true,
+		"var=$value",
+		"> $file",
+		"$command $arg",
+		"source \"$file\"")
+
+	t.CheckOutputLines(
+		"WARN: script.sh:3: Unquoted shell variable \"arg\".",
+		"WARN: script.sh:4: The command \"source\" is not available in POSIX sh.")
+
+	// In bash scripts, only the quoting is checked.
+	test(false,
+		"source $var")
+
+	t.CheckOutputLines(
+		"WARN: script.sh:1: Unquoted shell variable \"var\".")
+
+	t.SetUpCommandLine("-Wall,no-quoting")
+
+	test(true,
+		"echo $var")
+
+	t.CheckOutputEmpty()
+}
+
+func (s *Suite) Test_ShellScriptChecker_isRcdIdiom(c *check.C) {
+	t := s.Init(c)
+
+	test := func(lines ...string) {
+		ck := ShellScriptChecker{t.NewLines("script.sh", lines...), nil, true, false, nil, nil}
+
+		ck.Check()
+	}
+
+	test(
+		"#!/bin/sh",
+		". /etc/rc.subr",
+		"load_rc_config $daemon",
+		"run_rc_command $cmd",
+		"echo $cmd")
+
+	// Outside rc.d scripts, these commands are not special.
+	test(
+		"#!/bin/sh",
+		"load_rc_config $daemon")
+
+	t.CheckOutputLines(
+		"WARN: script.sh:5: Unquoted shell variable \"cmd\".",
+		"WARN: script.sh:2: Unquoted shell variable \"daemon\".")
+}
+
+func (s *Suite) Test_ShellScriptChecker_checkBashismsCommand(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpCommandLine("-Wall,no-quoting")
+	lines := t.NewLines("script.sh",
+		"declare -a array",
+		"let i=i+1",
+		"pushd dir; popd",
+		"shopt -s extglob",
+		"typeset -i i",
+		"[ \"$a\" == \"$b\" ]",
+		"test \"$a\" = \"$b\"",
+		"echo -e \"a\\tb\"",
+		"echo -ne \"a\\tb\"",
+		"echo \"-e\" -e",
+		"echo -n \"no newline\"")
+	ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+
+	ck.Check()
+
+	t.CheckOutputLines(
+		"WARN: script.sh:1: The command \"declare\" is not available in POSIX sh.",
+		"WARN: script.sh:2: The command \"let\" is not available in POSIX sh.",
+		"WARN: script.sh:3: The command \"pushd\" is not available in POSIX sh.",
+		"WARN: script.sh:3: The command \"popd\" is not available in POSIX sh.",
+		"WARN: script.sh:4: The command \"shopt\" is not available in POSIX sh.",
+		"WARN: script.sh:5: The command \"typeset\" is not available in POSIX sh.",
+		"WARN: script.sh:6: The operator \"==\" is not available in POSIX sh. Use \"=\" instead.",
+		"WARN: script.sh:8: The option \"-e\" of echo is not portable. Use printf instead.",
+		"WARN: script.sh:9: The option \"-e\" of echo is not portable. Use printf instead.")
+}
+
+func (s *Suite) Test_ShellScriptChecker_checkWordQuoting(c *check.C) {
+	t := s.Init(c)
+
+	lines := t.NewLines("script.sh",
+		"echo $var \"$var\" '$var' ${var} \"${var}\"",
+		"echo $# $? $$ $dir $prefix $1 $@",
+		"echo prefix$var \"prefix\"$var")
+	ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+
+	ck.Check()
+
+	t.CheckOutputLines(
+		"WARN: script.sh:1: Unquoted shell variable \"var\".",
+		"WARN: script.sh:1: Unquoted shell variable \"var\".",
+		"WARN: script.sh:2: Unquoted shell variable \"1\".",
+		"WARN: script.sh:2: Unquoted shell variable \"@\".",
+		"WARN: script.sh:3: Unquoted shell variable \"var\".",
+		"WARN: script.sh:3: Unquoted shell variable \"var\".")
+}
+
+// In rc.d scripts, the positional parameters and the variables "name" and
+// "rcvar" don't contain whitespace, therefore they need not be quoted.
+func (s *Suite) Test_ShellScriptChecker_checkWordQuoting__rcd(c *check.C) {
+	t := s.Init(c)
+
+	lines := t.NewLines("package.sh",
+		"#!@RCD_SCRIPTS_SHELL@",
+		". /etc/rc.subr",
+		"name=package",
+		"rcvar=$name",
+		"package_start() {",
+		"\tcase $1 in",
+		"\tstart|stop) echo ${1#s} $name $rcvar $2;;",
+		"\t*) echo $command_args;;",
+		"\tesac",
+		"}",
+		"load_rc_config $name",
+		"run_rc_command $1")
+	ck := ShellScriptChecker{lines, nil, true, false, nil, nil}
+
+	ck.Check()
+
+	t.CheckOutputLines(
+		"WARN: package.sh:8: Unquoted shell variable \"command_args\".")
+}
@@ -0,0 +1,169 @@
+package pkglint
+
+import (
+	"github.com/rillig/pkglint/v23/getopt"
+	"strings"
+)
+
+// VarQuery shows how a variable gets its value in a package,
+// similar to "bmake show-var VARNAME=...", but without requiring
+// a bootstrapped pkgsrc installation.
+//
+// See "pkglint show-var".
+type VarQuery struct {
+	pkg      *Package
+	allLines *MkLines // The package Makefile, including the included files.
+}
+
+// varAssignmentSite is a single assignment to a variable,
+// together with the conditions that enclose it.
+type varAssignmentSite struct {
+	mkline *MkLine
+	conds  []string // From the outermost to the innermost, e.g. ".if ${OPSYS} == NetBSD".
+}
+
+func NewVarQuery(pkg *Package, allLines *MkLines) *VarQuery {
+	return &VarQuery{pkg, allLines}
+}
+
+// Write prints the value of the variable,
+// followed by all the places where the variable is assigned.
+func (q *VarQuery) Write(out *SeparatorWriter, varname string) {
+	out.Separate()
+
+	_, found, _ := q.pkg.vars.LastValueFound(varname)
+	if !found {
+		out.WriteLine(sprintf("%s is not defined in the package.", varname))
+		return
+	}
+
+	e := NewMkExprEvaluator(&q.pkg.vars, q.pkg.File("."), "")
+	value, known := e.EvalExpr(NewMkExpr(varname))
+	out.WriteLine(sprintf("%s=\t%s", varname, value))
+	if !known {
+		out.WriteLine("\tpkglint could not determine the value completely.")
+	}
+
+	sites := q.sites(varname)
+	for _, site := range sites {
+		if len(site.conds) > 0 {
+			out.WriteLine("\tThe value assumes that all conditions are true.")
+			break
+		}
+	}
+	if len(sites) == 0 {
+		out.WriteLine("\tThe variable is defined by the pkgsrc infrastructure.")
+	}
+
+	for i, site := range sites {
+		mkline := site.mkline
+		out.WriteLine(sprintf("\t%s:%s: %s",
+			q.pkg.Rel(mkline.Filename()).String(), mkline.Linenos(), mkline.Text))
+
+		explanation := q.explain(site, sites[:i])
+		if len(site.conds) > 0 {
+			explanation += ", inside " + strings.Join(site.conds, " and ")
+		}
+		out.WriteLine("\t\t" + explanation)
+	}
+}
+
+// sites returns the assignments to the variable, in the order in which
+// bmake processes them.
+func (q *VarQuery) sites(varname string) []varAssignmentSite {
+	var sites []varAssignmentSite
+	var conds []string
+
+	for _, mkline := range q.allLines.mklines {
+		switch {
+		case mkline.IsVarassign() && mkline.Varname() == varname:
+			sites = append(sites, varAssignmentSite{mkline, append([]string(nil), conds...)})
+
+		case !mkline.IsDirective():
+			break
+
+		case hasPrefix(mkline.Directive(), "if") || mkline.Directive() == "for":
+			conds = append(conds, sprintf(".%s %s", mkline.Directive(), mkline.Args()))
+
+		case len(conds) == 0:
+			break
+
+		case hasPrefix(mkline.Directive(), "elif"):
+			conds[len(conds)-1] = sprintf(".%s %s", mkline.Directive(), mkline.Args())
+
+		case mkline.Directive() == "else":
+			conds[len(conds)-1] = ".else of " + conds[len(conds)-1]
+
+		case mkline.Directive() == "endif" || mkline.Directive() == "endfor":
+			conds = conds[:len(conds)-1]
+		}
+	}
+	return sites
+}
+
+// explain describes the effect of the assignment,
+// given the previous assignments to the same variable.
+func (q *VarQuery) explain(site varAssignmentSite, prev []varAssignmentSite) string {
+	switch site.mkline.Op() {
+	case opAssignShell:
+		return "sets the value to the output of the shell command, " +
+			"which pkglint cannot determine"
+	case opAssignEval:
+		return "sets the value, expanding the expressions at this point"
+	case opAssignAppend:
+		return "appends to the value"
+	case opAssignDefault:
+		if len(prev) == 0 {
+			return "sets the default value"
+		}
+		for _, p := range prev {
+			if len(p.conds) == 0 {
+				return "has no effect since the variable is already defined"
+			}
+		}
+		return "sets the default value unless the variable is already defined"
+	}
+	return condStr(len(prev) == 0, "sets the value", "overwrites the previous value")
+}
+
+// mainShowVar implements "pkglint show-var", which prints the values of
+// the given variables in a package, together with the places where they
+// are assigned.
+func mainShowVar(args []string) int {
+	p := &G
+	opts := getopt.NewOptions()
+	var dir string
+	opts.AddStrVar('C', "directory", &dir, ".", "the package directory")
+
+	usage := "pkglint show-var [options] varname..."
+	varnames, exitCode := p.parseCommandOptions(opts, args, usage)
+	if exitCode != -1 {
+		return exitCode
+	}
+	if len(varnames) == 0 {
+		p.Logger.TechErrorf("", "The variable names are missing.")
+		return 1
+	}
+
+	p.Todo.Push(NewCurrPathSlash(dir))
+	p.prepareMainLoop()
+	if p.Pkgsrc == nil {
+		G.Logger.TechFatalf(p.Todo.Front(), "Must be inside a pkgsrc tree.")
+	}
+
+	pkg := NewPackage(p.Todo.Pop())
+	_, _, allLines := pkg.load()
+	if allLines == nil {
+		return 1
+	}
+
+	q := NewVarQuery(pkg, allLines)
+	for _, varname := range varnames {
+		q.Write(p.Logger.out, varname)
+	}
+
+	if p.Logger.errors != 0 {
+		return 1
+	}
+	return 0
+}
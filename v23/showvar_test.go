@@ -0,0 +1,187 @@
+package pkglint
+
+import "gopkg.in/check.v1"
+
+func (s *Suite) Test_NewVarQuery(c *check.C) {
+	t := s.Init(c)
+
+	pkg := NewPackage(t.File("category/package"))
+	q := NewVarQuery(pkg, nil)
+
+	t.CheckEquals(q.pkg, pkg)
+}
+
+func (s *Suite) Test_VarQuery_Write(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"PKGNAME=\t${DISTNAME:S,-,-lib-,}",
+		"CONFIGURE_ARGS+=\t--enable-a",
+		".if ${OPSYS} == NetBSD",
+		"CONFIGURE_ARGS+=\t--enable-b",
+		".else",
+		"CONFIGURE_ARGS?=\t--enable-c",
+		".endif",
+		"HOST!=\thostname")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+	q := NewVarQuery(pkg, allLines)
+
+	q.Write(G.Logger.out, "PKGNAME")
+	q.Write(G.Logger.out, "CONFIGURE_ARGS")
+	q.Write(G.Logger.out, "HOST")
+	q.Write(G.Logger.out, "UNDEFINED")
+
+	t.CheckOutputLines(
+		"PKGNAME=\tpackage-lib-1.0",
+		"\tMakefile:4: PKGNAME=\t${DISTNAME:S,-,-lib-,}",
+		"\t\tsets the value",
+		"",
+		"CONFIGURE_ARGS=\t--enable-a --enable-b",
+		"\tThe value assumes that all conditions are true.",
+		"\tMakefile:20: CONFIGURE_ARGS+=\t--enable-a",
+		"\t\tappends to the value",
+		"\tMakefile:22: CONFIGURE_ARGS+=\t--enable-b",
+		"\t\tappends to the value, inside .if ${OPSYS} == NetBSD",
+		"\tMakefile:24: CONFIGURE_ARGS?=\t--enable-c",
+		"\t\thas no effect since the variable is already defined, "+
+			"inside .else of .if ${OPSYS} == NetBSD",
+		"",
+		"HOST=\t",
+		"\tpkglint could not determine the value completely.",
+		"\tMakefile:26: HOST!=\thostname",
+		"\t\tsets the value to the output of the shell command, "+
+			"which pkglint cannot determine",
+		"",
+		"UNDEFINED is not defined in the package.")
+}
+
+func (s *Suite) Test_VarQuery_Write__infrastructure(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+	q := NewVarQuery(pkg, allLines)
+
+	q.Write(G.Logger.out, "FILESDIR")
+
+	t.CheckOutputLines(
+		"FILESDIR=\tfiles",
+		"\tThe variable is defined by the pkgsrc infrastructure.")
+}
+
+func (s *Suite) Test_VarQuery_sites(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		".for i in 1 2",
+		".  if ${i} == 1",
+		"VAR=\tone",
+		".  elif ${i} == 2",
+		"VAR=\ttwo",
+		".  endif",
+		".endfor",
+		"VAR:=\t${VAR}")
+	t.FinishSetUp()
+
+	pkg := NewPackage(t.File("category/package"))
+	_, _, allLines := pkg.load()
+	q := NewVarQuery(pkg, allLines)
+
+	sites := q.sites("VAR")
+
+	t.CheckLen(sites, 3)
+	t.CheckDeepEquals(sites[0].conds, []string{".for i in 1 2", ".if ${i} == 1"})
+	t.CheckDeepEquals(sites[1].conds, []string{".for i in 1 2", ".elif ${i} == 2"})
+	t.CheckLen(sites[2].conds, 0)
+}
+
+func (s *Suite) Test_VarQuery_explain(c *check.C) {
+	t := s.Init(c)
+
+	q := NewVarQuery(nil, nil)
+	site := func(text string, conds ...string) varAssignmentSite {
+		return varAssignmentSite{t.NewMkLine("filename.mk", 123, text), conds}
+	}
+	test := func(s varAssignmentSite, prev []varAssignmentSite, explanation string) {
+		t.CheckEquals(q.explain(s, prev), explanation)
+	}
+
+	unconditional := []varAssignmentSite{site("VAR=\tvalue")}
+	conditional := []varAssignmentSite{site("VAR=\tvalue", ".if 1")}
+
+	test(site("VAR=\tvalue"), nil, "sets the value")
+	test(site("VAR=\tvalue"), unconditional, "overwrites the previous value")
+	test(site("VAR:=\tvalue"), nil, "sets the value, expanding the expressions at this point")
+	test(site("VAR+=\tvalue"), nil, "appends to the value")
+	test(site("VAR?=\tvalue"), nil, "sets the default value")
+	test(site("VAR?=\tvalue"), unconditional, "has no effect since the variable is already defined")
+	test(site("VAR?=\tvalue"), conditional, "sets the default value unless the variable is already defined")
+	test(site("VAR!=\tvalue"), nil,
+		"sets the value to the output of the shell command, which pkglint cannot determine")
+}
+
+func (s *Suite) Test_mainShowVar(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package",
+		"CONFIGURE_ARGS=\t--prefix=${PREFIX:Q}",
+		"CONFIGURE_ARGS+=\t--disable-static")
+
+	exitCode := t.Main("show-var", "-C", "category/package", "CONFIGURE_ARGS", "DISTNAME")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"CONFIGURE_ARGS=\t--prefix= --disable-static",
+		"\tpkglint could not determine the value completely.",
+		"\tMakefile:20: CONFIGURE_ARGS=\t--prefix=${PREFIX:Q}",
+		"\t\tsets the value",
+		"\tMakefile:21: CONFIGURE_ARGS+=\t--disable-static",
+		"\t\tappends to the value",
+		"",
+		"DISTNAME=\tpackage-1.0",
+		"\tMakefile:3: DISTNAME=\tpackage-1.0",
+		"\t\tsets the value")
+}
+
+func (s *Suite) Test_mainShowVar__missing_varnames(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("show-var")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"ERROR: The variable names are missing.")
+}
+
+func (s *Suite) Test_mainShowVar__missing_Makefile(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpPackage("category/package")
+	t.Remove("category/package/Makefile")
+
+	exitCode := t.Main("show-var", "-C", "category/package", "COMMENT")
+
+	t.CheckEquals(exitCode, 1)
+	t.CheckOutputLines(
+		"ERROR: ~/category/package/Makefile: Cannot be read.")
+}
+
+func (s *Suite) Test_mainShowVar__help(c *check.C) {
+	t := s.Init(c)
+
+	exitCode := t.Main("show-var", "--help")
+
+	t.CheckEquals(exitCode, 0)
+	t.CheckOutputLines(
+		"usage: pkglint show-var [options] varname...",
+		"",
+		"  -C, --directory   the package directory",
+		"  -d, --debug       log verbose call traces for debugging",
+		"  -h, --help        show a detailed usage message")
+}
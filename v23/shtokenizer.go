@@ -1,14 +1,45 @@
 package pkglint
 
-import "github.com/rillig/pkglint/v23/textproc"
+import (
+	"github.com/rillig/pkglint/v23/textproc"
+	"strings"
+)
 
 type ShTokenizer struct {
 	parser *MkLexer
 	inWord bool
+
+	// For each command substitution $$(...) and each parenthesis
+	// inside it, the quoting state after the closing parenthesis.
+	subshells []ShQuoting
+
+	// After a here-document operator, << or <<-, the next word is the
+	// delimiter of the here-document.
+	hereDocOp string
+
+	// The here-documents whose bodies start after the next newline.
+	hereDocs []shHereDoc
+
+	// Whether the next atoms are the bodies of the here-documents.
+	inHereDocs bool
+
+	// The arithmetic expansions $$((...)) that have been started but not
+	// yet finished, since they contain command substitutions.
+	ariths []shArith
+}
+
+type shArith struct {
+	parens    int // The number of open parentheses.
+	subshells int // The number of subshells outside the expansion.
+}
+
+type shHereDoc struct {
+	delimiter string
+	stripTabs bool // For <<-, the leading tabs of the lines are removed.
 }
 
 func NewShTokenizer(diag Autofixer, text string) *ShTokenizer {
-	return &ShTokenizer{NewMkLexer(text, diag), false}
+	return &ShTokenizer{NewMkLexer(text, diag), false, nil, "", nil, false, nil}
 }
 
 // ShAtom parses a basic building block of a shell program.
@@ -21,6 +52,14 @@ func (p *ShTokenizer) ShAtom(quoting ShQuoting) *ShAtom {
 		return nil
 	}
 
+	if p.inHereDocs {
+		return p.shHereDoc(quoting)
+	}
+
+	if n := len(p.ariths); n > 0 && p.ariths[n-1].subshells == len(p.subshells) {
+		return p.shArith(quoting)
+	}
+
 	lexer := p.parser.lexer
 	mark := lexer.Mark()
 
@@ -82,7 +121,8 @@ func (p *ShTokenizer) shAtomPlain() *ShAtom {
 	lexer := p.parser.lexer
 	mark := lexer.Mark()
 	switch {
-	case lexer.NextHspace() != "":
+	case lexer.NextHspace() != "",
+		lexer.SkipString("\\\n"): // Only in multi-line shell programs.
 		return &ShAtom{shtSpace, lexer.Since(mark), q, nil}
 	case lexer.SkipByte('"'):
 		return &ShAtom{shtText, lexer.Since(mark), shqDquot, nil}
@@ -91,13 +131,13 @@ func (p *ShTokenizer) shAtomPlain() *ShAtom {
 	case lexer.SkipByte('`'):
 		return &ShAtom{shtText, lexer.Since(mark), shqBackt, nil}
 	case lexer.PeekByte() == '#' && !inWord:
-		rest := lexer.Rest()
-		lexer.Skip(len(rest))
-		return &ShAtom{shtComment, rest, q, nil}
-	case lexer.SkipString("$$("):
-		return &ShAtom{shtSubshell, lexer.Since(mark), shqSubsh, nil}
+		lexer.NextBytesFunc(func(b byte) bool { return b != '\n' })
+		return &ShAtom{shtComment, lexer.Since(mark), q, nil}
 	}
 
+	if atom := p.shDollarParen(q); atom != nil {
+		return atom
+	}
 	return p.shAtomInternal(q, false, false)
 }
 
@@ -110,6 +150,9 @@ func (p *ShTokenizer) shAtomDquot() *ShAtom {
 	case lexer.SkipByte('`'):
 		return &ShAtom{shtText, lexer.Since(mark), shqDquotBackt, nil}
 	}
+	if atom := p.shDollarParen(shqDquot); atom != nil {
+		return atom
+	}
 	return p.shAtomInternal(shqDquot, true, false)
 }
 
@@ -162,6 +205,9 @@ func (p *ShTokenizer) shAtomSubsh() *ShAtom {
 		return &ShAtom{shtText, lexer.Since(mark), shqSubshBackt, nil}
 	case lexer.SkipRegexp(regcomp(`^#[^)]*`)):
 		return &ShAtom{shtComment, lexer.Since(mark), q, nil}
+	case lexer.SkipByte('('):
+		p.subshells = append(p.subshells, q)
+		return &ShAtom{shtOperator, lexer.Since(mark), q, nil}
 	case lexer.SkipByte(')'):
 		// The closing parenthesis can have multiple meanings:
 		// - end of a subshell, such as (echo "in a subshell")
@@ -171,7 +217,14 @@ func (p *ShTokenizer) shAtomSubsh() *ShAtom {
 		// could be shtText since it is part of a text node. On the
 		// other hand, pkglint doesn't tokenize shell programs correctly
 		// anyway. This needs to be fixed someday.
-		return &ShAtom{shtOperator, lexer.Since(mark), shqPlain, nil}
+		//
+		// Since the case patterns are not distinguished from the other
+		// parentheses, a case statement inside $$(...) ends the command
+		// substitution too early.
+		return &ShAtom{shtOperator, lexer.Since(mark), p.leaveSubshell(), nil}
+	}
+	if atom := p.shDollarParen(q); atom != nil {
+		return atom
 	}
 	if op := p.shOperator(q); op != nil {
 		return op
@@ -231,6 +284,9 @@ func (p *ShTokenizer) shAtomSubshDquot() *ShAtom {
 	case lexer.SkipByte('"'):
 		return &ShAtom{shtText, lexer.Since(mark), shqSubsh, nil}
 	}
+	if atom := p.shDollarParen(q); atom != nil {
+		return atom
+	}
 	return p.shAtomInternal(q, true, false)
 }
 
@@ -306,11 +362,11 @@ loop:
 		switch {
 		case lexer.SkipRegexp(regcomp(`^[!#%*+,\-./0-9:=?@A-Z\[\]^_a-z{}~]+`)):
 			break
-		case dquot && lexer.SkipRegexp(regcomp(`^[\t &'();<>|]+`)):
+		case dquot && lexer.SkipRegexp(regcomp(`^[\t\n &'();<>|]+`)):
 			break
 		case squot && lexer.SkipByte('`'):
 			break
-		case squot && lexer.SkipRegexp(regcomp(`^[\t "&();<>\\|]+`)):
+		case squot && lexer.SkipRegexp(regcomp(`^[\t\n "&();<>\\|]+`)):
 			break
 		case squot && lexer.SkipString("$$"):
 			break
@@ -379,10 +435,156 @@ func (p *ShTokenizer) shExpr(q ShQuoting) *ShAtom {
 	return &ShAtom{shtShExpr, lexer.Since(beforeDollar), q, shVarname}
 }
 
+// shDollarParen parses either the start of a command substitution $$(...)
+// or a complete arithmetic expansion $$((...)).
+func (p *ShTokenizer) shDollarParen(q ShQuoting) *ShAtom {
+	lexer := p.parser.lexer
+	mark := lexer.Mark()
+
+	if p.isArith() {
+		p.ariths = append(p.ariths, shArith{0, len(p.subshells)})
+		return p.shArith(q)
+	}
+
+	if lexer.SkipString("$$(") {
+		p.subshells = append(p.subshells, q)
+		return &ShAtom{shtSubshell, lexer.Since(mark), shqSubsh, nil}
+	}
+	return nil
+}
+
+// isArith returns whether the text starts with an arithmetic expansion
+// like $$((i + 1)).
+//
+// Text that starts with $$(( but whose parentheses don't match is a
+// command substitution that starts with a subshell instead, as in
+// $$((cd dir) && pwd).
+func (p *ShTokenizer) isArith() bool {
+	lexer := p.parser.lexer
+	mark := lexer.Mark()
+	defer lexer.Reset(mark)
+
+	if !lexer.SkipString("$$((") {
+		return false
+	}
+
+	depth := 2
+	for depth > 0 && !lexer.EOF() {
+		switch {
+		case p.parser.Expr() != nil,
+			lexer.SkipString("$$"):
+			break
+		case lexer.SkipByte('('):
+			depth++
+		case lexer.SkipByte(')'):
+			depth--
+			if depth == 1 {
+				// The two closing parentheses must be adjacent.
+				if !lexer.SkipByte(')') {
+					return false
+				}
+				depth = 0
+			}
+		default:
+			lexer.Skip(1)
+		}
+	}
+
+	return depth == 0
+}
+
+// shArith parses the text of the current arithmetic expansion,
+// up to its end or up to the next command substitution.
+//
+// Usually the whole arithmetic expansion becomes a single text atom.
+// The command substitutions inside it are parsed like everywhere else,
+// to make their commands available for the checks.
+// In that case, the arithmetic expansion is split into several atoms.
+func (p *ShTokenizer) shArith(q ShQuoting) *ShAtom {
+	lexer := p.parser.lexer
+	mark := lexer.Mark()
+	arith := &p.ariths[len(p.ariths)-1]
+
+	text := func() *ShAtom { return &ShAtom{shtText, lexer.Since(mark), q, true} }
+
+	for {
+		rest := lexer.Rest()
+		switch {
+		case lexer.EOF():
+			p.ariths = p.ariths[:len(p.ariths)-1]
+			return text()
+		case arith.parens > 0 && hasPrefix(rest, "$$(") && !hasPrefix(rest, "$$(("):
+			if lexer.Since(mark) != "" {
+				return text()
+			}
+			lexer.Skip(3)
+			p.subshells = append(p.subshells, q)
+			return &ShAtom{shtSubshell, lexer.Since(mark), shqSubsh, nil}
+		case p.parser.Expr() != nil,
+			lexer.SkipString("$$"):
+			break
+		case lexer.SkipByte('('):
+			arith.parens++
+		case lexer.SkipByte(')'):
+			arith.parens--
+			if arith.parens == 1 && lexer.SkipByte(')') {
+				arith.parens = 0
+			}
+			if arith.parens <= 0 {
+				p.ariths = p.ariths[:len(p.ariths)-1]
+				p.inWord = true
+				return text()
+			}
+		default:
+			lexer.Skip(1)
+		}
+	}
+}
+
+// leaveSubshell returns the quoting state after the closing parenthesis
+// of a command substitution or a parenthesis inside it.
+func (p *ShTokenizer) leaveSubshell() ShQuoting {
+	n := len(p.subshells)
+	if n == 0 {
+		return shqPlain
+	}
+	q := p.subshells[n-1]
+	p.subshells = p.subshells[:n-1]
+	return q
+}
+
+// shHereDoc reads the body of the next pending here-document,
+// up to and including the line with the delimiter.
+func (p *ShTokenizer) shHereDoc(q ShQuoting) *ShAtom {
+	lexer := p.parser.lexer
+	mark := lexer.Mark()
+
+	hereDoc := p.hereDocs[0]
+	for !lexer.EOF() {
+		line := lexer.NextBytesFunc(func(b byte) bool { return b != '\n' })
+		lexer.SkipByte('\n')
+		if hereDoc.stripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == hereDoc.delimiter {
+			break
+		}
+	}
+
+	p.hereDocs = p.hereDocs[1:]
+	p.inHereDocs = len(p.hereDocs) > 0
+	return &ShAtom{shtHereDoc, lexer.Since(mark), q, nil}
+}
+
 func (p *ShTokenizer) shOperator(q ShQuoting) *ShAtom {
 	lexer := p.parser.lexer
 	mark := lexer.Mark()
 	switch {
+	case len(p.hereDocs) > 0 && lexer.SkipByte('\n'):
+		// The bodies of the here-documents start directly after the
+		// first newline, which must therefore not be merged with the
+		// following empty lines.
+		return &ShAtom{shtOperator, lexer.Since(mark), q, nil}
 	case lexer.SkipString("||"),
 		lexer.SkipString("&&"),
 		lexer.SkipString(";;"),
@@ -433,6 +635,7 @@ func (p *ShTokenizer) ShToken() *ShToken {
 
 	lexer := p.parser.lexer
 	initialMark := lexer.Mark()
+	subshells := append([]ShQuoting(nil), p.subshells...)
 
 	for peek() != nil && peek().Type == shtSpace {
 		skip()
@@ -454,7 +657,9 @@ func (p *ShTokenizer) ShToken() *ShToken {
 	}
 
 	if !curr.Type.IsWord() && q != shqSubsh {
-		return NewShToken(curr.MkText, curr)
+		token := NewShToken(curr.MkText, curr)
+		p.rememberHereDoc(token)
+		return token
 	}
 
 	var atoms []*ShAtom
@@ -471,10 +676,41 @@ func (p *ShTokenizer) ShToken() *ShToken {
 
 	if q != shqPlain {
 		lexer.Reset(initialMark)
+		p.subshells = subshells
 		return nil
 	}
 
-	return NewShToken(lexer.Since(initialMark), atoms...)
+	token := NewShToken(lexer.Since(initialMark), atoms...)
+	p.rememberHereDoc(token)
+	return token
+}
+
+// rememberHereDoc keeps track of the here-documents, whose bodies start
+// after the next newline.
+//
+// Example:
+//
+//	cat <<EOF
+//	body
+//	EOF
+func (p *ShTokenizer) rememberHereDoc(token *ShToken) {
+	if token.Atoms[0].Type == shtOperator {
+		p.hereDocOp = ""
+		if m, op := match1(token.MkText, `^\d*(<<-?)$`); m {
+			p.hereDocOp = op
+		}
+		if token.MkText == "\n" && len(p.hereDocs) > 0 {
+			p.inHereDocs = true
+		}
+		return
+	}
+
+	if p.hereDocOp != "" && token.Atoms[0].Type.IsWord() {
+		// Quoting the delimiter only affects the expansions in the body.
+		delimiter := strings.NewReplacer("\"", "", "'", "", "\\", "").Replace(token.MkText)
+		p.hereDocs = append(p.hereDocs, shHereDoc{delimiter, p.hereDocOp == "<<-"})
+	}
+	p.hereDocOp = ""
 }
 
 func (p *ShTokenizer) Rest() string {
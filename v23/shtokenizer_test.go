@@ -156,6 +156,7 @@ func (s *Suite) Test_ShTokenizer_ShAtom(c *check.C) {
 	}
 	shvar := func(text, varname string) *ShAtom { return &ShAtom{shtShExpr, text, shqPlain, varname} }
 	text := func(s string) *ShAtom { return atom(shtText, s) }
+	arith := func(s string) *ShAtom { return &ShAtom{shtText, s, shqPlain, true} }
 	whitespace := func(s string) *ShAtom { return atom(shtSpace, s) }
 
 	space := whitespace(" ")
@@ -184,7 +185,7 @@ func (s *Suite) Test_ShTokenizer_ShAtom(c *check.C) {
 	// Ignore unused functions; useful for deleting some of the tests during debugging.
 	use := func(args ...interface{}) {}
 	use(testRest, test, atoms)
-	use(operator, comment, mkvar, text, whitespace)
+	use(operator, comment, mkvar, text, arith, whitespace)
 	use(space, semicolon, pipe, subshell, shvar)
 	use(backt, dquot, squot, subsh)
 	use(backtDquot, backtSquot, dquotBackt, subshDquot, subshSquot)
@@ -427,6 +428,29 @@ func (s *Suite) Test_ShTokenizer_ShAtom(c *check.C) {
 		comment("# comment"))
 	test("no#comment",
 		text("no#comment"))
+
+	// In multi-line shell programs, a comment ends at the end of the line.
+	test("# comment\necho",
+		comment("# comment"),
+		operator("\n"),
+		text("echo"))
+
+	// In multi-line shell programs, an escaped newline is whitespace.
+	test("echo \\\ncontinued",
+		text("echo"),
+		space,
+		whitespace("\\\n"),
+		text("continued"))
+
+	// In multi-line shell programs, strings may span multiple lines.
+	test("\"multi\nline\" 'multi\nline'",
+		dquot(text("\"")),
+		dquot(text("multi\nline")),
+		text("\""),
+		space,
+		squot(text("'")),
+		squot(text("multi\nline")),
+		text("'"))
 	test("`# comment`continue",
 		backt(text("`")),
 		backt(comment("# comment")),
@@ -517,6 +541,102 @@ func (s *Suite) Test_ShTokenizer_ShAtom(c *check.C) {
 		subsh(operator("`")),
 		operator(")"))
 
+	// Command substitutions can be nested.
+	test("$$(echo $$(id))",
+		subsh(subshell),
+		subsh(text("echo")),
+		subsh(space),
+		subsh(subshell),
+		subsh(text("id")),
+		subsh(operator(")")),
+		operator(")"))
+
+	// After the command substitution, the previous quoting state continues.
+	test("\"$$(id)\"",
+		dquot(text("\"")),
+		subsh(subshell),
+		subsh(text("id")),
+		dquot(operator(")")),
+		text("\""))
+
+	test("$$(echo \"$$(id)\")",
+		subsh(subshell),
+		subsh(text("echo")),
+		subsh(space),
+		subshDquot(text("\"")),
+		subsh(subshell),
+		subsh(text("id")),
+		subshDquot(operator(")")),
+		subsh(text("\"")),
+		operator(")"))
+
+	// The parentheses of a subshell inside the command substitution
+	// don't end the command substitution.
+	test("$$( (cd dir) )",
+		subsh(subshell),
+		subsh(space),
+		subsh(operator("(")),
+		subsh(text("cd")),
+		subsh(space),
+		subsh(text("dir")),
+		subsh(operator(")")),
+		subsh(space),
+		operator(")"))
+
+	// An arithmetic expansion is a single atom.
+	test("$$((i + 1))",
+		arith("$$((i + 1))"))
+
+	test("\"$$((${N} * (2 + 1)))\"",
+		dquot(text("\"")),
+		dquot(arith("$$((${N} * (2 + 1)))")),
+		text("\""))
+
+	// The command substitutions inside an arithmetic expansion are
+	// parsed as usual, which splits the arithmetic expansion.
+	test("$$((1 + $$(sed q) * (2 + $$(wc -l)))) x",
+		arith("$$((1 + "),
+		subsh(subshell),
+		subsh(text("sed")),
+		subsh(space),
+		subsh(text("q")),
+		operator(")"),
+		arith(" * (2 + "),
+		subsh(subshell),
+		subsh(text("wc")),
+		subsh(space),
+		subsh(text("-l")),
+		operator(")"),
+		arith(")))"),
+		space,
+		text("x"))
+
+	test("\"$$(($$(sed q)))\"",
+		dquot(text("\"")),
+		dquot(arith("$$((")),
+		subsh(subshell),
+		subsh(text("sed")),
+		subsh(space),
+		subsh(text("q")),
+		dquot(operator(")")),
+		dquot(arith("))")),
+		text("\""))
+
+	// Since the parentheses don't match, this is not an arithmetic
+	// expansion but a command substitution that starts with a subshell.
+	test("$$((cd dir) && pwd)",
+		subsh(subshell),
+		subsh(operator("(")),
+		subsh(text("cd")),
+		subsh(space),
+		subsh(text("dir")),
+		subsh(operator(")")),
+		subsh(space),
+		subsh(operator("&&")),
+		subsh(space),
+		subsh(text("pwd")),
+		operator(")"))
+
 	// Subshell with unbalanced parentheses. Many shells (and pkglint)
 	// fail this test, therefore nobody should write code like this.
 	//
@@ -729,4 +849,34 @@ func (s *Suite) Test_ShTokenizer_ShToken(c *check.C) {
 
 	test("id=`${AWK} '{print}' < ${WRKSRC}/idfile`",
 		"id=`${AWK} '{print}' < ${WRKSRC}/idfile`")
+
+	test("echo \"$$(expr $$(id -u) + 1)\"",
+		"echo",
+		"\"$$(expr $$(id -u) + 1)\"")
+
+	test("i=$$((i + 1))",
+		"i=$$((i + 1))")
+
+	// The body of a here-document, including the line with the
+	// delimiter, forms a single token.
+	test("cat <<EOF\nline $$var\nEOF\necho",
+		"cat", "<<", "EOF", "\n",
+		"line $$var\nEOF\n",
+		"echo")
+
+	// Only the first newline is a separate token.
+	// The empty lines after it belong to the here-document.
+	test("cat <<-\"EOF\"\n\n\tline\n\tEOF",
+		"cat", "<<-", "\"EOF\"", "\n",
+		"\n\tline\n\tEOF")
+
+	test("cat <<A 2<<'B'\na\nA\nb\nB",
+		"cat", "<<", "A", "2<<", "'B'", "\n",
+		"a\nA\n",
+		"b\nB")
+
+	// An unterminated here-document extends to the end of the text.
+	test("cat <<EOF\nline",
+		"cat", "<<", "EOF", "\n",
+		"line")
 }
@@ -12,6 +12,7 @@ const (
 	shtOperator            // (, ;, |
 	shtComment             // # ...
 	shtSubshell            // $$(
+	shtHereDoc             // The body of a here-document
 )
 
 func (t ShAtomType) String() string {
@@ -23,6 +24,7 @@ func (t ShAtomType) String() string {
 		"operator",
 		"comment",
 		"subshell",
+		"heredoc",
 	}[t]
 }
 
@@ -45,6 +47,8 @@ type ShAtom struct {
 	//  * usually nil
 	//  * for shtExpr a *MkExpr
 	//  * for shtShExpr a string
+	//  * for shtSubshell the parsed *MkShList, if available
+	//  * for shtText, true if the text is part of an arithmetic expansion
 	data interface{}
 }
 
@@ -67,6 +71,26 @@ func (atom *ShAtom) Expr() *MkExpr {
 	return nil
 }
 
+// Subshell returns the parsed commands of a command substitution $$(...),
+// or nil if the atom does not start a command substitution or the
+// commands have not been parsed.
+//
+// The commands are parsed by the ShellLexer.
+func (atom *ShAtom) Subshell() *MkShList {
+	if atom.Type == shtSubshell {
+		list, _ := atom.data.(*MkShList)
+		return list
+	}
+	return nil
+}
+
+// IsArith returns whether the atom is part of an arithmetic expansion
+// $$((...)), excluding the command substitutions inside it.
+func (atom *ShAtom) IsArith() bool {
+	arith, _ := atom.data.(bool)
+	return atom.Type == shtText && arith
+}
+
 // ShVarname applies to shell variable atoms like $$varname or $${varname:-modifier}
 // and returns the name of the shell variable.
 func (atom *ShAtom) ShVarname() string {
@@ -144,6 +144,17 @@ const (
 	// A typical example is CATEGORIES.
 	Unique
 
+	// UsedAtLoadTime marks user-settable variables that the pkgsrc
+	// infrastructure uses at load time, such as in .if conditions,
+	// .for loops or := assignments.
+	//
+	// The other user-settable variables are only used at run time,
+	// for example in shell commands.
+	//
+	// This option is not declared in vardefs.go but is determined by
+	// scanning the pkgsrc infrastructure, see Pkgsrc.loadUntypedVars.
+	UsedAtLoadTime
+
 	NoVartypeOptions = 0
 
 	// XXX: Maybe add "AppendOnly", see MkAssignChecker.checkOpAppendOnly.
@@ -223,6 +234,7 @@ func (vt *Vartype) IsAlwaysInScope() bool       { return vt.options&AlwaysInScop
 func (vt *Vartype) IsDefinedIfInScope() bool    { return vt.options&DefinedIfInScope != 0 }
 func (vt *Vartype) IsNonemptyIfDefined() bool   { return vt.options&NonemptyIfDefined != 0 }
 func (vt *Vartype) IsUnique() bool              { return vt.options&Unique != 0 }
+func (vt *Vartype) IsUsedAtLoadTime() bool      { return vt.options&UsedAtLoadTime != 0 }
 
 func (vt *Vartype) EffectivePermissions(basename RelPath) ACLPermissions {
 	for _, aclEntry := range vt.aclEntries {
@@ -49,6 +49,16 @@ func (s *Suite) Test_Vartype_IsNonemptyIfDefined(c *check.C) {
 	test("OS_VERSION", false)
 }
 
+func (s *Suite) Test_Vartype_IsUsedAtLoadTime(c *check.C) {
+	t := s.Init(c)
+
+	t.SetUpVarType("LOAD_TIME", BtYes, UserSettable|UsedAtLoadTime)
+	t.SetUpVarType("RUN_TIME", BtYes, UserSettable)
+
+	t.CheckEquals(G.Pkgsrc.VariableType(nil, "LOAD_TIME").IsUsedAtLoadTime(), true)
+	t.CheckEquals(G.Pkgsrc.VariableType(nil, "RUN_TIME").IsUsedAtLoadTime(), false)
+}
+
 func (s *Suite) Test_Vartype_EffectivePermissions(c *check.C) {
 	t := s.Init(c)
 
@@ -116,7 +116,15 @@ func (cv *VartypeCheck) BasicRegularExpression() {
 	// same order as in the OpenGroup spec
 	allowedAfterBackslash := textproc.NewByteSet(")({}1-9.[\\*^$")
 
-	lexer := textproc.NewLexer(cv.ValueNoVar)
+	checkBasicRegularExpression(cv, cv.ValueNoVar, allowedAfterBackslash)
+}
+
+// checkBasicRegularExpression checks the escape sequences and the
+// back-references of a basic regular expression and returns the number
+// of its subexpressions.
+func checkBasicRegularExpression(diag Diagnoser, re string, allowedAfterBackslash *textproc.ByteSet) int {
+	lexer := textproc.NewLexer(re)
+	groups := 0
 
 	parseCharacterClass := func() {
 		for !lexer.EOF() {
@@ -138,14 +146,22 @@ func (cv *VartypeCheck) BasicRegularExpression() {
 		}
 
 		if !lexer.TestByteSet(allowedAfterBackslash) {
-			cv.Warnf("In a basic regular expression, a backslash followed by %q is undefined.", lexer.Rest()[:1])
-			cv.Explain(
+			diag.Warnf("In a basic regular expression, a backslash followed by %q is undefined.", lexer.Rest()[:1])
+			diag.Explain(
 				"Only the characters . [ \\ * ^ $ may be escaped using a backslash.",
 				"Except when the escaped character appears in a character class like [\\.a-z].",
 				"",
 				"To fix this, remove the backslash before the character.")
 		}
-		lexer.Skip(1)
+
+		ch := lexer.NextByte()
+		switch {
+		case ch == ')':
+			groups++
+		case ch >= '1' && ch <= '9' && int(ch-'0') > groups:
+			diag.Errorf("In a basic regular expression, the back-reference %q "+
+				"refers to a subexpression that is not defined before.", "\\"+string(ch))
+		}
 	}
 
 	for !lexer.EOF() {
@@ -160,6 +176,8 @@ func (cv *VartypeCheck) BasicRegularExpression() {
 			lexer.Skip(1)
 		}
 	}
+
+	return groups
 }
 
 func (cv *VartypeCheck) BuildlinkDepmethod() {
@@ -1225,20 +1243,8 @@ func (cv *VartypeCheck) SedCommands() {
 	checkSedCommand := func(quotedCommand string) {
 		// TODO: Remember the extended flag for the whole file, especially
 		//  for SUBST_SED.* variables.
-		if !extended {
-			command := cv.MkLine.UnquoteShell(quotedCommand, true)
-			if !hasPrefix(command, "s") {
-				return
-			}
-
-			// The :C modifier is similar enough for parsing.
-			ok, _, from, _, _ := MkExprModifier("C" + command[1:]).MatchSubst()
-			if !ok {
-				return
-			}
-
-			cv.WithValue(from).BasicRegularExpression()
-		}
+		_, gnu := G.Tool(cv.MkLines, "gsed", RunTime)
+		NewSedChecker(cv, extended, gnu).CheckWord(cv.MkLine, quotedCommand, true)
 	}
 
 	for i := 0; i < ntokens; i++ {
@@ -1,6 +1,9 @@
 package pkglint
 
-import "gopkg.in/check.v1"
+import (
+	"github.com/rillig/pkglint/v23/textproc"
+	"gopkg.in/check.v1"
+)
 
 func (s *Suite) Test_VartypeCheck_Errorf(c *check.C) {
 	t := s.Init(c)
@@ -205,6 +208,40 @@ func (s *Suite) Test_VartypeCheck_BasicRegularExpression(c *check.C) {
 		"WARN: filename.mk:52: In a basic regular expression, a backslash followed by \"/\" is undefined.")
 }
 
+func (s *Suite) Test_checkBasicRegularExpression(c *check.C) {
+	t := s.Init(c)
+
+	test := func(re string, groups int, diagnostics ...string) {
+		mkline := t.NewMkLine("filename.mk", 123, "# dummy")
+		allowedAfterBackslash := textproc.NewByteSet(")({}1-9.[\\*^$")
+
+		t.CheckEquals(checkBasicRegularExpression(mkline, re, allowedAfterBackslash), groups)
+
+		t.CheckOutput(diagnostics)
+	}
+
+	test("plain", 0,
+		nil...)
+	test("\\(a\\)\\(b\\)\\2\\1", 2,
+		nil...)
+
+	// Inside the first subexpression, it is not yet defined.
+	test("\\(a\\1\\)", 1,
+		"ERROR: filename.mk:123: In a basic regular expression, "+
+			"the back-reference \"\\\\1\" refers to a subexpression "+
+			"that is not defined before.")
+
+	// Brackets are not subexpressions.
+	test("[\\(]\\1", 0,
+		"ERROR: filename.mk:123: In a basic regular expression, "+
+			"the back-reference \"\\\\1\" refers to a subexpression "+
+			"that is not defined before.")
+
+	test("\\n", 0,
+		"WARN: filename.mk:123: In a basic regular expression, "+
+			"a backslash followed by \"n\" is undefined.")
+}
+
 func (s *Suite) Test_VartypeCheck_BuildlinkDepmethod(c *check.C) {
 	vt := NewVartypeCheckTester(s.Init(c), BtBuildlinkDepmethod)
 
@@ -601,6 +638,18 @@ func (s *Suite) Test_VartypeCheck_Enum__use_match(c *check.C) {
 		"\tlike *, ?, []. In such a case, using the :M or :N modifiers is",
 		"\tuseful and preferred.",
 		"",
+		"NOTE: module.mk:5: \"!empty(MACHINE_ARCH:Mi386) || ${MACHINE_ARCH} == i386\" "+
+			"can be simplified to \"!empty(MACHINE_ARCH:Mi386)\".",
+		"",
+		"\tThe simplified condition has the same meaning as the original one.",
+		"",
+		"\tIn a double negation, the two negations cancel each other out. A",
+		"\tnegated group of conditions is replaced with a group of negated",
+		"\tconditions, for example !(A && B) becomes !A || !B. Several",
+		"\tcomparisons of the same variable are merged into a single pattern. A",
+		"\tcondition that is implied by another condition in the same group is",
+		"\tremoved.",
+		"",
 		"ERROR: module.mk:7: Use ${PKGSRC_COMPILER:Mclang} instead of the == operator.",
 		"",
 		"\tThe PKGSRC_COMPILER can be a list of chained compilers, e.g. \"ccache",
@@ -1785,6 +1834,7 @@ func (s *Suite) Test_VartypeCheck_SedCommands(c *check.C) {
 	vt.Output(
 		"NOTE: filename.mk:1: Always use \"-e\" in sed commands, even if there is only one substitution.",
 		"WARN: filename.mk:2: Each sed command should appear in an assignment of its own.",
+		"WARN: filename.mk:2: The sed command \"a,b,c,\" only works with GNU sed.",
 		"WARN: filename.mk:3: The # character starts a makefile comment.",
 		"ERROR: filename.mk:3: Invalid shell words \"\\\"s,\" in sed commands.",
 		"WARN: filename.mk:8: Unknown sed command \"1d\".",
@@ -1793,7 +1843,8 @@ func (s *Suite) Test_VartypeCheck_SedCommands(c *check.C) {
 		"NOTE: filename.mk:10: Always use \"-e\" in sed commands, even if there is only one substitution.",
 		// XXX: duplicate warning
 		"WARN: filename.mk:11: Unclosed shell variable starting at \"$${unclosedShellVar\".",
-		"WARN: filename.mk:11: Unclosed shell variable starting at \"$${unclosedShellVar\".")
+		"WARN: filename.mk:11: Unclosed shell variable starting at \"$${unclosedShellVar\".",
+		"ERROR: filename.mk:12: Invalid sed command \"s,...\".")
 }
 
 func (s *Suite) Test_VartypeCheck_SedCommands__experimental(c *check.C) {